@@ -76,5 +76,22 @@ func main() {
 	fmt.Printf("Time Range: %.2f - %.2f seconds\n", spectrogram.TimePoints[0], spectrogram.TimePoints[len(spectrogram.TimePoints)-1])
 	fmt.Printf("Freq Range: %.2f - %.2f Hz\n", spectrogram.FreqPoints[0], spectrogram.FreqPoints[len(spectrogram.FreqPoints)-1])
 
+	// Estimate tempo and beat grid
+	fmt.Println("\nEstimating tempo...")
+	tracker := audio.NewBeatTracker()
+	beatInfo, err := tracker.Analyze(spectrogram)
+
+	// Display rhythm information (short or arrhythmic audio has no tempo)
+	fmt.Println("Rhythm Information:")
+	if err != nil {
+		fmt.Printf("Tempo:      unavailable (%v)\n", err)
+	} else {
+		fmt.Printf("Tempo:      %.1f BPM\n", beatInfo.BPM)
+		fmt.Printf("Beats:      %d\n", len(beatInfo.BeatTimes))
+		if len(beatInfo.BeatTimes) > 0 {
+			fmt.Printf("First Beat: %.2f seconds\n", beatInfo.BeatTimes[0])
+		}
+	}
+
 	fmt.Println("\nAudio processing completed successfully.")
 }
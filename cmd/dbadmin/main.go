@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/db"
+)
+
+func usage() {
+	fmt.Println("Usage: dbadmin <command> [options] <arguments>")
+	fmt.Println("Commands:")
+	fmt.Println("  info <database>                  Show the configuration and size of a database")
+	fmt.Println("  export [options] <database> <snapshot>")
+	fmt.Println("                                   Write a compacted, portable snapshot of a database")
+	fmt.Println("  import [options] <snapshot> <database>")
+	fmt.Println("                                   Merge a snapshot into a database, creating it if needed")
+	fmt.Println("  merge [options] <a> <b> <out>    Merge snapshot b into snapshot a and write the result to out")
+	fmt.Println("Databases must not be open in a running server while they are changed.")
+	fmt.Println("Run 'dbadmin <command> -h' for the options of a command.")
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	ctx := context.Background()
+	var err error
+	switch command, args := os.Args[1], os.Args[2:]; command {
+	case "info":
+		err = info(ctx, args)
+	case "export":
+		err = export(ctx, args)
+	case "import":
+		err = importSnapshot(ctx, args)
+	case "merge":
+		err = merge(ctx, args)
+	default:
+		usage()
+		os.Exit(1)
+	}
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// parseArgs parses the options of a command and checks the number of
+// arguments
+func parseArgs(flags *flag.FlagSet, args []string, usage string, count int) []string {
+	flags.Usage = func() {
+		fmt.Printf("Usage: dbadmin %s %s\n", flags.Name(), usage)
+		fmt.Println("Options:")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != count {
+		flags.Usage()
+		os.Exit(1)
+	}
+	return flags.Args()
+}
+
+// conflictPolicy adds the -on-conflict option to a command
+func conflictPolicy(flags *flag.FlagSet) *string {
+	return flags.String("on-conflict", db.ConflictFail.String(),
+		"What to do with a track ID present in both: fail, keep (the existing copy), replace or newer (by Added)")
+}
+
+func info(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("info", flag.ExitOnError)
+	path := parseArgs(flags, args, "<database>", 1)[0]
+
+	d, err := db.LoadMemoryDB(ctx, path)
+	if err != nil {
+		return err
+	}
+	tracks, err := d.List(ctx)
+	if err != nil {
+		return err
+	}
+	config := d.Config()
+
+	fmt.Printf("Database:        %s\n", path)
+	fmt.Printf("Tracks:          %d\n", len(tracks))
+	fmt.Printf("Dimension:       %d\n", config.Dim)
+	fmt.Printf("Metric:          %s\n", config.Metric)
+	fmt.Printf("M:               %d\n", config.M)
+	fmt.Printf("EfConstruction:  %d\n", config.EfConstruction)
+	fmt.Printf("EfSearch:        %d\n", config.EfSearch)
+	fmt.Printf("Garbage:         %.1f%%\n", 100*d.Garbage())
+	return nil
+}
+
+func export(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	shards := flags.Int("shards", 0, "Read a sharded database saved by ShardedDB.Save with this many shards")
+	paths := parseArgs(flags, args, "[options] <database> <snapshot>", 2)
+
+	var src db.TrackSource
+	var config db.Config
+	if *shards > 0 {
+		loaded := make([]db.VectorDB, *shards)
+		for i := range loaded {
+			shard, err := db.LoadMemoryDB(ctx, db.ShardPath(paths[0], i))
+			if err != nil {
+				return err
+			}
+			loaded[i] = shard
+			config = shard.Config()
+		}
+		sharded, err := db.NewShardedDB(loaded...)
+		if err != nil {
+			return err
+		}
+		src = sharded
+	} else {
+		d, err := db.LoadMemoryDB(ctx, paths[0])
+		if err != nil {
+			return err
+		}
+		src = d
+		config = d.Config()
+	}
+
+	if err := db.ExportSnapshot(ctx, src, config, paths[1]); err != nil {
+		return err
+	}
+	fmt.Printf("Exported %s to %s\n", paths[0], paths[1])
+	return nil
+}
+
+func importSnapshot(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	onConflict := conflictPolicy(flags)
+	paths := parseArgs(flags, args, "[options] <snapshot> <database>", 2)
+	policy, err := db.ParseConflictPolicy(*onConflict)
+	if err != nil {
+		return err
+	}
+
+	dst, err := db.LoadMemoryDB(ctx, paths[1])
+	if errors.Is(err, os.ErrNotExist) {
+		// A new database is configured like the snapshot
+		src, err := db.LoadMemoryDB(ctx, paths[0])
+		if err != nil {
+			return err
+		}
+		dst = db.NewMemoryDB(src.Config())
+	} else if err != nil {
+		return err
+	}
+
+	stats, err := db.ImportSnapshot(ctx, dst, paths[0], policy)
+	if err != nil {
+		return err
+	}
+	if _, err := dst.Compact(ctx); err != nil {
+		return err
+	}
+	if err := dst.Save(ctx, paths[1]); err != nil {
+		return err
+	}
+	printStats(stats)
+	return nil
+}
+
+func merge(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	onConflict := conflictPolicy(flags)
+	paths := parseArgs(flags, args, "[options] <a> <b> <out>", 3)
+	policy, err := db.ParseConflictPolicy(*onConflict)
+	if err != nil {
+		return err
+	}
+
+	stats, err := db.MergeSnapshots(ctx, paths[0], paths[1], paths[2], policy)
+	if err != nil {
+		return err
+	}
+	printStats(stats)
+	return nil
+}
+
+// printStats displays what a merge did
+func printStats(stats db.MergeStats) {
+	fmt.Printf("Added:    %d tracks\n", stats.Added)
+	fmt.Printf("Replaced: %d tracks\n", stats.Replaced)
+	fmt.Printf("Kept:     %d tracks\n", stats.Kept)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+func main() {
+	// Parse command-line arguments
+	targetSampleRate := flag.Int("samplerate", 44100, "Target sample rate for resampling")
+	hashMode := flag.String("hash-mode", string(fingerprint.HashPairs), "Hash mode (pairs, triplets)")
+	flag.Parse()
+
+	// Check if at least one file path was provided
+	if flag.NArg() < 1 {
+		fmt.Println("Usage: fpquality [options] <audio-file>...")
+		fmt.Println("Options:")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	utils := audio.NewAudioUtils()
+	generator := fingerprint.NewGenerator(fingerprint.DefaultConfig())
+	mode, err := fingerprint.ParseHashMode(*hashMode)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	generator.Hasher.Mode = mode
+
+	// Report on every file, remembering whether any is weak
+	lowConfidence := false
+	for _, filePath := range flag.Args() {
+		audioData, err := utils.LoadAndPreprocess(filePath, *targetSampleRate, true)
+		if err != nil {
+			fmt.Printf("Error loading %s: %v\n", filePath, err)
+			os.Exit(1)
+		}
+
+		fp, err := generator.Fingerprint(audioData, filepath.Base(filePath))
+		if err != nil {
+			fmt.Printf("Error fingerprinting %s: %v\n", filePath, err)
+			os.Exit(1)
+		}
+		printReport(filePath, fp.Quality)
+		lowConfidence = lowConfidence || fp.Quality.LowConfidence
+	}
+
+	// A non-zero exit status lets ingest scripts stop on weak references
+	if lowConfidence {
+		os.Exit(2)
+	}
+}
+
+// printReport displays a quality report
+func printReport(filePath string, report *fingerprint.QualityReport) {
+	fmt.Printf("\nFingerprint Quality: %s\n", filepath.Base(filePath))
+	fmt.Printf("Duration:          %.2f seconds\n", report.Duration)
+	fmt.Printf("Peaks per second:  %.1f\n", report.PeaksPerSecond)
+	fmt.Printf("Hashes per second: %.1f\n", report.HashesPerSecond)
+
+	fmt.Println("Band coverage:")
+	for band, coverage := range report.BandCoverage {
+		fmt.Printf("  %5.0f - %5.0f Hz: %5.1f%% %s\n", report.BandEdges[band], report.BandEdges[band+1],
+			100*coverage, strings.Repeat("#", int(coverage*20+0.5)))
+	}
+
+	fmt.Printf("Silence:           %.1f%%\n", 100*report.SilentFraction)
+	for _, region := range report.SilentRegions {
+		fmt.Printf("  %.2f - %.2f seconds\n", region.Start, region.End)
+	}
+
+	if report.LowConfidence {
+		fmt.Println("Confidence:        LOW")
+		for _, warning := range report.Warnings {
+			fmt.Printf("  - %s\n", warning)
+		}
+	} else {
+		fmt.Println("Confidence:        ok")
+	}
+}
@@ -3,24 +3,40 @@ package main
 import (
 	"flag"
 	"fmt"
+	"image"
 	"os"
 	"path/filepath"
 
 	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
 )
 
 func main() {
 	// Parse command-line arguments
 	windowSize := flag.Int("window", 1024, "Window size for FFT")
 	hopSize := flag.Int("hop", 512, "Hop size between frames")
-	windowType := flag.String("window-type", "hamming", "Window function type (hamming, hann, blackman, rectangular)")
-	logScale := flag.Bool("log", true, "Apply logarithmic scaling")
-	normalize := flag.Bool("normalize", true, "Normalize spectrogram values")
+	windowType := flag.String("window-type", "hamming", "Window function type (hamming, hann, blackman, rectangular, kaiser, blackman-harris, gaussian, flat-top)")
+	logScale := flag.Bool("log", true, "Convert power to decibels")
+	topDB := flag.Float64("top-db", 80.0, "Dynamic range kept below the loudest bin when converting to decibels")
+	normalize := flag.String("normalize", "global", "Normalization mode (none, per-frame, global, percentile)")
+	percentile := flag.Float64("percentile", 99.0, "Percentile used by the percentile normalization mode")
 	outputDir := flag.String("output", ".", "Output directory for spectrogram images")
 	targetSampleRate := flag.Int("samplerate", 44100, "Target sample rate for resampling")
 	convertToMono := flag.Bool("mono", true, "Convert audio to mono")
+	colormap := flag.String("colormap", "jet", "Colormap (jet, grayscale, viridis, magma)")
+	axes := flag.Bool("axes", false, "Draw time and frequency axes")
+	showPeaks := flag.Bool("peaks", false, "Mark fingerprint peaks")
+	showHashes := flag.Bool("hashes", false, "Draw lines between the peaks of each hash")
+	hashMode := flag.String("hash-mode", "pairs", "Hash mode for -hashes (pairs, triplets)")
+	referencePath := flag.String("reference", "", "Reference audio file; renders both spectrograms with matching hashes highlighted")
 	flag.Parse()
 
+	mode, err := fingerprint.ParseHashMode(*hashMode)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
 	// Check if a file path was provided
 	if flag.NArg() < 1 {
 		fmt.Println("Usage: spectrogram [options] <audio-file>")
@@ -62,12 +78,19 @@ func main() {
 	analyzer := audio.NewSpectralAnalyzer()
 	analyzer.WindowSize = *windowSize
 	analyzer.HopSize = *hopSize
-	analyzer.WindowType = *windowType
-	analyzer.LogScaleBase = 0.0
-	if *logScale {
-		analyzer.LogScaleBase = 10.0
+	analyzer.WindowType, err = audio.ParseWindowType(*windowType)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	analyzer.DBScale = *logScale
+	analyzer.TopDB = *topDB
+	analyzer.Normalization, err = audio.ParseNormalizationMode(*normalize)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
-	analyzer.NormalizeSpec = *normalize
+	analyzer.NormalizePercentile = *percentile
 
 	// Compute spectrogram
 	fmt.Println("\nComputing spectrogram...")
@@ -84,6 +107,20 @@ func main() {
 	fmt.Printf("Time Range: %.2f - %.2f seconds\n", spectrogram.TimePoints[0], spectrogram.TimePoints[len(spectrogram.TimePoints)-1])
 	fmt.Printf("Freq Range: %.2f - %.2f Hz\n", spectrogram.FreqPoints[0], spectrogram.FreqPoints[len(spectrogram.FreqPoints)-1])
 
+	// Configure rendering
+	renderer := audio.NewSpectrogramRenderer()
+	renderer.Colormap, err = audio.ParseColormap(*colormap)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	renderer.Axes = *axes
+
+	// Overlays show the peaks and hashes the fingerprint generator finds, on
+	// its own spectrogram, whatever the settings of the rendered one
+	generator := fingerprint.NewGenerator(fingerprint.DefaultConfig())
+	generator.Hasher.Mode = mode
+
 	// Create output directory if it doesn't exist
 	if _, err := os.Stat(*outputDir); os.IsNotExist(err) {
 		err = os.MkdirAll(*outputDir, 0755)
@@ -98,9 +135,58 @@ func main() {
 	baseFileName = baseFileName[:len(baseFileName)-len(filepath.Ext(baseFileName))]
 	outputPath := filepath.Join(*outputDir, fmt.Sprintf("%s_spectrogram.png", baseFileName))
 
+	// Comparison against a reference highlights the hashes both share
+	var img image.Image
+	if *referencePath != "" {
+		fmt.Printf("\nLoading reference file: %s\n", *referencePath)
+		referenceData, err := utils.LoadAndPreprocess(*referencePath, *targetSampleRate, *convertToMono)
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		referenceSpectrogram, err := analyzer.ComputeSpectrogram(referenceData, *windowSize, *hopSize)
+		if err != nil {
+			fmt.Printf("Error computing reference spectrogram: %v\n", err)
+			os.Exit(1)
+		}
+
+		queryPeaks, queryLandmarks := extractLandmarks(generator, audioData)
+		referencePeaks, referenceLandmarks := extractLandmarks(generator, referenceData)
+		queryOverlay, referenceOverlay := fingerprint.MatchOverlays(queryPeaks, queryLandmarks, referencePeaks, referenceLandmarks)
+		fmt.Printf("Matching hashes: %d of %d\n", len(queryOverlay.HighlightedLinks), len(queryLandmarks))
+
+		img, err = renderer.RenderComparison(spectrogram, referenceSpectrogram, queryOverlay, referenceOverlay)
+		if err != nil {
+			fmt.Printf("Error rendering comparison: %v\n", err)
+			os.Exit(1)
+		}
+		outputPath = filepath.Join(*outputDir, fmt.Sprintf("%s_comparison.png", baseFileName))
+	} else {
+		var overlay *audio.Overlay
+		if *showPeaks || *showHashes {
+			peaks, landmarks := extractLandmarks(generator, audioData)
+			fmt.Printf("Peaks: %d\n", len(peaks))
+			if !*showPeaks {
+				peaks = nil
+			}
+			if *showHashes {
+				fmt.Printf("Hashes: %d\n", len(landmarks))
+			} else {
+				landmarks = nil
+			}
+			overlay = fingerprint.NewOverlay(peaks, landmarks)
+		}
+
+		img, err = renderer.Render(spectrogram, overlay)
+		if err != nil {
+			fmt.Printf("Error rendering spectrogram: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Save spectrogram as an image
 	fmt.Printf("\nSaving spectrogram to: %s\n", outputPath)
-	err = analyzer.SaveSpectrogramImage(spectrogram, outputPath)
+	err = audio.SavePNG(img, outputPath)
 	if err != nil {
 		fmt.Printf("Error saving spectrogram image: %v\n", err)
 		os.Exit(1)
@@ -108,3 +194,27 @@ func main() {
 
 	fmt.Println("Spectrogram generation completed successfully.")
 }
+
+// extractLandmarks picks fingerprint peaks with generator and hashes them,
+// exiting on error
+func extractLandmarks(generator *fingerprint.GeneratorImpl, data *audio.AudioData) ([]fingerprint.Peak, []fingerprint.Landmark) {
+	spectrogram, err := generator.ComputeSpectrogram(data)
+	if err != nil {
+		fmt.Printf("Error computing fingerprint spectrogram: %v\n", err)
+		os.Exit(1)
+	}
+
+	peaks, err := generator.ExtractPeaks(spectrogram)
+	if err != nil {
+		fmt.Printf("Error extracting peaks: %v\n", err)
+		os.Exit(1)
+	}
+
+	landmarks, err := generator.Hasher.Landmarks(peaks)
+	if err != nil {
+		fmt.Printf("Error hashing peaks: %v\n", err)
+		os.Exit(1)
+	}
+
+	return peaks, landmarks
+}
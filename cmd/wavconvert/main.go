@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+)
+
+func main() {
+	// Parse command-line arguments
+	targetSampleRate := flag.Int("samplerate", 44100, "Target sample rate for resampling")
+	sampleFormat := flag.String("format", "pcm16", "Output sample format (pcm16, pcm24, float32)")
+	outputPath := flag.String("output", "", "Output WAV file (default: <input>_mono.wav next to the input)")
+	flag.Parse()
+
+	// Check if a file path was provided
+	if flag.NArg() < 1 {
+		fmt.Println("Usage: wavconvert [options] <audio-file>")
+		fmt.Println("Options:")
+		flag.PrintDefaults()
+		os.Exit(1)
+	}
+
+	// Get the file path
+	filePath := flag.Arg(0)
+
+	// Check if the file exists
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		fmt.Printf("Error: File '%s' does not exist\n", filePath)
+		os.Exit(1)
+	}
+
+	// Validate the output format
+	format, err := audio.ParseWAVSampleFormat(*sampleFormat)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Generate output file path
+	if *outputPath == "" {
+		base := filePath[:len(filePath)-len(filepath.Ext(filePath))]
+		*outputPath = base + "_mono.wav"
+	}
+
+	// Create an audio utils instance
+	utils := audio.NewAudioUtils()
+
+	// Load, downmix, resample and normalize the audio file
+	fmt.Printf("Loading audio file: %s\n", filePath)
+	audioData, err := utils.LoadAndPreprocess(filePath, *targetSampleRate, true)
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Write the converted audio
+	fmt.Printf("Writing %s WAV to: %s\n", format, *outputPath)
+	err = utils.SaveWAV(*outputPath, audioData, format)
+	if err != nil {
+		fmt.Printf("Error saving WAV file: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Println("\nOutput Information:")
+	fmt.Printf("Channels:    %d\n", audioData.Channels)
+	fmt.Printf("Sample Rate: %d Hz\n", audioData.SampleRate)
+	fmt.Printf("Duration:    %.2f seconds\n", audioData.Duration)
+	fmt.Printf("Samples:     %d\n", len(audioData.Samples))
+
+	fmt.Println("\nConversion completed successfully.")
+}
@@ -0,0 +1,205 @@
+// Package bincodec reads and writes the varint and little-endian values of the
+// fingerprint and database file formats. Decoders check every length against
+// the remaining data, so corrupted or crafted input fails instead of
+// allocating or reading out of range.
+package bincodec
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Encoder appends binary values to a buffer
+type Encoder struct {
+	buf     bytes.Buffer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+// Bytes returns the encoded data
+func (e *Encoder) Bytes() []byte {
+	return e.buf.Bytes()
+}
+
+// Len returns the number of encoded bytes
+func (e *Encoder) Len() int {
+	return e.buf.Len()
+}
+
+// Write appends raw bytes
+func (e *Encoder) Write(p []byte) {
+	e.buf.Write(p)
+}
+
+// Byte appends a single byte
+func (e *Encoder) Byte(v byte) {
+	e.buf.WriteByte(v)
+}
+
+// Uvarint appends an unsigned varint
+func (e *Encoder) Uvarint(v uint64) {
+	e.buf.Write(e.scratch[:binary.PutUvarint(e.scratch[:], v)])
+}
+
+// Varint appends a signed varint
+func (e *Encoder) Varint(v int64) {
+	e.buf.Write(e.scratch[:binary.PutVarint(e.scratch[:], v)])
+}
+
+// Uint32 appends a little-endian uint32
+func (e *Encoder) Uint32(v uint32) {
+	binary.LittleEndian.PutUint32(e.scratch[:4], v)
+	e.buf.Write(e.scratch[:4])
+}
+
+// Uint64 appends a little-endian uint64
+func (e *Encoder) Uint64(v uint64) {
+	binary.LittleEndian.PutUint64(e.scratch[:8], v)
+	e.buf.Write(e.scratch[:8])
+}
+
+// Float64 appends the IEEE 754 bits of v as a uint64
+func (e *Encoder) Float64(v float64) {
+	e.Uint64(math.Float64bits(v))
+}
+
+// Text appends a length-prefixed string
+func (e *Encoder) Text(s string) {
+	e.Uvarint(uint64(len(s)))
+	e.buf.WriteString(s)
+}
+
+// Decoder consumes binary values from a byte slice. The first error sticks
+// and makes every later read return zero.
+type Decoder struct {
+	data []byte
+	err  error
+}
+
+// NewDecoder creates a decoder reading data
+func NewDecoder(data []byte) *Decoder {
+	return &Decoder{data: data}
+}
+
+// Err returns the first decoding error
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+// Len returns the number of bytes left to read
+func (d *Decoder) Len() int {
+	return len(d.data)
+}
+
+// Fail records io.ErrUnexpectedEOF unless an error is already recorded. It
+// lets callers reject sizes that the remaining data cannot hold.
+func (d *Decoder) Fail() {
+	if d.err == nil {
+		d.err = io.ErrUnexpectedEOF
+	}
+}
+
+// Uvarint reads an unsigned varint
+func (d *Decoder) Uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// Varint reads a signed varint
+func (d *Decoder) Varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	d.data = d.data[n:]
+	return v
+}
+
+// Bytes reads n raw bytes without copying them
+func (d *Decoder) Bytes(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if n < 0 || n > len(d.data) {
+		d.err = io.ErrUnexpectedEOF
+		return nil
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+// Byte reads a single byte
+func (d *Decoder) Byte() byte {
+	if b := d.Bytes(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+// Uint32 reads a little-endian uint32
+func (d *Decoder) Uint32() uint32 {
+	if b := d.Bytes(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+// Uint64 reads a little-endian uint64
+func (d *Decoder) Uint64() uint64 {
+	if b := d.Bytes(8); b != nil {
+		return binary.LittleEndian.Uint64(b)
+	}
+	return 0
+}
+
+// Float64 reads a float64 written by Encoder.Float64
+func (d *Decoder) Float64() float64 {
+	return math.Float64frombits(d.Uint64())
+}
+
+// Text reads a length-prefixed string
+func (d *Decoder) Text() string {
+	n := d.Uvarint()
+	if n > uint64(len(d.data)) {
+		d.Fail()
+		return ""
+	}
+	return string(d.Bytes(int(n)))
+}
+
+// Count reads an element count and rejects counts that cannot fit in the
+// remaining data given the minimum encoded size of an element
+func (d *Decoder) Count(minSize int) int {
+	n := d.Uvarint()
+	if d.err == nil && n > uint64(len(d.data)/minSize) {
+		d.err = io.ErrUnexpectedEOF
+		return 0
+	}
+	return int(n)
+}
+
+// Done reports a decoding error or leftover bytes
+func (d *Decoder) Done() error {
+	if d.err != nil {
+		return d.err
+	}
+	if len(d.data) != 0 {
+		return fmt.Errorf("%d trailing bytes", len(d.data))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package bincodec
+
+import (
+	"errors"
+	"io"
+	"math"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	e := &Encoder{}
+	e.Byte(7)
+	e.Uvarint(300)
+	e.Varint(-5)
+	e.Uint32(math.MaxUint32)
+	e.Uint64(1 << 40)
+	e.Float64(-1.5)
+	e.Text("track-1")
+	e.Write([]byte{1, 2})
+
+	d := NewDecoder(e.Bytes())
+	if b, u, v := d.Byte(), d.Uvarint(), d.Varint(); b != 7 || u != 300 || v != -5 {
+		t.Errorf("Expected 7, 300, -5, got %d, %d, %d", b, u, v)
+	}
+	if u32, u64, f := d.Uint32(), d.Uint64(), d.Float64(); u32 != math.MaxUint32 || u64 != 1<<40 || f != -1.5 {
+		t.Errorf("Expected %d, %d, -1.5, got %d, %d, %f", uint32(math.MaxUint32), uint64(1<<40), u32, u64, f)
+	}
+	if s := d.Text(); s != "track-1" {
+		t.Errorf("Expected track-1, got %q", s)
+	}
+	if err := d.Done(); err == nil {
+		t.Error("Expected trailing bytes to be reported")
+	}
+	if b := d.Bytes(2); len(b) != 2 || b[1] != 2 {
+		t.Errorf("Expected the raw bytes, got %v", b)
+	}
+	if err := d.Done(); err != nil {
+		t.Errorf("Expected no error, got %v", err)
+	}
+}
+
+func TestDecoderBounds(t *testing.T) {
+	// Lengths and counts beyond the remaining data fail and the error sticks
+	e := &Encoder{}
+	e.Uvarint(1000)
+	e.Write([]byte("short"))
+	if d := NewDecoder(e.Bytes()); d.Text() != "" || !errors.Is(d.Err(), io.ErrUnexpectedEOF) || d.Uvarint() != 0 {
+		t.Errorf("Expected an oversized string to fail, got %v", d.Err())
+	}
+	if d := NewDecoder(e.Bytes()); d.Count(4) != 0 || !errors.Is(d.Done(), io.ErrUnexpectedEOF) {
+		t.Errorf("Expected an oversized count to fail, got %v", d.Err())
+	}
+
+	e = &Encoder{}
+	e.Uvarint(2)
+	e.Uint64(0)
+	if d := NewDecoder(e.Bytes()); d.Count(4) != 2 || d.Err() != nil {
+		t.Errorf("Expected a count that fits to succeed, got %v", d.Err())
+	}
+
+	d := NewDecoder([]byte{1, 2, 3})
+	if d.Uint32() != 0 || d.Bytes(-1) != nil || !errors.Is(d.Err(), io.ErrUnexpectedEOF) {
+		t.Errorf("Expected a truncated read to fail, got %v", d.Err())
+	}
+	d = NewDecoder([]byte{0x80})
+	if d.Varint() != 0 || d.Err() == nil {
+		t.Error("Expected an unterminated varint to fail")
+	}
+}
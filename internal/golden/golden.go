@@ -0,0 +1,52 @@
+// Package golden compares test output with golden files in testdata. Run the
+// tests with -update to rewrite the files, then review their diff.
+package golden
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+// Check compares got with testdata/name, rewriting it with -update. Only the
+// first differing line is reported since golden files can be long.
+func Check(t testing.TB, name, got string) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.MkdirAll("testdata", 0o755); err != nil {
+			t.Fatalf("Failed to create testdata: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got+"\n"), 0o644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file: %v", err)
+	}
+	if strings.TrimSpace(string(want)) == got {
+		return
+	}
+
+	gotLines := strings.Split(got, "\n")
+	wantLines := strings.Split(strings.TrimSpace(string(want)), "\n")
+	for i := 0; i < max(len(gotLines), len(wantLines)); i++ {
+		var gotLine, wantLine string
+		if i < len(gotLines) {
+			gotLine = gotLines[i]
+		}
+		if i < len(wantLines) {
+			wantLine = wantLines[i]
+		}
+		if gotLine != wantLine {
+			t.Errorf("Output differs from %s at line %d (%d lines, want %d):\ngot:  %s\nwant: %s",
+				path, i+1, len(gotLines), len(wantLines), gotLine, wantLine)
+			return
+		}
+	}
+}
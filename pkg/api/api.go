@@ -2,6 +2,7 @@ package api
 
 import (
 	"github.com/kshitijk4poor/shazam-golang/pkg/db"
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
 	"github.com/kshitijk4poor/shazam-golang/pkg/matcher"
 )
 
@@ -11,6 +12,15 @@ type IdentifyRequest struct {
 	Format    string `json:"format"` // Audio format (wav, mp3, etc)
 }
 
+// IdentifyFingerprintRequest represents an identification request carrying a
+// fingerprint computed by the client instead of audio. Fingerprint holds the
+// serialized form produced by GeneratorImpl.MarshalFingerprint (base64 in
+// JSON). IdentifyFingerprintHandler rejects fingerprints generated with a
+// different configuration or analysis sample rate than the server's.
+type IdentifyFingerprintRequest struct {
+	Fingerprint []byte `json:"fingerprint"`
+}
+
 // IdentifyResponse represents the response to an identification request
 type IdentifyResponse struct {
 	Matches []matcher.Match `json:"matches"`
@@ -26,14 +36,17 @@ type AddTrackRequest struct {
 
 // AddTrackResponse represents the response to an add track request
 type AddTrackResponse struct {
-	TrackID string `json:"track_id,omitempty"`
-	Error   string `json:"error,omitempty"`
+	TrackID string                     `json:"track_id,omitempty"`
+	Quality *fingerprint.QualityReport `json:"quality,omitempty"` // Flags references likely to match poorly
+	Error   string                     `json:"error,omitempty"`
 }
 
-// ListTracksResponse represents the response to a list tracks request
+// ListTracksResponse represents the response to a list tracks request.
+// NextCursor, if set, is passed as the cursor parameter to get the next page.
 type ListTracksResponse struct {
-	Tracks []db.TrackMetadata `json:"tracks"`
-	Error  string             `json:"error,omitempty"`
+	Tracks     []db.TrackMetadata `json:"tracks"`
+	NextCursor string             `json:"next_cursor,omitempty"`
+	Error      string             `json:"error,omitempty"`
 }
 
 // Config holds API service configuration
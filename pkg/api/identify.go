@@ -0,0 +1,66 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+	"github.com/kshitijk4poor/shazam-golang/pkg/matcher"
+)
+
+// defaultMaxRequestSize limits request bodies when Config.MaxRequestSize is
+// not set. It leaves ample room for the fingerprint of a query clip of
+// several minutes.
+const defaultMaxRequestSize = 1 << 20
+
+// IdentifyFingerprintHandler serves POST /identify/fingerprint from engine,
+// answering an IdentifyFingerprintRequest with an IdentifyResponse. The
+// fingerprint is decoded with engine.Generator, so fingerprints of another
+// configuration or analysis sample rate are answered with 422. Bodies larger
+// than config.MaxRequestSize, 1 MiB if unset, are answered with 413.
+func IdentifyFingerprintHandler(engine *matcher.EngineImpl, config Config) http.Handler {
+	maxRequestSize := config.MaxRequestSize
+	if maxRequestSize <= 0 {
+		maxRequestSize = defaultMaxRequestSize
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeJSON(w, http.StatusMethodNotAllowed, IdentifyResponse{Error: "method not allowed"})
+			return
+		}
+
+		var request IdentifyFingerprintRequest
+		body := http.MaxBytesReader(w, r.Body, maxRequestSize)
+		if err := json.NewDecoder(body).Decode(&request); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSON(w, http.StatusRequestEntityTooLarge, IdentifyResponse{Error: err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusBadRequest, IdentifyResponse{Error: "invalid request: " + err.Error()})
+			return
+		}
+		fp, err := engine.Generator.UnmarshalFingerprint(request.Fingerprint)
+		if errors.Is(err, fingerprint.ErrConfigMismatch) || errors.Is(err, fingerprint.ErrUnsupportedVersion) {
+			writeJSON(w, http.StatusUnprocessableEntity, IdentifyResponse{Error: err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, IdentifyResponse{Error: err.Error()})
+			return
+		}
+
+		matches, err := engine.IdentifyFingerprint(r.Context(), fp)
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, IdentifyResponse{Error: err.Error()})
+			return
+		}
+		if matches == nil {
+			matches = []matcher.Match{}
+		}
+		writeJSON(w, http.StatusOK, IdentifyResponse{Matches: matches})
+	})
+}
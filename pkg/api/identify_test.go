@@ -0,0 +1,95 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+	"github.com/kshitijk4poor/shazam-golang/pkg/db"
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+	"github.com/kshitijk4poor/shazam-golang/pkg/matcher"
+)
+
+func TestIdentifyFingerprintHandler(t *testing.T) {
+	track, err := audio.NewSynthesizer(22050, 1).Chords(8, 0.5, []float64{196, 247, 294, 330}, 0.6)
+	if err != nil {
+		t.Fatalf("Failed to synthesize track: %v", err)
+	}
+	memory := db.NewMemoryDB(db.DefaultConfig())
+	engine := matcher.NewEngine(matcher.DefaultConfig(), fingerprint.NewGenerator(fingerprint.DefaultConfig()), memory, memory)
+	if err := engine.AddTrack(context.Background(), track, &db.TrackMetadata{ID: "track-1"}); err != nil {
+		t.Fatalf("Failed to add track: %v", err)
+	}
+	config := Config{MaxRequestSize: 64 << 10}
+	handler := IdentifyFingerprintHandler(engine, config)
+
+	// marshal fingerprints an excerpt of the track with generator
+	marshal := func(generator *fingerprint.GeneratorImpl) []byte {
+		query, err := audio.Excerpt(track, 2, 6)
+		if err != nil {
+			t.Fatalf("Failed to cut excerpt: %v", err)
+		}
+		fp, err := generator.Fingerprint(query, "")
+		if err != nil {
+			t.Fatalf("Failed to fingerprint query: %v", err)
+		}
+		encoded, err := generator.MarshalFingerprint(fp, query.SampleRate)
+		if err != nil {
+			t.Fatalf("Failed to marshal: %v", err)
+		}
+		return encoded
+	}
+	post := func(body []byte) (int, IdentifyResponse) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/identify/fingerprint", bytes.NewReader(body)))
+		var response IdentifyResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return recorder.Code, response
+	}
+	request := func(encoded []byte) []byte {
+		body, err := json.Marshal(IdentifyFingerprintRequest{Fingerprint: encoded})
+		if err != nil {
+			t.Fatalf("Failed to encode request: %v", err)
+		}
+		return body
+	}
+
+	status, response := post(request(marshal(engine.Generator)))
+	if status != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", status, response.Error)
+	}
+	if len(response.Matches) == 0 || response.Matches[0].TrackID != "track-1" {
+		t.Errorf("Expected track-1, got %+v", response.Matches)
+	}
+
+	// A fingerprint of another configuration is rejected
+	other := fingerprint.NewGenerator(fingerprint.DefaultConfig())
+	other.Hasher.Mode = fingerprint.HashTriplets
+	if status, response := post(request(marshal(other))); status != http.StatusUnprocessableEntity || response.Error == "" {
+		t.Errorf("Expected 422 for another configuration, got %d", status)
+	}
+
+	for _, body := range [][]byte{[]byte("{"), request([]byte("SGFP"))} {
+		if status, response := post(body); status != http.StatusBadRequest || response.Error == "" {
+			t.Errorf("%q: expected 400 with an error, got %d", body, status)
+		}
+	}
+
+	// Bodies beyond the configured limit are not read to the end
+	huge := request(make([]byte, config.MaxRequestSize))
+	if status, response := post(huge); status != http.StatusRequestEntityTooLarge || response.Error == "" {
+		t.Errorf("Expected 413 for a %d byte body, got %d", len(huge), status)
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/identify/fingerprint", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for GET, got %d", recorder.Code)
+	}
+}
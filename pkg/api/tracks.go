@@ -0,0 +1,111 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/db"
+)
+
+const (
+	// DefaultPageSize is the number of tracks per page when a list tracks
+	// request sets no limit
+	DefaultPageSize = 100
+
+	// MaxPageSize is the largest limit a list tracks request may set
+	MaxPageSize = 1000
+)
+
+// ParseListTracksQuery converts the query parameters of GET /tracks into
+// list options:
+//
+//	artist, title:              case-insensitive substrings to match
+//	added_after, added_before:  Unix timestamps bounding Added, the first
+//	                            inclusive and the second exclusive
+//	sort:                       id (default), title, artist or added
+//	order:                      asc (default) or desc
+//	limit:                      tracks per page, up to MaxPageSize
+//	cursor:                     next_cursor of the previous page
+func ParseListTracksQuery(query url.Values) (db.ListOptions, error) {
+	opts := db.ListOptions{
+		Artist: query.Get("artist"),
+		Title:  query.Get("title"),
+		Cursor: query.Get("cursor"),
+		Limit:  DefaultPageSize,
+	}
+
+	var err error
+	for name, bound := range map[string]*int64{"added_after": &opts.AddedAfter, "added_before": &opts.AddedBefore} {
+		if value := query.Get(name); value != "" {
+			if *bound, err = strconv.ParseInt(value, 10, 64); err != nil {
+				return opts, fmt.Errorf("invalid %s %q", name, value)
+			}
+		}
+	}
+	if value := query.Get("sort"); value != "" {
+		if opts.Sort, err = db.ParseSortOrder(value); err != nil {
+			return opts, err
+		}
+	}
+	switch order := query.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		opts.Descending = true
+	default:
+		return opts, fmt.Errorf("invalid order %q", order)
+	}
+	if value := query.Get("limit"); value != "" {
+		opts.Limit, err = strconv.Atoi(value)
+		if err != nil || opts.Limit < 1 || opts.Limit > MaxPageSize {
+			return opts, fmt.Errorf("limit must be between 1 and %d", MaxPageSize)
+		}
+	}
+	return opts, nil
+}
+
+// ListTracksHandler serves GET /tracks from tracks, answering with a
+// ListTracksResponse
+func ListTracksHandler(tracks db.TrackQuerier) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			writeJSON(w, http.StatusMethodNotAllowed, ListTracksResponse{Error: "method not allowed"})
+			return
+		}
+
+		opts, err := ParseListTracksQuery(r.URL.Query())
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, ListTracksResponse{Error: err.Error()})
+			return
+		}
+		page, err := tracks.Query(r.Context(), opts)
+		if errors.Is(err, db.ErrInvalidCursor) {
+			writeJSON(w, http.StatusBadRequest, ListTracksResponse{Error: err.Error()})
+			return
+		}
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, ListTracksResponse{Error: err.Error()})
+			return
+		}
+
+		response := ListTracksResponse{
+			Tracks:     make([]db.TrackMetadata, len(page.Tracks)),
+			NextCursor: page.NextCursor,
+		}
+		for i, metadata := range page.Tracks {
+			response.Tracks[i] = *metadata
+		}
+		writeJSON(w, http.StatusOK, response)
+	})
+}
+
+// writeJSON writes a JSON response with the given status
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
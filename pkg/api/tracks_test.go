@@ -0,0 +1,81 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/db"
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+func TestListTracksHandler(t *testing.T) {
+	config := db.DefaultConfig()
+	config.Dim = 2
+	d := db.NewMemoryDB(config)
+	for i := 0; i < 25; i++ {
+		metadata := &db.TrackMetadata{ID: fmt.Sprintf("track-%02d", i), Artist: []string{"Nina Simone", "Björk"}[i%2], Added: int64(i)}
+		if err := d.Add(context.Background(), metadata, []*fingerprint.Vector{{Data: []float32{1, float32(i)}}}); err != nil {
+			t.Fatalf("Failed to add: %v", err)
+		}
+	}
+	handler := ListTracksHandler(d)
+
+	get := func(query url.Values) (int, ListTracksResponse) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/tracks?"+query.Encode(), nil))
+		var response ListTracksResponse
+		if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return recorder.Code, response
+	}
+
+	// Björk's tracks added from 5 on, newest first, in pages of 4
+	query := url.Values{"artist": {"BJÖRK"}, "added_after": {"5"}, "sort": {"added"}, "order": {"desc"}, "limit": {"4"}}
+	var ids []string
+	for {
+		status, response := get(query)
+		if status != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", status, response.Error)
+		}
+		for _, metadata := range response.Tracks {
+			ids = append(ids, metadata.ID)
+		}
+		if response.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", response.NextCursor)
+	}
+	want := []string{"track-23", "track-21", "track-19", "track-17", "track-15", "track-13", "track-11", "track-09", "track-07", "track-05"}
+	if fmt.Sprint(ids) != fmt.Sprint(want) {
+		t.Errorf("Expected %v, got %v", want, ids)
+	}
+
+	if _, response := get(url.Values{}); len(response.Tracks) != 25 || response.NextCursor != "" {
+		t.Errorf("Expected all 25 tracks in the default page, got %d", len(response.Tracks))
+	}
+
+	for _, query := range []url.Values{
+		{"limit": {"0"}},
+		{"limit": {"5000"}},
+		{"sort": {"duration"}},
+		{"order": {"sideways"}},
+		{"added_before": {"yesterday"}},
+		{"cursor": {"garbage"}},
+	} {
+		if status, response := get(query); status != http.StatusBadRequest || response.Error == "" {
+			t.Errorf("%v: expected 400 with an error, got %d", query, status)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/tracks", nil))
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected 405 for POST, got %d", recorder.Code)
+	}
+}
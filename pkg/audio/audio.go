@@ -2,7 +2,9 @@ package audio
 
 import (
 	"context"
+	"fmt"
 	"io"
+	"math/cmplx"
 )
 
 type AudioFormat string
@@ -27,6 +29,12 @@ type Loader interface {
 	Load(ctx context.Context, reader io.Reader, format AudioFormat) (*AudioData, error)
 }
 
+// Encoder handles encoding PCM samples into an audio file
+type Encoder interface {
+	// Encode writes audio data to the writer in the encoder's format
+	Encode(ctx context.Context, writer io.Writer, data *AudioData) error
+}
+
 // Processor handles audio signal processing operations
 type Processor interface {
 	// Normalize adjusts audio amplitude to a standard level
@@ -48,6 +56,62 @@ type Spectrogram struct {
 	FreqPoints []float64   // Frequency points for each row
 }
 
+// ComplexSpectrogram represents a complex-valued short-time Fourier transform.
+// Unlike Spectrogram it keeps the phase of every bin, so it can be inverted
+// back to audio with InverseSTFT.
+type ComplexSpectrogram struct {
+	Data       [][]complex128 // Complex spectrum over time (bins 0..WindowSize/2)
+	FreqBins   int            // Number of frequency bins
+	TimeBins   int            // Number of time bins
+	TimePoints []float64      // Time points for each column
+	FreqPoints []float64      // Frequency points for each row
+	WindowSize int            // Window size used for analysis
+	HopSize    int            // Hop size used for analysis
+	SampleRate int            // Sample rate of the analysed audio
+	WindowType WindowType     // Window applied during analysis
+}
+
+// Magnitude returns the magnitude of every bin
+func (c *ComplexSpectrogram) Magnitude() [][]float64 {
+	magnitude := make([][]float64, len(c.Data))
+	for t, frame := range c.Data {
+		magnitude[t] = make([]float64, len(frame))
+		for f, val := range frame {
+			magnitude[t][f] = cmplx.Abs(val)
+		}
+	}
+	return magnitude
+}
+
+// Phase returns the phase (in radians) of every bin
+func (c *ComplexSpectrogram) Phase() [][]float64 {
+	phase := make([][]float64, len(c.Data))
+	for t, frame := range c.Data {
+		phase[t] = make([]float64, len(frame))
+		for f, val := range frame {
+			phase[t][f] = cmplx.Phase(val)
+		}
+	}
+	return phase
+}
+
+// ApplyMask multiplies every bin by the matching mask value, leaving the
+// phase untouched. The mask must have the same shape as Data.
+func (c *ComplexSpectrogram) ApplyMask(mask [][]float64) error {
+	if len(mask) != len(c.Data) {
+		return fmt.Errorf("mask has %d time bins, expected %d", len(mask), len(c.Data))
+	}
+	for t, frame := range c.Data {
+		if len(mask[t]) != len(frame) {
+			return fmt.Errorf("mask frame %d has %d bins, expected %d", t, len(mask[t]), len(frame))
+		}
+		for f := range frame {
+			frame[f] *= complex(mask[t][f], 0)
+		}
+	}
+	return nil
+}
+
 // SpectralAnalyzer handles conversion of audio to spectral domain
 type SpectralAnalyzer interface {
 	// ComputeSpectrogram converts audio data to spectrogram
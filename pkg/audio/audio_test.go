@@ -237,3 +237,104 @@ func TestAudioUtils(t *testing.T) {
 		t.Errorf("FLAC loader not found")
 	}
 }
+
+func TestWAVEncoder(t *testing.T) {
+	// Create test audio data
+	audioData := &AudioData{
+		Samples:    make([]float64, 4410*2),
+		SampleRate: 44100,
+		Channels:   2,
+		Duration:   0.1,
+	}
+	for i := 0; i < 4410; i++ {
+		t := float64(i) / 44100.0
+		audioData.Samples[i*2] = 0.5 * math.Sin(2*math.Pi*440*t)
+		audioData.Samples[i*2+1] = -0.5 * math.Sin(2*math.Pi*440*t)
+	}
+
+	ctx := context.Background()
+
+	// Every format round-trips through the WAV loader
+	tolerances := map[WAVSampleFormat]float64{PCM16: 1e-4, PCM24: 1e-6, Float32: 1e-7}
+	for format, tolerance := range tolerances {
+		encoder := NewWAVEncoder()
+		encoder.SampleFormat = format
+
+		buf := bytes.NewBuffer(nil)
+		if err := encoder.Encode(ctx, buf, audioData); err != nil {
+			t.Fatalf("Failed to encode %s WAV data: %v", format, err)
+		}
+
+		decoded, err := NewWAVLoader().Load(ctx, bytes.NewReader(buf.Bytes()), WAV)
+		if err != nil {
+			t.Fatalf("Failed to load encoded %s WAV data: %v", format, err)
+		}
+		if decoded.SampleRate != audioData.SampleRate {
+			t.Errorf("%s: expected sample rate %d, got %d", format, audioData.SampleRate, decoded.SampleRate)
+		}
+		if decoded.Channels != audioData.Channels {
+			t.Errorf("%s: expected %d channels, got %d", format, audioData.Channels, decoded.Channels)
+		}
+		if len(decoded.Samples) != len(audioData.Samples) {
+			t.Fatalf("%s: expected %d samples, got %d", format, len(audioData.Samples), len(decoded.Samples))
+		}
+		for i, sample := range decoded.Samples {
+			if math.Abs(sample-audioData.Samples[i]) > tolerance {
+				t.Fatalf("%s: sample %d mismatch: expected %f, got %f", format, i, audioData.Samples[i], sample)
+			}
+		}
+	}
+
+	// Float files carry format tag 3 and the raw float32 values
+	encoder := NewWAVEncoder()
+	encoder.SampleFormat = Float32
+	buf := bytes.NewBuffer(nil)
+	if err := encoder.Encode(ctx, buf, audioData); err != nil {
+		t.Fatalf("Failed to encode float WAV data: %v", err)
+	}
+	data := buf.Bytes()
+	if tag := binary.LittleEndian.Uint16(data[20:22]); tag != 3 {
+		t.Errorf("Expected float format tag 3, got %d", tag)
+	}
+	if bits := binary.LittleEndian.Uint16(data[34:36]); bits != 32 {
+		t.Errorf("Expected 32 bits per sample, got %d", bits)
+	}
+	if riffSize := binary.LittleEndian.Uint32(data[4:8]); int(riffSize) != len(data)-8 {
+		t.Errorf("Expected RIFF size %d, got %d", len(data)-8, riffSize)
+	}
+	samplesStart := len(data) - len(audioData.Samples)*4
+	first := math.Float32frombits(binary.LittleEndian.Uint32(data[samplesStart+4 : samplesStart+8]))
+	if math.Abs(float64(first)-audioData.Samples[1]) > 1e-7 {
+		t.Errorf("Expected float sample %f, got %f", audioData.Samples[1], first)
+	}
+
+	// An odd-sized data chunk is padded to a word boundary
+	odd := &AudioData{Samples: []float64{0.25, -0.5, 0.75}, SampleRate: 8000, Channels: 1}
+	encoder.SampleFormat = PCM24
+	buf.Reset()
+	if err := encoder.Encode(ctx, buf, odd); err != nil {
+		t.Fatalf("Failed to encode odd-sized WAV data: %v", err)
+	}
+	data = buf.Bytes()
+	if len(data)%2 != 0 {
+		t.Errorf("Expected a padded file, got %d bytes", len(data))
+	}
+	if riffSize := binary.LittleEndian.Uint32(data[4:8]); int(riffSize) != len(data)-8 {
+		t.Errorf("Expected RIFF size %d, got %d", len(data)-8, riffSize)
+	}
+	if dataSize := binary.LittleEndian.Uint32(data[40:44]); dataSize != 9 {
+		t.Errorf("Expected data size 9 without the pad byte, got %d", dataSize)
+	}
+	decoded, err := NewWAVLoader().Load(ctx, bytes.NewReader(data), WAV)
+	if err != nil {
+		t.Fatalf("Failed to load padded WAV data: %v", err)
+	}
+	if len(decoded.Samples) != len(odd.Samples) {
+		t.Errorf("Expected %d samples, got %d", len(odd.Samples), len(decoded.Samples))
+	}
+
+	// Unknown formats are rejected
+	if _, err := ParseWAVSampleFormat("pcm8"); err == nil {
+		t.Errorf("Expected error for unsupported sample format")
+	}
+}
@@ -0,0 +1,265 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"math/rand"
+
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// DefaultGriffinLimIterations is the number of Griffin-Lim iterations used
+// when the caller does not specify one
+const DefaultGriffinLimIterations = 32
+
+// ComputeSTFT converts audio data to a complex-valued STFT, keeping the phase
+// of every bin so the result can be inverted with InverseSTFT
+func (s *SpectralAnalyzerImpl) ComputeSTFT(data *AudioData, windowSize, hopSize int) (*ComplexSpectrogram, error) {
+	// Update window and hop size if provided
+	if windowSize > 0 {
+		s.WindowSize = windowSize
+	}
+	if hopSize > 0 {
+		s.HopSize = hopSize
+	}
+
+	// Ensure audio is mono
+	if data.Channels != 1 {
+		return nil, fmt.Errorf("STFT computation requires mono audio, got %d channels", data.Channels)
+	}
+
+	if err := s.validateFrameSizes(); err != nil {
+		return nil, err
+	}
+
+	// Set sample rate from audio data
+	s.SampleRate = data.SampleRate
+
+	// Segment audio into frames
+	processor := NewPCMProcessor()
+	processor.FrameSize = s.WindowSize
+	processor.HopSize = s.HopSize
+	frames, err := processor.SegmentIntoFrames(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to segment audio into frames: %w", err)
+	}
+
+	// Compute the half spectrum of each windowed frame
+	numFrames := len(frames)
+	numBins := s.WindowSize/2 + 1
+	stftData := make([][]complex128, numFrames)
+	for i, frame := range frames {
+		windowedFrame, err := s.ApplyWindow(frame)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply window: %w", err)
+		}
+		fftResult := s.ComputeFFT(windowedFrame)
+		stftData[i] = append([]complex128(nil), fftResult[:numBins]...)
+	}
+
+	// Calculate time and frequency points
+	timePoints := make([]float64, numFrames)
+	for i := 0; i < numFrames; i++ {
+		timePoints[i] = float64(i*s.HopSize) / float64(s.SampleRate)
+	}
+
+	freqPoints := make([]float64, numBins)
+	for i := 0; i < numBins; i++ {
+		freqPoints[i] = float64(i) * float64(s.SampleRate) / float64(s.WindowSize)
+	}
+
+	return &ComplexSpectrogram{
+		Data:       stftData,
+		FreqBins:   numBins,
+		TimeBins:   numFrames,
+		TimePoints: timePoints,
+		FreqPoints: freqPoints,
+		WindowSize: s.WindowSize,
+		HopSize:    s.HopSize,
+		SampleRate: s.SampleRate,
+		WindowType: s.WindowType,
+	}, nil
+}
+
+// InverseSTFT reconstructs audio from a complex STFT using weighted
+// overlap-add. The synthesis window is the STFT's analysis window; only its
+// Kaiser beta or Gaussian sigma come from the analyzer, which is not modified.
+func (s *SpectralAnalyzerImpl) InverseSTFT(stft *ComplexSpectrogram) (*AudioData, error) {
+	if stft == nil || len(stft.Data) == 0 {
+		return nil, fmt.Errorf("invalid STFT data")
+	}
+	if stft.WindowSize <= 0 || stft.HopSize <= 0 || stft.SampleRate <= 0 {
+		return nil, fmt.Errorf("STFT is missing window size, hop size or sample rate")
+	}
+	if stft.HopSize > stft.WindowSize {
+		return nil, fmt.Errorf("hop size %d larger than window size %d cannot be inverted", stft.HopSize, stft.WindowSize)
+	}
+
+	// Synthesis uses the same window as analysis
+	synthesis := *s
+	if stft.WindowType != "" {
+		synthesis.WindowType = stft.WindowType
+	}
+	window, err := synthesis.WindowCoefficients(stft.WindowSize)
+	if err != nil {
+		return nil, err
+	}
+
+	numSamples := (len(stft.Data)-1)*stft.HopSize + stft.WindowSize
+	samples := make([]float64, numSamples)
+	windowSum := make([]float64, numSamples)
+
+	for i, halfSpectrum := range stft.Data {
+		frame, err := inverseHalfSpectrum(halfSpectrum, stft.WindowSize)
+		if err != nil {
+			return nil, fmt.Errorf("frame %d: %w", i, err)
+		}
+
+		// Overlap-add the windowed frame
+		offset := i * stft.HopSize
+		for n := 0; n < stft.WindowSize; n++ {
+			samples[offset+n] += frame[n] * window[n]
+			windowSum[offset+n] += window[n] * window[n]
+		}
+	}
+
+	// Normalize by the accumulated squared window
+	for n := range samples {
+		if windowSum[n] > 1e-8 {
+			samples[n] /= windowSum[n]
+		} else {
+			samples[n] = 0
+		}
+	}
+
+	return &AudioData{
+		Samples:    samples,
+		SampleRate: stft.SampleRate,
+		Channels:   1,
+		Duration:   float64(numSamples) / float64(stft.SampleRate),
+	}, nil
+}
+
+// GriffinLim estimates audio from a magnitude-only STFT by iteratively
+// re-estimating the phase. magnitude is indexed [time][bin] with
+// windowSize/2+1 bins per frame.
+func (s *SpectralAnalyzerImpl) GriffinLim(magnitude [][]float64, windowSize, hopSize, sampleRate, iterations int) (*AudioData, error) {
+	if len(magnitude) == 0 {
+		return nil, fmt.Errorf("invalid magnitude data")
+	}
+	if iterations <= 0 {
+		iterations = DefaultGriffinLimIterations
+	}
+
+	numBins := windowSize/2 + 1
+	for t, frame := range magnitude {
+		if len(frame) != numBins {
+			return nil, fmt.Errorf("magnitude frame %d has %d bins, expected %d", t, len(frame), numBins)
+		}
+	}
+
+	// Start from a random phase estimate (seeded so results are reproducible)
+	rng := rand.New(rand.NewSource(1))
+	stft := &ComplexSpectrogram{
+		Data:       make([][]complex128, len(magnitude)),
+		FreqBins:   numBins,
+		TimeBins:   len(magnitude),
+		WindowSize: windowSize,
+		HopSize:    hopSize,
+		SampleRate: sampleRate,
+		WindowType: s.WindowType,
+	}
+	for t, frame := range magnitude {
+		stft.Data[t] = make([]complex128, numBins)
+		for f, mag := range frame {
+			stft.Data[t][f] = cmplx.Rect(mag, 2*math.Pi*rng.Float64())
+		}
+	}
+
+	var estimate *AudioData
+	var err error
+	for iter := 0; iter < iterations; iter++ {
+		// Go back to the time domain with the current phase estimate
+		estimate, err = s.InverseSTFT(stft)
+		if err != nil {
+			return nil, fmt.Errorf("griffin-lim iteration %d: %w", iter, err)
+		}
+
+		// Re-analyse and keep only the phase
+		rebuilt, err := s.ComputeSTFT(estimate, windowSize, hopSize)
+		if err != nil {
+			return nil, fmt.Errorf("griffin-lim iteration %d: %w", iter, err)
+		}
+		for t := range stft.Data {
+			for f := range stft.Data[t] {
+				stft.Data[t][f] = cmplx.Rect(magnitude[t][f], cmplx.Phase(rebuilt.Data[t][f]))
+			}
+		}
+	}
+
+	// Final reconstruction with the converged phase
+	estimate, err = s.InverseSTFT(stft)
+	if err != nil {
+		return nil, fmt.Errorf("griffin-lim reconstruction: %w", err)
+	}
+
+	return estimate, nil
+}
+
+// ReconstructAudio resynthesizes audio from a spectrogram produced by this
+// analyzer. Spectrograms hold no phase, so Griffin-Lim is used to estimate it.
+// dB scaling and global normalization are undone with the loudest bin mapped
+// to unit power, so the result is only correct up to an overall gain.
+// Per-frame and percentile normalization cannot be inverted and are rejected.
+func (s *SpectralAnalyzerImpl) ReconstructAudio(spectrogram *Spectrogram, iterations int) (*AudioData, error) {
+	if spectrogram == nil || len(spectrogram.Data) == 0 || len(spectrogram.Data[0]) == 0 {
+		return nil, fmt.Errorf("invalid spectrogram data")
+	}
+	switch s.Normalization {
+	case NormalizeNone, NormalizeGlobal, "":
+	default:
+		return nil, fmt.Errorf("cannot invert a spectrogram with %s normalization", s.Normalization)
+	}
+
+	// Convert power (or dB above the floor) back to linear magnitude
+	magnitude := make([][]float64, len(spectrogram.Data))
+	for t, frame := range spectrogram.Data {
+		magnitude[t] = make([]float64, len(frame))
+		for f, val := range frame {
+			power := val
+			if s.DBScale {
+				// Globally normalized dB values span [0, 1] instead of [0, TopDB]
+				if s.Normalization == NormalizeGlobal {
+					val *= s.TopDB
+				}
+				power = math.Pow(10, (val-s.TopDB)/10)
+			}
+			magnitude[t][f] = math.Sqrt(math.Max(power, 0))
+		}
+	}
+
+	return s.GriffinLim(magnitude, s.WindowSize, s.HopSize, s.SampleRate, iterations)
+}
+
+// inverseHalfSpectrum rebuilds a real frame of length n from its half spectrum
+// using Hermitian symmetry
+func inverseHalfSpectrum(halfSpectrum []complex128, n int) ([]float64, error) {
+	if len(halfSpectrum) != n/2+1 {
+		return nil, fmt.Errorf("half spectrum has %d bins, expected %d", len(halfSpectrum), n/2+1)
+	}
+
+	fullSpectrum := make([]complex128, n)
+	copy(fullSpectrum, halfSpectrum)
+	for k := n/2 + 1; k < n; k++ {
+		fullSpectrum[k] = cmplx.Conj(halfSpectrum[n-k])
+	}
+
+	timeDomain := fft.IFFT(fullSpectrum)
+	frame := make([]float64, n)
+	for i, val := range timeDomain {
+		frame[i] = real(val)
+	}
+
+	return frame, nil
+}
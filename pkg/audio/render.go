@@ -0,0 +1,382 @@
+package audio
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"os"
+	"strconv"
+)
+
+// Colormap maps normalized spectrogram values to colors
+type Colormap string
+
+const (
+	ColormapJet       Colormap = "jet"       // Blue -> cyan -> green -> yellow -> red
+	ColormapGrayscale Colormap = "grayscale" // Black -> white
+	ColormapViridis   Colormap = "viridis"   // Perceptually uniform purple -> green -> yellow
+	ColormapMagma     Colormap = "magma"     // Perceptually uniform black -> purple -> orange -> white
+)
+
+// colormapStops are evenly spaced control points interpolated linearly
+var colormapStops = map[Colormap][]color.RGBA{
+	ColormapJet: {
+		{0, 0, 255, 255}, {0, 255, 255, 255}, {0, 255, 0, 255}, {255, 255, 0, 255}, {255, 0, 0, 255},
+	},
+	ColormapGrayscale: {
+		{0, 0, 0, 255}, {255, 255, 255, 255},
+	},
+	ColormapViridis: {
+		{68, 1, 84, 255}, {59, 82, 139, 255}, {33, 145, 140, 255}, {94, 201, 98, 255}, {253, 231, 37, 255},
+	},
+	ColormapMagma: {
+		{0, 0, 4, 255}, {81, 18, 124, 255}, {183, 55, 121, 255}, {252, 137, 97, 255}, {252, 253, 191, 255},
+	},
+}
+
+// ParseColormap converts a string such as "viridis" into a Colormap
+func ParseColormap(name string) (Colormap, error) {
+	colormap := Colormap(name)
+	if _, ok := colormapStops[colormap]; !ok {
+		return "", fmt.Errorf("unsupported colormap: %s", name)
+	}
+	return colormap, nil
+}
+
+// Color maps a value in [0, 1] to a color; values outside are clamped
+func (c Colormap) Color(value float64) color.RGBA {
+	stops, ok := colormapStops[c]
+	if !ok {
+		stops = colormapStops[ColormapJet]
+	}
+
+	position := math.Max(0, math.Min(1, value)) * float64(len(stops)-1)
+	i := min(int(position), len(stops)-2)
+	frac := position - float64(i)
+	lerp := func(a, b uint8) uint8 {
+		return uint8(math.Round(float64(a) + frac*(float64(b)-float64(a))))
+	}
+	return color.RGBA{lerp(stops[i].R, stops[i+1].R), lerp(stops[i].G, stops[i+1].G), lerp(stops[i].B, stops[i+1].B), 255}
+}
+
+// Point is a position in a spectrogram
+type Point struct {
+	Time      float64 // Seconds
+	Frequency float64 // Hz
+}
+
+// Overlay holds the annotations drawn on top of a spectrogram
+type Overlay struct {
+	Markers            []Point   // Drawn as dots, e.g. spectral peaks
+	Segments           [][]Point // Drawn as polylines, e.g. hash anchor-target links
+	HighlightedMarkers []Point   // Drawn in the highlight color, e.g. matched peaks
+	HighlightedLinks   [][]Point // Drawn in the highlight color, e.g. matched hashes
+}
+
+// SpectrogramRenderer draws spectrograms with optional overlays and axes
+type SpectrogramRenderer struct {
+	// Configuration parameters
+	Colormap       Colormap
+	Axes           bool       // Draw time and frequency axes with labels
+	MarkerRadius   int        // Radius of marker dots in pixels
+	MarkerColor    color.RGBA // Color of markers
+	SegmentColor   color.RGBA // Color of segments
+	HighlightColor color.RGBA // Color of highlighted markers and segments
+}
+
+// Margins around the spectrogram when axes are drawn
+const (
+	axisMarginLeft   = 32
+	axisMarginBottom = 14
+	axisTickLength   = 3
+)
+
+// NewSpectrogramRenderer creates a new renderer with default settings
+func NewSpectrogramRenderer() *SpectrogramRenderer {
+	return &SpectrogramRenderer{
+		Colormap:       ColormapJet,
+		Axes:           false,
+		MarkerRadius:   2,
+		MarkerColor:    color.RGBA{255, 255, 255, 255},
+		SegmentColor:   color.RGBA{255, 255, 255, 128},
+		HighlightColor: color.RGBA{255, 0, 255, 255},
+	}
+}
+
+// Render draws a spectrogram with one pixel per time and frequency bin, low
+// frequencies at the bottom, and the overlay on top. overlay may be nil.
+func (r *SpectrogramRenderer) Render(spectrogram *Spectrogram, overlay *Overlay) (*image.RGBA, error) {
+	if spectrogram == nil || len(spectrogram.Data) == 0 || len(spectrogram.Data[0]) == 0 {
+		return nil, fmt.Errorf("invalid spectrogram data")
+	}
+
+	width := spectrogram.TimeBins
+	height := spectrogram.FreqBins
+	left, bottom := 0, 0
+	if r.Axes {
+		left, bottom = axisMarginLeft, axisMarginBottom
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, left+width, height+bottom))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{0, 0, 0, 255}), image.Point{}, draw.Src)
+
+	// Fill the plot area with spectrogram data
+	for t := 0; t < width; t++ {
+		for f := 0; f < height; f++ {
+			img.SetRGBA(left+t, f, r.Colormap.Color(spectrogram.Data[t][height-f-1]))
+		}
+	}
+
+	if overlay != nil {
+		plot := &plotArea{img: img, spectrogram: spectrogram, left: left}
+		for _, segment := range overlay.Segments {
+			plot.polyline(segment, r.SegmentColor)
+		}
+		for _, marker := range overlay.Markers {
+			plot.dot(marker, r.MarkerRadius, r.MarkerColor)
+		}
+		for _, segment := range overlay.HighlightedLinks {
+			plot.polyline(segment, r.HighlightColor)
+		}
+		for _, marker := range overlay.HighlightedMarkers {
+			plot.dot(marker, r.MarkerRadius+1, r.HighlightColor)
+		}
+	}
+
+	if r.Axes {
+		r.drawAxes(img, spectrogram, left)
+	}
+
+	return img, nil
+}
+
+// RenderComparison draws a query spectrogram above a reference spectrogram,
+// e.g. with matched hashes highlighted in both overlays
+func (r *SpectrogramRenderer) RenderComparison(query, reference *Spectrogram, queryOverlay, referenceOverlay *Overlay) (*image.RGBA, error) {
+	top, err := r.Render(query, queryOverlay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render query: %w", err)
+	}
+	bottom, err := r.Render(reference, referenceOverlay)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render reference: %w", err)
+	}
+
+	const gap = 4
+	width := max(top.Bounds().Dx(), bottom.Bounds().Dx())
+	img := image.NewRGBA(image.Rect(0, 0, width, top.Bounds().Dy()+gap+bottom.Bounds().Dy()))
+	draw.Draw(img, img.Bounds(), image.NewUniform(color.RGBA{0, 0, 0, 255}), image.Point{}, draw.Src)
+	draw.Draw(img, top.Bounds(), top, image.Point{}, draw.Src)
+	draw.Draw(img, bottom.Bounds().Add(image.Pt(0, top.Bounds().Dy()+gap)), bottom, image.Point{}, draw.Src)
+
+	return img, nil
+}
+
+// SavePNG encodes an image as PNG
+func SavePNG(img image.Image, filePath string) error {
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create image file: %w", err)
+	}
+
+	if err := png.Encode(file, img); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to encode image: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close image file: %w", err)
+	}
+	return nil
+}
+
+// plotArea maps spectrogram coordinates to pixels
+type plotArea struct {
+	img         *image.RGBA
+	spectrogram *Spectrogram
+	left        int
+}
+
+// pixel returns the pixel of a point
+func (p *plotArea) pixel(point Point) (int, int) {
+	spec := p.spectrogram
+	x := 0
+	if len(spec.TimePoints) > 1 {
+		x = int(math.Round((point.Time - spec.TimePoints[0]) / (spec.TimePoints[1] - spec.TimePoints[0])))
+	}
+	y := 0
+	if len(spec.FreqPoints) > 1 {
+		y = int(math.Round((point.Frequency - spec.FreqPoints[0]) / (spec.FreqPoints[1] - spec.FreqPoints[0])))
+	}
+	return p.left + x, spec.FreqBins - y - 1
+}
+
+// set blends a color into a pixel of the plot area
+func (p *plotArea) set(x, y int, c color.RGBA) {
+	if x < p.left || x >= p.left+p.spectrogram.TimeBins || y < 0 || y >= p.spectrogram.FreqBins {
+		return
+	}
+	if c.A == 255 {
+		p.img.SetRGBA(x, y, c)
+		return
+	}
+	under := p.img.RGBAAt(x, y)
+	blend := func(a, b uint8) uint8 {
+		return uint8((int(a)*int(c.A) + int(b)*(255-int(c.A))) / 255)
+	}
+	p.img.SetRGBA(x, y, color.RGBA{blend(c.R, under.R), blend(c.G, under.G), blend(c.B, under.B), 255})
+}
+
+// dot draws a filled circle
+func (p *plotArea) dot(point Point, radius int, c color.RGBA) {
+	x, y := p.pixel(point)
+	for dx := -radius; dx <= radius; dx++ {
+		for dy := -radius; dy <= radius; dy++ {
+			// Skip corners to make it more circular
+			if dx*dx+dy*dy <= radius*radius+1 {
+				p.set(x+dx, y+dy, c)
+			}
+		}
+	}
+}
+
+// polyline draws straight lines between consecutive points
+func (p *plotArea) polyline(points []Point, c color.RGBA) {
+	for i := 1; i < len(points); i++ {
+		x0, y0 := p.pixel(points[i-1])
+		x1, y1 := p.pixel(points[i])
+
+		// Bresenham's line algorithm
+		dx, dy := abs(x1-x0), -abs(y1-y0)
+		sx, sy := sign(x1-x0), sign(y1-y0)
+		err := dx + dy
+		for {
+			p.set(x0, y0, c)
+			if x0 == x1 && y0 == y1 {
+				break
+			}
+			if e2 := 2 * err; e2 >= dy {
+				err += dy
+				x0 += sx
+			} else {
+				err += dx
+				y0 += sy
+			}
+		}
+	}
+}
+
+// drawAxes draws the frequency axis left of and the time axis below the plot
+func (r *SpectrogramRenderer) drawAxes(img *image.RGBA, spectrogram *Spectrogram, left int) {
+	white := color.RGBA{255, 255, 255, 255}
+	width, height := spectrogram.TimeBins, spectrogram.FreqBins
+	plot := &plotArea{img: img, spectrogram: spectrogram, left: left}
+
+	for y := 0; y <= height; y++ {
+		img.SetRGBA(left-1, y, white)
+	}
+	for x := left - 1; x < left+width; x++ {
+		img.SetRGBA(x, height, white)
+	}
+
+	// Time ticks at least 40 pixels apart
+	timeEnd := spectrogram.TimePoints[len(spectrogram.TimePoints)-1]
+	secondsPerPixel := timeEnd / math.Max(1, float64(width-1))
+	step := niceStep(40 * secondsPerPixel)
+	for i := 0; float64(i)*step <= timeEnd; i++ {
+		t := float64(i) * step
+		x, _ := plot.pixel(Point{Time: t})
+		for dy := 0; dy < axisTickLength; dy++ {
+			img.SetRGBA(x, height+1+dy, white)
+		}
+		label := formatTick(t, step) + "s"
+		drawText(img, x-textWidth(label)/2, height+axisTickLength+2, label, white)
+	}
+
+	// Frequency ticks at least 20 pixels apart, labeled in kHz from 1 kHz up
+	freqEnd := spectrogram.FreqPoints[len(spectrogram.FreqPoints)-1]
+	hzPerPixel := freqEnd / math.Max(1, float64(height-1))
+	step = niceStep(20 * hzPerPixel)
+	for i := 0; float64(i)*step <= freqEnd; i++ {
+		f := float64(i) * step
+		_, y := plot.pixel(Point{Frequency: f})
+		for dx := 1; dx <= axisTickLength; dx++ {
+			img.SetRGBA(left-1-dx, y, white)
+		}
+		label := formatTick(f, step)
+		if f >= 1000 {
+			label = formatTick(f/1000, step/1000) + "k"
+		}
+		drawText(img, left-axisTickLength-3-textWidth(label), y-2, label, white)
+	}
+}
+
+// niceStep returns the smallest 1, 2 or 5 times a power of ten of at least x
+func niceStep(x float64) float64 {
+	if x <= 0 {
+		return 1
+	}
+	magnitude := math.Pow(10, math.Floor(math.Log10(x)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if m*magnitude >= x {
+			return m * magnitude
+		}
+	}
+	return 10 * magnitude
+}
+
+// formatTick formats a tick value with as many decimals as its step needs
+func formatTick(value, step float64) string {
+	decimals := max(0, int(math.Ceil(-math.Log10(step)-1e-9)))
+	return strconv.FormatFloat(value, 'f', decimals, 64)
+}
+
+// glyphs is a 3x5 pixel font for axis labels; each row is 3 bits, MSB left
+var glyphs = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {7, 1, 7, 4, 7}, '3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1}, '5': {7, 4, 7, 1, 7}, '6': {7, 4, 7, 5, 7}, '7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7}, '9': {7, 5, 7, 1, 7}, '.': {0, 0, 0, 0, 2}, 's': {0, 3, 6, 3, 6},
+	'k': {4, 5, 6, 5, 5},
+}
+
+// textWidth returns the width of a label in pixels
+func textWidth(text string) int {
+	return 4*len(text) - 1
+}
+
+// drawText draws a label with its top-left corner at (x, y)
+func drawText(img *image.RGBA, x, y int, text string, c color.RGBA) {
+	bounds := img.Bounds()
+	for _, ch := range text {
+		glyph := glyphs[ch]
+		for row := 0; row < 5; row++ {
+			for col := 0; col < 3; col++ {
+				px, py := x+col, y+row
+				if glyph[row]&(4>>col) != 0 && image.Pt(px, py).In(bounds) {
+					img.SetRGBA(px, py, c)
+				}
+			}
+		}
+		x += 4
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func sign(x int) int {
+	switch {
+	case x > 0:
+		return 1
+	case x < 0:
+		return -1
+	}
+	return 0
+}
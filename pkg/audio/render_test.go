@@ -0,0 +1,81 @@
+package audio
+
+import (
+	"image/color"
+	"testing"
+)
+
+func TestColormaps(t *testing.T) {
+	for _, name := range []string{"jet", "grayscale", "viridis", "magma"} {
+		colormap, err := ParseColormap(name)
+		if err != nil {
+			t.Fatalf("Failed to parse colormap %s: %v", name, err)
+		}
+		stops := colormapStops[colormap]
+		if got := colormap.Color(-1); got != stops[0] {
+			t.Errorf("%s: expected %v below range, got %v", name, stops[0], got)
+		}
+		if got := colormap.Color(2); got != stops[len(stops)-1] {
+			t.Errorf("%s: expected %v above range, got %v", name, stops[len(stops)-1], got)
+		}
+	}
+	if _, err := ParseColormap("rainbow"); err == nil {
+		t.Error("Expected an error for an unknown colormap")
+	}
+}
+
+func TestSpectrogramRenderer(t *testing.T) {
+	// 20 frames of 10 ms, 11 bins of 100 Hz
+	spectrogram := &Spectrogram{TimeBins: 20, FreqBins: 11}
+	for i := 0; i < 20; i++ {
+		spectrogram.Data = append(spectrogram.Data, make([]float64, 11))
+		spectrogram.TimePoints = append(spectrogram.TimePoints, float64(i)*0.01)
+	}
+	for f := 0; f < 11; f++ {
+		spectrogram.FreqPoints = append(spectrogram.FreqPoints, float64(f)*100)
+	}
+
+	renderer := NewSpectrogramRenderer()
+	renderer.MarkerRadius = 0
+	overlay := &Overlay{
+		Markers:          []Point{{Time: 0.05, Frequency: 300}},
+		HighlightedLinks: [][]Point{{{Time: 0.1, Frequency: 0}, {Time: 0.1, Frequency: 1000}}},
+	}
+	img, err := renderer.Render(spectrogram, overlay)
+	if err != nil {
+		t.Fatalf("Failed to render: %v", err)
+	}
+	if img.Bounds().Dx() != 20 || img.Bounds().Dy() != 11 {
+		t.Fatalf("Expected a 20x11 image, got %v", img.Bounds())
+	}
+
+	// Low frequencies are at the bottom
+	if got := img.RGBAAt(5, 10-3); got != renderer.MarkerColor {
+		t.Errorf("Expected marker at (5, 7), got %v", got)
+	}
+	for y := 0; y < 11; y++ {
+		if got := img.RGBAAt(10, y); got != renderer.HighlightColor {
+			t.Errorf("Expected highlighted link at (10, %d), got %v", y, got)
+		}
+	}
+	if got := img.RGBAAt(0, 0); got != ColormapJet.Color(0) {
+		t.Errorf("Expected background color %v, got %v", ColormapJet.Color(0), got)
+	}
+
+	// Axes add margins around the plot
+	renderer.Axes = true
+	img, err = renderer.Render(spectrogram, nil)
+	if err != nil {
+		t.Fatalf("Failed to render with axes: %v", err)
+	}
+	if img.Bounds().Dx() != 20+axisMarginLeft || img.Bounds().Dy() != 11+axisMarginBottom {
+		t.Errorf("Unexpected image size with axes: %v", img.Bounds())
+	}
+	if got := img.RGBAAt(axisMarginLeft-1, 5); got != (color.RGBA{255, 255, 255, 255}) {
+		t.Errorf("Expected frequency axis line, got %v", got)
+	}
+
+	if _, err := renderer.Render(&Spectrogram{}, nil); err == nil {
+		t.Error("Expected an error for an empty spectrogram")
+	}
+}
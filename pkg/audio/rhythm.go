@@ -0,0 +1,229 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+)
+
+// BeatInfo holds the tempo and beat grid estimated for a piece of audio
+type BeatInfo struct {
+	BPM           float64   // Estimated tempo in beats per minute
+	BeatTimes     []float64 // Beat positions in seconds
+	OnsetEnvelope []float64 // Onset strength for each spectrogram frame
+	FrameRate     float64   // Onset envelope frames per second
+}
+
+// BeatTracker estimates onsets, tempo and beat positions from a spectrogram
+type BeatTracker struct {
+	// Configuration parameters
+	MinBPM       float64 // Slowest tempo considered
+	MaxBPM       float64 // Fastest tempo considered
+	PreferredBPM float64 // Centre of the tempo prior (resolves octave errors)
+	PriorWidth   float64 // Width of the tempo prior in octaves
+	Tightness    float64 // How strictly beats must follow the estimated period
+}
+
+// NewBeatTracker creates a new beat tracker with default settings
+func NewBeatTracker() *BeatTracker {
+	return &BeatTracker{
+		MinBPM:       60.0,
+		MaxBPM:       200.0,
+		PreferredBPM: 120.0,
+		PriorWidth:   1.0,
+		Tightness:    100.0,
+	}
+}
+
+// OnsetStrength computes the half-wave rectified spectral flux of a
+// spectrogram, normalized to a maximum of 1. The first frame is always 0.
+func (b *BeatTracker) OnsetStrength(spectrogram *Spectrogram) ([]float64, error) {
+	if spectrogram == nil || len(spectrogram.Data) < 2 {
+		return nil, fmt.Errorf("spectrogram needs at least two frames for onset detection")
+	}
+
+	onset := make([]float64, len(spectrogram.Data))
+	maxFlux := 0.0
+	for t := 1; t < len(spectrogram.Data); t++ {
+		// Sum the increases in energy across all bins
+		flux := 0.0
+		for f, val := range spectrogram.Data[t] {
+			if diff := val - spectrogram.Data[t-1][f]; diff > 0 {
+				flux += diff
+			}
+		}
+		onset[t] = flux
+		maxFlux = math.Max(maxFlux, flux)
+	}
+
+	// Normalize
+	if maxFlux > 1e-10 {
+		for t := range onset {
+			onset[t] /= maxFlux
+		}
+	}
+
+	return onset, nil
+}
+
+// EstimateTempo estimates the tempo of an onset envelope from its
+// autocorrelation, weighted by a log-Gaussian prior around PreferredBPM
+func (b *BeatTracker) EstimateTempo(onset []float64, frameRate float64) (float64, error) {
+	if frameRate <= 0 {
+		return 0, fmt.Errorf("frame rate must be positive, got %f", frameRate)
+	}
+	if b.MinBPM <= 0 || b.MaxBPM <= b.MinBPM {
+		return 0, fmt.Errorf("invalid tempo range: %f - %f BPM", b.MinBPM, b.MaxBPM)
+	}
+
+	// Lags (in frames) covering the tempo range
+	minLag := int(math.Floor(60 * frameRate / b.MaxBPM))
+	maxLag := int(math.Ceil(60 * frameRate / b.MinBPM))
+	if minLag < 1 {
+		minLag = 1
+	}
+	if maxLag >= len(onset)-1 {
+		return 0, fmt.Errorf("audio too short to estimate tempo down to %.0f BPM", b.MinBPM)
+	}
+
+	// Remove the mean so the autocorrelation reflects periodicity
+	mean := 0.0
+	for _, val := range onset {
+		mean += val
+	}
+	mean /= float64(len(onset))
+
+	centered := make([]float64, len(onset))
+	for i, val := range onset {
+		centered[i] = val - mean
+	}
+
+	// Weighted autocorrelation over the lag range
+	scores := make([]float64, maxLag+2)
+	bestLag := 0
+	for lag := minLag; lag <= maxLag+1; lag++ {
+		sum := 0.0
+		for i := lag; i < len(centered); i++ {
+			sum += centered[i] * centered[i-lag]
+		}
+		sum /= float64(len(centered) - lag)
+
+		bpm := 60 * frameRate / float64(lag)
+		octaves := math.Log2(bpm / b.PreferredBPM)
+		scores[lag] = sum * math.Exp(-0.5*(octaves/b.PriorWidth)*(octaves/b.PriorWidth))
+
+		if lag <= maxLag && (bestLag == 0 || scores[lag] > scores[bestLag]) {
+			bestLag = lag
+		}
+	}
+	if scores[bestLag] <= 0 {
+		return 0, fmt.Errorf("no periodicity found in onset envelope")
+	}
+
+	// Refine the lag with parabolic interpolation
+	lag := float64(bestLag)
+	if bestLag > minLag {
+		left, centre, right := scores[bestLag-1], scores[bestLag], scores[bestLag+1]
+		if denominator := left - 2*centre + right; denominator < 0 {
+			lag += 0.5 * (left - right) / denominator
+		}
+	}
+
+	return 60 * frameRate / lag, nil
+}
+
+// TrackBeats places beats on an onset envelope using dynamic programming:
+// every beat is scored by its onset strength plus the best preceding beat,
+// penalizing spacings that deviate from the tempo's period. Returned values
+// are frame indices in increasing order.
+func (b *BeatTracker) TrackBeats(onset []float64, frameRate, bpm float64) ([]int, error) {
+	if bpm <= 0 || frameRate <= 0 {
+		return nil, fmt.Errorf("tempo and frame rate must be positive")
+	}
+	if len(onset) == 0 {
+		return nil, fmt.Errorf("empty onset envelope")
+	}
+
+	period := 60 * frameRate / bpm
+	scores := make([]float64, len(onset))
+	backlinks := make([]int, len(onset))
+
+	for t := range onset {
+		// Search for the best predecessor between half and two periods back
+		backlinks[t] = -1
+		bestScore := 0.0
+		start := t - int(math.Round(2*period))
+		end := t - int(math.Round(period/2))
+		for prev := start; prev <= end; prev++ {
+			if prev < 0 {
+				continue
+			}
+			deviation := math.Log(float64(t-prev) / period)
+			score := scores[prev] - b.Tightness*deviation*deviation
+			if backlinks[t] == -1 || score > bestScore {
+				bestScore = score
+				backlinks[t] = prev
+			}
+		}
+
+		scores[t] = onset[t]
+		if backlinks[t] != -1 {
+			scores[t] += bestScore
+		}
+	}
+
+	// Start from the best scoring frame within the last period
+	last := len(onset) - 1
+	for t := len(onset) - 1; t >= 0 && float64(len(onset)-1-t) < period; t-- {
+		if scores[t] > scores[last] {
+			last = t
+		}
+	}
+
+	// Follow the backlinks
+	var beats []int
+	for t := last; t >= 0; t = backlinks[t] {
+		beats = append(beats, t)
+	}
+	for i, j := 0, len(beats)-1; i < j; i, j = i+1, j-1 {
+		beats[i], beats[j] = beats[j], beats[i]
+	}
+
+	return beats, nil
+}
+
+// Analyze computes the onset envelope, tempo and beat grid of a spectrogram
+func (b *BeatTracker) Analyze(spectrogram *Spectrogram) (*BeatInfo, error) {
+	onset, err := b.OnsetStrength(spectrogram)
+	if err != nil {
+		return nil, err
+	}
+
+	// Frame rate of the onset envelope
+	frameDuration := spectrogram.TimePoints[1] - spectrogram.TimePoints[0]
+	if frameDuration <= 0 {
+		return nil, fmt.Errorf("invalid spectrogram time points")
+	}
+	frameRate := 1 / frameDuration
+
+	bpm, err := b.EstimateTempo(onset, frameRate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to estimate tempo: %w", err)
+	}
+
+	beatFrames, err := b.TrackBeats(onset, frameRate, bpm)
+	if err != nil {
+		return nil, fmt.Errorf("failed to track beats: %w", err)
+	}
+
+	beatTimes := make([]float64, len(beatFrames))
+	for i, frame := range beatFrames {
+		beatTimes[i] = spectrogram.TimePoints[frame]
+	}
+
+	return &BeatInfo{
+		BPM:           bpm,
+		BeatTimes:     beatTimes,
+		OnsetEnvelope: onset,
+		FrameRate:     frameRate,
+	}, nil
+}
@@ -0,0 +1,96 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// createClickTrack creates a mono click track with short decaying bursts at the given tempo
+func createClickTrack(sampleRate int, bpm, duration float64) *AudioData {
+	numSamples := int(duration * float64(sampleRate))
+	samples := make([]float64, numSamples)
+
+	interval := 60.0 / bpm
+	clickLength := sampleRate / 100 // 10ms
+	for beat := 0.0; beat < duration; beat += interval {
+		start := int(beat * float64(sampleRate))
+		for i := 0; i < clickLength && start+i < numSamples; i++ {
+			decay := math.Exp(-float64(i) / float64(clickLength) * 5)
+			samples[start+i] = decay * math.Sin(2*math.Pi*2000*float64(i)/float64(sampleRate))
+		}
+	}
+
+	return &AudioData{
+		Samples:    samples,
+		SampleRate: sampleRate,
+		Channels:   1,
+		Duration:   duration,
+	}
+}
+
+func TestBeatTracker(t *testing.T) {
+	// Create a 120 BPM click track
+	audioData := createClickTrack(22050, 120, 10)
+
+	// Compute spectrogram
+	analyzer := NewSpectralAnalyzer()
+	spectrogram, err := analyzer.ComputeSpectrogram(audioData, 1024, 256)
+	if err != nil {
+		t.Fatalf("Failed to compute spectrogram: %v", err)
+	}
+
+	// Analyze rhythm
+	tracker := NewBeatTracker()
+	info, err := tracker.Analyze(spectrogram)
+	if err != nil {
+		t.Fatalf("Failed to analyze rhythm: %v", err)
+	}
+
+	// Check the tempo
+	if math.Abs(info.BPM-120) > 2 {
+		t.Errorf("Expected tempo around 120 BPM, got %f", info.BPM)
+	}
+
+	// Check the beat grid: roughly one beat every half second
+	if len(info.BeatTimes) < 18 || len(info.BeatTimes) > 21 {
+		t.Errorf("Expected around 20 beats, got %d", len(info.BeatTimes))
+	}
+	for i := 1; i < len(info.BeatTimes); i++ {
+		interval := info.BeatTimes[i] - info.BeatTimes[i-1]
+		if math.Abs(interval-0.5) > 0.05 {
+			t.Errorf("Expected beat interval around 0.5s between beats %d and %d, got %f", i-1, i, interval)
+		}
+	}
+
+	// Beats should land on clicks. Times are frame starts, so a beat may
+	// precede its click by up to one window (1024 samples ≈ 46ms).
+	for i, beatTime := range info.BeatTimes {
+		nearestClick := math.Round(beatTime/0.5) * 0.5
+		if lead := nearestClick - beatTime; lead < -0.01 || lead > 0.05 {
+			t.Errorf("Beat %d at %fs is not aligned with a click", i, beatTime)
+		}
+	}
+}
+
+func TestOnsetStrength(t *testing.T) {
+	// A spectrogram with a single jump in energy at frame 2
+	spectrogram := &Spectrogram{
+		Data:     [][]float64{{0, 0}, {0, 0}, {1, 0.5}, {1, 0.5}, {0, 0}},
+		FreqBins: 2,
+		TimeBins: 5,
+	}
+
+	tracker := NewBeatTracker()
+	onset, err := tracker.OnsetStrength(spectrogram)
+	if err != nil {
+		t.Fatalf("Failed to compute onset strength: %v", err)
+	}
+
+	// Only increases in energy count
+	expected := []float64{0, 0, 1, 0, 0}
+	for i, val := range onset {
+		if math.Abs(val-expected[i]) > 1e-10 {
+			t.Errorf("Expected onset %f at frame %d, got %f", expected[i], i, val)
+		}
+	}
+}
@@ -2,92 +2,93 @@ package audio
 
 import (
 	"fmt"
-	"image"
-	"image/color"
-	"image/png"
 	"math"
 	"math/cmplx"
-	"os"
+	"sort"
 
 	"github.com/mjibson/go-dsp/fft"
 )
 
+// NormalizationMode selects how spectrogram values are rescaled to [0, 1]
+type NormalizationMode string
+
+const (
+	NormalizeNone       NormalizationMode = "none"       // Leave values unscaled
+	NormalizePerFrame   NormalizationMode = "per-frame"  // Scale every frame to its own maximum
+	NormalizeGlobal     NormalizationMode = "global"     // Scale by the maximum of the whole spectrogram
+	NormalizePercentile NormalizationMode = "percentile" // Scale by a percentile of all values, clipping above it
+)
+
+// minPower is the smallest power considered when converting to decibels
+const minPower = 1e-10
+
 // SpectralAnalyzerImpl implements the SpectralAnalyzer interface
 type SpectralAnalyzerImpl struct {
 	// Configuration parameters
-	WindowSize    int     // Size of the window function
-	HopSize       int     // Hop size between frames
-	SampleRate    int     // Sample rate of the audio
-	WindowType    string  // Type of window function (hamming, hann, etc.)
-	MinFreq       float64 // Minimum frequency to consider (Hz)
-	MaxFreq       float64 // Maximum frequency to consider (Hz)
-	LogScaleBase  float64 // Base for logarithmic scaling (0 for linear scale)
-	NormalizeSpec bool    // Whether to normalize the spectrogram
-	MelScale      bool    // Whether to use mel scale for frequency bins
-	NumMelBins    int     // Number of mel bins (if using mel scale)
+	WindowSize          int               // Size of the window function
+	HopSize             int               // Hop size between frames
+	SampleRate          int               // Sample rate of the audio
+	WindowType          WindowType        // Type of window function (hamming, hann, etc.)
+	KaiserBeta          float64           // Shape parameter of the Kaiser window
+	GaussianSigma       float64           // Width of the Gaussian window relative to half its length
+	MinFreq             float64           // Minimum frequency to consider (Hz)
+	MaxFreq             float64           // Maximum frequency to consider (Hz)
+	DBScale             bool              // Whether to convert power to decibels
+	TopDB               float64           // Dynamic range kept below the loudest bin when DBScale is set (dB)
+	Normalization       NormalizationMode // How to normalize the spectrogram
+	NormalizePercentile float64           // Percentile (0-100) used by NormalizePercentile
+	MelScale            bool              // Whether to use mel scale for frequency bins
+	NumMelBins          int               // Number of mel bins (if using mel scale)
 }
 
 // NewSpectralAnalyzer creates a new spectral analyzer with default settings
 func NewSpectralAnalyzer() *SpectralAnalyzerImpl {
 	return &SpectralAnalyzerImpl{
-		WindowSize:    1024,
-		HopSize:       512,
-		SampleRate:    44100,
-		WindowType:    "hamming",
-		MinFreq:       0,
-		MaxFreq:       22050, // Nyquist frequency for 44.1kHz
-		LogScaleBase:  10.0,
-		NormalizeSpec: true,
-		MelScale:      false,
-		NumMelBins:    128,
+		WindowSize:          1024,
+		HopSize:             512,
+		SampleRate:          44100,
+		WindowType:          WindowHamming,
+		KaiserBeta:          8.6,
+		GaussianSigma:       0.4,
+		MinFreq:             0,
+		MaxFreq:             22050, // Nyquist frequency for 44.1kHz
+		DBScale:             true,
+		TopDB:               80.0,
+		Normalization:       NormalizeGlobal,
+		NormalizePercentile: 99.0,
+		MelScale:            false,
+		NumMelBins:          128,
+	}
+}
+
+// ParseNormalizationMode converts a string such as "global" into a NormalizationMode
+func ParseNormalizationMode(name string) (NormalizationMode, error) {
+	switch mode := NormalizationMode(name); mode {
+	case NormalizeNone, NormalizePerFrame, NormalizeGlobal, NormalizePercentile:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unsupported normalization mode: %s (expected none, per-frame, global or percentile)", name)
 	}
 }
 
 // ApplyWindow applies a window function to a frame of audio samples
-func (s *SpectralAnalyzerImpl) ApplyWindow(frame []float64) []float64 {
+func (s *SpectralAnalyzerImpl) ApplyWindow(frame []float64) ([]float64, error) {
 	if len(frame) != s.WindowSize {
-		// Resize frame if necessary
-		newFrame := make([]float64, s.WindowSize)
-		copy(newFrame, frame)
-		frame = newFrame
+		return nil, fmt.Errorf("frame has %d samples, expected window size %d", len(frame), s.WindowSize)
+	}
+
+	window, err := s.WindowCoefficients(len(frame))
+	if err != nil {
+		return nil, err
 	}
 
 	// Create a new windowed frame
 	windowedFrame := make([]float64, len(frame))
-
-	switch s.WindowType {
-	case "hamming":
-		// Hamming window: w(n) = 0.54 - 0.46 * cos(2π * n / (N-1))
-		for i := 0; i < len(frame); i++ {
-			windowCoeff := 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(len(frame)-1))
-			windowedFrame[i] = frame[i] * windowCoeff
-		}
-	case "hann":
-		// Hann window: w(n) = 0.5 * (1 - cos(2π * n / (N-1)))
-		for i := 0; i < len(frame); i++ {
-			windowCoeff := 0.5 * (1 - math.Cos(2*math.Pi*float64(i)/float64(len(frame)-1)))
-			windowedFrame[i] = frame[i] * windowCoeff
-		}
-	case "blackman":
-		// Blackman window: w(n) = 0.42 - 0.5 * cos(2π * n / (N-1)) + 0.08 * cos(4π * n / (N-1))
-		for i := 0; i < len(frame); i++ {
-			n := float64(i)
-			N := float64(len(frame) - 1)
-			windowCoeff := 0.42 - 0.5*math.Cos(2*math.Pi*n/N) + 0.08*math.Cos(4*math.Pi*n/N)
-			windowedFrame[i] = frame[i] * windowCoeff
-		}
-	case "rectangular":
-		// Rectangular window (no windowing)
-		copy(windowedFrame, frame)
-	default:
-		// Default to Hamming window
-		for i := 0; i < len(frame); i++ {
-			windowCoeff := 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(len(frame)-1))
-			windowedFrame[i] = frame[i] * windowCoeff
-		}
+	for i, sample := range frame {
+		windowedFrame[i] = sample * window[i]
 	}
 
-	return windowedFrame
+	return windowedFrame, nil
 }
 
 // ComputeFFT computes the Fast Fourier Transform of a windowed frame
@@ -132,20 +133,37 @@ func (s *SpectralAnalyzerImpl) ComputePowerSpectrum(fftResult []complex128) []fl
 	return powerSpectrum
 }
 
-// ApplyLogScale applies logarithmic scaling to a spectrum
-func (s *SpectralAnalyzerImpl) ApplyLogScale(spectrum []float64) []float64 {
-	if s.LogScaleBase <= 1.0 {
-		// No log scaling
-		return spectrum
+// PowerToDB converts a power spectrum to decibels relative to a power of 1.0.
+// Powers below minPower are clamped so silence maps to -100 dB rather than -Inf.
+func (s *SpectralAnalyzerImpl) PowerToDB(spectrum []float64) []float64 {
+	dbSpectrum := make([]float64, len(spectrum))
+	for i, val := range spectrum {
+		dbSpectrum[i] = 10 * math.Log10(math.Max(val, minPower))
 	}
 
-	logSpectrum := make([]float64, len(spectrum))
-	for i, val := range spectrum {
-		// Add a small value to avoid log(0)
-		logSpectrum[i] = math.Log(val+1e-10) / math.Log(s.LogScaleBase)
+	return dbSpectrum
+}
+
+// ApplyDBFloor clamps a decibel spectrogram to TopDB below its loudest bin and
+// shifts it so the floor is 0. Every value ends up in [0, TopDB], keeping the
+// relative loudness between frames intact.
+func (s *SpectralAnalyzerImpl) ApplyDBFloor(data [][]float64) {
+	// Find the loudest bin
+	maxDB := math.Inf(-1)
+	for _, frame := range data {
+		for _, val := range frame {
+			if val > maxDB {
+				maxDB = val
+			}
+		}
 	}
 
-	return logSpectrum
+	floor := maxDB - s.TopDB
+	for _, frame := range data {
+		for i, val := range frame {
+			frame[i] = math.Max(val, floor) - floor
+		}
+	}
 }
 
 // NormalizeSpectrum normalizes a spectrum to [0, 1] range
@@ -172,6 +190,63 @@ func (s *SpectralAnalyzerImpl) NormalizeSpectrum(spectrum []float64) []float64 {
 	return normalizedSpectrum
 }
 
+// NormalizeSpectrogram rescales a spectrogram in place according to the
+// analyzer's normalization mode
+func (s *SpectralAnalyzerImpl) NormalizeSpectrogram(data [][]float64) error {
+	switch s.Normalization {
+	case NormalizeNone, "":
+		return nil
+	case NormalizePerFrame:
+		for i, frame := range data {
+			data[i] = s.NormalizeSpectrum(frame)
+		}
+		return nil
+	case NormalizeGlobal:
+		maxVal := 0.0
+		for _, frame := range data {
+			for _, val := range frame {
+				maxVal = math.Max(maxVal, val)
+			}
+		}
+		scaleSpectrogram(data, maxVal)
+		return nil
+	case NormalizePercentile:
+		if s.NormalizePercentile <= 0 || s.NormalizePercentile > 100 {
+			return fmt.Errorf("normalization percentile must be in (0, 100], got %f", s.NormalizePercentile)
+		}
+		var values []float64
+		for _, frame := range data {
+			values = append(values, frame...)
+		}
+		if len(values) == 0 {
+			return nil
+		}
+		sort.Float64s(values)
+		index := int(math.Ceil(s.NormalizePercentile/100*float64(len(values)))) - 1
+		if index < 0 {
+			index = 0
+		}
+		scaleSpectrogram(data, values[index])
+		return nil
+	default:
+		return fmt.Errorf("unsupported normalization mode: %s", s.Normalization)
+	}
+}
+
+// scaleSpectrogram divides every value by reference, clipping the result to 1
+func scaleSpectrogram(data [][]float64, reference float64) {
+	// Avoid division by zero
+	if reference < 1e-10 {
+		return
+	}
+
+	for _, frame := range data {
+		for i, val := range frame {
+			frame[i] = math.Min(val/reference, 1.0)
+		}
+	}
+}
+
 // ComputeSpectrogram converts audio data to a spectrogram
 func (s *SpectralAnalyzerImpl) ComputeSpectrogram(data *AudioData, windowSize, hopSize int) (*Spectrogram, error) {
 	// Update window and hop size if provided
@@ -187,6 +262,15 @@ func (s *SpectralAnalyzerImpl) ComputeSpectrogram(data *AudioData, windowSize, h
 		return nil, fmt.Errorf("spectrogram computation requires mono audio, got %d channels", data.Channels)
 	}
 
+	if err := s.validateFrameSizes(); err != nil {
+		return nil, err
+	}
+
+	// A dB floor needs a positive dynamic range
+	if s.DBScale && s.TopDB <= 0 {
+		return nil, fmt.Errorf("TopDB must be positive when DBScale is enabled, got %f", s.TopDB)
+	}
+
 	// Set sample rate from audio data
 	s.SampleRate = data.SampleRate
 
@@ -207,7 +291,10 @@ func (s *SpectralAnalyzerImpl) ComputeSpectrogram(data *AudioData, windowSize, h
 	// Process each frame
 	for i, frame := range frames {
 		// Apply window function
-		windowedFrame := s.ApplyWindow(frame)
+		windowedFrame, err := s.ApplyWindow(frame)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply window: %w", err)
+		}
 
 		// Compute FFT
 		fftResult := s.ComputeFFT(windowedFrame)
@@ -215,20 +302,26 @@ func (s *SpectralAnalyzerImpl) ComputeSpectrogram(data *AudioData, windowSize, h
 		// Compute power spectrum
 		powerSpectrum := s.ComputePowerSpectrum(fftResult)
 
-		// Apply log scaling if needed
-		if s.LogScaleBase > 1.0 {
-			powerSpectrum = s.ApplyLogScale(powerSpectrum)
-		}
-
-		// Normalize if needed
-		if s.NormalizeSpec {
-			powerSpectrum = s.NormalizeSpectrum(powerSpectrum)
+		// Convert to decibels if needed
+		if s.DBScale {
+			powerSpectrum = s.PowerToDB(powerSpectrum)
 		}
 
 		// Store in spectrogram
 		spectrogramData[i] = powerSpectrum
 	}
 
+	// Clamp the dynamic range once every frame is known, so the floor is
+	// shared across the whole spectrogram
+	if s.DBScale {
+		s.ApplyDBFloor(spectrogramData)
+	}
+
+	// Normalize
+	if err := s.NormalizeSpectrogram(spectrogramData); err != nil {
+		return nil, err
+	}
+
 	// Calculate time and frequency points
 	timePoints := make([]float64, numFrames)
 	for i := 0; i < numFrames; i++ {
@@ -250,79 +343,24 @@ func (s *SpectralAnalyzerImpl) ComputeSpectrogram(data *AudioData, windowSize, h
 	}, nil
 }
 
-// SaveSpectrogramImage saves a spectrogram as an image
-func (s *SpectralAnalyzerImpl) SaveSpectrogramImage(spectrogram *Spectrogram, filePath string) error {
-	// Check if spectrogram is valid
-	if spectrogram == nil || len(spectrogram.Data) == 0 || len(spectrogram.Data[0]) == 0 {
-		return fmt.Errorf("invalid spectrogram data")
-	}
-
-	// Create a new image
-	width := spectrogram.TimeBins
-	height := spectrogram.FreqBins
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-
-	// Define a color palette (from blue to red)
-	getColor := func(value float64) color.RGBA {
-		// Map value from [0,1] to a color
-		// Blue (0,0,255) -> Cyan (0,255,255) -> Green (0,255,0) -> Yellow (255,255,0) -> Red (255,0,0)
-		r, g, b := 0, 0, 0
-
-		if value < 0.25 {
-			// Blue to Cyan
-			v := value * 4
-			b = 255
-			g = int(v * 255)
-		} else if value < 0.5 {
-			// Cyan to Green
-			v := (value - 0.25) * 4
-			g = 255
-			b = 255 - int(v*255)
-		} else if value < 0.75 {
-			// Green to Yellow
-			v := (value - 0.5) * 4
-			g = 255
-			r = int(v * 255)
-		} else {
-			// Yellow to Red
-			v := (value - 0.75) * 4
-			r = 255
-			g = 255 - int(v*255)
-		}
-
-		return color.RGBA{uint8(r), uint8(g), uint8(b), 255}
-	}
-
-	// Fill the image with spectrogram data
-	// Note: Frequency axis is typically displayed with low frequencies at the bottom
-	for t := 0; t < width; t++ {
-		for f := 0; f < height; f++ {
-			// Get the spectrogram value (ensure it's in [0,1] range)
-			value := spectrogram.Data[t][height-f-1] // Invert frequency axis
-			if value < 0 {
-				value = 0
-			}
-			if value > 1 {
-				value = 1
-			}
-
-			// Set the pixel color
-			img.Set(t, f, getColor(value))
-		}
+// validateFrameSizes checks that the window and hop sizes can be analysed
+func (s *SpectralAnalyzerImpl) validateFrameSizes() error {
+	if !isPowerOfTwo(s.WindowSize) {
+		return fmt.Errorf("window size must be a power of two, got %d", s.WindowSize)
 	}
-
-	// Create the output file
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create image file: %w", err)
+	if s.HopSize <= 0 || s.HopSize > s.WindowSize {
+		return fmt.Errorf("hop size must be in [1, %d], got %d", s.WindowSize, s.HopSize)
 	}
-	defer file.Close()
+	return nil
+}
 
-	// Encode and save the image
-	err = png.Encode(file, img)
+// SaveSpectrogramImage saves a spectrogram as an image with the default
+// colormap, one pixel per time and frequency bin
+func (s *SpectralAnalyzerImpl) SaveSpectrogramImage(spectrogram *Spectrogram, filePath string) error {
+	img, err := NewSpectrogramRenderer().Render(spectrogram, nil)
 	if err != nil {
-		return fmt.Errorf("failed to encode image: %w", err)
+		return err
 	}
 
-	return nil
+	return SavePNG(img, filePath)
 }
@@ -19,7 +19,10 @@ func TestWindowFunctions(t *testing.T) {
 
 	// Test Hamming window
 	analyzer.WindowType = "hamming"
-	hammingFrame := analyzer.ApplyWindow(frame)
+	hammingFrame, err := analyzer.ApplyWindow(frame)
+	if err != nil {
+		t.Fatalf("Failed to apply Hamming window: %v", err)
+	}
 
 	// Check that the window is applied correctly
 	// Hamming window should have values between 0.08 and 1.0
@@ -39,7 +42,10 @@ func TestWindowFunctions(t *testing.T) {
 
 	// Test Hann window
 	analyzer.WindowType = "hann"
-	hannFrame := analyzer.ApplyWindow(frame)
+	hannFrame, err := analyzer.ApplyWindow(frame)
+	if err != nil {
+		t.Fatalf("Failed to apply Hann window: %v", err)
+	}
 
 	// Check that the window is applied correctly
 	// Hann window should have values between 0.0 and 1.0
@@ -50,6 +56,75 @@ func TestWindowFunctions(t *testing.T) {
 	}
 }
 
+func TestAdditionalWindowFunctions(t *testing.T) {
+	// Create a spectral analyzer
+	analyzer := NewSpectralAnalyzer()
+
+	// Every window should be symmetric, peak near 1 in the middle and stay within range
+	windowTypes := []WindowType{WindowKaiser, WindowBlackmanHarris, WindowGaussian, WindowFlatTop}
+	for _, windowType := range windowTypes {
+		analyzer.WindowType = windowType
+		window, err := analyzer.WindowCoefficients(1025)
+		if err != nil {
+			t.Fatalf("%s: failed to compute window: %v", windowType, err)
+		}
+
+		for i := 0; i < len(window)/2; i++ {
+			if math.Abs(window[i]-window[len(window)-1-i]) > 1e-10 {
+				t.Errorf("%s window not symmetric at index %d: %f vs %f", windowType, i, window[i], window[len(window)-1-i])
+				break
+			}
+		}
+		if math.Abs(window[512]-1.0) > 1e-3 {
+			t.Errorf("%s window center expected 1.0, got %f", windowType, window[512])
+		}
+		for i, val := range window {
+			// Flat-top windows dip slightly below zero at the edges
+			if val < -0.1 || val > 1.0+1e-6 {
+				t.Errorf("%s window value out of range at index %d: %f", windowType, i, val)
+				break
+			}
+		}
+	}
+
+	// Kaiser with beta 0 is rectangular
+	analyzer.WindowType = WindowKaiser
+	analyzer.KaiserBeta = 0
+	window, err := analyzer.WindowCoefficients(16)
+	if err != nil {
+		t.Fatalf("Failed to compute Kaiser window: %v", err)
+	}
+	for i, val := range window {
+		if math.Abs(val-1.0) > 1e-12 {
+			t.Errorf("Kaiser beta 0 expected 1.0 at index %d, got %f", i, val)
+		}
+	}
+
+	// Unknown window types and mismatched frames are rejected
+	analyzer.WindowType = "hamm"
+	if _, err := analyzer.ApplyWindow(make([]float64, analyzer.WindowSize)); err == nil {
+		t.Errorf("Expected error for unknown window type")
+	}
+	if _, err := ParseWindowType("hamm"); err == nil {
+		t.Errorf("Expected error parsing unknown window type")
+	}
+	analyzer.WindowType = WindowHann
+	if _, err := analyzer.ApplyWindow(make([]float64, analyzer.WindowSize-1)); err == nil {
+		t.Errorf("Expected error for mismatched frame length")
+	}
+
+	// Window sizes must be powers of two
+	audioData := &AudioData{
+		Samples:    make([]float64, 4096),
+		SampleRate: 8000,
+		Channels:   1,
+		Duration:   0.512,
+	}
+	if _, err := analyzer.ComputeSpectrogram(audioData, 1000, 500); err == nil {
+		t.Errorf("Expected error for non power-of-two window size")
+	}
+}
+
 func TestFFT(t *testing.T) {
 	// Create a spectral analyzer
 	analyzer := NewSpectralAnalyzer()
@@ -113,22 +188,35 @@ func TestFFT(t *testing.T) {
 	}
 }
 
-func TestLogScale(t *testing.T) {
+func TestDBScale(t *testing.T) {
 	// Create a spectral analyzer
 	analyzer := NewSpectralAnalyzer()
 
 	// Create a test spectrum
-	spectrum := []float64{1.0, 10.0, 100.0, 1000.0}
+	spectrum := []float64{1.0, 10.0, 100.0, 1000.0, 0.0}
+
+	// Convert to decibels
+	dbSpectrum := analyzer.PowerToDB(spectrum)
+
+	// Check that the conversion is applied correctly, with silence clamped
+	expectedDBSpectrum := []float64{0.0, 10.0, 20.0, 30.0, -100.0}
+	for i, val := range dbSpectrum {
+		if math.Abs(val-expectedDBSpectrum[i]) > 1e-10 {
+			t.Errorf("Expected dB value %f at index %d, got %f", expectedDBSpectrum[i], i, val)
+		}
+	}
 
-	// Apply log scale (base 10)
-	analyzer.LogScaleBase = 10.0
-	logSpectrum := analyzer.ApplyLogScale(spectrum)
+	// Apply a 25 dB floor across two frames
+	analyzer.TopDB = 25.0
+	data := [][]float64{{0.0, 10.0}, {20.0, 30.0}}
+	analyzer.ApplyDBFloor(data)
 
-	// Check that the log scale is applied correctly
-	expectedLogSpectrum := []float64{0.0, 1.0, 2.0, 3.0}
-	for i, val := range logSpectrum {
-		if math.Abs(val-expectedLogSpectrum[i]) > 1e-10 {
-			t.Errorf("Expected log value %f at index %d, got %f", expectedLogSpectrum[i], i, val)
+	expectedFloored := [][]float64{{0.0, 5.0}, {15.0, 25.0}}
+	for i := range data {
+		for j, val := range data[i] {
+			if math.Abs(val-expectedFloored[i][j]) > 1e-10 {
+				t.Errorf("Expected floored value %f at [%d][%d], got %f", expectedFloored[i][j], i, j, val)
+			}
 		}
 	}
 }
@@ -153,6 +241,47 @@ func TestNormalization(t *testing.T) {
 	}
 }
 
+func TestNormalizationModes(t *testing.T) {
+	// Create a spectral analyzer
+	analyzer := NewSpectralAnalyzer()
+
+	// A quiet frame followed by a loud one
+	newData := func() [][]float64 {
+		return [][]float64{{1.0, 2.0}, {4.0, 8.0}}
+	}
+
+	tests := []struct {
+		mode     NormalizationMode
+		expected [][]float64
+	}{
+		{NormalizeNone, [][]float64{{1.0, 2.0}, {4.0, 8.0}}},
+		{NormalizePerFrame, [][]float64{{0.5, 1.0}, {0.5, 1.0}}},
+		{NormalizeGlobal, [][]float64{{0.125, 0.25}, {0.5, 1.0}}},
+		{NormalizePercentile, [][]float64{{0.25, 0.5}, {1.0, 1.0}}},
+	}
+
+	analyzer.NormalizePercentile = 75.0
+	for _, test := range tests {
+		analyzer.Normalization = test.mode
+		data := newData()
+		if err := analyzer.NormalizeSpectrogram(data); err != nil {
+			t.Fatalf("%s: failed to normalize: %v", test.mode, err)
+		}
+		for i := range data {
+			for j, val := range data[i] {
+				if math.Abs(val-test.expected[i][j]) > 1e-10 {
+					t.Errorf("%s: expected %f at [%d][%d], got %f", test.mode, test.expected[i][j], i, j, val)
+				}
+			}
+		}
+	}
+
+	// Unknown modes are rejected
+	if _, err := ParseNormalizationMode("max"); err == nil {
+		t.Errorf("Expected error for unknown normalization mode")
+	}
+}
+
 func TestSpectrogramImage(t *testing.T) {
 	// Create a spectral analyzer
 	analyzer := NewSpectralAnalyzer()
@@ -206,3 +335,109 @@ func TestSpectrogramImage(t *testing.T) {
 		t.Errorf("Spectrogram image file was not created")
 	}
 }
+
+func TestInverseSTFTRoundTrip(t *testing.T) {
+	// Create a spectral analyzer
+	analyzer := NewSpectralAnalyzer()
+	analyzer.WindowType = "hann"
+
+	// Create a two-tone signal
+	sampleRate := 22050
+	samples := make([]float64, sampleRate)
+	for i := range samples {
+		time := float64(i) / float64(sampleRate)
+		samples[i] = 0.5*math.Sin(2*math.Pi*440*time) + 0.25*math.Sin(2*math.Pi*1500*time)
+	}
+	audioData := &AudioData{
+		Samples:    samples,
+		SampleRate: sampleRate,
+		Channels:   1,
+		Duration:   1.0,
+	}
+
+	// Forward and inverse transform
+	stft, err := analyzer.ComputeSTFT(audioData, 1024, 256)
+	if err != nil {
+		t.Fatalf("Failed to compute STFT: %v", err)
+	}
+	reconstructed, err := analyzer.InverseSTFT(stft)
+	if err != nil {
+		t.Fatalf("Failed to invert STFT: %v", err)
+	}
+
+	// Compare the fully overlapped region (the edges are attenuated by the window)
+	for i := 1024; i < len(reconstructed.Samples)-1024; i++ {
+		if math.Abs(reconstructed.Samples[i]-samples[i]) > 1e-6 {
+			t.Fatalf("Reconstruction error at sample %d: expected %f, got %f", i, samples[i], reconstructed.Samples[i])
+		}
+	}
+
+	// Inversion uses the STFT's own window and leaves the analyzer alone
+	analyzer.WindowType = WindowBlackman
+	analyzer.WindowSize, analyzer.HopSize, analyzer.SampleRate = 512, 128, 44100
+	again, err := analyzer.InverseSTFT(stft)
+	if err != nil {
+		t.Fatalf("Failed to invert STFT: %v", err)
+	}
+	if analyzer.WindowType != WindowBlackman || analyzer.WindowSize != 512 || analyzer.HopSize != 128 || analyzer.SampleRate != 44100 {
+		t.Errorf("Expected the analyzer to be unchanged, got %s %d/%d at %d Hz",
+			analyzer.WindowType, analyzer.WindowSize, analyzer.HopSize, analyzer.SampleRate)
+	}
+	for i := range again.Samples {
+		if again.Samples[i] != reconstructed.Samples[i] {
+			t.Fatalf("Expected the same reconstruction with another analyzer window, sample %d differs", i)
+		}
+	}
+}
+
+func TestGriffinLim(t *testing.T) {
+	// Create a spectral analyzer with a globally normalized dB spectrogram
+	analyzer := NewSpectralAnalyzer()
+	analyzer.WindowType = "hann"
+
+	// Create a sine wave at 1000 Hz
+	sampleRate := 22050
+	samples := make([]float64, sampleRate/2)
+	for i := range samples {
+		samples[i] = 0.5 * math.Sin(2*math.Pi*1000*float64(i)/float64(sampleRate))
+	}
+	audioData := &AudioData{
+		Samples:    samples,
+		SampleRate: sampleRate,
+		Channels:   1,
+		Duration:   0.5,
+	}
+
+	spectrogram, err := analyzer.ComputeSpectrogram(audioData, 512, 128)
+	if err != nil {
+		t.Fatalf("Failed to compute spectrogram: %v", err)
+	}
+
+	// Reconstruct from the magnitude-only spectrogram
+	reconstructed, err := analyzer.ReconstructAudio(spectrogram, 16)
+	if err != nil {
+		t.Fatalf("Failed to reconstruct audio: %v", err)
+	}
+
+	// The reconstruction should carry the same dominant frequency
+	check, err := analyzer.ComputeSpectrogram(reconstructed, 512, 128)
+	if err != nil {
+		t.Fatalf("Failed to compute spectrogram of reconstruction: %v", err)
+	}
+	middleFrame := check.Data[check.TimeBins/2]
+	peakBin := 0
+	for i, val := range middleFrame {
+		if val > middleFrame[peakBin] {
+			peakBin = i
+		}
+	}
+	if math.Abs(check.FreqPoints[peakBin]-1000) > 50 {
+		t.Errorf("Expected peak frequency around 1000 Hz, got %f Hz", check.FreqPoints[peakBin])
+	}
+
+	// Per-frame normalized spectrograms cannot be inverted
+	analyzer.Normalization = NormalizePerFrame
+	if _, err := analyzer.ReconstructAudio(spectrogram, 1); err == nil {
+		t.Errorf("Expected error reconstructing a per-frame normalized spectrogram")
+	}
+}
@@ -0,0 +1,227 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// Synthesizer renders deterministic mono test signals. Every call that draws
+// random numbers seeds a fresh generator with Seed, so equal settings always
+// produce equal samples regardless of call order.
+type Synthesizer struct {
+	SampleRate int
+	Seed       int64
+	Fade       float64 // Raised-cosine fade in and out of each note or burst (seconds)
+}
+
+// NewSynthesizer creates a synthesizer with default settings
+func NewSynthesizer(sampleRate int, seed int64) *Synthesizer {
+	return &Synthesizer{
+		SampleRate: sampleRate,
+		Seed:       seed,
+		Fade:       0.01,
+	}
+}
+
+// Sweep renders a sine sweeping exponentially from startFreq to endFreq
+func (s *Synthesizer) Sweep(duration, startFreq, endFreq, amplitude float64) (*AudioData, error) {
+	if startFreq <= 0 || endFreq <= 0 {
+		return nil, fmt.Errorf("sweep frequencies must be positive")
+	}
+	data, err := s.silence(duration)
+	if err != nil {
+		return nil, err
+	}
+
+	// Integrate the instantaneous frequency f(t) = start * (end/start)^(t/duration)
+	rate := math.Log(endFreq/startFreq) / duration
+	for i := range data.Samples {
+		t := float64(i) / float64(s.SampleRate)
+		phase := 2 * math.Pi * startFreq * t
+		if rate != 0 {
+			phase = 2 * math.Pi * startFreq * (math.Exp(rate*t) - 1) / rate
+		}
+		data.Samples[i] = amplitude * s.envelope(t, duration) * math.Sin(phase)
+	}
+	return data, nil
+}
+
+// Chords renders major triads on roots, one every chordLength seconds,
+// cycling through roots until duration is filled
+func (s *Synthesizer) Chords(duration, chordLength float64, roots []float64, amplitude float64) (*AudioData, error) {
+	if len(roots) == 0 || chordLength <= 0 {
+		return nil, fmt.Errorf("chords need roots and a positive chord length")
+	}
+	data, err := s.silence(duration)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range data.Samples {
+		t := float64(i) / float64(s.SampleRate)
+		chord := int(t / chordLength)
+		root := roots[chord%len(roots)]
+		gain := amplitude / 3 * s.envelope(t-float64(chord)*chordLength, chordLength)
+		for _, interval := range []float64{0, 4, 7} {
+			data.Samples[i] += gain * math.Sin(2*math.Pi*root*math.Pow(2, interval/12)*t)
+		}
+	}
+	return data, nil
+}
+
+// NoiseBursts renders white noise bursts of burstLength seconds starting
+// every interval seconds
+func (s *Synthesizer) NoiseBursts(duration, interval, burstLength, amplitude float64) (*AudioData, error) {
+	if interval <= 0 || burstLength <= 0 {
+		return nil, fmt.Errorf("noise bursts need a positive interval and length")
+	}
+	data, err := s.silence(duration)
+	if err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(s.Seed))
+	for i := range data.Samples {
+		t := float64(i) / float64(s.SampleRate)
+		position := math.Mod(t, interval)
+		if position < burstLength {
+			data.Samples[i] = amplitude * s.envelope(position, burstLength) * (2*rng.Float64() - 1)
+		}
+	}
+	return data, nil
+}
+
+// Noise renders continuous white noise
+func (s *Synthesizer) Noise(duration, amplitude float64) (*AudioData, error) {
+	data, err := s.silence(duration)
+	if err != nil {
+		return nil, err
+	}
+
+	rng := rand.New(rand.NewSource(s.Seed))
+	for i := range data.Samples {
+		data.Samples[i] = amplitude * (2*rng.Float64() - 1)
+	}
+	return data, nil
+}
+
+// Clicks renders a click track at bpm: 10 ms decaying bursts of a 2 kHz tone
+func (s *Synthesizer) Clicks(duration, bpm, amplitude float64) (*AudioData, error) {
+	if bpm <= 0 {
+		return nil, fmt.Errorf("tempo must be positive")
+	}
+	data, err := s.silence(duration)
+	if err != nil {
+		return nil, err
+	}
+
+	clickLength := s.SampleRate / 100
+	for beat := 0.0; beat < duration; beat += 60 / bpm {
+		start := int(beat * float64(s.SampleRate))
+		for i := 0; i < clickLength && start+i < len(data.Samples); i++ {
+			decay := math.Exp(-float64(i) / float64(clickLength) * 5)
+			data.Samples[start+i] = amplitude * decay * math.Sin(2*math.Pi*2000*float64(i)/float64(s.SampleRate))
+		}
+	}
+	return data, nil
+}
+
+// Mix sums signals sample by sample. The result is as long as the longest
+// signal; all signals must share a sample rate and channel count.
+func Mix(signals ...*AudioData) (*AudioData, error) {
+	if len(signals) == 0 {
+		return nil, fmt.Errorf("nothing to mix")
+	}
+
+	first := signals[0]
+	mixed := &AudioData{SampleRate: first.SampleRate, Channels: first.Channels}
+	for _, signal := range signals {
+		if signal.SampleRate != first.SampleRate || signal.Channels != first.Channels {
+			return nil, fmt.Errorf("cannot mix %d Hz/%d channels with %d Hz/%d channels",
+				signal.SampleRate, signal.Channels, first.SampleRate, first.Channels)
+		}
+		if len(signal.Samples) > len(mixed.Samples) {
+			mixed.Samples = append(mixed.Samples, make([]float64, len(signal.Samples)-len(mixed.Samples))...)
+		}
+		for i, sample := range signal.Samples {
+			mixed.Samples[i] += sample
+		}
+	}
+	mixed.Duration = float64(len(mixed.Samples)/mixed.Channels) / float64(mixed.SampleRate)
+	return mixed, nil
+}
+
+// Concat joins signals end to end. All signals must share a sample rate and
+// channel count.
+func Concat(signals ...*AudioData) (*AudioData, error) {
+	if len(signals) == 0 {
+		return nil, fmt.Errorf("nothing to concatenate")
+	}
+
+	first := signals[0]
+	joined := &AudioData{SampleRate: first.SampleRate, Channels: first.Channels}
+	for _, signal := range signals {
+		if signal.SampleRate != first.SampleRate || signal.Channels != first.Channels {
+			return nil, fmt.Errorf("cannot concatenate %d Hz/%d channels with %d Hz/%d channels",
+				signal.SampleRate, signal.Channels, first.SampleRate, first.Channels)
+		}
+		joined.Samples = append(joined.Samples, signal.Samples...)
+	}
+	joined.Duration = float64(len(joined.Samples)/joined.Channels) / float64(joined.SampleRate)
+	return joined, nil
+}
+
+// Excerpt copies the audio between start and end seconds, clamped to the
+// signal
+func Excerpt(data *AudioData, start, end float64) (*AudioData, error) {
+	if data == nil || data.SampleRate <= 0 || data.Channels <= 0 {
+		return nil, fmt.Errorf("invalid audio data")
+	}
+
+	frames := len(data.Samples) / data.Channels
+	first := min(frames, max(0, int(start*float64(data.SampleRate))))
+	last := min(frames, max(first, int(end*float64(data.SampleRate))))
+	samples := make([]float64, (last-first)*data.Channels)
+	copy(samples, data.Samples[first*data.Channels:last*data.Channels])
+
+	return &AudioData{
+		Samples:    samples,
+		SampleRate: data.SampleRate,
+		Channels:   data.Channels,
+		Duration:   float64(last-first) / float64(data.SampleRate),
+	}, nil
+}
+
+// silence allocates duration seconds of mono silence
+func (s *Synthesizer) silence(duration float64) (*AudioData, error) {
+	if s.SampleRate <= 0 {
+		return nil, fmt.Errorf("invalid sample rate: %d", s.SampleRate)
+	}
+	if duration <= 0 {
+		return nil, fmt.Errorf("duration must be positive")
+	}
+
+	return &AudioData{
+		Samples:    make([]float64, int(duration*float64(s.SampleRate))),
+		SampleRate: s.SampleRate,
+		Channels:   1,
+		Duration:   duration,
+	}, nil
+}
+
+// envelope returns the raised-cosine fade gain at position t of a note
+// lasting length seconds
+func (s *Synthesizer) envelope(t, length float64) float64 {
+	fade := min(s.Fade, length/2)
+	if fade <= 0 {
+		return 1
+	}
+	switch {
+	case t < fade:
+		return 0.5 - 0.5*math.Cos(math.Pi*t/fade)
+	case t > length-fade:
+		return 0.5 - 0.5*math.Cos(math.Pi*(length-t)/fade)
+	}
+	return 1
+}
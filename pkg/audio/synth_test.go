@@ -0,0 +1,79 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestSynthesizer(t *testing.T) {
+	synth := NewSynthesizer(8000, 5)
+
+	// Noise is reproducible for a seed and differs between seeds
+	first, err := synth.NoiseBursts(1, 0.25, 0.1, 0.5)
+	if err != nil {
+		t.Fatalf("Failed to synthesize noise: %v", err)
+	}
+	second, _ := synth.NoiseBursts(1, 0.25, 0.1, 0.5)
+	for i := range first.Samples {
+		if first.Samples[i] != second.Samples[i] {
+			t.Fatalf("Sample %d differs between runs", i)
+		}
+	}
+	other, _ := NewSynthesizer(8000, 6).NoiseBursts(1, 0.25, 0.1, 0.5)
+	same := true
+	for i := range first.Samples {
+		same = same && first.Samples[i] == other.Samples[i]
+	}
+	if same {
+		t.Error("Expected different seeds to give different noise")
+	}
+
+	// Bursts are silent between intervals
+	if first.Samples[int(0.2*8000)] != 0 {
+		t.Error("Expected silence between bursts")
+	}
+
+	// A sweep from 100 to 1000 Hz crosses zero about 2 * mean frequency times
+	sweep, err := synth.Sweep(1, 100, 1000, 1)
+	if err != nil {
+		t.Fatalf("Failed to synthesize sweep: %v", err)
+	}
+	crossings := 0
+	for i := 1; i < len(sweep.Samples); i++ {
+		if (sweep.Samples[i-1] < 0) != (sweep.Samples[i] < 0) {
+			crossings++
+		}
+	}
+	expected := 2 * 900 / math.Log(10) // Mean of an exponential sweep
+	if math.Abs(float64(crossings)-expected) > 0.02*expected {
+		t.Errorf("Expected about %.0f zero crossings, got %d", expected, crossings)
+	}
+
+	// Mix pads to the longest signal, Concat appends
+	clicks, _ := synth.Clicks(2, 120, 1)
+	mixed, err := Mix(sweep, clicks)
+	if err != nil {
+		t.Fatalf("Failed to mix: %v", err)
+	}
+	if len(mixed.Samples) != 16000 || mixed.Duration != 2 {
+		t.Errorf("Expected 2 seconds of mix, got %d samples", len(mixed.Samples))
+	}
+	joined, err := Concat(sweep, clicks)
+	if err != nil {
+		t.Fatalf("Failed to concatenate: %v", err)
+	}
+	if len(joined.Samples) != 24000 || joined.Duration != 3 {
+		t.Errorf("Expected 3 seconds joined, got %d samples", len(joined.Samples))
+	}
+	excerpt, err := Excerpt(joined, 1, 1.5)
+	if err != nil || len(excerpt.Samples) != 4000 || excerpt.Samples[0] != clicks.Samples[0] {
+		t.Errorf("Expected the first half second of clicks, got %d samples (err %v)", len(excerpt.Samples), err)
+	}
+
+	if _, err := Mix(sweep, &AudioData{SampleRate: 44100, Channels: 1}); err == nil {
+		t.Error("Expected an error mixing different sample rates")
+	}
+	if _, err := synth.Sweep(0, 100, 1000, 1); err == nil {
+		t.Error("Expected an error for zero duration")
+	}
+}
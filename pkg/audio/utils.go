@@ -79,6 +79,29 @@ func (u *AudioUtils) LoadAndPreprocess(filePath string, targetSampleRate int, co
 	return audioData, nil
 }
 
+// SaveWAV writes audio data to a WAV file using the given sample format
+func (u *AudioUtils) SaveWAV(filePath string, data *AudioData, sampleFormat WAVSampleFormat) error {
+	// Create the output file
+	file, err := os.Create(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+
+	// Encode the audio data
+	encoder := NewWAVEncoder()
+	encoder.SampleFormat = sampleFormat
+	if err := encoder.Encode(context.Background(), file, data); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to encode audio: %w", err)
+	}
+
+	// Close flushes the last writes, so its error means an incomplete file
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close file: %w", err)
+	}
+	return nil
+}
+
 // CalculateRMS calculates the Root Mean Square (RMS) of audio samples
 func (u *AudioUtils) CalculateRMS(samples []float64) float64 {
 	if len(samples) == 0 {
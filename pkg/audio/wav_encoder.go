@@ -0,0 +1,146 @@
+package audio
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// WAVSampleFormat selects how samples are stored in an encoded WAV file
+type WAVSampleFormat string
+
+const (
+	PCM16   WAVSampleFormat = "pcm16"   // 16-bit signed integer PCM
+	PCM24   WAVSampleFormat = "pcm24"   // 24-bit signed integer PCM
+	Float32 WAVSampleFormat = "float32" // 32-bit IEEE float
+)
+
+// WAV format tags from the fmt chunk
+const (
+	wavFormatPCM       = 1
+	wavFormatIEEEFloat = 3
+)
+
+// WAVEncoder implements the Encoder interface for WAV files
+type WAVEncoder struct {
+	SampleFormat WAVSampleFormat // Sample encoding to write
+}
+
+// NewWAVEncoder creates a new WAV encoder writing 16-bit PCM
+func NewWAVEncoder() *WAVEncoder {
+	return &WAVEncoder{
+		SampleFormat: PCM16,
+	}
+}
+
+// ParseWAVSampleFormat converts a string such as "pcm24" into a WAVSampleFormat
+func ParseWAVSampleFormat(name string) (WAVSampleFormat, error) {
+	switch format := WAVSampleFormat(name); format {
+	case PCM16, PCM24, Float32:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported WAV sample format: %s (expected pcm16, pcm24 or float32)", name)
+	}
+}
+
+// Encode writes audio data as a WAV file in the configured sample format
+func (e *WAVEncoder) Encode(ctx context.Context, writer io.Writer, data *AudioData) error {
+	if data == nil || data.Channels <= 0 || data.SampleRate <= 0 {
+		return fmt.Errorf("invalid audio data")
+	}
+	if len(data.Samples)%data.Channels != 0 {
+		return fmt.Errorf("sample count %d is not a multiple of channel count %d", len(data.Samples), data.Channels)
+	}
+
+	// Resolve the sample layout
+	var bitDepth, formatTag int
+	switch e.SampleFormat {
+	case PCM16, "":
+		bitDepth, formatTag = 16, wavFormatPCM
+	case PCM24:
+		bitDepth, formatTag = 24, wavFormatPCM
+	case Float32:
+		bitDepth, formatTag = 32, wavFormatIEEEFloat
+	default:
+		return fmt.Errorf("unsupported WAV sample format: %s", e.SampleFormat)
+	}
+
+	bytesPerSample := bitDepth / 8
+	blockAlign := data.Channels * bytesPerSample
+	dataSize := len(data.Samples) * bytesPerSample
+
+	// Chunks are word aligned, so an odd-sized data chunk is followed by a
+	// pad byte that its size does not count
+	padSize := dataSize % 2
+
+	// Non-PCM files carry an extended fmt chunk and a fact chunk
+	fmtSize := 16
+	headerSize := 4 + (8 + fmtSize) + 8
+	if formatTag != wavFormatPCM {
+		fmtSize = 18
+		headerSize = 4 + (8 + fmtSize) + (8 + 4) + 8
+	}
+
+	buf := bufio.NewWriter(writer)
+
+	// RIFF header
+	buf.WriteString("RIFF")
+	binary.Write(buf, binary.LittleEndian, uint32(headerSize+dataSize+padSize))
+	buf.WriteString("WAVE")
+
+	// fmt chunk
+	buf.WriteString("fmt ")
+	binary.Write(buf, binary.LittleEndian, uint32(fmtSize))
+	binary.Write(buf, binary.LittleEndian, uint16(formatTag))
+	binary.Write(buf, binary.LittleEndian, uint16(data.Channels))
+	binary.Write(buf, binary.LittleEndian, uint32(data.SampleRate))
+	binary.Write(buf, binary.LittleEndian, uint32(data.SampleRate*blockAlign))
+	binary.Write(buf, binary.LittleEndian, uint16(blockAlign))
+	binary.Write(buf, binary.LittleEndian, uint16(bitDepth))
+	if formatTag != wavFormatPCM {
+		// No extension bytes
+		binary.Write(buf, binary.LittleEndian, uint16(0))
+
+		// fact chunk with the number of sample frames
+		buf.WriteString("fact")
+		binary.Write(buf, binary.LittleEndian, uint32(4))
+		binary.Write(buf, binary.LittleEndian, uint32(len(data.Samples)/data.Channels))
+	}
+
+	// data chunk
+	buf.WriteString("data")
+	binary.Write(buf, binary.LittleEndian, uint32(dataSize))
+
+	// Convert float64 samples in [-1.0, 1.0], clipping integer formats
+	sampleBytes := make([]byte, 4)
+	for _, sample := range data.Samples {
+		switch e.SampleFormat {
+		case PCM24:
+			sample = math.Max(-1.0, math.Min(1.0, sample))
+			value := int32(math.Round(sample * 8388607))
+			sampleBytes[0] = byte(value)
+			sampleBytes[1] = byte(value >> 8)
+			sampleBytes[2] = byte(value >> 16)
+		case Float32:
+			binary.LittleEndian.PutUint32(sampleBytes, math.Float32bits(float32(sample)))
+		default:
+			sample = math.Max(-1.0, math.Min(1.0, sample))
+			binary.LittleEndian.PutUint16(sampleBytes, uint16(int16(math.Round(sample*32767))))
+		}
+		if _, err := buf.Write(sampleBytes[:bytesPerSample]); err != nil {
+			return fmt.Errorf("error writing PCM data: %w", err)
+		}
+	}
+	if padSize > 0 {
+		buf.WriteByte(0)
+	}
+
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("error writing WAV data: %w", err)
+	}
+
+	return nil
+}
@@ -41,6 +41,10 @@ func (l *WAVLoader) Load(ctx context.Context, reader io.Reader, format AudioForm
 	sampleRate := int(audioFormat.SampleRate)
 	channels := int(audioFormat.NumChannels)
 	bitDepth := int(decoder.BitDepth)
+	isFloat := decoder.WavAudioFormat == wavFormatIEEEFloat
+	if isFloat && bitDepth != 32 {
+		return nil, fmt.Errorf("unsupported %d-bit float WAV file", bitDepth)
+	}
 
 	// Read all samples
 	decoder.FwdToPCM()
@@ -51,15 +55,27 @@ func (l *WAVLoader) Load(ctx context.Context, reader io.Reader, format AudioForm
 		return nil, fmt.Errorf("error reading PCM data: %w", err)
 	}
 
+	// The decoder counts the pad byte of an odd-sized data chunk and reads
+	// it as a partial sample, so keep only whole frames
+	bytesPerSample := (bitDepth + 7) / 8
+	if whole := int(decoder.PCMSize) / bytesPerSample / channels * channels; len(samplesInt.Data) > whole {
+		samplesInt.Data = samplesInt.Data[:whole]
+	}
+
 	// Calculate duration
 	numFrames := len(samplesInt.Data) / channels
 	duration := float64(numFrames) / float64(sampleRate)
 
-	// Convert int samples to float64 samples (normalized to [-1.0, 1.0])
+	// Convert int samples to float64 samples (normalized to [-1.0, 1.0]).
+	// The decoder reads float samples as the integers of their bits.
 	maxValue := math.Pow(2, float64(bitDepth-1))
 	samples := make([]float64, len(samplesInt.Data))
 	for i, sample := range samplesInt.Data {
-		samples[i] = float64(sample) / maxValue
+		if isFloat {
+			samples[i] = float64(math.Float32frombits(uint32(sample)))
+		} else {
+			samples[i] = float64(sample) / maxValue
+		}
 	}
 
 	return &AudioData{
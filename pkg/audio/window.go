@@ -0,0 +1,137 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+)
+
+// WindowType identifies a window function applied to frames before the FFT
+type WindowType string
+
+const (
+	WindowHamming        WindowType = "hamming"
+	WindowHann           WindowType = "hann"
+	WindowBlackman       WindowType = "blackman"
+	WindowRectangular    WindowType = "rectangular"
+	WindowKaiser         WindowType = "kaiser"          // Shape set by KaiserBeta
+	WindowBlackmanHarris WindowType = "blackman-harris" // 4-term, -92 dB sidelobes
+	WindowGaussian       WindowType = "gaussian"        // Width set by GaussianSigma
+	WindowFlatTop        WindowType = "flat-top"        // Accurate amplitudes, wide main lobe
+)
+
+// ParseWindowType converts a string such as "hann" into a WindowType
+func ParseWindowType(name string) (WindowType, error) {
+	switch windowType := WindowType(name); windowType {
+	case WindowHamming, WindowHann, WindowBlackman, WindowRectangular,
+		WindowKaiser, WindowBlackmanHarris, WindowGaussian, WindowFlatTop:
+		return windowType, nil
+	default:
+		return "", fmt.Errorf("unknown window type: %s", name)
+	}
+}
+
+// WindowCoefficients returns the analyzer's window function evaluated over n samples
+func (s *SpectralAnalyzerImpl) WindowCoefficients(n int) ([]float64, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("window size must be positive, got %d", n)
+	}
+
+	window := make([]float64, n)
+
+	// A single-sample window is always 1
+	if n == 1 {
+		window[0] = 1.0
+		return window, nil
+	}
+
+	N := float64(n - 1)
+	switch s.WindowType {
+	case WindowHamming:
+		// Hamming window: w(n) = 0.54 - 0.46 * cos(2π * n / (N-1))
+		for i := range window {
+			window[i] = 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/N)
+		}
+	case WindowHann:
+		// Hann window: w(n) = 0.5 * (1 - cos(2π * n / (N-1)))
+		for i := range window {
+			window[i] = 0.5 * (1 - math.Cos(2*math.Pi*float64(i)/N))
+		}
+	case WindowBlackman:
+		// Blackman window: w(n) = 0.42 - 0.5 * cos(2π * n / (N-1)) + 0.08 * cos(4π * n / (N-1))
+		for i := range window {
+			x := float64(i)
+			window[i] = 0.42 - 0.5*math.Cos(2*math.Pi*x/N) + 0.08*math.Cos(4*math.Pi*x/N)
+		}
+	case WindowRectangular:
+		// Rectangular window (no windowing)
+		for i := range window {
+			window[i] = 1.0
+		}
+	case WindowKaiser:
+		// Kaiser window: w(n) = I0(β * sqrt(1 - (2n/(N-1) - 1)²)) / I0(β)
+		if s.KaiserBeta < 0 {
+			return nil, fmt.Errorf("kaiser beta must be non-negative, got %f", s.KaiserBeta)
+		}
+		denominator := besselI0(s.KaiserBeta)
+		for i := range window {
+			ratio := 2*float64(i)/N - 1
+			window[i] = besselI0(s.KaiserBeta*math.Sqrt(1-ratio*ratio)) / denominator
+		}
+	case WindowBlackmanHarris:
+		// 4-term Blackman-Harris window
+		cosineSum(window, []float64{0.35875, 0.48829, 0.14128, 0.01168})
+	case WindowGaussian:
+		// Gaussian window: w(n) = exp(-½ * ((n - (N-1)/2) / (σ * (N-1)/2))²)
+		if s.GaussianSigma <= 0 || s.GaussianSigma > 0.5 {
+			return nil, fmt.Errorf("gaussian sigma must be in (0, 0.5], got %f", s.GaussianSigma)
+		}
+		half := N / 2
+		for i := range window {
+			x := (float64(i) - half) / (s.GaussianSigma * half)
+			window[i] = math.Exp(-0.5 * x * x)
+		}
+	case WindowFlatTop:
+		// 5-term flat-top window (as in MATLAB's flattopwin)
+		cosineSum(window, []float64{0.21557895, 0.41663158, 0.277263158, 0.083578947, 0.006947368})
+	default:
+		return nil, fmt.Errorf("unknown window type: %s", s.WindowType)
+	}
+
+	return window, nil
+}
+
+// cosineSum fills window with a generalized cosine window
+// w(n) = a0 - a1*cos(2πn/(N-1)) + a2*cos(4πn/(N-1)) - ...
+func cosineSum(window []float64, coefficients []float64) {
+	N := float64(len(window) - 1)
+	for i := range window {
+		sign := 1.0
+		value := 0.0
+		for k, a := range coefficients {
+			value += sign * a * math.Cos(2*math.Pi*float64(k)*float64(i)/N)
+			sign = -sign
+		}
+		window[i] = value
+	}
+}
+
+// besselI0 computes the zeroth-order modified Bessel function of the first kind
+// using its power series
+func besselI0(x float64) float64 {
+	sum := 1.0
+	term := 1.0
+	halfX := x / 2
+	for k := 1; k < 50; k++ {
+		term *= (halfX / float64(k)) * (halfX / float64(k))
+		sum += term
+		if term < sum*1e-16 {
+			break
+		}
+	}
+	return sum
+}
+
+// isPowerOfTwo reports whether n is a positive power of two
+func isPowerOfTwo(n int) bool {
+	return n > 0 && n&(n-1) == 0
+}
@@ -0,0 +1,237 @@
+package db
+
+import (
+	"context"
+	"time"
+	"unsafe"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// CompactStats reports what a compaction reclaimed
+type CompactStats struct {
+	Vectors  int   // Vectors of deleted tracks removed from the graph
+	Postings int   // Postings of deleted tracks removed from the inverted index
+	Bytes    int64 // Estimated memory released
+}
+
+// Add accumulates the statistics of another compaction
+func (s *CompactStats) Add(other CompactStats) {
+	s.Vectors += other.Vectors
+	s.Postings += other.Postings
+	s.Bytes += other.Bytes
+}
+
+// Compactor is implemented by databases that delete lazily and reclaim the
+// space of deleted tracks on request
+type Compactor interface {
+	// Compact removes the tombstones of deleted tracks
+	Compact(ctx context.Context) (CompactStats, error)
+}
+
+// Garbage returns the fraction of the stored vectors and postings that
+// belong to deleted tracks
+func (d *MemoryDB) Garbage() float64 {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	total := len(d.vectors) + d.postingCount
+	if total == 0 {
+		return 0
+	}
+	return float64(d.deadVectors+d.deadPostings) / float64(total)
+}
+
+// Compact removes the vectors and postings of deleted tracks. The graph is
+// rebuilt from the live vectors if any were deleted; only the posting lists
+// of deleted tracks' hash values are touched. The graph is built without
+// holding the lock, so queries and writes continue meanwhile; if a write
+// lands during the build, it is redone with writers locked out.
+func (d *MemoryDB) Compact(ctx context.Context) (CompactStats, error) {
+	for attempt := 0; ; attempt++ {
+		if attempt == 0 {
+			d.mu.RLock()
+		} else {
+			d.mu.Lock()
+		}
+		version := d.version
+		config := d.config
+		var live []*fingerprint.Vector
+		var liveIDs []int
+		if d.deadVectors > 0 {
+			live = make([]*fingerprint.Vector, 0, len(d.vectors)-d.deadVectors)
+			for id, vector := range d.vectors {
+				if !d.dead[id] {
+					live = append(live, vector)
+					liveIDs = append(liveIDs, id)
+				}
+			}
+		}
+		var stored vectorView
+		if live != nil && d.exact != nil {
+			stored = d.exact.acquire()
+		}
+		tombstones := len(d.tombstones)
+		if attempt == 0 {
+			d.mu.RUnlock()
+			if live == nil && tombstones == 0 {
+				return CompactStats{}, nil
+			}
+		}
+
+		// Stored vectors are never modified, so they can be read unlocked.
+		// Exact vectors kept off the heap are copied to a new file without
+		// the dead ones; the acquired view keeps the old file open until
+		// then even if Load or another Compact replaces it.
+		var graph *hnswGraph
+		var exact *vectorFile
+		if live != nil {
+			vector := func(id int) []float32 {
+				return live[id].Data
+			}
+			if stored.file != nil {
+				exact = newVectorFile(stored.file.dim)
+				for _, id := range liveIDs {
+					exact.append(stored.vector(id))
+				}
+				stored.release()
+				vector = exact.vector
+			}
+			graph = newHNSWGraph(config.M, config.EfConstruction, vector, config.Metric.distance())
+			for id := range live {
+				if err := ctx.Err(); err != nil {
+					if attempt > 0 {
+						d.mu.Unlock()
+					}
+					if exact != nil {
+						exact.close()
+					}
+					return CompactStats{}, err
+				}
+				graph.insert(id)
+			}
+		}
+
+		if attempt == 0 {
+			d.mu.Lock()
+			if d.version != version {
+				// A write raced the rebuild
+				d.mu.Unlock()
+				if exact != nil {
+					exact.close()
+				}
+				continue
+			}
+		}
+		stats := d.compact(live, graph, exact)
+		d.mu.Unlock()
+		return stats, nil
+	}
+}
+
+// compact swaps in a graph rebuilt from the live vectors, if there is one,
+// together with the file of their exact data when quantizing, and purges
+// the postings of deleted tracks. The caller holds d.mu for writing.
+func (d *MemoryDB) compact(live []*fingerprint.Vector, graph *hnswGraph, exact *vectorFile) CompactStats {
+	var stats CompactStats
+
+	if graph != nil {
+		for id := range d.vectors {
+			if !d.dead[id] {
+				continue
+			}
+			stats.Vectors++
+			stats.Bytes += int64(unsafe.Sizeof(fingerprint.Vector{})) + int64(4*len(d.vectorData(id)))
+			for _, links := range d.graph.nodes[id].links {
+				stats.Bytes += int64(unsafe.Sizeof(links)) + int64(4*len(links))
+			}
+		}
+
+		if d.quantizer != nil {
+			size := d.quantizer.codeSize()
+			codes := make([]byte, 0, len(live)*size)
+			for id := range d.vectors {
+				if !d.dead[id] {
+					codes = append(codes, d.codes[id*size:(id+1)*size]...)
+				}
+			}
+			stats.Bytes += int64(len(d.codes) - len(codes))
+			d.codes = codes
+		}
+
+		d.vectors = live
+		if d.exact != nil {
+			d.exact.retire()
+		}
+		d.exact = exact
+		d.dead = make([]bool, len(live))
+		d.deadVectors = 0
+		d.graph = graph
+		d.graph.vector = d.vectorData
+	}
+
+	for trackID, values := range d.tombstones {
+		removed := d.purgePostings(trackID, values)
+		stats.Postings += removed
+		stats.Bytes += int64(removed) * int64(unsafe.Sizeof(fingerprint.Hash{}))
+	}
+
+	d.version++
+	return stats
+}
+
+// purgePostings removes the postings of a deleted track under the given hash
+// values and its tombstone, returning the number of postings removed. The
+// caller holds d.mu for writing.
+func (d *MemoryDB) purgePostings(trackID string, values []uint32) int {
+	removed := 0
+	for _, value := range values {
+		postings, exists := d.postings[value]
+		if !exists {
+			// Several of the track's hashes shared this value
+			continue
+		}
+		kept := postings[:0]
+		for _, posting := range postings {
+			if posting.TrackID != trackID {
+				kept = append(kept, posting)
+			}
+		}
+		removed += len(postings) - len(kept)
+		if len(kept) == 0 {
+			delete(d.postings, value)
+		} else {
+			d.postings[value] = kept
+		}
+	}
+
+	delete(d.tombstones, trackID)
+	d.deadPostings -= removed
+	d.postingCount -= removed
+	return removed
+}
+
+// AutoCompact compacts the database whenever at least threshold of its
+// vectors and postings belong to deleted tracks, checking every interval
+// until ctx is done. It blocks, so run it in its own goroutine. report, if
+// not nil, is called with the outcome of every compaction.
+func (d *MemoryDB) AutoCompact(ctx context.Context, interval time.Duration, threshold float64, report func(CompactStats, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if garbage := d.Garbage(); garbage == 0 || garbage < threshold {
+			continue
+		}
+		stats, err := d.Compact(ctx)
+		if report != nil {
+			report(stats, err)
+		}
+	}
+}
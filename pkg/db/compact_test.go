@@ -0,0 +1,359 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countTrack counts the search results and hash matches of a track
+func countTrack(t *testing.T, d interface {
+	VectorDB
+	HashIndex
+}, source *MemoryDB, trackID string) (int, int) {
+	t.Helper()
+	ctx := context.Background()
+	_, vectors, hashes, err := source.Export(ctx, trackID)
+	if err != nil {
+		t.Fatalf("Failed to export %s: %v", trackID, err)
+	}
+	results, err := d.Search(ctx, vectors, 5)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	matches, err := d.LookupHashes(ctx, hashes)
+	if err != nil {
+		t.Fatalf("Failed to look up hashes: %v", err)
+	}
+
+	found, matched := 0, 0
+	for _, result := range results {
+		if result.TrackID == trackID {
+			found++
+		}
+	}
+	for _, match := range matches {
+		if match.Reference.TrackID == trackID {
+			matched++
+		}
+	}
+	return found, matched
+}
+
+func TestDeleteTombstones(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 8
+	source := createTestDB(t, config, 6, 20)
+	d := createTestDB(t, config, 6, 20)
+
+	if found, matched := countTrack(t, d, source, "track-02"); found == 0 || matched == 0 {
+		t.Fatalf("Expected track-02 before deleting, found %d vectors and %d hashes", found, matched)
+	}
+	nodes := len(d.graph.nodes)
+	if err := d.Delete(ctx, "track-02"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+
+	// The graph is left alone and the track filtered out of every query
+	if len(d.graph.nodes) != nodes {
+		t.Errorf("Expected the graph to keep its %d nodes, has %d", nodes, len(d.graph.nodes))
+	}
+	if found, matched := countTrack(t, d, source, "track-02"); found != 0 || matched != 0 {
+		t.Errorf("Expected no trace of track-02, found %d vectors and %d hashes", found, matched)
+	}
+	if _, err := d.Get(ctx, "track-02"); err == nil {
+		t.Error("Expected deleted track to be gone")
+	}
+	if _, _, _, err := d.Export(ctx, "track-02"); err == nil {
+		t.Error("Expected deleted track not to be exported")
+	}
+	if garbage := d.Garbage(); garbage <= 0 || garbage >= 0.5 {
+		t.Errorf("Expected a sixth of the database to be garbage, got %.3f", garbage)
+	}
+
+	// Adding the track again brings back only the new copy
+	metadata, vectors, hashes, _ := source.Export(ctx, "track-02")
+	if err := d.Add(ctx, metadata, vectors[:5]); err != nil {
+		t.Fatalf("Failed to add again: %v", err)
+	}
+	if err := d.AddHashes(ctx, "track-02", hashes[:10]); err != nil {
+		t.Fatalf("Failed to add hashes again: %v", err)
+	}
+	_, exportedVectors, exportedHashes, _ := d.Export(ctx, "track-02")
+	if len(exportedVectors) != 5 || len(exportedHashes) != 10 {
+		t.Errorf("Expected the new copy only, got %d vectors and %d hashes", len(exportedVectors), len(exportedHashes))
+	}
+	want := 0
+	for _, query := range hashes {
+		for _, stored := range hashes[:10] {
+			if query.Value == stored.Value {
+				want++
+			}
+		}
+	}
+	if _, matched := countTrack(t, d, source, "track-02"); matched != want {
+		t.Errorf("Expected %d hash matches for the new copy, got %d", want, matched)
+	}
+}
+
+func TestSearchSkipsTombstones(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 8
+	d := createTestDB(t, config, 40, 20)
+	for i := 0; i < 36; i++ {
+		if err := d.Delete(ctx, fmt.Sprintf("track-%02d", i)); err != nil {
+			t.Fatalf("Failed to delete: %v", err)
+		}
+	}
+	path := filepath.Join(t.TempDir(), "library.idx")
+	if err := d.WriteIndex(ctx, path); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	mapped, err := OpenMappedDB(path)
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	defer mapped.Close()
+
+	// With nine in ten nodes deleted, the ef nearest are mostly dead, yet
+	// every query still gets k live results
+	_, query, _, _ := d.Export(ctx, "track-38")
+	for _, store := range []VectorDB{d, mapped} {
+		results, err := store.Search(ctx, query, 10)
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		if len(results) != 10*len(query) {
+			t.Errorf("Expected %d results, got %d", 10*len(query), len(results))
+		}
+		for _, result := range results {
+			if result.TrackID < "track-36" {
+				t.Fatalf("Expected only live tracks, got %s", result.TrackID)
+			}
+		}
+	}
+}
+
+func TestCompact(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 8
+	source := createTestDB(t, config, 6, 20)
+	d := createTestDB(t, config, 6, 20)
+
+	for _, trackID := range []string{"track-02", "track-04"} {
+		if err := d.Delete(ctx, trackID); err != nil {
+			t.Fatalf("Failed to delete %s: %v", trackID, err)
+		}
+	}
+
+	stats, err := d.Compact(ctx)
+	if err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if stats.Vectors != 40 || stats.Postings != 120 || stats.Bytes <= 0 {
+		t.Errorf("Expected 40 vectors and 120 postings reclaimed, got %+v", stats)
+	}
+	if len(d.vectors) != 80 || len(d.graph.nodes) != 80 || d.Garbage() != 0 {
+		t.Errorf("Expected 80 live vectors and no garbage, got %d vectors, %d nodes, %.3f garbage",
+			len(d.vectors), len(d.graph.nodes), d.Garbage())
+	}
+	for _, postings := range d.postings {
+		for _, posting := range postings {
+			if posting.TrackID == "track-02" || posting.TrackID == "track-04" {
+				t.Fatalf("Posting of %s survived compaction", posting.TrackID)
+			}
+		}
+	}
+
+	// The remaining tracks are intact and still found
+	for _, trackID := range []string{"track-00", "track-01", "track-03", "track-05"} {
+		_, wantVectors, wantHashes, _ := source.Export(ctx, trackID)
+		_, gotVectors, gotHashes, err := d.Export(ctx, trackID)
+		if err != nil || len(gotVectors) != len(wantVectors) || len(gotHashes) != len(wantHashes) {
+			t.Errorf("Track %s changed during compaction (err %v)", trackID, err)
+		}
+		if found, _ := countTrack(t, d, source, trackID); found == 0 {
+			t.Errorf("Track %s is no longer found after compaction", trackID)
+		}
+	}
+
+	if stats, err := d.Compact(ctx); err != nil || stats != (CompactStats{}) {
+		t.Errorf("Expected nothing to compact a second time, got %+v (err %v)", stats, err)
+	}
+}
+
+func TestCompactReleasesVectorFiles(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	config.Quantization = QuantizeInt8
+	d := createTestDB(t, config, 10, 5)
+
+	// Compact and Load replace the file of exact vectors and release the old
+	// one, and Close releases the last
+	replaced := d.exact
+	if err := d.Delete(ctx, "track-03"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, err := d.Compact(ctx); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	if d.exact == replaced || !isClosed(t, replaced) || isClosed(t, d.exact) {
+		t.Error("Expected Compact to close the replaced vector file only")
+	}
+
+	path := filepath.Join(t.TempDir(), "library.db")
+	if err := d.Save(ctx, path); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	replaced = d.exact
+	if err := d.Load(ctx, path); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if d.exact == replaced || !isClosed(t, replaced) || isClosed(t, d.exact) {
+		t.Error("Expected Load to close the replaced vector file only")
+	}
+
+	loaded := d.exact
+	if err := d.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if !isClosed(t, loaded) {
+		t.Error("Expected Close to close the vector file")
+	}
+}
+
+func TestTombstonesPersist(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 8
+	source := createTestDB(t, config, 4, 10)
+	d := createTestDB(t, config, 4, 10)
+	if err := d.Delete(ctx, "track-01"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+
+	// Deleted vectors are saved as such, deleted postings not at all
+	dir := t.TempDir()
+	path := filepath.Join(dir, "library.db")
+	if err := d.Save(ctx, path); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	loaded := NewMemoryDB(config)
+	if err := loaded.Load(ctx, path); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if loaded.deadVectors != 10 || loaded.deadPostings != 0 {
+		t.Errorf("Expected 10 dead vectors and no dead postings, got %d and %d", loaded.deadVectors, loaded.deadPostings)
+	}
+	if found, matched := countTrack(t, loaded, source, "track-01"); found != 0 || matched != 0 {
+		t.Errorf("Expected the deleted track to stay deleted, found %d vectors and %d hashes", found, matched)
+	}
+	if stats, err := loaded.Compact(ctx); err != nil || stats.Vectors != 10 {
+		t.Errorf("Expected to compact the loaded tombstones, got %+v (err %v)", stats, err)
+	}
+
+	// Mapped indexes skip them too
+	indexPath := filepath.Join(dir, "library.idx")
+	if err := d.WriteIndex(ctx, indexPath); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	mapped, err := OpenMappedDB(indexPath)
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	defer mapped.Close()
+	if err := mapped.Verify(); err != nil {
+		t.Fatalf("Failed to verify index: %v", err)
+	}
+	if found, matched := countTrack(t, mapped, source, "track-01"); found != 0 || matched != 0 {
+		t.Errorf("Expected the mapped index to skip the deleted track, found %d vectors and %d hashes", found, matched)
+	}
+	if found, _ := countTrack(t, mapped, source, "track-02"); found == 0 {
+		t.Error("Expected the mapped index to find a live track")
+	}
+}
+
+func TestCompactConcurrentWrites(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 8
+	d := createTestDB(t, config, 8, 30)
+	source := createTestDB(t, config, 1, 5)
+	for i := 0; i < 8; i += 2 {
+		d.Delete(ctx, fmt.Sprintf("track-%02d", i))
+	}
+
+	// Writes racing the rebuild are kept
+	_, vectors, _, _ := source.Export(ctx, "track-00")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			if err := d.Add(ctx, &TrackMetadata{ID: fmt.Sprintf("new-%02d", i)}, vectors); err != nil {
+				t.Errorf("Failed to add: %v", err)
+			}
+		}
+	}()
+	if _, err := d.Compact(ctx); err != nil {
+		t.Fatalf("Failed to compact: %v", err)
+	}
+	wg.Wait()
+
+	if tracks, _ := d.List(ctx); len(tracks) != 24 {
+		t.Errorf("Expected 24 tracks, got %d", len(tracks))
+	}
+	if d.deadVectors != 0 || len(d.vectors) != 4*30+20*5 || len(d.graph.nodes) != len(d.vectors) {
+		t.Errorf("Expected %d live vectors, got %d vectors (%d dead) and %d nodes",
+			4*30+20*5, len(d.vectors), d.deadVectors, len(d.graph.nodes))
+	}
+
+	// Compaction is refused once the context is done
+	d.Delete(ctx, "new-00")
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := d.Compact(cancelled); err == nil {
+		t.Error("Expected a cancelled compaction to fail")
+	}
+}
+
+func TestAutoCompact(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	config := DefaultConfig()
+	config.Dim = 4
+	d := createTestDB(t, config, 4, 5)
+
+	reports := make(chan CompactStats, 1)
+	go d.AutoCompact(ctx, time.Millisecond, 0.3, func(stats CompactStats, err error) {
+		if err == nil {
+			reports <- stats
+		}
+	})
+
+	// A quarter of the database is below the threshold, half is above
+	d.Delete(ctx, "track-00")
+	time.Sleep(20 * time.Millisecond)
+	if d.Garbage() == 0 {
+		t.Fatal("Expected no compaction below the threshold")
+	}
+	d.Delete(ctx, "track-01")
+	select {
+	case stats := <-reports:
+		if stats.Vectors != 10 {
+			t.Errorf("Expected 10 vectors reclaimed, got %+v", stats)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a compaction above the threshold")
+	}
+	if d.Garbage() != 0 {
+		t.Errorf("Expected no garbage after compacting, got %.3f", d.Garbage())
+	}
+}
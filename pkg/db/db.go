@@ -2,27 +2,42 @@ package db
 
 import (
 	"context"
+	"errors"
 
 	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
 )
 
-// TrackMetadata contains information about an audio track
+// TrackMetadata contains information about an audio track. TrackUpdater.Update
+// replaces every field except ID, which selects the track, and Added and
+// Quality, which keep the values stored when the track was added.
 type TrackMetadata struct {
 	ID       string
 	Title    string
 	Artist   string
 	Duration float64
-	Added    int64 // Unix timestamp
+	Added    int64                      // Unix timestamp
+	Quality  *fingerprint.QualityReport // Fingerprint quality at ingest, if known
+
+	Album       string
+	ISRC        string            // International Standard Recording Code, e.g. USRC17607839
+	UPC         string            // Universal Product Code (12 digits) or EAN (13) of the release
+	Label       string            // Record label
+	ReleaseDate string            // YYYY-MM-DD, YYYY-MM or YYYY
+	ExternalIDs map[string]string // Identifiers in other catalogues by catalogue name
+	Custom      map[string]string // Free-form attributes
 }
 
 // SearchResult represents a match from the vector database
 type SearchResult struct {
 	TrackID       string
-	Score         float64
+	Score         float64 // Similarity in [0, 1], higher is better; see Metric
 	TimeOffset    float64
 	MatchedVector *fingerprint.Vector
 }
 
+// ErrNotFound is returned for a track ID that the database does not hold
+var ErrNotFound = errors.New("track not found")
+
 // VectorDB defines interface for vector database operations
 type VectorDB interface {
 	// Add inserts vectors and metadata for a track
@@ -34,7 +49,7 @@ type VectorDB interface {
 	// Delete removes a track and its vectors
 	Delete(ctx context.Context, trackID string) error
 
-	// Get retrieves track metadata
+	// Get retrieves track metadata, returning ErrNotFound for an unknown ID
 	Get(ctx context.Context, trackID string) (*TrackMetadata, error)
 
 	// List returns all track metadata
@@ -47,6 +62,28 @@ type VectorDB interface {
 	Load(ctx context.Context, path string) error
 }
 
+// HashMatch pairs a query hash with a stored reference hash of the same value
+type HashMatch struct {
+	Query     fingerprint.Hash
+	Reference fingerprint.Hash
+}
+
+// HashIndex defines interface for landmark hash storage and lookup
+type HashIndex interface {
+	// AddHashes inserts hashes for a track that has been added with Add
+	AddHashes(ctx context.Context, trackID string, hashes []fingerprint.Hash) error
+
+	// LookupHashes returns every stored hash sharing a value with a query hash
+	LookupHashes(ctx context.Context, query []fingerprint.Hash) ([]HashMatch, error)
+}
+
+// TrackExporter is implemented by databases that can return everything
+// stored for a track, so that it can be moved to another database
+type TrackExporter interface {
+	// Export returns a copy of a track's metadata, vectors and hashes
+	Export(ctx context.Context, trackID string) (*TrackMetadata, []*fingerprint.Vector, []fingerprint.Hash, error)
+}
+
 // Config holds database configuration
 type Config struct {
 	M              int // Number of connections in HNSW graph
@@ -54,4 +91,11 @@ type Config struct {
 	EfSearch       int // Size of dynamic candidate list for search
 	Dim            int // Vector dimensionality
 	MaxElements    int // Maximum number of vectors to store
+
+	Metric Metric // Vector comparison; see Metric for the resulting Scores
+
+	Quantization   Quantization // Compression of vectors for graph traversal
+	PQSubvectors   int          // Subvectors per vector with QuantizePQ; 0 uses one per 4 dimensions
+	PQTrainingSize int          // Vectors needed to train the QuantizePQ codebooks
+	Rerank         int          // Candidates per result re-ranked on exact vectors after a quantized search
 }
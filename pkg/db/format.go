@@ -0,0 +1,434 @@
+package db
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/kshitijk4poor/shazam-golang/internal/bincodec"
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// FormatVersion is the version of the database file format written by
+// MemoryDB.Save. Load rejects any other version.
+const FormatVersion = 1
+
+// formatMagic identifies database files
+var formatMagic = [4]byte{'S', 'G', 'D', 'B'}
+
+var (
+	// ErrUnsupportedVersion is returned when loading a database file written
+	// with a different format version
+	ErrUnsupportedVersion = errors.New("unsupported database format version")
+
+	// ErrCorrupted is returned when a database file fails validation: bad
+	// magic, checksum mismatch, truncation or inconsistent contents
+	ErrCorrupted = errors.New("database file is corrupted")
+
+	// ErrDimensionMismatch is returned when loading vectors whose dimension
+	// differs from Config.Dim
+	ErrDimensionMismatch = errors.New("vector dimension mismatch")
+
+	// ErrMetricMismatch is returned when loading a graph built for a
+	// different Config.Metric
+	ErrMetricMismatch = errors.New("metric mismatch")
+)
+
+// sectionKind identifies a section of a database file
+type sectionKind byte
+
+const (
+	sectionConfig sectionKind = iota + 1
+	sectionTracks
+	sectionVectors
+	sectionHashes
+	sectionGraph
+	sectionEnd
+)
+
+// sectionOrder lists the sections in the order they are written; all are
+// required
+var sectionOrder = []sectionKind{sectionConfig, sectionTracks, sectionVectors, sectionHashes, sectionGraph, sectionEnd}
+
+func (k sectionKind) String() string {
+	switch k {
+	case sectionConfig:
+		return "config"
+	case sectionTracks:
+		return "tracks"
+	case sectionVectors:
+		return "vectors"
+	case sectionHashes:
+		return "hashes"
+	case sectionGraph:
+		return "graph"
+	case sectionEnd:
+		return "end"
+	}
+	return fmt.Sprintf("section %d", byte(k))
+}
+
+// snapshot is the decoded content of a database file
+type snapshot struct {
+	config  Config
+	tracks  []*TrackMetadata // Ordered by ID
+	vectors []*fingerprint.Vector
+	dead    []bool // Per vector: belongs to a deleted track; may be nil when encoding
+	hashes  map[string][]fingerprint.Hash
+	nodes   []hnswNode
+	entry   int
+	level   int
+
+	sequence uint64 // Last write-ahead log record included
+}
+
+// encodeSnapshot writes a database file. The layout is
+//
+//	header:   magic "SGDB", version (1 byte)
+//	sections: kind (1 byte), payload length (uint64), payload,
+//	          CRC-32 (IEEE) of kind, length and payload
+//
+// with one section of each kind in this order:
+//
+//	config:  M, EfConstruction, EfSearch, Dim, MaxElements, Metric (uvarints)
+//	tracks:  JSON array of TrackMetadata ordered by ID
+//	vectors: count, dimension, then per vector: track index (uvarint; the
+//	         track count for a vector of a deleted track), time (float64)
+//	         and components (float32 each)
+//	hashes:  per track: count, then per hash: value (uint32) and anchor
+//	         time, anchor frequency and span (float64 each)
+//	graph:   entry point (varint), top level, node count, then per node:
+//	         level and per layer the link count and linked node IDs
+//	end:     last write-ahead log sequence number included (uvarint, 0
+//	         without a log); marks a complete file
+//
+// Fixed-width values are little-endian. Metadata is JSON so new fields do
+// not need a format change.
+func encodeSnapshot(s *snapshot) ([]byte, error) {
+	out := &bincodec.Encoder{}
+	out.Write(formatMagic[:])
+	out.Byte(FormatVersion)
+
+	trackIndex := make(map[string]int, len(s.tracks))
+	for i, metadata := range s.tracks {
+		trackIndex[metadata.ID] = i
+	}
+
+	for _, kind := range sectionOrder {
+		w := &bincodec.Encoder{}
+		switch kind {
+		case sectionConfig:
+			for _, value := range []int{s.config.M, s.config.EfConstruction, s.config.EfSearch, s.config.Dim, s.config.MaxElements, int(s.config.Metric)} {
+				w.Uvarint(uint64(max(value, 0)))
+			}
+
+		case sectionTracks:
+			encoded, err := json.Marshal(s.tracks)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode track metadata: %w", err)
+			}
+			w.Write(encoded)
+
+		case sectionVectors:
+			w.Uvarint(uint64(len(s.vectors)))
+			dim := 0
+			if len(s.vectors) > 0 {
+				dim = len(s.vectors[0].Data)
+			}
+			w.Uvarint(uint64(dim))
+			for i, vector := range s.vectors {
+				index, exists := trackIndex[vector.TrackID]
+				if s.dead != nil && s.dead[i] {
+					// Kept until compaction as the graph still links to it
+					index, exists = len(s.tracks), true
+				}
+				if !exists {
+					return nil, fmt.Errorf("vector %d belongs to unknown track %s", i, vector.TrackID)
+				}
+				if len(vector.Data) != dim {
+					return nil, fmt.Errorf("vector %d has dimension %d, expected %d", i, len(vector.Data), dim)
+				}
+				w.Uvarint(uint64(index))
+				w.Float64(vector.TimeRef)
+				for _, val := range vector.Data {
+					w.Uint32(math.Float32bits(val))
+				}
+			}
+
+		case sectionHashes:
+			for _, metadata := range s.tracks {
+				hashes := s.hashes[metadata.ID]
+				w.Uvarint(uint64(len(hashes)))
+				for _, hash := range hashes {
+					w.Uint32(hash.Value)
+					w.Float64(hash.Time)
+					w.Float64(hash.Frequency)
+					w.Float64(hash.Span)
+				}
+			}
+
+		case sectionGraph:
+			w.Varint(int64(s.entry))
+			w.Uvarint(uint64(s.level))
+			w.Uvarint(uint64(len(s.nodes)))
+			for _, node := range s.nodes {
+				w.Uvarint(uint64(node.level))
+				for _, links := range node.links {
+					w.Uvarint(uint64(len(links)))
+					for _, link := range links {
+						w.Uvarint(uint64(link))
+					}
+				}
+			}
+
+		case sectionEnd:
+			w.Uvarint(s.sequence)
+		}
+
+		payload := w.Bytes()
+		start := out.Len()
+		out.Byte(byte(kind))
+		out.Uint64(uint64(len(payload)))
+		out.Write(payload)
+		out.Uint32(crc32.ChecksumIEEE(out.Bytes()[start:]))
+	}
+
+	return out.Bytes(), nil
+}
+
+// decodeSnapshot reads a database file written by encodeSnapshot, verifying
+// every section checksum and the consistency of the contents
+func decodeSnapshot(data []byte) (*snapshot, error) {
+	if len(data) < len(formatMagic)+1 || !bytes.Equal(data[:len(formatMagic)], formatMagic[:]) {
+		return nil, fmt.Errorf("%w: not a database file", ErrCorrupted)
+	}
+	if version := data[len(formatMagic)]; version != FormatVersion {
+		return nil, fmt.Errorf("%w: %d (expected %d)", ErrUnsupportedVersion, version, FormatVersion)
+	}
+
+	// Split and verify the sections before decoding any of them
+	payloads := make(map[sectionKind][]byte, len(sectionOrder))
+	rest := data[len(formatMagic)+1:]
+	for _, kind := range sectionOrder {
+		if len(rest) < 1+8+4 {
+			return nil, fmt.Errorf("%w: truncated before %s section", ErrCorrupted, kind)
+		}
+		if got := sectionKind(rest[0]); got != kind {
+			return nil, fmt.Errorf("%w: found %s where %s section was expected", ErrCorrupted, got, kind)
+		}
+		length := binary.LittleEndian.Uint64(rest[1:9])
+		if length > uint64(len(rest)-1-8-4) {
+			return nil, fmt.Errorf("%w: %s section truncated", ErrCorrupted, kind)
+		}
+		end := 1 + 8 + int(length)
+		if crc32.ChecksumIEEE(rest[:end]) != binary.LittleEndian.Uint32(rest[end:end+4]) {
+			return nil, fmt.Errorf("%w: %s section checksum mismatch", ErrCorrupted, kind)
+		}
+		payloads[kind] = rest[1+8 : end]
+		rest = rest[end+4:]
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: %d trailing bytes", ErrCorrupted, len(rest))
+	}
+
+	s := &snapshot{hashes: make(map[string][]fingerprint.Hash)}
+
+	// Config
+	r := bincodec.NewDecoder(payloads[sectionConfig])
+	s.config = Config{
+		M:              int(r.Uvarint()),
+		EfConstruction: int(r.Uvarint()),
+		EfSearch:       int(r.Uvarint()),
+		Dim:            int(r.Uvarint()),
+		MaxElements:    int(r.Uvarint()),
+		Metric:         Metric(r.Uvarint()),
+	}
+	if err := finishSection(r, sectionConfig); err != nil {
+		return nil, err
+	}
+	if !s.config.Metric.valid() {
+		return nil, fmt.Errorf("%w: config section: unknown %s", ErrCorrupted, s.config.Metric)
+	}
+
+	// Tracks
+	if err := json.Unmarshal(payloads[sectionTracks], &s.tracks); err != nil {
+		return nil, fmt.Errorf("%w: tracks section: %v", ErrCorrupted, err)
+	}
+	seen := make(map[string]bool, len(s.tracks))
+	for _, metadata := range s.tracks {
+		if metadata == nil || metadata.ID == "" || seen[metadata.ID] {
+			return nil, fmt.Errorf("%w: tracks section has a missing or duplicate track ID", ErrCorrupted)
+		}
+		seen[metadata.ID] = true
+	}
+
+	// Vectors
+	r = bincodec.NewDecoder(payloads[sectionVectors])
+	count := r.Count(1 + 8)
+	dim := int(r.Uvarint())
+	if r.Err() == nil && count > 0 && dim > r.Len()/4 {
+		r.Fail()
+	}
+	s.vectors = make([]*fingerprint.Vector, 0, count)
+	s.dead = make([]bool, 0, count)
+	for i := 0; i < count && r.Err() == nil; i++ {
+		index := int(r.Uvarint())
+		if r.Err() == nil && index > len(s.tracks) {
+			return nil, fmt.Errorf("%w: vector %d belongs to track %d of %d", ErrCorrupted, i, index, len(s.tracks))
+		}
+		vector := &fingerprint.Vector{
+			TimeRef: r.Float64(),
+			Data:    make([]float32, dim),
+		}
+		dead := index == len(s.tracks)
+		if r.Err() == nil && !dead {
+			vector.TrackID = s.tracks[index].ID
+		}
+		for j := range vector.Data {
+			vector.Data[j] = math.Float32frombits(r.Uint32())
+		}
+		s.vectors = append(s.vectors, vector)
+		s.dead = append(s.dead, dead)
+	}
+	if err := finishSection(r, sectionVectors); err != nil {
+		return nil, err
+	}
+	if count > 0 && s.config.Dim > 0 && dim != s.config.Dim {
+		return nil, fmt.Errorf("%w: stored vectors have dimension %d but the stored config has %d", ErrCorrupted, dim, s.config.Dim)
+	}
+
+	// Hashes
+	r = bincodec.NewDecoder(payloads[sectionHashes])
+	for _, metadata := range s.tracks {
+		count := r.Count(4 + 3*8)
+		if count == 0 {
+			continue
+		}
+		hashes := make([]fingerprint.Hash, 0, count)
+		for i := 0; i < count && r.Err() == nil; i++ {
+			hashes = append(hashes, fingerprint.Hash{
+				Value:     r.Uint32(),
+				Time:      r.Float64(),
+				Frequency: r.Float64(),
+				Span:      r.Float64(),
+				TrackID:   metadata.ID,
+			})
+		}
+		s.hashes[metadata.ID] = hashes
+	}
+	if err := finishSection(r, sectionHashes); err != nil {
+		return nil, err
+	}
+
+	// Graph
+	r = bincodec.NewDecoder(payloads[sectionGraph])
+	s.entry = int(r.Varint())
+	s.level = int(r.Uvarint())
+	count = r.Count(1)
+	if r.Err() == nil && count != len(s.vectors) {
+		return nil, fmt.Errorf("%w: graph has %d nodes for %d vectors", ErrCorrupted, count, len(s.vectors))
+	}
+	s.nodes = make([]hnswNode, 0, count)
+	for i := 0; i < count && r.Err() == nil; i++ {
+		level := int(r.Uvarint())
+		if r.Err() == nil && (level > s.level || level >= r.Len()) {
+			return nil, fmt.Errorf("%w: node %d has invalid level %d", ErrCorrupted, i, level)
+		}
+		node := hnswNode{level: level, links: make([][]uint32, level+1)}
+		for l := range node.links {
+			links := r.Count(1)
+			for j := 0; j < links; j++ {
+				node.links[l] = append(node.links[l], uint32(r.Uvarint()))
+			}
+		}
+		s.nodes = append(s.nodes, node)
+	}
+	if err := finishSection(r, sectionGraph); err != nil {
+		return nil, err
+	}
+	if err := validateGraph(s.nodes, s.entry, s.level); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+
+	// End
+	r = bincodec.NewDecoder(payloads[sectionEnd])
+	s.sequence = r.Uvarint()
+	if err := finishSection(r, sectionEnd); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// validateGraph checks that every link and the entry point refer to existing
+// nodes on layers they belong to
+func validateGraph(nodes []hnswNode, entry, level int) error {
+	if len(nodes) == 0 {
+		if entry != -1 {
+			return fmt.Errorf("empty graph has entry point %d", entry)
+		}
+		return nil
+	}
+	if entry < 0 || entry >= len(nodes) || nodes[entry].level != level {
+		return fmt.Errorf("invalid graph entry point %d at level %d", entry, level)
+	}
+	for id, node := range nodes {
+		for l, links := range node.links {
+			for _, link := range links {
+				if int(link) >= len(nodes) || nodes[link].level < l {
+					return fmt.Errorf("node %d links to invalid node %d on layer %d", id, link, l)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes a temporary file next to path with write, syncs it
+// and renames it over path, so readers see either the old or the new file
+// even if the process crashes midway
+func writeFileAtomic(path string, write func(file *os.File) error) error {
+	dir := filepath.Dir(path)
+	file, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath) // No-op after the rename
+
+	if err := write(file); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write temporary file: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to sync temporary file: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close temporary file: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", path, err)
+	}
+
+	// Persist the rename itself; not every platform can sync directories
+	if dirFile, err := os.Open(dir); err == nil {
+		dirFile.Sync()
+		dirFile.Close()
+	}
+	return nil
+}
+
+// finishSection reports a decoding error or leftover bytes in a section
+func finishSection(r *bincodec.Decoder, kind sectionKind) error {
+	if err := r.Done(); err != nil {
+		return fmt.Errorf("%w: %s section: %v", ErrCorrupted, kind, err)
+	}
+	return nil
+}
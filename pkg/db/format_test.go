@@ -0,0 +1,157 @@
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+func TestSaveLoadRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 8
+	original := createTestDB(t, config, 5, 20)
+	original.tracks["track-01"].Quality = &fingerprint.QualityReport{Duration: 10, Warnings: []string{"quiet"}}
+
+	path := filepath.Join(t.TempDir(), "library.db")
+	if err := original.Save(ctx, path); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	loaded := NewMemoryDB(config)
+	if err := loaded.Load(ctx, path); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+
+	if !reflect.DeepEqual(loaded.config, original.config) {
+		t.Errorf("Config: got %+v, want %+v", loaded.config, original.config)
+	}
+	if !reflect.DeepEqual(loaded.tracks, original.tracks) {
+		t.Error("Track metadata differs after loading")
+	}
+	if !reflect.DeepEqual(loaded.vectors, original.vectors) {
+		t.Error("Vectors differ after loading")
+	}
+	if !reflect.DeepEqual(loaded.trackHashes, original.trackHashes) {
+		t.Error("Hashes differ after loading")
+	}
+	if !reflect.DeepEqual(loaded.graph.nodes, original.graph.nodes) ||
+		loaded.graph.entryPoint != original.graph.entryPoint || loaded.graph.maxLevel != original.graph.maxLevel {
+		t.Error("Graph differs after loading")
+	}
+
+	// Inserting after a load builds the same graph as inserting without one
+	extra := createTestDB(t, config, 1, 10)
+	for _, d := range []*MemoryDB{original, loaded} {
+		if err := d.Add(ctx, &TrackMetadata{ID: "extra"}, extra.vectors); err != nil {
+			t.Fatalf("Failed to add after load: %v", err)
+		}
+	}
+	if !reflect.DeepEqual(loaded.graph.nodes, original.graph.nodes) {
+		t.Error("Graphs diverge after adding to a loaded database")
+	}
+
+	// Saving over an existing file leaves no temporary files behind
+	if err := loaded.Save(ctx, path); err != nil {
+		t.Fatalf("Failed to save again: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("Failed to list directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected only the database file, found %d entries", len(entries))
+	}
+}
+
+func TestLoadRejectsCorruption(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	d := createTestDB(t, config, 3, 5)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "library.db")
+	if err := d.Save(ctx, path); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+
+	target := createTestDB(t, config, 1, 1)
+	load := func(name string, content []byte) error {
+		t.Helper()
+		corrupted := filepath.Join(dir, name)
+		if err := os.WriteFile(corrupted, content, 0o644); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		return target.Load(ctx, corrupted)
+	}
+
+	// Every flipped byte is caught, by the magic, version or a checksum
+	for i := 0; i < len(data); i++ {
+		flipped := append([]byte(nil), data...)
+		flipped[i] ^= 0x40
+		err := load("flipped.db", flipped)
+		if !errors.Is(err, ErrCorrupted) && !errors.Is(err, ErrUnsupportedVersion) {
+			t.Fatalf("Byte %d: expected a corruption error, got %v", i, err)
+		}
+	}
+
+	// Every truncation is caught
+	for n := 0; n < len(data); n++ {
+		if err := load("truncated.db", data[:n]); !errors.Is(err, ErrCorrupted) {
+			t.Fatalf("Truncated to %d bytes: expected ErrCorrupted, got %v", n, err)
+		}
+	}
+
+	version := append([]byte(nil), data...)
+	version[4] = FormatVersion + 1
+	if err := load("version.db", version); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+
+	// Files without a metric, as written before metrics, are not read as cosine
+	length := binary.LittleEndian.Uint64(data[6:14])
+	section := append([]byte(nil), data[5:14+length-1]...)
+	binary.LittleEndian.PutUint64(section[1:9], length-1)
+	section = binary.LittleEndian.AppendUint32(section, crc32.ChecksumIEEE(section))
+	noMetric := append(append(append([]byte(nil), data[:5]...), section...), data[14+length+4:]...)
+	if err := load("nometric.db", noMetric); !errors.Is(err, ErrCorrupted) {
+		t.Errorf("Expected ErrCorrupted without a metric, got %v", err)
+	}
+
+	// Failed loads leave the database untouched
+	if tracks, _ := target.List(ctx); len(tracks) != 1 || tracks[0].ID != "track-00" {
+		t.Errorf("Expected the original single track after failed loads, got %d", len(tracks))
+	}
+}
+
+func TestLoadChecksDimension(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	path := filepath.Join(t.TempDir(), "library.db")
+	if err := createTestDB(t, config, 2, 3).Save(ctx, path); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	config.Dim = 8
+	if err := NewMemoryDB(config).Load(ctx, path); !errors.Is(err, ErrDimensionMismatch) {
+		t.Errorf("Expected ErrDimensionMismatch, got %v", err)
+	}
+
+	// A database without a fixed dimension accepts the file
+	config.Dim = 0
+	if err := NewMemoryDB(config).Load(ctx, path); err != nil {
+		t.Errorf("Expected load without a configured dimension to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,286 @@
+package db
+
+import (
+	"container/heap"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// hnswGraph is a hierarchical navigable small world graph (Malkov & Yashunin)
+// over vectors identified by dense integer IDs. It is not safe for
+// concurrent use; MemoryDB serializes access.
+type hnswGraph struct {
+	m              int     // Links per node on upper layers
+	maxLinks0      int     // Links per node on layer 0
+	efConstruction int     // Candidate list size while inserting
+	levelFactor    float64 // Normalization factor for random levels
+	nodes          []hnswNode
+	entryPoint     int
+	maxLevel       int
+	rng            *rand.Rand
+	vector         func(id int) []float32
+	distance       func(a, b []float32) float64
+}
+
+// hnswNode holds a node's neighbors on every layer it belongs to
+type hnswNode struct {
+	level int
+	links [][]uint32
+}
+
+// hnswCandidate is a node together with its distance to the query
+type hnswCandidate struct {
+	id       int
+	distance float64
+}
+
+// newHNSWGraph creates an empty graph. vector resolves node IDs to their data.
+func newHNSWGraph(m, efConstruction int, vector func(id int) []float32, distance func(a, b []float32) float64) *hnswGraph {
+	if m < 2 {
+		m = 2
+	}
+	if efConstruction < m {
+		efConstruction = m
+	}
+	return &hnswGraph{
+		m:              m,
+		maxLinks0:      2 * m,
+		efConstruction: efConstruction,
+		levelFactor:    1 / math.Log(float64(m)),
+		entryPoint:     -1,
+		rng:            rand.New(rand.NewSource(42)),
+		vector:         vector,
+		distance:       distance,
+	}
+}
+
+// restore replaces the nodes with ones loaded from disk. The level generator
+// is advanced past the levels already drawn, so later inserts get the same
+// levels as if the graph had never been saved.
+func (g *hnswGraph) restore(nodes []hnswNode, entryPoint, maxLevel int) {
+	g.nodes = nodes
+	g.entryPoint = entryPoint
+	g.maxLevel = maxLevel
+	for range nodes {
+		g.rng.Float64()
+	}
+}
+
+// insert adds the node with the next free ID (len(nodes)) to the graph
+func (g *hnswGraph) insert(id int) {
+	level := int(-math.Log(1-g.rng.Float64()) * g.levelFactor)
+	g.nodes = append(g.nodes, hnswNode{level: level, links: make([][]uint32, level+1)})
+
+	// The first node becomes the entry point
+	if g.entryPoint < 0 {
+		g.entryPoint = id
+		g.maxLevel = level
+		return
+	}
+
+	query := g.vector(id)
+	entries := []hnswCandidate{{g.entryPoint, g.distance(query, g.vector(g.entryPoint))}}
+
+	// Greedy descent through the layers above the node's level
+	for l := g.maxLevel; l > level; l-- {
+		entries = g.searchLayer(query, entries, 1, l)[:1]
+	}
+
+	// Connect the node on each of its layers
+	for l := min(level, g.maxLevel); l >= 0; l-- {
+		candidates := g.searchLayer(query, entries, g.efConstruction, l)
+		neighbors := candidates
+		if len(neighbors) > g.m {
+			neighbors = neighbors[:g.m]
+		}
+
+		g.nodes[id].links[l] = make([]uint32, len(neighbors))
+		for i, neighbor := range neighbors {
+			g.nodes[id].links[l][i] = uint32(neighbor.id)
+			g.link(neighbor.id, id, l)
+		}
+		entries = candidates
+	}
+
+	if level > g.maxLevel {
+		g.entryPoint = id
+		g.maxLevel = level
+	}
+}
+
+// link adds a directed edge from -> to on a layer, pruning the farthest links
+// when the node exceeds its link budget
+func (g *hnswGraph) link(from, to, level int) {
+	links := append(g.nodes[from].links[level], uint32(to))
+	maxLinks := g.m
+	if level == 0 {
+		maxLinks = g.maxLinks0
+	}
+
+	if len(links) > maxLinks {
+		origin := g.vector(from)
+		sort.Slice(links, func(i, j int) bool {
+			return g.distance(origin, g.vector(int(links[i]))) < g.distance(origin, g.vector(int(links[j])))
+		})
+		links = links[:maxLinks]
+	}
+	g.nodes[from].links[level] = links
+}
+
+// search returns up to k nearest nodes to the query, closest first
+func (g *hnswGraph) search(query []float32, k, ef int) []hnswCandidate {
+	return g.searcher().search(query, k, ef)
+}
+
+// searchLayer runs a best-first search on one layer of the graph
+func (g *hnswGraph) searchLayer(query []float32, entries []hnswCandidate, ef, level int) []hnswCandidate {
+	s := g.searcher()
+	return s.searchLayer(s.distances(query), entries, ef, level)
+}
+
+// searcher returns a search over the graph's in-memory links
+func (g *hnswGraph) searcher() hnswSearch {
+	return hnswSearch{
+		entryPoint: g.entryPoint,
+		maxLevel:   g.maxLevel,
+		links: func(id, level int) []uint32 {
+			return g.nodes[id].links[level]
+		},
+		vector:   g.vector,
+		distance: g.distance,
+	}
+}
+
+// hnswSearch runs queries against an HNSW graph whose links and vectors may
+// live on the heap (hnswGraph) or in a mapped file (MappedDB)
+type hnswSearch struct {
+	entryPoint int // -1 for an empty graph
+	maxLevel   int
+	links      func(id, level int) []uint32
+	vector     func(id int) []float32
+	distance   func(a, b []float32) float64
+	deleted    func(id int) bool // Optional; deleted nodes are traversed but not returned
+
+	// Optional; returns distances from the query to nodes estimated from
+	// compressed vectors, used instead of distance and vector
+	estimate func(query []float32) func(id int) float64
+}
+
+// distances returns the distance from the query to a node
+func (s hnswSearch) distances(query []float32) func(id int) float64 {
+	if s.estimate != nil {
+		return s.estimate(query)
+	}
+	return func(id int) float64 {
+		return s.distance(query, s.vector(id))
+	}
+}
+
+// search returns up to k nearest nodes to the query, closest first. Deleted
+// nodes among the ef nearest widen the search by their number until k live
+// nodes are found or the graph has no more.
+func (s hnswSearch) search(query []float32, k, ef int) []hnswCandidate {
+	if s.entryPoint < 0 || k <= 0 {
+		return nil
+	}
+	if ef < k {
+		ef = k
+	}
+
+	distance := s.distances(query)
+	entries := []hnswCandidate{{s.entryPoint, distance(s.entryPoint)}}
+	for l := s.maxLevel; l > 0; l-- {
+		entries = s.searchLayer(distance, entries, 1, l)[:1]
+	}
+
+	for {
+		found := s.searchLayer(distance, entries, ef, 0)
+		results := found
+		if s.deleted != nil {
+			results = make([]hnswCandidate, 0, len(found))
+			for _, result := range found {
+				if !s.deleted(result.id) {
+					results = append(results, result)
+				}
+			}
+		}
+		if len(results) >= k || len(found) < ef {
+			return results[:min(k, len(results))]
+		}
+		ef += len(found) - len(results)
+	}
+}
+
+// searchLayer runs a best-first search on one layer and returns up to ef
+// candidates sorted by ascending distance from the query
+func (s hnswSearch) searchLayer(distance func(id int) float64, entries []hnswCandidate, ef, level int) []hnswCandidate {
+	visited := make(map[int]bool, ef*4)
+	candidates := &candidateHeap{}
+	results := &candidateHeap{farthestFirst: true}
+
+	for _, entry := range entries {
+		visited[entry.id] = true
+		heap.Push(candidates, entry)
+		heap.Push(results, entry)
+		if results.Len() > ef {
+			heap.Pop(results)
+		}
+	}
+
+	for candidates.Len() > 0 {
+		current := heap.Pop(candidates).(hnswCandidate)
+		if results.Len() >= ef && current.distance > results.items[0].distance {
+			break
+		}
+
+		for _, link := range s.links(current.id, level) {
+			neighbor := int(link)
+			if visited[neighbor] {
+				continue
+			}
+			visited[neighbor] = true
+
+			d := distance(neighbor)
+			if results.Len() < ef || d < results.items[0].distance {
+				heap.Push(candidates, hnswCandidate{neighbor, d})
+				heap.Push(results, hnswCandidate{neighbor, d})
+				if results.Len() > ef {
+					heap.Pop(results)
+				}
+			}
+		}
+	}
+
+	sorted := results.items
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].distance < sorted[j].distance
+	})
+	return sorted
+}
+
+// candidateHeap is a binary heap of candidates ordered by distance, closest
+// first unless farthestFirst is set
+type candidateHeap struct {
+	items         []hnswCandidate
+	farthestFirst bool
+}
+
+func (h *candidateHeap) Len() int { return len(h.items) }
+
+func (h *candidateHeap) Less(i, j int) bool {
+	if h.farthestFirst {
+		return h.items[i].distance > h.items[j].distance
+	}
+	return h.items[i].distance < h.items[j].distance
+}
+
+func (h *candidateHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *candidateHeap) Push(x interface{}) { h.items = append(h.items, x.(hnswCandidate)) }
+
+func (h *candidateHeap) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
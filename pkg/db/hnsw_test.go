@@ -0,0 +1,108 @@
+package db
+
+import (
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// createGraph inserts n random vectors into a graph with cosine distance
+func createGraph(n, dim int, seed int64) (*hnswGraph, [][]float32) {
+	rng := rand.New(rand.NewSource(seed))
+	vectors := make([][]float32, n)
+	graph := newHNSWGraph(16, 200, func(id int) []float32 { return vectors[id] }, cosineDistance)
+	for i := range vectors {
+		vectors[i] = make([]float32, dim)
+		for j := range vectors[i] {
+			vectors[i][j] = float32(rng.NormFloat64())
+		}
+		graph.insert(i)
+	}
+	return graph, vectors
+}
+
+func TestHNSWInsert(t *testing.T) {
+	graph, vectors := createGraph(500, 8, 1)
+	if len(graph.nodes) != len(vectors) {
+		t.Fatalf("Expected %d nodes, got %d", len(vectors), len(graph.nodes))
+	}
+	if graph.nodes[graph.entryPoint].level != graph.maxLevel {
+		t.Errorf("Expected the entry point on the top layer %d, got level %d", graph.maxLevel, graph.nodes[graph.entryPoint].level)
+	}
+
+	for id, node := range graph.nodes {
+		if len(node.links) != node.level+1 {
+			t.Fatalf("Node %d: expected links on %d layers, got %d", id, node.level+1, len(node.links))
+		}
+		for level, links := range node.links {
+			maxLinks := graph.m
+			if level == 0 {
+				maxLinks = graph.maxLinks0
+			}
+			if len(links) > maxLinks {
+				t.Errorf("Node %d: %d links on layer %d exceed the budget of %d", id, len(links), level, maxLinks)
+			}
+			for _, link := range links {
+				if int(link) == id || graph.nodes[link].level < level {
+					t.Errorf("Node %d: invalid link to %d on layer %d", id, link, level)
+				}
+			}
+		}
+		if id > 0 && len(node.links[0]) == 0 {
+			t.Errorf("Node %d is not connected on layer 0", id)
+		}
+	}
+
+	// Every stored vector finds itself
+	for id := 0; id < len(vectors); id += 25 {
+		found := graph.search(vectors[id], 1, 64)
+		if len(found) != 1 || found[0].id != id {
+			t.Errorf("Expected node %d to find itself, got %v", id, found)
+		}
+	}
+
+	empty := newHNSWGraph(16, 200, nil, cosineDistance)
+	if found := empty.search(vectors[0], 5, 64); found != nil {
+		t.Errorf("Expected no results from an empty graph, got %v", found)
+	}
+}
+
+func TestHNSWRecall(t *testing.T) {
+	const k = 10
+	graph, vectors := createGraph(3000, 16, 2)
+	queries, _ := createGraph(50, 16, 3)
+
+	distance := cosineDistance
+	found := 0
+	for q := range queries.nodes {
+		query := queries.vector(q)
+
+		// Exhaustive k nearest neighbors
+		ids := make([]int, len(vectors))
+		for i := range ids {
+			ids[i] = i
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			return distance(query, vectors[ids[i]]) < distance(query, vectors[ids[j]])
+		})
+		exact := make(map[int]bool, k)
+		for _, id := range ids[:k] {
+			exact[id] = true
+		}
+
+		results := graph.search(query, k, 100)
+		for i, result := range results {
+			if exact[result.id] {
+				found++
+			}
+			if i > 0 && result.distance < results[i-1].distance {
+				t.Fatalf("Expected results closest first, got %v", results)
+			}
+		}
+	}
+
+	recall := float64(found) / float64(k*len(queries.nodes))
+	if recall < 0.9 {
+		t.Errorf("Expected recall@%d of at least 0.9, got %.3f", k, recall)
+	}
+}
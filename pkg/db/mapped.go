@@ -0,0 +1,832 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"math"
+	"os"
+	"sort"
+	"sync"
+	"unsafe"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// IndexVersion is the version of the mapped index format written by
+// MemoryDB.WriteIndex. OpenMappedDB rejects any other version.
+const IndexVersion = 1
+
+// indexMagic identifies mapped index files
+var indexMagic = [4]byte{'S', 'G', 'I', 'X'}
+
+// ErrReadOnly is returned by the mutating methods of MappedDB
+var ErrReadOnly = errors.New("mapped database is read-only")
+
+// Sections of a mapped index, in file order. Counts are implied by the
+// section lengths; "plus the total" arrays have one more entry than their
+// owners so entry i spans [starts[i], starts[i+1]).
+const (
+	indexTracks             = iota // JSON array of TrackMetadata ordered by ID
+	indexVectorTracks              // uint32 track index per vector, the track count if deleted
+	indexVectorTimes               // float64 reference time per vector
+	indexVectorData                // float32 components, Dim per vector
+	indexHashValues                // uint32 distinct hash values, ascending
+	indexHashStarts                // uint64 first posting per value, plus the total
+	indexPostingTracks             // uint32 track index per posting
+	indexPostingTimes              // float64 anchor time per posting
+	indexPostingFrequencies        // float64 anchor frequency per posting
+	indexPostingSpans              // float64 span per posting
+	indexNodeLayers                // uint64 first layer per graph node, plus the total
+	indexLayerLinks                // uint64 first link per layer, plus the total
+	indexLinks                     // uint32 linked node IDs
+	indexSectionCount
+)
+
+// indexElementSize is the size of one element of each section
+var indexElementSize = [indexSectionCount]uint64{1, 4, 8, 4, 4, 8, 4, 8, 8, 8, 8, 8, 4}
+
+// indexHeader starts a mapped index file. Sections follow at 8-byte aligned
+// offsets so that they can be read in place as typed arrays. All values are
+// little-endian.
+type indexHeader struct {
+	Magic          [4]byte
+	Version        uint32
+	M              uint64
+	EfConstruction uint64
+	EfSearch       uint64
+	Dim            uint64
+	MaxElements    uint64
+	Metric         uint64
+	EntryPoint     int64 // -1 for an empty graph
+	MaxLevel       uint64
+	Sections       [indexSectionCount]indexSection
+	Checksum       uint32 // CRC-32 (IEEE) of the header before this field
+	_              uint32
+}
+
+// indexSection locates a section of a mapped index
+type indexSection struct {
+	Offset   uint64
+	Length   uint64
+	Checksum uint32 // CRC-32 (IEEE) of the section, checked by MappedDB.Verify
+	_        uint32
+}
+
+// indexHeaderSize is the encoded size of indexHeader
+var indexHeaderSize = binary.Size(indexHeader{})
+
+// WriteIndex writes the database as a mapped index file for OpenMappedDB,
+// replacing path atomically. Unlike Save, the layout keeps vectors, postings
+// and graph links in flat arrays that can be searched without decoding.
+func (d *MemoryDB) WriteIndex(ctx context.Context, path string) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	tracks := make([]*TrackMetadata, 0, len(d.tracks))
+	for _, metadata := range d.tracks {
+		tracks = append(tracks, metadata)
+	}
+	sort.Slice(tracks, func(i, j int) bool {
+		return tracks[i].ID < tracks[j].ID
+	})
+	trackIndex := make(map[string]uint32, len(tracks))
+	for i, metadata := range tracks {
+		trackIndex[metadata.ID] = uint32(i)
+	}
+	encodedTracks, err := json.Marshal(tracks)
+	if err != nil {
+		return fmt.Errorf("failed to encode track metadata: %w", err)
+	}
+
+	// Postings of deleted tracks are left out
+	live := make(map[uint32][]fingerprint.Hash, len(d.postings))
+	for value, postings := range d.postings {
+		for _, posting := range postings {
+			if _, deleted := d.tombstones[posting.TrackID]; !deleted {
+				live[value] = append(live[value], posting)
+			}
+		}
+	}
+	values := make([]uint32, 0, len(live))
+	for value := range live {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+
+	// Postings in value order, each value's postings in insertion order
+	var postings []fingerprint.Hash
+	for _, value := range values {
+		postings = append(postings, live[value]...)
+	}
+
+	header := indexHeader{
+		Magic:          indexMagic,
+		Version:        IndexVersion,
+		M:              uint64(max(d.config.M, 0)),
+		EfConstruction: uint64(max(d.config.EfConstruction, 0)),
+		EfSearch:       uint64(max(d.config.EfSearch, 0)),
+		Dim:            uint64(max(d.config.Dim, 0)),
+		MaxElements:    uint64(max(d.config.MaxElements, 0)),
+		Metric:         uint64(d.config.Metric),
+		EntryPoint:     int64(d.graph.entryPoint),
+		MaxLevel:       uint64(d.graph.maxLevel),
+	}
+	dim := d.storedDim()
+	if len(d.vectors) > 0 {
+		header.Dim = uint64(dim)
+	}
+
+	write := func(file *os.File) error {
+		w := &indexWriter{out: bufio.NewWriterSize(file, 1<<20), crc: crc32.NewIEEE(), header: &header}
+		w.bytes(make([]byte, indexHeaderSize)) // Placeholder, rewritten below
+
+		w.begin(indexTracks)
+		w.bytes(encodedTracks)
+		w.end()
+
+		w.begin(indexVectorTracks)
+		for id, vector := range d.vectors {
+			if d.dead[id] {
+				// The graph still links to it, so it stays until Compact
+				w.uint32(uint32(len(tracks)))
+			} else {
+				w.uint32(trackIndex[vector.TrackID])
+			}
+		}
+		w.end()
+		w.begin(indexVectorTimes)
+		for _, vector := range d.vectors {
+			w.float64(vector.TimeRef)
+		}
+		w.end()
+		w.begin(indexVectorData)
+		for i := range d.vectors {
+			data := d.vectorData(i)
+			if len(data) != dim {
+				return fmt.Errorf("vector %d has dimension %d, expected %d", i, len(data), dim)
+			}
+			for _, val := range data {
+				w.uint32(math.Float32bits(val))
+			}
+		}
+		w.end()
+
+		w.begin(indexHashValues)
+		for _, value := range values {
+			w.uint32(value)
+		}
+		w.end()
+		w.begin(indexHashStarts)
+		start := 0
+		for _, value := range values {
+			w.uint64(uint64(start))
+			start += len(live[value])
+		}
+		w.uint64(uint64(start))
+		w.end()
+		w.begin(indexPostingTracks)
+		for _, posting := range postings {
+			w.uint32(trackIndex[posting.TrackID])
+		}
+		w.end()
+		w.begin(indexPostingTimes)
+		for _, posting := range postings {
+			w.float64(posting.Time)
+		}
+		w.end()
+		w.begin(indexPostingFrequencies)
+		for _, posting := range postings {
+			w.float64(posting.Frequency)
+		}
+		w.end()
+		w.begin(indexPostingSpans)
+		for _, posting := range postings {
+			w.float64(posting.Span)
+		}
+		w.end()
+
+		w.begin(indexNodeLayers)
+		layer := 0
+		for _, node := range d.graph.nodes {
+			w.uint64(uint64(layer))
+			layer += len(node.links)
+		}
+		w.uint64(uint64(layer))
+		w.end()
+		w.begin(indexLayerLinks)
+		link := 0
+		for _, node := range d.graph.nodes {
+			for _, links := range node.links {
+				w.uint64(uint64(link))
+				link += len(links)
+			}
+		}
+		w.uint64(uint64(link))
+		w.end()
+		w.begin(indexLinks)
+		for _, node := range d.graph.nodes {
+			for _, links := range node.links {
+				for _, link := range links {
+					w.uint32(link)
+				}
+			}
+		}
+		w.end()
+
+		if err := w.out.Flush(); err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		_, err := file.WriteAt(encodeIndexHeader(header), 0)
+		return err
+	}
+
+	if err := writeFileAtomic(path, write); err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+	return nil
+}
+
+// encodeIndexHeader encodes a header and fills in its checksum
+func encodeIndexHeader(header indexHeader) []byte {
+	var buf bytes.Buffer
+	header.Checksum = 0
+	binary.Write(&buf, binary.LittleEndian, &header)
+	encoded := buf.Bytes()
+	binary.LittleEndian.PutUint32(encoded[indexHeaderSize-8:], crc32.ChecksumIEEE(encoded[:indexHeaderSize-8]))
+	return encoded
+}
+
+// indexWriter writes the sections of a mapped index, tracking their
+// offsets, lengths and checksums in the header
+type indexWriter struct {
+	out     *bufio.Writer
+	crc     hash.Hash32
+	header  *indexHeader
+	offset  uint64
+	section int
+	start   uint64
+	scratch [8]byte
+}
+
+// begin pads to an 8-byte boundary and starts a section
+func (w *indexWriter) begin(section int) {
+	for w.offset%8 != 0 {
+		w.out.WriteByte(0)
+		w.offset++
+	}
+	w.section = section
+	w.start = w.offset
+	w.crc.Reset()
+}
+
+// end records the current section in the header
+func (w *indexWriter) end() {
+	w.header.Sections[w.section] = indexSection{
+		Offset:   w.start,
+		Length:   w.offset - w.start,
+		Checksum: w.crc.Sum32(),
+	}
+}
+
+func (w *indexWriter) bytes(b []byte) {
+	w.out.Write(b)
+	w.crc.Write(b)
+	w.offset += uint64(len(b))
+}
+
+func (w *indexWriter) uint32(v uint32) {
+	binary.LittleEndian.PutUint32(w.scratch[:4], v)
+	w.bytes(w.scratch[:4])
+}
+
+func (w *indexWriter) uint64(v uint64) {
+	binary.LittleEndian.PutUint64(w.scratch[:8], v)
+	w.bytes(w.scratch[:8])
+}
+
+func (w *indexWriter) float64(v float64) {
+	w.uint64(math.Float64bits(v))
+}
+
+// MappedDB is a read-only VectorDB and HashIndex backed by an index file
+// written by MemoryDB.WriteIndex. Vectors, postings and graph links are read
+// in place from a shared memory mapping, so opening takes milliseconds
+// regardless of size and processes serving the same file share its pages.
+// Only track metadata is decoded onto the heap.
+//
+// Opening checks the section layout but not the stored indices; Search and
+// LookupHashes check the ones they follow and return ErrCorrupted rather than
+// reading outside the mapping. Verify checks them all.
+type MappedDB struct {
+	mu    sync.RWMutex
+	index *mappedIndex
+}
+
+// mappedIndex holds the typed views of one mapped index file
+type mappedIndex struct {
+	data       []byte
+	header     indexHeader
+	config     Config
+	tracks     []*TrackMetadata // Ordered by ID
+	trackIndex map[string]int
+
+	vectorTracks       []uint32
+	vectorTimes        []float64
+	vectorData         []float32
+	hashValues         []uint32
+	hashStarts         []uint64
+	postingTracks      []uint32
+	postingTimes       []float64
+	postingFrequencies []float64
+	postingSpans       []float64
+	nodeLayers         []uint64
+	layerLinks         []uint64
+	links              []uint32
+}
+
+// OpenMappedDB maps an index file written by MemoryDB.WriteIndex. Only the
+// header checksum and the section layout are checked, which keeps opening
+// fast; call Verify to check the section checksums and the graph.
+func OpenMappedDB(path string) (*MappedDB, error) {
+	index, err := openMappedIndex(path)
+	if err != nil {
+		return nil, err
+	}
+	return &MappedDB{index: index}, nil
+}
+
+// openMappedIndex maps and validates an index file
+func openMappedIndex(path string) (*mappedIndex, error) {
+	if binary.NativeEndian.Uint16([]byte{1, 0}) != 1 {
+		return nil, fmt.Errorf("mapped indexes require a little-endian host")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open index file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat index file: %w", err)
+	}
+	if info.Size() < int64(indexHeaderSize) || info.Size() > math.MaxInt {
+		return nil, fmt.Errorf("failed to open %s: %w: not an index file", path, ErrCorrupted)
+	}
+	data, err := mapFile(file, 0, int(info.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to map index file: %w", err)
+	}
+
+	index := &mappedIndex{data: data}
+	if err := index.init(); err != nil {
+		unmapFile(data)
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return index, nil
+}
+
+// init decodes the header and sets up the typed section views
+func (m *mappedIndex) init() error {
+	header := &m.header
+	if err := binary.Read(bytes.NewReader(m.data[:indexHeaderSize]), binary.LittleEndian, header); err != nil {
+		return fmt.Errorf("%w: %v", ErrCorrupted, err)
+	}
+	if header.Magic != indexMagic {
+		return fmt.Errorf("%w: not an index file", ErrCorrupted)
+	}
+	if header.Version != IndexVersion {
+		return fmt.Errorf("%w: %d (expected %d)", ErrUnsupportedVersion, header.Version, IndexVersion)
+	}
+	if crc32.ChecksumIEEE(m.data[:indexHeaderSize-8]) != header.Checksum {
+		return fmt.Errorf("%w: header checksum mismatch", ErrCorrupted)
+	}
+	if uintptr(unsafe.Pointer(&m.data[0]))%8 != 0 {
+		return fmt.Errorf("index mapping is not 8-byte aligned")
+	}
+
+	sections := make([][]byte, indexSectionCount)
+	for i, section := range header.Sections {
+		if section.Offset%8 != 0 || section.Offset < uint64(indexHeaderSize) ||
+			section.Offset > uint64(len(m.data)) || section.Length > uint64(len(m.data))-section.Offset ||
+			section.Length%indexElementSize[i] != 0 {
+			return fmt.Errorf("%w: section %d lies outside the file", ErrCorrupted, i)
+		}
+		sections[i] = m.data[section.Offset : section.Offset+section.Length]
+	}
+
+	m.config = Config{
+		M:              int(header.M),
+		EfConstruction: int(header.EfConstruction),
+		EfSearch:       int(header.EfSearch),
+		Dim:            int(header.Dim),
+		MaxElements:    int(header.MaxElements),
+		Metric:         Metric(header.Metric),
+	}
+	if !m.config.Metric.valid() {
+		return fmt.Errorf("%w: unknown metric %d", ErrCorrupted, header.Metric)
+	}
+	if err := json.Unmarshal(sections[indexTracks], &m.tracks); err != nil {
+		return fmt.Errorf("%w: tracks section: %v", ErrCorrupted, err)
+	}
+	m.trackIndex = make(map[string]int, len(m.tracks))
+	for i, metadata := range m.tracks {
+		if metadata == nil || metadata.ID == "" {
+			return fmt.Errorf("%w: track %d has no ID", ErrCorrupted, i)
+		}
+		m.trackIndex[metadata.ID] = i
+	}
+
+	m.vectorTracks = mappedSlice[uint32](sections[indexVectorTracks])
+	m.vectorTimes = mappedSlice[float64](sections[indexVectorTimes])
+	m.vectorData = mappedSlice[float32](sections[indexVectorData])
+	m.hashValues = mappedSlice[uint32](sections[indexHashValues])
+	m.hashStarts = mappedSlice[uint64](sections[indexHashStarts])
+	m.postingTracks = mappedSlice[uint32](sections[indexPostingTracks])
+	m.postingTimes = mappedSlice[float64](sections[indexPostingTimes])
+	m.postingFrequencies = mappedSlice[float64](sections[indexPostingFrequencies])
+	m.postingSpans = mappedSlice[float64](sections[indexPostingSpans])
+	m.nodeLayers = mappedSlice[uint64](sections[indexNodeLayers])
+	m.layerLinks = mappedSlice[uint64](sections[indexLayerLinks])
+	m.links = mappedSlice[uint32](sections[indexLinks])
+
+	// Array lengths must agree with each other; contents are left to Verify
+	vectors := len(m.vectorTracks)
+	postings := len(m.postingTracks)
+	switch {
+	case len(m.vectorTimes) != vectors || len(m.vectorData) != vectors*m.config.Dim:
+		return fmt.Errorf("%w: vector sections disagree on the vector count", ErrCorrupted)
+	case len(m.hashStarts) != len(m.hashValues)+1 || m.hashStarts[len(m.hashValues)] != uint64(postings):
+		return fmt.Errorf("%w: hash sections disagree on the posting count", ErrCorrupted)
+	case len(m.postingTimes) != postings || len(m.postingFrequencies) != postings || len(m.postingSpans) != postings:
+		return fmt.Errorf("%w: posting sections disagree on the posting count", ErrCorrupted)
+	case len(m.nodeLayers) != vectors+1 || len(m.layerLinks) == 0 ||
+		m.nodeLayers[vectors] != uint64(len(m.layerLinks)-1) || m.layerLinks[len(m.layerLinks)-1] != uint64(len(m.links)):
+		return fmt.Errorf("%w: graph sections disagree on the node count", ErrCorrupted)
+	case vectors == 0 && header.EntryPoint != -1, vectors > 0 && (header.EntryPoint < 0 || header.EntryPoint >= int64(vectors)):
+		return fmt.Errorf("%w: invalid graph entry point %d", ErrCorrupted, header.EntryPoint)
+	case vectors > 0 && m.nodeLayers[header.EntryPoint+1]-m.nodeLayers[header.EntryPoint] != uint64(header.MaxLevel)+1:
+		return fmt.Errorf("%w: graph entry point is not on the top level", ErrCorrupted)
+	}
+	return nil
+}
+
+// mappedSlice reinterprets mapped bytes as a slice of T without copying
+func mappedSlice[T uint32 | uint64 | float32 | float64](data []byte) []T {
+	if len(data) == 0 {
+		return nil
+	}
+	var zero T
+	return unsafe.Slice((*T)(unsafe.Pointer(&data[0])), len(data)/int(unsafe.Sizeof(zero)))
+}
+
+// vector returns the components of a vector in place
+func (m *mappedIndex) vector(id int) []float32 {
+	dim := m.config.Dim
+	return m.vectorData[id*dim : (id+1)*dim : (id+1)*dim]
+}
+
+// searcher returns a search over the mapped graph. Open only checks the
+// section lengths, so the links of every visited node are bounds-checked; on
+// the first invalid one the search sees no further links and *corrupted is
+// set.
+func (m *mappedIndex) searcher(corrupted *error) hnswSearch {
+	nodes := len(m.vectorTracks)
+	return hnswSearch{
+		entryPoint: int(m.header.EntryPoint),
+		maxLevel:   int(m.header.MaxLevel),
+		links: func(id, level int) []uint32 {
+			if *corrupted != nil {
+				return nil
+			}
+			start, end := m.nodeLayers[id], m.nodeLayers[id+1]
+			layer := start + uint64(level)
+			if end < start || layer >= end || end >= uint64(len(m.layerLinks)) {
+				*corrupted = fmt.Errorf("%w: node %d has no layer %d", ErrCorrupted, id, level)
+				return nil
+			}
+			first, last := m.layerLinks[layer], m.layerLinks[layer+1]
+			if first > last || last > uint64(len(m.links)) {
+				*corrupted = fmt.Errorf("%w: links of node %d on layer %d lie outside the links section", ErrCorrupted, id, level)
+				return nil
+			}
+			links := m.links[first:last]
+			for _, link := range links {
+				if int(link) >= nodes {
+					*corrupted = fmt.Errorf("%w: node %d links to invalid node %d on layer %d", ErrCorrupted, id, link, level)
+					return nil
+				}
+			}
+			return links
+		},
+		vector:   m.vector,
+		distance: m.config.Metric.distance(),
+		deleted: func(id int) bool {
+			track := int(m.vectorTracks[id])
+			if track > len(m.tracks) && *corrupted == nil {
+				*corrupted = fmt.Errorf("%w: vector %d belongs to track %d of %d", ErrCorrupted, id, track, len(m.tracks))
+			}
+			return track >= len(m.tracks)
+		},
+	}
+}
+
+// track returns the metadata of the track with index i, which may come from
+// the vector or posting sections
+func (m *mappedIndex) track(i uint32) (*TrackMetadata, error) {
+	if int(i) >= len(m.tracks) {
+		return nil, fmt.Errorf("%w: reference to track %d of %d", ErrCorrupted, i, len(m.tracks))
+	}
+	return m.tracks[i], nil
+}
+
+// verify checks the section checksums and that every stored index refers to
+// an existing track, posting, layer or node
+func (m *mappedIndex) verify() error {
+	for i, section := range m.header.Sections {
+		if crc32.ChecksumIEEE(m.data[section.Offset:section.Offset+section.Length]) != section.Checksum {
+			return fmt.Errorf("%w: section %d checksum mismatch", ErrCorrupted, i)
+		}
+	}
+
+	for i, track := range m.vectorTracks {
+		if int(track) > len(m.tracks) {
+			return fmt.Errorf("%w: vector %d belongs to track %d of %d", ErrCorrupted, i, track, len(m.tracks))
+		}
+	}
+	for i, track := range m.postingTracks {
+		if int(track) >= len(m.tracks) {
+			return fmt.Errorf("%w: posting %d belongs to track %d of %d", ErrCorrupted, i, track, len(m.tracks))
+		}
+	}
+	for i := 1; i < len(m.hashValues); i++ {
+		if m.hashValues[i] <= m.hashValues[i-1] {
+			return fmt.Errorf("%w: hash values are not ascending at %d", ErrCorrupted, i)
+		}
+	}
+	for i := 1; i < len(m.hashStarts); i++ {
+		if m.hashStarts[i] < m.hashStarts[i-1] {
+			return fmt.Errorf("%w: hash postings are not ascending at %d", ErrCorrupted, i)
+		}
+	}
+
+	// Graph: node i has layers nodeLayers[i] to nodeLayers[i+1], at least
+	// one, and links only to nodes present on the layer
+	if m.nodeLayers[0] != 0 {
+		return fmt.Errorf("%w: graph layers start at %d", ErrCorrupted, m.nodeLayers[0])
+	}
+	if last := m.nodeLayers[len(m.nodeLayers)-1]; last >= uint64(len(m.layerLinks)) {
+		return fmt.Errorf("%w: graph has %d layers, links cover %d", ErrCorrupted, last, len(m.layerLinks)-1)
+	}
+	levels := make([]int, len(m.nodeLayers)-1)
+	for i := range levels {
+		if m.nodeLayers[i+1] <= m.nodeLayers[i] {
+			return fmt.Errorf("%w: graph layers are not ascending at node %d", ErrCorrupted, i)
+		}
+		levels[i] = int(m.nodeLayers[i+1] - m.nodeLayers[i] - 1)
+		if levels[i] > int(m.header.MaxLevel) {
+			return fmt.Errorf("%w: node %d has invalid level %d", ErrCorrupted, i, levels[i])
+		}
+	}
+	if len(levels) > 0 && levels[m.header.EntryPoint] != int(m.header.MaxLevel) {
+		return fmt.Errorf("%w: graph entry point is not on the top level", ErrCorrupted)
+	}
+	for i := 1; i < len(m.layerLinks); i++ {
+		if m.layerLinks[i] < m.layerLinks[i-1] {
+			return fmt.Errorf("%w: graph links are not ascending at layer %d", ErrCorrupted, i)
+		}
+	}
+	for id, level := range levels {
+		for l := 0; l <= level; l++ {
+			layer := m.nodeLayers[id] + uint64(l)
+			for _, link := range m.links[m.layerLinks[layer]:m.layerLinks[layer+1]] {
+				if int(link) >= len(levels) || levels[link] < l {
+					return fmt.Errorf("%w: node %d links to invalid node %d on layer %d", ErrCorrupted, id, link, l)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Verify checks the section checksums and the consistency of the whole
+// index. It reads every page of the file, so it is slow for large indexes.
+func (m *MappedDB) Verify() error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.index == nil {
+		return fmt.Errorf("mapped database is closed")
+	}
+	return m.index.verify()
+}
+
+// Close unmaps the index file
+func (m *MappedDB) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.index == nil {
+		return nil
+	}
+	err := unmapFile(m.index.data)
+	m.index = nil
+	return err
+}
+
+// current returns the open index; the caller holds m.mu
+func (m *MappedDB) current() (*mappedIndex, error) {
+	if m.index == nil {
+		return nil, fmt.Errorf("mapped database is closed")
+	}
+	return m.index, nil
+}
+
+// Add is not supported; build indexes with MemoryDB.WriteIndex
+func (m *MappedDB) Add(ctx context.Context, metadata *TrackMetadata, vectors []*fingerprint.Vector) error {
+	return ErrReadOnly
+}
+
+// Delete is not supported; build indexes with MemoryDB.WriteIndex
+func (m *MappedDB) Delete(ctx context.Context, trackID string) error {
+	return ErrReadOnly
+}
+
+// AddHashes is not supported; build indexes with MemoryDB.WriteIndex
+func (m *MappedDB) AddHashes(ctx context.Context, trackID string, hashes []fingerprint.Hash) error {
+	return ErrReadOnly
+}
+
+// Update is not supported; build indexes with MemoryDB.WriteIndex
+func (m *MappedDB) Update(ctx context.Context, metadata *TrackMetadata) error {
+	return ErrReadOnly
+}
+
+// Search finds the k nearest neighbors of every query vector, like
+// MemoryDB.Search. Matched vectors are copies that outlive Load and Close.
+func (m *MappedDB) Search(ctx context.Context, query []*fingerprint.Vector, k int) ([]SearchResult, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	index, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+
+	var corrupted error
+	search := index.searcher(&corrupted)
+	ef := max(index.config.EfSearch, k)
+	var results []SearchResult
+	for i, vector := range query {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if len(vector.Data) != index.config.Dim {
+			return nil, fmt.Errorf("query vector %d has dimension %d, expected %d", i, len(vector.Data), index.config.Dim)
+		}
+
+		candidates := search.search(vector.Data, k, ef)
+		if corrupted != nil {
+			return nil, corrupted
+		}
+		for _, candidate := range candidates {
+			// Copied out of the mapping, which Load and Close unmap
+			matched := &fingerprint.Vector{
+				Data:    append([]float32(nil), index.vector(candidate.id)...),
+				TimeRef: index.vectorTimes[candidate.id],
+				TrackID: index.tracks[index.vectorTracks[candidate.id]].ID,
+			}
+			results = append(results, SearchResult{
+				TrackID:       matched.TrackID,
+				Score:         index.config.Metric.score(candidate.distance),
+				TimeOffset:    matched.TimeRef - vector.TimeRef,
+				MatchedVector: matched,
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// LookupHashes returns every stored hash sharing a value with a query hash
+func (m *MappedDB) LookupHashes(ctx context.Context, query []fingerprint.Hash) ([]HashMatch, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	index, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+
+	var matches []HashMatch
+	for _, hash := range query {
+		i := sort.Search(len(index.hashValues), func(i int) bool {
+			return index.hashValues[i] >= hash.Value
+		})
+		if i == len(index.hashValues) || index.hashValues[i] != hash.Value {
+			continue
+		}
+		start, end := index.hashStarts[i], index.hashStarts[i+1]
+		if start > end || end > uint64(len(index.postingTracks)) {
+			return nil, fmt.Errorf("%w: postings of hash %08x lie outside the posting sections", ErrCorrupted, hash.Value)
+		}
+		for p := start; p < end; p++ {
+			track, err := index.track(index.postingTracks[p])
+			if err != nil {
+				return nil, err
+			}
+			matches = append(matches, HashMatch{
+				Query: hash,
+				Reference: fingerprint.Hash{
+					Value:     hash.Value,
+					Time:      index.postingTimes[p],
+					Frequency: index.postingFrequencies[p],
+					Span:      index.postingSpans[p],
+					TrackID:   track.ID,
+				},
+			})
+		}
+	}
+
+	return matches, ctx.Err()
+}
+
+// Get retrieves track metadata
+func (m *MappedDB) Get(ctx context.Context, trackID string) (*TrackMetadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	index, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+	i, exists := index.trackIndex[trackID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, trackID)
+	}
+	return index.tracks[i].Clone(), nil
+}
+
+// List returns all track metadata ordered by ID
+func (m *MappedDB) List(ctx context.Context) ([]*TrackMetadata, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	index, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+	tracks := make([]*TrackMetadata, len(index.tracks))
+	for i, metadata := range index.tracks {
+		tracks[i] = metadata.Clone()
+	}
+	return tracks, nil
+}
+
+// Save copies the mapped index file to path atomically
+func (m *MappedDB) Save(ctx context.Context, path string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	index, err := m.current()
+	if err != nil {
+		return err
+	}
+	err = writeFileAtomic(path, func(file *os.File) error {
+		_, err := file.Write(index.data)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save index: %w", err)
+	}
+	return nil
+}
+
+// Load maps another index file in place of the current one, which is
+// unmapped
+func (m *MappedDB) Load(ctx context.Context, path string) error {
+	index, err := openMappedIndex(path)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.index != nil {
+		unmapFile(m.index.data)
+	}
+	m.index = index
+	return nil
+}
@@ -0,0 +1,289 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// sortMatches orders hash matches for comparison
+func sortMatches(matches []HashMatch) {
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.Query.Value != b.Query.Value {
+			return a.Query.Value < b.Query.Value
+		}
+		if a.Reference.TrackID != b.Reference.TrackID {
+			return a.Reference.TrackID < b.Reference.TrackID
+		}
+		if a.Reference.Time != b.Reference.Time {
+			return a.Reference.Time < b.Reference.Time
+		}
+		return a.Query.Time < b.Query.Time
+	})
+}
+
+func TestMappedDB(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 8
+	memory := createTestDB(t, config, 6, 30)
+
+	path := filepath.Join(t.TempDir(), "library.idx")
+	if err := memory.WriteIndex(ctx, path); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	mapped, err := OpenMappedDB(path)
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	defer mapped.Close()
+	if err := mapped.Verify(); err != nil {
+		t.Fatalf("Failed to verify index: %v", err)
+	}
+
+	// The mapped graph answers exactly like the one in memory
+	query := createTestDB(t, config, 1, 10).vectors
+	want, err := memory.Search(ctx, query, 5)
+	if err != nil {
+		t.Fatalf("Failed to search memory: %v", err)
+	}
+	got, err := mapped.Search(ctx, query, 5)
+	if err != nil {
+		t.Fatalf("Failed to search index: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Error("Mapped search results differ from memory")
+	}
+
+	var hashes []fingerprint.Hash
+	for _, trackHashes := range memory.trackHashes {
+		hashes = append(hashes, trackHashes[:10]...)
+	}
+	hashes = append(hashes, fingerprint.Hash{Value: 1 << 20})
+	wantMatches, _ := memory.LookupHashes(ctx, hashes)
+	gotMatches, err := mapped.LookupHashes(ctx, hashes)
+	if err != nil {
+		t.Fatalf("Failed to look up hashes: %v", err)
+	}
+	sortMatches(wantMatches)
+	sortMatches(gotMatches)
+	if len(gotMatches) == 0 || !reflect.DeepEqual(gotMatches, wantMatches) {
+		t.Errorf("Mapped hash lookup differs from memory: %d vs %d matches", len(gotMatches), len(wantMatches))
+	}
+
+	wantTracks, _ := memory.List(ctx)
+	gotTracks, err := mapped.List(ctx)
+	if err != nil || !reflect.DeepEqual(gotTracks, wantTracks) {
+		t.Errorf("Mapped track list differs from memory (err %v)", err)
+	}
+	if metadata, err := mapped.Get(ctx, "track-03"); err != nil || metadata.Title != "Title track-03" {
+		t.Errorf("Expected track-03, got %+v (err %v)", metadata, err)
+	}
+	if _, err := mapped.Get(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for an unknown track, got %v", err)
+	}
+
+	// Writes are refused
+	if err := mapped.Add(ctx, &TrackMetadata{ID: "new"}, nil); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from Add, got %v", err)
+	}
+	if err := mapped.Delete(ctx, "track-01"); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly from Delete, got %v", err)
+	}
+
+	// Save copies the index and Load switches to another one
+	copied := filepath.Join(t.TempDir(), "copy.idx")
+	if err := mapped.Save(ctx, copied); err != nil {
+		t.Fatalf("Failed to save index: %v", err)
+	}
+	smaller := createTestDB(t, config, 2, 5)
+	if err := smaller.WriteIndex(ctx, path); err != nil {
+		t.Fatalf("Failed to rewrite index: %v", err)
+	}
+	if err := mapped.Load(ctx, path); err != nil {
+		t.Fatalf("Failed to load index: %v", err)
+	}
+	if tracks, _ := mapped.List(ctx); len(tracks) != 2 {
+		t.Errorf("Expected 2 tracks after loading, got %d", len(tracks))
+	}
+	reopened, err := OpenMappedDB(copied)
+	if err != nil {
+		t.Fatalf("Failed to open copy: %v", err)
+	}
+	defer reopened.Close()
+	if tracks, _ := reopened.List(ctx); len(tracks) != 6 {
+		t.Errorf("Expected 6 tracks in the copy, got %d", len(tracks))
+	}
+
+	if err := mapped.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	if _, err := mapped.Search(ctx, query, 1); err == nil {
+		t.Error("Expected an error searching a closed index")
+	}
+
+	// Matched vectors were copied out of the mapping
+	if !reflect.DeepEqual(got[0].MatchedVector, want[0].MatchedVector) {
+		t.Error("Expected matched vectors to outlive the mapping")
+	}
+}
+
+func TestMappedDBCorruption(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	dir := t.TempDir()
+	path := filepath.Join(dir, "library.idx")
+	memory := createTestDB(t, config, 3, 5)
+	if err := memory.WriteIndex(ctx, path); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	queries := memory.vectors[:2]
+	var hashes []fingerprint.Hash
+	for _, trackHashes := range memory.trackHashes {
+		hashes = append(hashes, trackHashes...)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read: %v", err)
+	}
+
+	// Every flipped byte is caught by opening or by Verify, except in the
+	// padding between header fields and sections
+	var header indexHeader
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, &header); err != nil {
+		t.Fatalf("Failed to read header: %v", err)
+	}
+	covered := make([]bool, len(data))
+	for i := 0; i < indexHeaderSize-4; i++ {
+		covered[i] = true
+	}
+	for _, section := range header.Sections {
+		for i := section.Offset; i < section.Offset+section.Length; i++ {
+			covered[i] = true
+		}
+	}
+
+	corrupted := filepath.Join(dir, "corrupted.idx")
+	for i := 0; i < len(data); i++ {
+		if !covered[i] {
+			continue
+		}
+		flipped := append([]byte(nil), data...)
+		flipped[i] ^= 0x10
+		if err := os.WriteFile(corrupted, flipped, 0o644); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		mapped, err := OpenMappedDB(corrupted)
+		if err == nil {
+			// Whatever opens can be queried without reading outside the
+			// mapping
+			if _, err := mapped.Search(ctx, queries, 3); err != nil && !errors.Is(err, ErrCorrupted) {
+				t.Fatalf("Byte %d: expected search to succeed or report corruption, got %v", i, err)
+			}
+			if _, err := mapped.LookupHashes(ctx, hashes); err != nil && !errors.Is(err, ErrCorrupted) {
+				t.Fatalf("Byte %d: expected lookup to succeed or report corruption, got %v", i, err)
+			}
+			err = mapped.Verify()
+			mapped.Close()
+		}
+		if !errors.Is(err, ErrCorrupted) && !errors.Is(err, ErrUnsupportedVersion) {
+			t.Fatalf("Byte %d: expected a corruption error, got %v", i, err)
+		}
+	}
+
+	// Indices beyond their arrays open, since opening only checks the
+	// layout, but are reported by the queries that follow them
+	for _, test := range []struct {
+		name    string
+		section int
+		search  bool
+	}{
+		{"link", indexLinks, true},
+		{"vector track", indexVectorTracks, true},
+		{"posting track", indexPostingTracks, false},
+		{"hash start", indexHashStarts, false},
+	} {
+		broken := append([]byte(nil), data...)
+		offset := header.Sections[test.section].Offset
+		binary.LittleEndian.PutUint32(broken[offset:], math.MaxUint32)
+		if err := os.WriteFile(corrupted, broken, 0o644); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		mapped, err := OpenMappedDB(corrupted)
+		if err != nil {
+			t.Fatalf("%s: failed to open: %v", test.name, err)
+		}
+		if test.search {
+			_, err = mapped.Search(ctx, queries, 3)
+		} else {
+			_, err = mapped.LookupHashes(ctx, hashes)
+		}
+		if !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%s: expected ErrCorrupted, got %v", test.name, err)
+		}
+		mapped.Close()
+	}
+
+	// Graph layers that pass the checksums but do not start at zero, do not
+	// ascend or run past the layer links are reported without panicking
+	nodeLayers := header.Sections[indexNodeLayers]
+	setLayer := func(i int, value uint64) func([]byte, *indexHeader) {
+		return func(broken []byte, _ *indexHeader) {
+			binary.LittleEndian.PutUint64(broken[nodeLayers.Offset+8*uint64(i):], value)
+		}
+	}
+	for _, test := range []struct {
+		name   string
+		modify func([]byte, *indexHeader)
+	}{
+		{"nonzero start", setLayer(0, 1)},
+		{"wrapped start", setLayer(0, math.MaxUint64)},
+		{"descending", setLayer(1, 0)},
+		{"past the links", setLayer(int(nodeLayers.Length/8)-1, math.MaxUint64)},
+		{"no layer links", func(broken []byte, crafted *indexHeader) {
+			setLayer(int(nodeLayers.Length/8)-1, math.MaxUint64)(broken, crafted)
+			crafted.Sections[indexLayerLinks].Length = 0
+		}},
+	} {
+		broken := append([]byte(nil), data...)
+		crafted := header
+		test.modify(broken, &crafted)
+		for i, section := range crafted.Sections {
+			crafted.Sections[i].Checksum = crc32.ChecksumIEEE(broken[section.Offset : section.Offset+section.Length])
+		}
+		copy(broken, encodeIndexHeader(crafted))
+		if err := os.WriteFile(corrupted, broken, 0o644); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		mapped, err := OpenMappedDB(corrupted)
+		if err == nil {
+			err = mapped.Verify()
+			mapped.Close()
+		}
+		if !errors.Is(err, ErrCorrupted) {
+			t.Errorf("%s: expected ErrCorrupted, got %v", test.name, err)
+		}
+	}
+
+	// Truncated files fail to open
+	for _, n := range []int{0, 10, indexHeaderSize, len(data) - 1} {
+		if err := os.WriteFile(corrupted, data[:n], 0o644); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		if _, err := OpenMappedDB(corrupted); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("Truncated to %d bytes: expected ErrCorrupted, got %v", n, err)
+		}
+	}
+}
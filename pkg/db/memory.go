@@ -0,0 +1,593 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/kshitijk4poor/shazam-golang/internal/bincodec"
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// MemoryDB implements the VectorDB and HashIndex interfaces in memory.
+// Vectors are indexed with an HNSW graph under Config.Metric and hashes
+// with an inverted index from hash value to postings. Deleted tracks leave
+// tombstones that are skipped by queries until Compact reclaims them.
+type MemoryDB struct {
+	mu          sync.RWMutex
+	config      Config
+	tracks      map[string]*TrackMetadata
+	vectors     []*fingerprint.Vector
+	graph       *hnswGraph
+	postings    map[uint32][]fingerprint.Hash
+	trackHashes map[string][]fingerprint.Hash
+
+	dead         []bool              // Per vector: belongs to a deleted track
+	deadVectors  int                 // Number of dead vectors
+	tombstones   map[string][]uint32 // Deleted track ID -> values of its remaining postings
+	deadPostings int                 // Number of postings of deleted tracks
+	postingCount int                 // Number of postings, live and dead
+	version      uint64              // Incremented by every change, for Compact
+
+	quantizer quantizer   // Set once Config.Quantization can be applied
+	codes     []byte      // Quantized vectors, quantizer.codeSize() bytes each
+	exact     *vectorFile // Exact vectors while quantizing; their Data in vectors is nil
+
+	sequence uint64         // Number of the last write-ahead log record applied
+	wal      *writeAheadLog // Set by OpenMemoryDB
+	path     string         // Database file of a database opened with OpenMemoryDB
+	saveMu   sync.Mutex     // Held by Save around the snapshot and log truncation, before mu
+}
+
+// DefaultConfig returns the default database configuration
+func DefaultConfig() Config {
+	return Config{
+		M:              16,
+		EfConstruction: 200,
+		EfSearch:       64,
+		Dim:            fingerprint.DefaultConfig().VectorDim,
+		MaxElements:    1000000,
+		Quantization:   QuantizeNone,
+		PQTrainingSize: 4096,
+		Rerank:         4,
+	}
+}
+
+// NewMemoryDB creates a new empty in-memory database
+func NewMemoryDB(config Config) *MemoryDB {
+	d := &MemoryDB{config: config}
+	d.reset()
+	return d
+}
+
+// reset clears all contents
+func (d *MemoryDB) reset() {
+	d.tracks = make(map[string]*TrackMetadata)
+	d.vectors = nil
+	d.graph = newHNSWGraph(d.config.M, d.config.EfConstruction, d.vectorData, d.config.Metric.distance())
+	d.postings = make(map[uint32][]fingerprint.Hash)
+	d.trackHashes = make(map[string][]fingerprint.Hash)
+	d.dead = nil
+	d.deadVectors = 0
+	d.tombstones = make(map[string][]uint32)
+	d.deadPostings = 0
+	d.postingCount = 0
+	d.quantizer = nil
+	d.codes = nil
+	d.exact = nil
+}
+
+// vectorData resolves a graph node ID to its vector
+func (d *MemoryDB) vectorData(id int) []float32 {
+	if d.exact != nil {
+		return d.exact.vector(id)
+	}
+	return d.vectors[id].Data
+}
+
+// storedVector returns a copy of a stored vector that shares no memory
+// with the database
+func (d *MemoryDB) storedVector(id int) *fingerprint.Vector {
+	vector := *d.vectors[id]
+	vector.Data = append([]float32(nil), d.vectorData(id)...)
+	return &vector
+}
+
+// Add inserts vectors and metadata for a track
+func (d *MemoryDB) Add(ctx context.Context, metadata *TrackMetadata, vectors []*fingerprint.Vector) error {
+	if metadata == nil || metadata.ID == "" {
+		return fmt.Errorf("track metadata must have an ID")
+	}
+	if err := metadata.Validate(); err != nil {
+		return fmt.Errorf("failed to add track %s: %w", metadata.ID, err)
+	}
+	for i, vector := range vectors {
+		if d.config.Dim > 0 && len(vector.Data) != d.config.Dim {
+			return fmt.Errorf("vector %d has dimension %d, expected %d", i, len(vector.Data), d.config.Dim)
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.checkAdd(metadata, vectors); err != nil {
+		return err
+	}
+	err := d.log(walAdd, func(w *bincodec.Encoder) error {
+		return encodeAdd(w, metadata, vectors)
+	})
+	if err != nil {
+		return err
+	}
+	d.add(metadata, vectors)
+
+	return nil
+}
+
+// checkAdd reports why a track cannot be added
+func (d *MemoryDB) checkAdd(metadata *TrackMetadata, vectors []*fingerprint.Vector) error {
+	if _, exists := d.tracks[metadata.ID]; exists {
+		return fmt.Errorf("track %s already exists", metadata.ID)
+	}
+	if d.quantizing() {
+		// The exact vectors are stored in fixed-size slots
+		dim := d.storedDim()
+		for i, vector := range vectors {
+			if dim <= 0 {
+				dim = len(vector.Data)
+			}
+			if len(vector.Data) != dim || dim == 0 {
+				return fmt.Errorf("vector %d has dimension %d, expected %d", i, len(vector.Data), dim)
+			}
+		}
+	}
+	if d.config.MaxElements > 0 && len(d.vectors)-d.deadVectors+len(vectors) > d.config.MaxElements {
+		return fmt.Errorf("adding %d vectors would exceed the maximum of %d", len(vectors), d.config.MaxElements)
+	}
+	return nil
+}
+
+// add stores a track and indexes its vectors
+func (d *MemoryDB) add(metadata *TrackMetadata, vectors []*fingerprint.Vector) {
+	// Postings can only be told apart by track ID, so those of an earlier
+	// track with the same ID must go before it comes back
+	if values, deleted := d.tombstones[metadata.ID]; deleted {
+		d.purgePostings(metadata.ID, values)
+	}
+
+	d.tracks[metadata.ID] = metadata.Clone()
+
+	for _, vector := range vectors {
+		copied := *vector
+		copied.TrackID = metadata.ID
+		d.vectors = append(d.vectors, &copied)
+		d.dead = append(d.dead, false)
+		d.spill(len(d.vectors) - 1)
+		d.graph.insert(len(d.vectors) - 1)
+	}
+	d.quantize()
+	d.version++
+}
+
+// Search finds the k nearest neighbors of every query vector. Score is in
+// [0, 1] as described at Metric and TimeOffset the reference time minus the
+// query time.
+// With quantization the graph is searched on estimated distances and the
+// best k*Config.Rerank candidates re-ranked on exact ones, so Scores are
+// always exact.
+func (d *MemoryDB) Search(ctx context.Context, query []*fingerprint.Vector, k int) ([]SearchResult, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	search := d.graph.searcher()
+	if d.deadVectors > 0 {
+		search.deleted = d.isDead
+	}
+	candidates := k
+	if d.quantizer != nil {
+		search.estimate = func(query []float32) func(id int) float64 {
+			return d.quantizer.estimator(query, d.codes)
+		}
+		candidates = k * max(d.config.Rerank, 1)
+	}
+	ef := max(d.config.EfSearch, candidates)
+	var results []SearchResult
+	for i, vector := range query {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if d.config.Dim > 0 && len(vector.Data) != d.config.Dim {
+			return nil, fmt.Errorf("query vector %d has dimension %d, expected %d", i, len(vector.Data), d.config.Dim)
+		}
+
+		found := search.search(vector.Data, candidates, ef)
+		if d.quantizer != nil {
+			found = rerank(vector.Data, found, k, d.vectorData, d.graph.distance)
+		}
+		for _, candidate := range found {
+			matched := d.vectors[candidate.id]
+			if d.exact != nil {
+				// Copied out of the vector file, which Close, Compact and
+				// Load release
+				matched = d.storedVector(candidate.id)
+			}
+			results = append(results, SearchResult{
+				TrackID:       matched.TrackID,
+				Score:         d.config.Metric.score(candidate.distance),
+				TimeOffset:    matched.TimeRef - vector.TimeRef,
+				MatchedVector: matched,
+			})
+		}
+	}
+
+	return results, nil
+}
+
+// Delete removes a track, its hashes and its vectors. The vectors stay in
+// the graph and the hashes in the inverted index as tombstones, skipped by
+// Search and LookupHashes, until Compact removes them.
+func (d *MemoryDB) Delete(ctx context.Context, trackID string) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.tracks[trackID]; !exists {
+		return fmt.Errorf("%w: %s", ErrNotFound, trackID)
+	}
+	err := d.log(walDelete, func(w *bincodec.Encoder) error {
+		w.Text(trackID)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d.remove(trackID)
+
+	return nil
+}
+
+// remove drops a track and tombstones its vectors and postings
+func (d *MemoryDB) remove(trackID string) {
+	delete(d.tracks, trackID)
+
+	if hashes := d.trackHashes[trackID]; len(hashes) > 0 {
+		values := make([]uint32, len(hashes))
+		for i, hash := range hashes {
+			values[i] = hash.Value
+		}
+		d.tombstones[trackID] = values
+		d.deadPostings += len(values)
+	}
+	delete(d.trackHashes, trackID)
+
+	for id, vector := range d.vectors {
+		if !d.dead[id] && vector.TrackID == trackID {
+			d.dead[id] = true
+			d.deadVectors++
+		}
+	}
+	d.version++
+}
+
+// isDead reports whether a graph node belongs to a deleted track
+func (d *MemoryDB) isDead(id int) bool {
+	return d.dead[id]
+}
+
+// Get retrieves track metadata
+func (d *MemoryDB) Get(ctx context.Context, trackID string) (*TrackMetadata, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	metadata, exists := d.tracks[trackID]
+	if !exists {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, trackID)
+	}
+	return metadata.Clone(), nil
+}
+
+// List returns all track metadata ordered by ID
+func (d *MemoryDB) List(ctx context.Context) ([]*TrackMetadata, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	tracks := make([]*TrackMetadata, 0, len(d.tracks))
+	for _, metadata := range d.tracks {
+		tracks = append(tracks, metadata.Clone())
+	}
+	sort.Slice(tracks, func(i, j int) bool {
+		return tracks[i].ID < tracks[j].ID
+	})
+
+	return tracks, nil
+}
+
+// Export returns a copy of a track's metadata, vectors and hashes
+func (d *MemoryDB) Export(ctx context.Context, trackID string) (*TrackMetadata, []*fingerprint.Vector, []fingerprint.Hash, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	metadata, exists := d.tracks[trackID]
+	if !exists {
+		return nil, nil, nil, fmt.Errorf("%w: %s", ErrNotFound, trackID)
+	}
+	copied := metadata.Clone()
+
+	var vectors []*fingerprint.Vector
+	for id, vector := range d.vectors {
+		if !d.dead[id] && vector.TrackID == trackID {
+			vectors = append(vectors, d.storedVector(id))
+		}
+	}
+	hashes := append([]fingerprint.Hash(nil), d.trackHashes[trackID]...)
+
+	return copied, vectors, hashes, nil
+}
+
+// AddHashes inserts hashes for a track that has been added with Add
+func (d *MemoryDB) AddHashes(ctx context.Context, trackID string, hashes []fingerprint.Hash) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.tracks[trackID]; !exists {
+		return fmt.Errorf("%w: %s", ErrNotFound, trackID)
+	}
+	err := d.log(walAddHashes, func(w *bincodec.Encoder) error {
+		encodeHashes(w, trackID, hashes)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	d.addHashes(trackID, hashes)
+
+	return nil
+}
+
+// addHashes stores hashes for a track
+func (d *MemoryDB) addHashes(trackID string, hashes []fingerprint.Hash) {
+	for _, hash := range hashes {
+		hash.TrackID = trackID
+		d.postings[hash.Value] = append(d.postings[hash.Value], hash)
+		d.trackHashes[trackID] = append(d.trackHashes[trackID], hash)
+	}
+	d.postingCount += len(hashes)
+	d.version++
+}
+
+// LookupHashes returns every stored hash sharing a value with a query hash
+func (d *MemoryDB) LookupHashes(ctx context.Context, query []fingerprint.Hash) ([]HashMatch, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var matches []HashMatch
+	for _, hash := range query {
+		for _, reference := range d.postings[hash.Value] {
+			if _, deleted := d.tombstones[reference.TrackID]; deleted {
+				continue
+			}
+			matches = append(matches, HashMatch{Query: hash, Reference: reference})
+		}
+	}
+
+	return matches, ctx.Err()
+}
+
+// Save persists the database to path in the format described at
+// encodeSnapshot. The file is replaced atomically, so a crash during Save
+// leaves the previous file intact. Saving a database opened with
+// OpenMemoryDB to its own path is a checkpoint: the write-ahead log is
+// truncated once the snapshot is on disk. Writers wait until Save returns,
+// and concurrent saves run one after another.
+func (d *MemoryDB) Save(ctx context.Context, path string) error {
+	d.saveMu.Lock()
+	defer d.saveMu.Unlock()
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	s := &snapshot{
+		config:   d.config,
+		vectors:  d.exactVectors(),
+		dead:     d.dead,
+		hashes:   d.trackHashes,
+		nodes:    d.graph.nodes,
+		entry:    d.graph.entryPoint,
+		level:    d.graph.maxLevel,
+		sequence: d.sequence,
+	}
+	for _, metadata := range d.tracks {
+		s.tracks = append(s.tracks, metadata)
+	}
+	sort.Slice(s.tracks, func(i, j int) bool {
+		return s.tracks[i].ID < s.tracks[j].ID
+	})
+	data, err := encodeSnapshot(s)
+	if err != nil {
+		return fmt.Errorf("failed to encode database: %w", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	err = writeFileAtomic(path, func(file *os.File) error {
+		_, err := file.Write(data)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save database: %w", err)
+	}
+
+	// Every logged record is in the snapshot now. A crash before the
+	// truncation is harmless: replay skips records the snapshot includes.
+	if d.wal != nil && path == d.path {
+		if err := d.wal.truncate(); err != nil {
+			return fmt.Errorf("failed to checkpoint: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Load restores the database from a file written by Save, replacing its
+// contents, and replays the write-ahead log at WALPath(path) if there is
+// one. Corrupted files are rejected with ErrCorrupted and files whose
+// vectors do not have the configured Dim with ErrDimensionMismatch; the
+// database is left unchanged in both cases. The graph settings are taken
+// from the file since the stored links were built with them.
+func (d *MemoryDB) Load(ctx context.Context, path string) error {
+	_, err := d.load(ctx, path)
+	return err
+}
+
+// LoadMemoryDB loads a database file into a new MemoryDB configured as
+// stored in the file, for tools that don't know how it was built.
+// Quantization is not stored and stays off.
+func LoadMemoryDB(ctx context.Context, path string) (*MemoryDB, error) {
+	s, err := readSnapshot(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	d := NewMemoryDB(Config{Metric: s.config.Metric})
+	if _, err := d.loadSnapshot(s, path); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Config returns the database configuration
+func (d *MemoryDB) Config() Config {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.config
+}
+
+// readSnapshot reads and decodes a database file
+func readSnapshot(ctx context.Context, path string) (*snapshot, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database file: %w", err)
+	}
+
+	s, err := decodeSnapshot(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load implements Load and returns the size of the intact part of the
+// write-ahead log
+func (d *MemoryDB) load(ctx context.Context, path string) (int64, error) {
+	s, err := readSnapshot(ctx, path)
+	if err != nil {
+		return 0, err
+	}
+	return d.loadSnapshot(s, path)
+}
+
+// loadSnapshot replaces the contents of d with the snapshot read from path
+// and the records of its write-ahead log
+func (d *MemoryDB) loadSnapshot(s *snapshot, path string) (int64, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.wal != nil {
+		return 0, fmt.Errorf("cannot load into a database opened with OpenMemoryDB")
+	}
+	if err := checkDim(d.config.Dim, s); err != nil {
+		return 0, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+	if s.config.Metric != d.config.Metric {
+		return 0, fmt.Errorf("failed to load %s: %w: file uses %s, database is configured for %s", path, ErrMetricMismatch, s.config.Metric, d.config.Metric)
+	}
+
+	// Quantization is not stored; the codes are rebuilt with the current
+	// settings
+	s.config.Quantization = d.config.Quantization
+	s.config.PQSubvectors = d.config.PQSubvectors
+	s.config.PQTrainingSize = d.config.PQTrainingSize
+	s.config.Rerank = d.config.Rerank
+
+	// Build the new state aside so that a failed replay changes nothing
+	loaded := NewMemoryDB(s.config)
+	for _, metadata := range s.tracks {
+		loaded.tracks[metadata.ID] = metadata
+	}
+	loaded.vectors = s.vectors
+	loaded.dead = s.dead
+	for _, dead := range s.dead {
+		if dead {
+			loaded.deadVectors++
+		}
+	}
+	loaded.spill(0)
+	loaded.graph.restore(s.nodes, s.entry, s.level)
+	for _, metadata := range s.tracks {
+		hashes := s.hashes[metadata.ID]
+		for _, hash := range hashes {
+			loaded.postings[hash.Value] = append(loaded.postings[hash.Value], hash)
+		}
+		if len(hashes) > 0 {
+			loaded.trackHashes[metadata.ID] = hashes
+		}
+		loaded.postingCount += len(hashes)
+	}
+	loaded.quantize()
+	loaded.sequence = s.sequence
+
+	size, err := loaded.replay(WALPath(path))
+	if err != nil {
+		if loaded.exact != nil {
+			loaded.exact.close()
+		}
+		return 0, fmt.Errorf("failed to load %s: %w", path, err)
+	}
+
+	d.config = loaded.config
+	d.tracks = loaded.tracks
+	d.vectors = loaded.vectors
+	d.graph = loaded.graph
+	d.graph.vector = d.vectorData
+	d.postings = loaded.postings
+	d.trackHashes = loaded.trackHashes
+	d.dead = loaded.dead
+	d.deadVectors = loaded.deadVectors
+	d.tombstones = loaded.tombstones
+	d.deadPostings = loaded.deadPostings
+	d.postingCount = loaded.postingCount
+	d.quantizer = loaded.quantizer
+	d.codes = loaded.codes
+	if d.exact != nil {
+		d.exact.retire()
+	}
+	d.exact = loaded.exact
+	d.version++
+	d.sequence = loaded.sequence
+
+	return size, nil
+}
+
+// checkDim rejects a snapshot whose vectors do not have dimension dim. A dim
+// of 0 accepts any dimension.
+func checkDim(dim int, s *snapshot) error {
+	if dim <= 0 {
+		return nil
+	}
+	stored := s.config.Dim
+	if len(s.vectors) > 0 {
+		stored = len(s.vectors[0].Data)
+	}
+	if stored > 0 && stored != dim {
+		return fmt.Errorf("%w: file has %d-dimensional vectors, database is configured for %d", ErrDimensionMismatch, stored, dim)
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// testDBOptions adjust the tracks createTestDB adds
+type testDBOptions struct {
+	db   *MemoryDB // Database filled instead of a new one
+	seed int64     // Seed of the random vectors and hashes
+	ids  []string  // Track IDs instead of track-00, track-01...
+}
+
+// testDBOption sets a field of testDBOptions
+type testDBOption func(*testDBOptions)
+
+// into fills d instead of a new MemoryDB
+func into(d *MemoryDB) testDBOption {
+	return func(opts *testDBOptions) { opts.db = d }
+}
+
+// withSeed draws the random vectors and hashes from seed
+func withSeed(seed int64) testDBOption {
+	return func(opts *testDBOptions) { opts.seed = seed }
+}
+
+// withIDs names the tracks ids[0], ids[1]...
+func withIDs(ids ...string) testDBOption {
+	return func(opts *testDBOptions) { opts.ids = ids }
+}
+
+// createTestDB fills a database with random vectors and hashes for tracks
+func createTestDB(t *testing.T, config Config, tracks, vectorsPerTrack int, options ...testDBOption) *MemoryDB {
+	t.Helper()
+	ctx := context.Background()
+	opts := testDBOptions{seed: 7}
+	for _, option := range options {
+		option(&opts)
+	}
+	d := opts.db
+	if d == nil {
+		d = NewMemoryDB(config)
+	}
+	rng := rand.New(rand.NewSource(opts.seed))
+	for i := 0; i < tracks; i++ {
+		trackID := fmt.Sprintf("track-%02d", i)
+		if opts.ids != nil {
+			trackID = opts.ids[i]
+		}
+		vectors := make([]*fingerprint.Vector, vectorsPerTrack)
+		hashes := make([]fingerprint.Hash, 3*vectorsPerTrack)
+		for j := range vectors {
+			vectors[j] = &fingerprint.Vector{Data: make([]float32, config.Dim), TimeRef: float64(j) / 4}
+			for k := range vectors[j].Data {
+				vectors[j].Data[k] = rng.Float32()
+			}
+		}
+		for j := range hashes {
+			hashes[j] = fingerprint.Hash{Value: rng.Uint32() % 512, Time: rng.Float64() * 10, Frequency: 1000 * rng.Float64(), Span: rng.Float64()}
+		}
+
+		metadata := &TrackMetadata{ID: trackID, Title: "Title " + trackID, Artist: "Artist", Duration: 10, Added: int64(i)}
+		if err := d.Add(ctx, metadata, vectors); err != nil {
+			t.Fatalf("Failed to add %s: %v", trackID, err)
+		}
+		if err := d.AddHashes(ctx, trackID, hashes); err != nil {
+			t.Fatalf("Failed to add hashes for %s: %v", trackID, err)
+		}
+	}
+	return d
+}
+
+// trackVectors returns the stored vectors of a track
+func trackVectors(d *MemoryDB, trackID string) []*fingerprint.Vector {
+	var vectors []*fingerprint.Vector
+	for _, vector := range d.vectors {
+		if vector.TrackID == trackID {
+			vectors = append(vectors, vector)
+		}
+	}
+	return vectors
+}
+
+func TestMemoryDBAdd(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 8
+	d := createTestDB(t, config, 4, 10)
+
+	tracks, err := d.List(ctx)
+	if err != nil || len(tracks) != 4 {
+		t.Fatalf("Expected 4 tracks, got %d (err %v)", len(tracks), err)
+	}
+	if metadata, err := d.Get(ctx, "track-02"); err != nil || metadata.Title != "Title track-02" {
+		t.Errorf("Expected the metadata of track-02, got %+v (err %v)", metadata, err)
+	}
+
+	// A stored vector is its own nearest neighbor, with its track and time
+	vectors := trackVectors(d, "track-02")
+	query := &fingerprint.Vector{Data: vectors[3].Data, TimeRef: 0.5}
+	results, err := d.Search(ctx, []*fingerprint.Vector{query}, 3)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("Expected 3 results, got %d", len(results))
+	}
+	best := results[0]
+	if best.TrackID != "track-02" || best.Score < 0.999 || best.TimeOffset != vectors[3].TimeRef-0.5 {
+		t.Errorf("Expected track-02 with score 1 and offset %.2f, got %+v", vectors[3].TimeRef-0.5, best)
+	}
+	if best.MatchedVector == nil || best.MatchedVector.TrackID != "track-02" {
+		t.Errorf("Expected the matched vector of track-02, got %+v", best.MatchedVector)
+	}
+
+	// Duplicates, wrong dimensions and missing IDs are rejected
+	if err := d.Add(ctx, &TrackMetadata{ID: "track-02"}, nil); err == nil {
+		t.Error("Expected an error for a duplicate track")
+	}
+	wide := []*fingerprint.Vector{{Data: make([]float32, 9)}}
+	if err := d.Add(ctx, &TrackMetadata{ID: "track-09"}, wide); err == nil {
+		t.Error("Expected an error for a wrong dimension")
+	}
+	if err := d.Add(ctx, &TrackMetadata{}, nil); err == nil {
+		t.Error("Expected an error for a missing ID")
+	}
+	if _, err := d.Search(ctx, wide, 1); err == nil {
+		t.Error("Expected an error for a query of the wrong dimension")
+	}
+	config.MaxElements = 45
+	if err := createTestDB(t, config, 4, 10).Add(ctx, &TrackMetadata{ID: "track-09"}, vectors[:6]); err == nil {
+		t.Error("Expected an error beyond MaxElements")
+	}
+}
+
+func TestMemoryDBLookupHashes(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	d := NewMemoryDB(config)
+	vectors := []*fingerprint.Vector{{Data: []float32{1, 0, 0, 0}}}
+	for _, trackID := range []string{"a", "b"} {
+		if err := d.Add(ctx, &TrackMetadata{ID: trackID}, vectors); err != nil {
+			t.Fatalf("Failed to add %s: %v", trackID, err)
+		}
+	}
+	d.AddHashes(ctx, "a", []fingerprint.Hash{{Value: 1, Time: 1}, {Value: 2, Time: 2}, {Value: 1, Time: 3}})
+	d.AddHashes(ctx, "b", []fingerprint.Hash{{Value: 2, Time: 4}})
+	if err := d.AddHashes(ctx, "c", []fingerprint.Hash{{Value: 1}}); err == nil {
+		t.Error("Expected an error for hashes of a missing track")
+	}
+
+	query := []fingerprint.Hash{{Value: 1, Time: 0.5}, {Value: 2, Time: 0.7}, {Value: 3, Time: 0.9}}
+	matches, err := d.LookupHashes(ctx, query)
+	if err != nil {
+		t.Fatalf("Failed to look up hashes: %v", err)
+	}
+	// Every stored hash with a query's value, stamped with its track
+	want := []HashMatch{
+		{Query: query[0], Reference: fingerprint.Hash{Value: 1, Time: 1, TrackID: "a"}},
+		{Query: query[0], Reference: fingerprint.Hash{Value: 1, Time: 3, TrackID: "a"}},
+		{Query: query[1], Reference: fingerprint.Hash{Value: 2, Time: 2, TrackID: "a"}},
+		{Query: query[1], Reference: fingerprint.Hash{Value: 2, Time: 4, TrackID: "b"}},
+	}
+	if len(matches) != len(want) {
+		t.Fatalf("Expected %d matches, got %d: %v", len(want), len(matches), matches)
+	}
+	unmatched := make(map[HashMatch]int)
+	for _, match := range want {
+		unmatched[match]++
+	}
+	for _, match := range matches {
+		if unmatched[match] == 0 {
+			t.Errorf("Unexpected match %+v", match)
+		}
+		unmatched[match]--
+	}
+}
+
+func TestMemoryDBDelete(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 8
+	d := createTestDB(t, config, 4, 10)
+	vectors := trackVectors(d, "track-01")
+	hashes := d.trackHashes["track-01"]
+
+	if err := d.Delete(ctx, "track-01"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if err := d.Delete(ctx, "track-01"); err == nil {
+		t.Error("Expected an error deleting a missing track")
+	}
+	if _, err := d.Get(ctx, "track-01"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for the deleted track, got %v", err)
+	}
+	if tracks, _ := d.List(ctx); len(tracks) != 3 {
+		t.Errorf("Expected 3 tracks, got %d", len(tracks))
+	}
+
+	// Neither its vectors nor its hashes are found
+	results, err := d.Search(ctx, vectors, 5)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	for _, result := range results {
+		if result.TrackID == "track-01" {
+			t.Fatalf("Expected no results for the deleted track, got %+v", result)
+		}
+	}
+	matches, err := d.LookupHashes(ctx, hashes)
+	if err != nil {
+		t.Fatalf("Failed to look up hashes: %v", err)
+	}
+	for _, match := range matches {
+		if match.Reference.TrackID == "track-01" {
+			t.Fatalf("Expected no hash matches for the deleted track, got %+v", match)
+		}
+	}
+
+	// The ID can be reused
+	if err := d.Add(ctx, &TrackMetadata{ID: "track-01"}, vectors[:1]); err != nil {
+		t.Fatalf("Failed to add the track again: %v", err)
+	}
+	results, err = d.Search(ctx, vectors, 5)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	found := 0
+	for _, result := range results {
+		if result.TrackID == "track-01" {
+			found++
+		}
+	}
+	if found == 0 {
+		t.Error("Expected the new copy's vector to be found")
+	}
+	matches, err = d.LookupHashes(ctx, hashes)
+	if err != nil {
+		t.Fatalf("Failed to look up hashes: %v", err)
+	}
+	for _, match := range matches {
+		if match.Reference.TrackID == "track-01" {
+			t.Fatalf("Expected no hashes for the new copy, got %+v", match)
+		}
+	}
+}
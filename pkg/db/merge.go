@@ -0,0 +1,306 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// ErrConflict is returned by Merge with ConflictFail for a track ID present
+// in both databases
+var ErrConflict = errors.New("track exists in both databases")
+
+// ConflictPolicy decides which copy Merge keeps of a track ID present in
+// both databases
+type ConflictPolicy int
+
+const (
+	// ConflictFail stops the merge with ErrConflict
+	ConflictFail ConflictPolicy = iota
+
+	// ConflictKeep keeps the destination's copy
+	ConflictKeep
+
+	// ConflictReplace replaces the destination's copy with the source's
+	ConflictReplace
+
+	// ConflictNewer keeps the copy with the later Added timestamp, the
+	// destination's if both were added at the same time
+	ConflictNewer
+)
+
+func (p ConflictPolicy) String() string {
+	switch p {
+	case ConflictFail:
+		return "fail"
+	case ConflictKeep:
+		return "keep"
+	case ConflictReplace:
+		return "replace"
+	case ConflictNewer:
+		return "newer"
+	}
+	return fmt.Sprintf("conflict policy %d", int(p))
+}
+
+// ParseConflictPolicy parses the name of a policy as returned by String
+func ParseConflictPolicy(name string) (ConflictPolicy, error) {
+	for _, p := range []ConflictPolicy{ConflictFail, ConflictKeep, ConflictReplace, ConflictNewer} {
+		if p.String() == name {
+			return p, nil
+		}
+	}
+	return ConflictFail, fmt.Errorf("unknown conflict policy %q", name)
+}
+
+// MergeStats reports what a merge did with the source's tracks
+type MergeStats struct {
+	Added    int // Tracks new to the destination
+	Replaced int // Tracks that replaced the destination's copy
+	Kept     int // Tracks skipped in favour of the destination's copy
+}
+
+// TrackSource is a database whose tracks can be copied out
+type TrackSource interface {
+	VectorDB
+	TrackExporter
+}
+
+// TrackStore is a database that tracks can be copied into and out of
+type TrackStore interface {
+	VectorDB
+	HashIndex
+	TrackExporter
+}
+
+// Merge copies every track of src into dst, resolving IDs present in both
+// with policy. Tracks are copied one at a time, so a failed merge leaves
+// the tracks copied so far; a replaced track is restored if its replacement
+// cannot be added.
+func Merge(ctx context.Context, dst TrackStore, src TrackSource, policy ConflictPolicy) (MergeStats, error) {
+	var stats MergeStats
+	existing, err := dst.List(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("failed to list destination tracks: %w", err)
+	}
+	added := make(map[string]int64, len(existing))
+	for _, metadata := range existing {
+		added[metadata.ID] = metadata.Added
+	}
+	tracks, err := src.List(ctx)
+	if err != nil {
+		return stats, fmt.Errorf("failed to list source tracks: %w", err)
+	}
+
+	for _, incoming := range tracks {
+		if err := ctx.Err(); err != nil {
+			return stats, err
+		}
+
+		current, exists := added[incoming.ID]
+		if exists {
+			replace := false
+			switch policy {
+			case ConflictFail:
+				return stats, fmt.Errorf("failed to merge track %s: %w", incoming.ID, ErrConflict)
+			case ConflictReplace:
+				replace = true
+			case ConflictNewer:
+				replace = incoming.Added > current
+			case ConflictKeep:
+			default:
+				return stats, fmt.Errorf("unknown %s", policy)
+			}
+			if !replace {
+				stats.Kept++
+				continue
+			}
+		}
+
+		metadata, vectors, hashes, err := src.Export(ctx, incoming.ID)
+		if err != nil {
+			return stats, fmt.Errorf("failed to export track %s: %w", incoming.ID, err)
+		}
+		if exists {
+			if err := replaceTrack(ctx, dst, metadata, vectors, hashes); err != nil {
+				return stats, fmt.Errorf("failed to replace track %s: %w", incoming.ID, err)
+			}
+			stats.Replaced++
+		} else {
+			if err := copyTrack(ctx, dst, metadata, vectors, hashes); err != nil {
+				return stats, fmt.Errorf("failed to add track %s: %w", incoming.ID, err)
+			}
+			stats.Added++
+		}
+	}
+
+	return stats, nil
+}
+
+// copyTrack adds a track with its hashes, deleting it again if the hashes
+// cannot be added
+func copyTrack(ctx context.Context, dst TrackStore, metadata *TrackMetadata, vectors []*fingerprint.Vector, hashes []fingerprint.Hash) error {
+	if err := dst.Add(ctx, metadata, vectors); err != nil {
+		return err
+	}
+	if len(hashes) > 0 {
+		if err := dst.AddHashes(ctx, metadata.ID, hashes); err != nil {
+			// Don't leave a track without hashes behind
+			if deleteErr := dst.Delete(ctx, metadata.ID); deleteErr != nil {
+				return fmt.Errorf("%w (rollback failed: %v)", err, deleteErr)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// replaceTrack swaps the destination's copy of a track for another,
+// restoring the original if the new copy cannot be added
+func replaceTrack(ctx context.Context, dst TrackStore, metadata *TrackMetadata, vectors []*fingerprint.Vector, hashes []fingerprint.Hash) error {
+	oldMetadata, oldVectors, oldHashes, err := dst.Export(ctx, metadata.ID)
+	if err != nil {
+		return err
+	}
+	if err := dst.Delete(ctx, metadata.ID); err != nil {
+		return err
+	}
+	if err := copyTrack(ctx, dst, metadata, vectors, hashes); err != nil {
+		if restoreErr := copyTrack(ctx, dst, oldMetadata, oldVectors, oldHashes); restoreErr != nil {
+			return fmt.Errorf("%w (restore failed: %v)", err, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// ExportSnapshot writes every track of src to a database file at path,
+// which LoadMemoryDB, MemoryDB.Load and ImportSnapshot read. The graph is
+// built anew with config, so src may be any database that exports tracks,
+// e.g. a ShardedDB, and the file holds no deleted tracks. If src is a
+// MemoryDB or ShardedDB, config must use its dimension and metric.
+func ExportSnapshot(ctx context.Context, src TrackSource, config Config, path string) error {
+	// The graph of the file does not use quantized codes
+	config.Quantization = QuantizeNone
+	exported := NewMemoryDB(config)
+	if space, ok := src.(vectorSpace); ok {
+		if err := checkSpace(exported, space); err != nil {
+			return fmt.Errorf("failed to export snapshot: %w", err)
+		}
+	}
+	if _, err := Merge(ctx, exported, src, ConflictFail); err != nil {
+		return fmt.Errorf("failed to export snapshot: %w", err)
+	}
+	return exported.Save(ctx, path)
+}
+
+// vectorSpace is implemented by databases that can report the dimension and
+// metric that the vectors copied into them must match
+type vectorSpace interface {
+	dim() int
+	metric() Metric
+}
+
+// dim returns the dimension of the stored vectors, or of the configuration
+// if there are none
+func (d *MemoryDB) dim() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.storedDim()
+}
+
+func (d *MemoryDB) metric() Metric {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.config.Metric
+}
+
+// dim returns the dimension of the first shard that reports a nonzero one
+func (d *ShardedDB) dim() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, shard := range d.shards {
+		if space, ok := shard.(vectorSpace); ok && space.dim() > 0 {
+			return space.dim()
+		}
+	}
+	return 0
+}
+
+// metric returns the metric of the first shard that reports one, or the
+// default metric
+func (d *ShardedDB) metric() Metric {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	for _, shard := range d.shards {
+		if space, ok := shard.(vectorSpace); ok {
+			return space.metric()
+		}
+	}
+	return DefaultConfig().Metric
+}
+
+// checkSpace returns ErrDimensionMismatch or ErrMetricMismatch if the
+// vectors of src cannot be copied into dst. A dimension of 0 matches any.
+func checkSpace(dst, src vectorSpace) error {
+	if dim, srcDim := dst.dim(), src.dim(); dim > 0 && srcDim > 0 && dim != srcDim {
+		return fmt.Errorf("%w: %d and %d", ErrDimensionMismatch, srcDim, dim)
+	}
+	if metric, srcMetric := dst.metric(), src.metric(); metric != srcMetric {
+		return fmt.Errorf("%w: %s and %s", ErrMetricMismatch, srcMetric, metric)
+	}
+	return nil
+}
+
+// ImportSnapshot merges the tracks of the database file at path into dst.
+// If dst is a MemoryDB or ShardedDB, the file must use the same dimension
+// and metric; nothing is imported otherwise.
+func ImportSnapshot(ctx context.Context, dst TrackStore, path string, policy ConflictPolicy) (MergeStats, error) {
+	src, err := LoadMemoryDB(ctx, path)
+	if err != nil {
+		return MergeStats{}, err
+	}
+	if space, ok := dst.(vectorSpace); ok {
+		if err := checkSpace(space, src); err != nil {
+			return MergeStats{}, fmt.Errorf("failed to import %s: %w", path, err)
+		}
+	}
+	stats, err := Merge(ctx, dst, src, policy)
+	if err != nil {
+		return stats, fmt.Errorf("failed to import %s: %w", path, err)
+	}
+	return stats, nil
+}
+
+// MergeSnapshots merges the tracks of the database file at path b into
+// those of the file at path a and saves the compacted result to out. The
+// result is configured like a; b must use the same dimension and metric.
+func MergeSnapshots(ctx context.Context, a, b, out string, policy ConflictPolicy) (MergeStats, error) {
+	base, err := LoadMemoryDB(ctx, a)
+	if err != nil {
+		return MergeStats{}, err
+	}
+	other, err := LoadMemoryDB(ctx, b)
+	if err != nil {
+		return MergeStats{}, err
+	}
+	if err := checkSpace(base, other); err != nil {
+		return MergeStats{}, fmt.Errorf("failed to merge %s into %s: %w", b, a, err)
+	}
+
+	stats, err := Merge(ctx, base, other, policy)
+	if err != nil {
+		return stats, fmt.Errorf("failed to merge %s into %s: %w", b, a, err)
+	}
+	// Replaced tracks leave tombstones
+	if _, err := base.Compact(ctx); err != nil {
+		return stats, err
+	}
+	return stats, base.Save(ctx, out)
+}
@@ -0,0 +1,270 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// addVersion adds a track whose title and Added timestamp identify a copy
+func addVersion(t *testing.T, d VectorDB, trackID string, added int64, dim int) {
+	t.Helper()
+	ctx := context.Background()
+	vectors := make([]*fingerprint.Vector, 3)
+	for i := range vectors {
+		vectors[i] = &fingerprint.Vector{Data: make([]float32, dim), TimeRef: float64(i)}
+		for j := range vectors[i].Data {
+			vectors[i].Data[j] = float32(added) + float32(i*j) + 1
+		}
+	}
+	metadata := &TrackMetadata{ID: trackID, Title: fmt.Sprintf("%s@%d", trackID, added), Added: added}
+	if err := d.Add(ctx, metadata, vectors); err != nil {
+		t.Fatalf("Failed to add %s: %v", trackID, err)
+	}
+	hashes := []fingerprint.Hash{{Value: uint32(added), Time: 1}, {Value: uint32(added) + 1, Time: 2}}
+	if err := d.(HashIndex).AddHashes(ctx, trackID, hashes); err != nil {
+		t.Fatalf("Failed to add hashes for %s: %v", trackID, err)
+	}
+}
+
+// titles maps the track IDs of a database to their titles
+func titles(t *testing.T, d VectorDB) map[string]string {
+	t.Helper()
+	tracks, err := d.List(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	titles := make(map[string]string, len(tracks))
+	for _, metadata := range tracks {
+		titles[metadata.ID] = metadata.Title
+	}
+	return titles
+}
+
+func TestMerge(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	src := NewMemoryDB(config)
+	addVersion(t, src, "a", 5, 4)
+	addVersion(t, src, "b", 1, 4)
+	addVersion(t, src, "c", 3, 4)
+
+	for _, test := range []struct {
+		policy ConflictPolicy
+		stats  MergeStats
+		titles map[string]string
+	}{
+		{ConflictKeep, MergeStats{Added: 1, Kept: 2}, map[string]string{"a": "a@2", "b": "b@2", "c": "c@3", "d": "d@2"}},
+		{ConflictReplace, MergeStats{Added: 1, Replaced: 2}, map[string]string{"a": "a@5", "b": "b@1", "c": "c@3", "d": "d@2"}},
+		{ConflictNewer, MergeStats{Added: 1, Replaced: 1, Kept: 1}, map[string]string{"a": "a@5", "b": "b@2", "c": "c@3", "d": "d@2"}},
+	} {
+		t.Run(test.policy.String(), func(t *testing.T) {
+			dst := NewMemoryDB(config)
+			for _, trackID := range []string{"a", "b", "d"} {
+				addVersion(t, dst, trackID, 2, 4)
+			}
+			stats, err := Merge(ctx, dst, src, test.policy)
+			if err != nil {
+				t.Fatalf("Failed to merge: %v", err)
+			}
+			if stats != test.stats {
+				t.Errorf("Expected %+v, got %+v", test.stats, stats)
+			}
+			if got := titles(t, dst); !reflect.DeepEqual(got, test.titles) {
+				t.Errorf("Expected %v, got %v", test.titles, got)
+			}
+
+			// The copies kept are complete, with vectors and hashes
+			for trackID := range test.titles {
+				if found, matched := countTrack(t, dst, dst, trackID); found == 0 || matched == 0 {
+					t.Errorf("Expected %s to be found, found %d vectors and %d hashes", trackID, found, matched)
+				}
+				if _, vectors, _, _ := dst.Export(ctx, trackID); len(vectors) != 3 {
+					t.Errorf("Expected 3 vectors for %s, got %d", trackID, len(vectors))
+				}
+			}
+		})
+	}
+
+	dst := NewMemoryDB(config)
+	addVersion(t, dst, "b", 2, 4)
+	if _, err := Merge(ctx, dst, src, ConflictFail); !errors.Is(err, ErrConflict) {
+		t.Errorf("Expected ErrConflict, got %v", err)
+	}
+
+	if p, err := ParseConflictPolicy("newer"); err != nil || p != ConflictNewer {
+		t.Errorf("Expected newer to parse, got %v (err %v)", p, err)
+	}
+	if _, err := ParseConflictPolicy("overwrite"); err == nil {
+		t.Error("Expected an unknown policy to be rejected")
+	}
+}
+
+func TestMergeRestoresReplacedTrack(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	dst := NewMemoryDB(config)
+	addVersion(t, dst, "a", 1, 4)
+
+	// The replacement has the wrong dimension and cannot be added
+	wide := DefaultConfig()
+	wide.Dim = 8
+	src := NewMemoryDB(wide)
+	addVersion(t, src, "a", 2, 8)
+
+	if _, err := Merge(ctx, dst, src, ConflictReplace); err == nil {
+		t.Fatal("Expected the replacement to fail")
+	}
+	if got := titles(t, dst); !reflect.DeepEqual(got, map[string]string{"a": "a@1"}) {
+		t.Errorf("Expected the original copy back, got %v", got)
+	}
+	if found, matched := countTrack(t, dst, dst, "a"); found == 0 || matched == 0 {
+		t.Errorf("Expected the original copy to be found, found %d vectors and %d hashes", found, matched)
+	}
+}
+
+func TestSnapshots(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	config.Metric = MetricL2
+	dir := t.TempDir()
+
+	// A batch worker exports a sharded database
+	sharded, err := NewShardedDB(NewMemoryDB(config), NewMemoryDB(config), NewMemoryDB(config))
+	if err != nil {
+		t.Fatalf("Failed to create sharded database: %v", err)
+	}
+	for i := 0; i < 6; i++ {
+		addVersion(t, sharded, fmt.Sprintf("track-%d", i), 10, 4)
+	}
+	sharded.Delete(ctx, "track-5")
+	first := filepath.Join(dir, "first.db")
+	if err := ExportSnapshot(ctx, sharded, config, first); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+
+	// The configuration must describe the vectors of the database exported
+	for _, test := range []struct {
+		change func(*Config)
+		err    error
+	}{
+		{func(c *Config) { c.Dim = 8 }, ErrDimensionMismatch},
+		{func(c *Config) { c.Metric = MetricCosine }, ErrMetricMismatch},
+	} {
+		mismatched := config
+		test.change(&mismatched)
+		path := filepath.Join(dir, "mismatched.db")
+		if err := ExportSnapshot(ctx, sharded, mismatched, path); !errors.Is(err, test.err) {
+			t.Errorf("Expected %v, got %v", test.err, err)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("Expected no snapshot to be written, got %v", err)
+		}
+	}
+
+	exported, err := LoadMemoryDB(ctx, first)
+	if err != nil {
+		t.Fatalf("Failed to load snapshot: %v", err)
+	}
+	if exported.Config().Metric != MetricL2 || exported.Config().Dim != 4 {
+		t.Errorf("Expected the snapshot to keep the configuration, got %+v", exported.Config())
+	}
+	if got, want := titles(t, exported), titles(t, sharded); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the snapshot to hold %v, got %v", want, got)
+	}
+	if exported.Garbage() != 0 {
+		t.Errorf("Expected no deleted tracks in the snapshot, got %.3f garbage", exported.Garbage())
+	}
+
+	// Another worker's snapshot overlaps it
+	other := NewMemoryDB(config)
+	addVersion(t, other, "track-0", 20, 4)
+	addVersion(t, other, "track-9", 20, 4)
+	second := filepath.Join(dir, "second.db")
+	if err := other.Save(ctx, second); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	merged := filepath.Join(dir, "merged.db")
+	stats, err := MergeSnapshots(ctx, first, second, merged, ConflictNewer)
+	if err != nil {
+		t.Fatalf("Failed to merge snapshots: %v", err)
+	}
+	if stats != (MergeStats{Added: 1, Replaced: 1}) {
+		t.Errorf("Expected one track added and one replaced, got %+v", stats)
+	}
+	result, err := LoadMemoryDB(ctx, merged)
+	if err != nil {
+		t.Fatalf("Failed to load merged snapshot: %v", err)
+	}
+	want := map[string]string{"track-0": "track-0@20", "track-1": "track-1@10", "track-2": "track-2@10",
+		"track-3": "track-3@10", "track-4": "track-4@10", "track-9": "track-9@20"}
+	if got := titles(t, result); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+	if result.Garbage() != 0 {
+		t.Errorf("Expected the merged snapshot to be compacted, got %.3f garbage", result.Garbage())
+	}
+
+	// A serving node imports it
+	serving := NewMemoryDB(config)
+	addVersion(t, serving, "track-0", 30, 4)
+	stats, err = ImportSnapshot(ctx, serving, merged, ConflictKeep)
+	if err != nil {
+		t.Fatalf("Failed to import: %v", err)
+	}
+	if stats != (MergeStats{Added: 5, Kept: 1}) {
+		t.Errorf("Expected 5 tracks added and 1 kept, got %+v", stats)
+	}
+	if found, _ := countTrack(t, serving, result, "track-9"); found == 0 {
+		t.Error("Expected an imported track to be found")
+	}
+
+	// Snapshots of different metrics are not merged
+	cosineConfig := config
+	cosineConfig.Metric = MetricCosine
+	cosine := NewMemoryDB(cosineConfig)
+	addVersion(t, cosine, "track-7", 40, 4)
+	third := filepath.Join(dir, "third.db")
+	if err := cosine.Save(ctx, third); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	if _, err := MergeSnapshots(ctx, first, third, merged, ConflictKeep); !errors.Is(err, ErrMetricMismatch) {
+		t.Errorf("Expected ErrMetricMismatch, got %v", err)
+	}
+
+	// Nor are they imported, into any kind of database
+	wideConfig := config
+	wideConfig.Dim = 8
+	wide := NewMemoryDB(wideConfig)
+	addVersion(t, wide, "track-8", 40, 8)
+	fourth := filepath.Join(dir, "fourth.db")
+	if err := wide.Save(ctx, fourth); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	for _, test := range []struct {
+		path, id string
+		err      error
+	}{
+		{third, "track-7", ErrMetricMismatch},
+		{fourth, "track-8", ErrDimensionMismatch},
+	} {
+		for _, dst := range []TrackStore{serving, sharded} {
+			if _, err := ImportSnapshot(ctx, dst, test.path, ConflictKeep); !errors.Is(err, test.err) {
+				t.Errorf("Expected %v, got %v", test.err, err)
+			}
+			if _, err := dst.Get(ctx, test.id); err == nil {
+				t.Errorf("Expected %s not to be imported", test.id)
+			}
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/kshitijk4poor/shazam-golang/internal/bincodec"
+)
+
+// TrackUpdater is implemented by databases whose track metadata can be
+// edited without fingerprinting the track again
+type TrackUpdater interface {
+	// Update replaces the metadata of the track with metadata's ID. Added
+	// and Quality describe the ingest and are kept.
+	Update(ctx context.Context, metadata *TrackMetadata) error
+}
+
+// releaseDateLayouts are the accepted forms of TrackMetadata.ReleaseDate
+var releaseDateLayouts = []string{"2006-01-02", "2006-01", "2006"}
+
+// Validate checks the formats of the identifiers and the release date. Empty
+// fields are valid.
+func (m *TrackMetadata) Validate() error {
+	if m.ISRC != "" && !validISRC(m.ISRC) {
+		return fmt.Errorf("invalid ISRC %q: expected 2 letters, 3 letters or digits and 7 digits", m.ISRC)
+	}
+	if m.UPC != "" && ((len(m.UPC) != 12 && len(m.UPC) != 13) || !digits(m.UPC)) {
+		return fmt.Errorf("invalid UPC %q: expected 12 or 13 digits", m.UPC)
+	}
+	if m.ReleaseDate != "" {
+		valid := false
+		for _, layout := range releaseDateLayouts {
+			if _, err := time.Parse(layout, m.ReleaseDate); err == nil {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("invalid release date %q: expected YYYY-MM-DD, YYYY-MM or YYYY", m.ReleaseDate)
+		}
+	}
+	for name := range m.ExternalIDs {
+		if name == "" {
+			return fmt.Errorf("external ID without a catalogue name")
+		}
+	}
+	return nil
+}
+
+// validISRC reports whether s is an ISRC without hyphens: country code,
+// registrant code, year and designation code
+func validISRC(s string) bool {
+	if len(s) != 12 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		letter := c >= 'A' && c <= 'Z'
+		digit := c >= '0' && c <= '9'
+		switch {
+		case i < 2 && !letter:
+			return false
+		case i >= 2 && i < 5 && !letter && !digit:
+			return false
+		case i >= 5 && !digit:
+			return false
+		}
+	}
+	return true
+}
+
+// digits reports whether s consists of ASCII digits only
+func digits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Clone returns a copy of m that shares no maps with it. The quality report
+// is shared; it is never modified.
+func (m *TrackMetadata) Clone() *TrackMetadata {
+	copied := *m
+	copied.ExternalIDs = cloneMap(m.ExternalIDs)
+	copied.Custom = cloneMap(m.Custom)
+	return &copied
+}
+
+func cloneMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	copied := make(map[string]string, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+	return copied
+}
+
+// Update replaces the metadata of a track, leaving its vectors and hashes
+// alone. Added and Quality are kept.
+func (d *MemoryDB) Update(ctx context.Context, metadata *TrackMetadata) error {
+	if metadata == nil || metadata.ID == "" {
+		return fmt.Errorf("track metadata must have an ID")
+	}
+	if err := metadata.Validate(); err != nil {
+		return fmt.Errorf("failed to update track %s: %w", metadata.ID, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if _, exists := d.tracks[metadata.ID]; !exists {
+		return fmt.Errorf("%w: %s", ErrNotFound, metadata.ID)
+	}
+	err := d.log(walUpdate, func(w *bincodec.Encoder) error {
+		return encodeMetadata(w, metadata)
+	})
+	if err != nil {
+		return err
+	}
+	d.update(metadata)
+
+	return nil
+}
+
+// update stores a copy of metadata in place of the existing track's
+func (d *MemoryDB) update(metadata *TrackMetadata) {
+	stored := d.tracks[metadata.ID]
+	updated := metadata.Clone()
+	updated.Added = stored.Added
+	updated.Quality = stored.Quality
+	d.tracks[metadata.ID] = updated
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// fullMetadata returns metadata with every field set
+func fullMetadata(trackID string) *TrackMetadata {
+	return &TrackMetadata{
+		ID:          trackID,
+		Title:       "Feeling Good",
+		Artist:      "Nina Simone",
+		Duration:    176.5,
+		Added:       1700000000,
+		Quality:     &fingerprint.QualityReport{Duration: 176.5},
+		Album:       "I Put a Spell on You",
+		ISRC:        "USPR36500123",
+		UPC:         "042284238728",
+		Label:       "Philips",
+		ReleaseDate: "1965-06",
+		ExternalIDs: map[string]string{"musicbrainz": "b3d6b1a4", "spotify": "1kLFo3dW"},
+		Custom:      map[string]string{"mood": "triumphant"},
+	}
+}
+
+func TestTrackMetadataValidate(t *testing.T) {
+	if err := fullMetadata("track").Validate(); err != nil {
+		t.Errorf("Expected complete metadata to be valid, got %v", err)
+	}
+	if err := (&TrackMetadata{ID: "track"}).Validate(); err != nil {
+		t.Errorf("Expected empty fields to be valid, got %v", err)
+	}
+	for _, invalid := range []func(*TrackMetadata){
+		func(m *TrackMetadata) { m.ISRC = "US-PR3-65-00123" },
+		func(m *TrackMetadata) { m.ISRC = "1SPR36500123" },
+		func(m *TrackMetadata) { m.ISRC = "USPR365001X3" },
+		func(m *TrackMetadata) { m.UPC = "04228423872" },
+		func(m *TrackMetadata) { m.UPC = "04228423872X" },
+		func(m *TrackMetadata) { m.ReleaseDate = "June 1965" },
+		func(m *TrackMetadata) { m.ReleaseDate = "1965-13-01" },
+		func(m *TrackMetadata) { m.ExternalIDs[""] = "orphan" },
+	} {
+		metadata := fullMetadata("track")
+		invalid(metadata)
+		if err := metadata.Validate(); err == nil {
+			t.Errorf("Expected %+v to be invalid", metadata)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	dir := t.TempDir()
+	path := filepath.Join(dir, "library.db")
+
+	d, err := OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	defer d.Close()
+	addTrack(t, d, "track-0", 1)
+	addTrack(t, d, "track-1", 2)
+	if err := d.Checkpoint(ctx); err != nil {
+		t.Fatalf("Failed to checkpoint: %v", err)
+	}
+
+	// Fields are replaced but Added and Quality kept
+	stored, _ := d.Get(ctx, "track-0")
+	updated := fullMetadata("track-0")
+	updated.Added = 42
+	updated.Quality = nil
+	if err := d.Update(ctx, updated); err != nil {
+		t.Fatalf("Failed to update: %v", err)
+	}
+	want := fullMetadata("track-0")
+	want.Added = stored.Added
+	want.Quality = stored.Quality
+	got, _ := d.Get(ctx, "track-0")
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %+v after updating, got %+v", want, got)
+	}
+
+	// Neither the caller's nor a returned copy's maps alias the stored ones
+	updated.Custom["mood"] = "changed"
+	got.ExternalIDs["spotify"] = "changed"
+	if again, _ := d.Get(ctx, "track-0"); !reflect.DeepEqual(again, want) {
+		t.Errorf("Stored metadata changed through a map: %+v", again)
+	}
+
+	// Vectors and hashes are untouched
+	if found, matched := countTrack(t, d, d, "track-0"); found == 0 || matched == 0 {
+		t.Errorf("Expected track-0 to still be found, found %d vectors and %d hashes", found, matched)
+	}
+
+	if err := d.Update(ctx, &TrackMetadata{ID: "track-9"}); err == nil {
+		t.Error("Expected updating a missing track to fail")
+	}
+	if err := d.Update(ctx, &TrackMetadata{ID: "track-1", ISRC: "bad"}); err == nil {
+		t.Error("Expected invalid metadata to be rejected")
+	}
+	if err := d.Add(ctx, &TrackMetadata{ID: "track-2", UPC: "bad"}, nil); err == nil {
+		t.Error("Expected Add to reject invalid metadata")
+	}
+
+	// The update is replayed from the log
+	reopened := NewMemoryDB(config)
+	if err := reopened.Load(ctx, path); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if got, _ := reopened.Get(ctx, "track-0"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the update to be replayed, got %+v", got)
+	}
+
+	// and survives snapshots and mapped indexes
+	if err := d.Checkpoint(ctx); err != nil {
+		t.Fatalf("Failed to checkpoint: %v", err)
+	}
+	loaded := NewMemoryDB(config)
+	if err := loaded.Load(ctx, path); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if got, _ := loaded.Get(ctx, "track-0"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the update in the snapshot, got %+v", got)
+	}
+	indexPath := filepath.Join(dir, "library.idx")
+	if err := d.WriteIndex(ctx, indexPath); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	mapped, err := OpenMappedDB(indexPath)
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	defer mapped.Close()
+	if got, _ := mapped.Get(ctx, "track-0"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the update in the mapped index, got %+v", got)
+	}
+	if err := mapped.Update(ctx, updated); !errors.Is(err, ErrReadOnly) {
+		t.Errorf("Expected ErrReadOnly, got %v", err)
+	}
+}
+
+func TestShardedUpdate(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	sharded, err := NewShardedDB(NewMemoryDB(config), NewMemoryDB(config))
+	if err != nil {
+		t.Fatalf("Failed to create sharded database: %v", err)
+	}
+	vectors := []*fingerprint.Vector{{Data: []float32{1, 2, 3, 4}}}
+	for _, trackID := range []string{"track-0", "track-1", "track-2", "track-3"} {
+		if err := sharded.Add(ctx, &TrackMetadata{ID: trackID}, vectors); err != nil {
+			t.Fatalf("Failed to add: %v", err)
+		}
+		if err := sharded.Update(ctx, &TrackMetadata{ID: trackID, Album: "Album " + trackID}); err != nil {
+			t.Fatalf("Failed to update %s: %v", trackID, err)
+		}
+		if got, err := sharded.Get(ctx, trackID); err != nil || got.Album != "Album "+trackID {
+			t.Errorf("Expected the updated album of %s, got %+v (err %v)", trackID, got, err)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package db
+
+import (
+	"fmt"
+	"math"
+)
+
+// Metric selects how vectors are compared. Each metric has a distance, lower
+// is closer, that builds and searches the graph, and a SearchResult.Score
+// derived from it in [0, 1], higher is better:
+//
+//	MetricCosine:       (1+c)/2 for the cosine similarity c
+//	MetricInnerProduct: 1/(1+exp(-p)) for the dot product p
+//	MetricL2:           1/(1+d) for the Euclidean distance d
+//	MetricHamming:      fraction of equal bits
+//
+// Identical non-zero vectors score 1 under every metric but inner product,
+// where the score grows with their length. Scores are only comparable
+// between results of the same metric.
+type Metric int
+
+const (
+	// MetricCosine compares directions and ignores lengths; zero vectors
+	// have no direction and count as orthogonal to everything, scoring 0.5
+	MetricCosine Metric = iota
+
+	// MetricInnerProduct ranks by dot product, for embeddings trained to be
+	// compared that way. It equals cosine for unit vectors.
+	MetricInnerProduct
+
+	// MetricL2 ranks by Euclidean distance
+	MetricL2
+
+	// MetricHamming treats every component as a bit, set if positive, and
+	// ranks by the number of differing bits, for binary fingerprints
+	MetricHamming
+)
+
+func (m Metric) String() string {
+	switch m {
+	case MetricCosine:
+		return "cosine"
+	case MetricInnerProduct:
+		return "ip"
+	case MetricL2:
+		return "l2"
+	case MetricHamming:
+		return "hamming"
+	}
+	return fmt.Sprintf("metric %d", int(m))
+}
+
+// ParseMetric parses the name of a metric as returned by String
+func ParseMetric(name string) (Metric, error) {
+	for _, m := range []Metric{MetricCosine, MetricInnerProduct, MetricL2, MetricHamming} {
+		if m.String() == name {
+			return m, nil
+		}
+	}
+	return MetricCosine, fmt.Errorf("unknown metric %q", name)
+}
+
+// valid reports whether m is a known metric
+func (m Metric) valid() bool {
+	return m >= MetricCosine && m <= MetricHamming
+}
+
+// distance returns the distance function of the metric
+func (m Metric) distance() func(a, b []float32) float64 {
+	switch m {
+	case MetricInnerProduct:
+		return innerProductDistance
+	case MetricL2:
+		return l2Distance
+	case MetricHamming:
+		return hammingDistance
+	}
+	return cosineDistance
+}
+
+// score converts a distance of the metric into a SearchResult.Score
+func (m Metric) score(distance float64) float64 {
+	switch m {
+	case MetricCosine:
+		return 1 - distance/2
+	case MetricInnerProduct:
+		return 1 / (1 + math.Exp(distance))
+	case MetricL2:
+		return 1 / (1 + math.Sqrt(max(distance, 0)))
+	}
+	return 1 - distance
+}
+
+// cosineDistance returns 1 - cosine similarity, treating zero vectors as
+// orthogonal
+func cosineDistance(a, b []float32) float64 {
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 1
+	}
+	return 1 - dot/math.Sqrt(normA*normB)
+}
+
+// innerProductDistance returns the negated dot product
+func innerProductDistance(a, b []float32) float64 {
+	var dot float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+	}
+	return -dot
+}
+
+// l2Distance returns the squared Euclidean distance, which orders like the
+// distance itself without the square root
+func l2Distance(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		diff := float64(a[i]) - float64(b[i])
+		sum += diff * diff
+	}
+	return sum
+}
+
+// hammingDistance returns the fraction of components that differ in sign,
+// counting zero as an unset bit
+func hammingDistance(a, b []float32) float64 {
+	if len(a) == 0 {
+		return 0
+	}
+	differing := 0
+	for i := range a {
+		if (a[i] > 0) != (b[i] > 0) {
+			differing++
+		}
+	}
+	return float64(differing) / float64(len(a))
+}
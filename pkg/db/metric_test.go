@@ -0,0 +1,183 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+var allMetrics = []Metric{MetricCosine, MetricInnerProduct, MetricL2, MetricHamming}
+
+func TestMetricScores(t *testing.T) {
+	a := []float32{1, 2, -2, 0}
+	b := []float32{2, 0, -1, 1}
+
+	for _, test := range []struct {
+		metric    Metric
+		score     float64 // of a and b
+		identical float64 // of a and a
+	}{
+		{MetricCosine, (1 + 4/(3*math.Sqrt(6))) / 2, 1},
+		{MetricInnerProduct, 1 / (1 + math.Exp(-4)), 1 / (1 + math.Exp(-9))},
+		{MetricL2, 1 / (1 + math.Sqrt(7)), 1},
+		{MetricHamming, 0.5, 1},
+	} {
+		distance := test.metric.distance()
+		if score := test.metric.score(distance(a, b)); math.Abs(score-test.score) > 1e-9 {
+			t.Errorf("%s: expected score %.6f, got %.6f", test.metric, test.score, score)
+		}
+		if score := test.metric.score(distance(a, a)); math.Abs(score-test.identical) > 1e-9 {
+			t.Errorf("%s: expected identical vectors to score %.6f, got %.6f", test.metric, test.identical, score)
+		}
+		// Closer is a smaller distance and a higher score
+		if distance(a, a) > distance(a, b) || test.metric.score(distance(a, a)) < test.metric.score(distance(a, b)) {
+			t.Errorf("%s: a is not closer to itself than to b", test.metric)
+		}
+
+		// Scores stay in [0, 1] even for opposite and long vectors
+		opposite := []float32{-100, -200, 200, 0}
+		for _, other := range [][]float32{opposite, {100, 200, -200, 0}} {
+			if score := test.metric.score(distance(a, other)); score < 0 || score > 1 {
+				t.Errorf("%s: expected a score in [0, 1], got %f", test.metric, score)
+			}
+		}
+
+		if parsed, err := ParseMetric(test.metric.String()); err != nil || parsed != test.metric {
+			t.Errorf("Expected %s to parse, got %v (err %v)", test.metric, parsed, err)
+		}
+	}
+	if _, err := ParseMetric("manhattan"); err == nil {
+		t.Error("Expected an unknown metric to be rejected")
+	}
+}
+
+// bestScore returns the highest score of any stored vector for the query
+func bestScore(d *MemoryDB, query []float32) float64 {
+	distance := d.config.Metric.distance()
+	best := math.Inf(1)
+	for id := range d.vectors {
+		best = min(best, distance(query, d.vectorData(id)))
+	}
+	return d.config.Metric.score(best)
+}
+
+func TestMetricSearch(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(11))
+	vectors := createClusteredVectors(rng, 1000, 16, 8, 1)
+	queries := createClusteredVectors(rng, 30, 16, 8, 1)
+
+	for _, metric := range allMetrics {
+		for _, quantization := range []Quantization{QuantizeNone, QuantizeInt8} {
+			t.Run(metric.String()+"/"+quantization.String(), func(t *testing.T) {
+				config := DefaultConfig()
+				config.Dim = 16
+				config.EfSearch = 128
+				config.Metric = metric
+				config.Quantization = quantization
+				d := createQuantizedDB(t, config, vectors)
+				if metric == MetricHamming && d.quantizer != nil {
+					t.Error("Expected Hamming vectors not to be quantized")
+				}
+
+				exact := 0
+				for _, query := range queries {
+					results, err := d.Search(ctx, []*fingerprint.Vector{query}, 5)
+					if err != nil {
+						t.Fatalf("Failed to search: %v", err)
+					}
+					if len(results) != 5 {
+						t.Fatalf("Expected 5 results, got %d", len(results))
+					}
+					for i, result := range results {
+						want := metric.score(metric.distance()(query.Data, result.MatchedVector.Data))
+						if result.Score != want {
+							t.Errorf("Score %.6f is not the exact score %.6f", result.Score, want)
+						}
+						if i > 0 && result.Score > results[i-1].Score {
+							t.Errorf("Results are not ordered by descending score: %.6f after %.6f", result.Score, results[i-1].Score)
+						}
+					}
+					if results[0].Score == bestScore(d, query.Data) {
+						exact++
+					}
+				}
+				if exact < len(queries)*9/10 {
+					t.Errorf("Top result is the exact best for only %d of %d queries", exact, len(queries))
+				}
+			})
+		}
+	}
+}
+
+func TestMetricPersists(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 8
+	config.Metric = MetricL2
+	d := createTestDB(t, config, 4, 10)
+	_, query, _, _ := d.Export(ctx, "track-02")
+	want, err := d.Search(ctx, query, 3)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "library.db")
+	if err := d.Save(ctx, path); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	loaded := NewMemoryDB(config)
+	if err := loaded.Load(ctx, path); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if loaded.config.Metric != MetricL2 {
+		t.Errorf("Expected the l2 metric after loading, got %s", loaded.config.Metric)
+	}
+	got, err := loaded.Search(ctx, query, 3)
+	if err != nil {
+		t.Fatalf("Failed to search: %v", err)
+	}
+	checkSameScores(t, got, want)
+
+	// A graph built for one metric cannot be searched with another
+	config.Metric = MetricCosine
+	err = NewMemoryDB(config).Load(ctx, path)
+	if !errors.Is(err, ErrMetricMismatch) {
+		t.Errorf("Expected ErrMetricMismatch, got %v", err)
+	}
+
+	indexPath := filepath.Join(dir, "library.idx")
+	if err := d.WriteIndex(ctx, indexPath); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	mapped, err := OpenMappedDB(indexPath)
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	defer mapped.Close()
+	got, err = mapped.Search(ctx, query, 3)
+	if err != nil {
+		t.Fatalf("Failed to search the mapped index: %v", err)
+	}
+	checkSameScores(t, got, want)
+}
+
+// checkSameScores compares the tracks and scores of two result lists
+func checkSameScores(t *testing.T, got, want []SearchResult) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d results, got %d", len(want), len(got))
+	}
+	for i := range want {
+		if got[i].TrackID != want[i].TrackID || got[i].Score != want[i].Score {
+			t.Errorf("Result %d: expected %s (%.6f), got %s (%.6f)",
+				i, want[i].TrackID, want[i].Score, got[i].TrackID, got[i].Score)
+		}
+	}
+}
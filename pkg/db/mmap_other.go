@@ -0,0 +1,22 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd || dragonfly)
+
+package db
+
+import (
+	"os"
+)
+
+// mapFile reads size bytes of the file from offset into memory on platforms
+// without mmap support
+func mapFile(file *os.File, offset int64, size int) ([]byte, error) {
+	data := make([]byte, size)
+	if n, err := file.ReadAt(data, offset); n < size {
+		return nil, err
+	}
+	return data, nil
+}
+
+// unmapFile releases a mapping returned by mapFile
+func unmapFile(data []byte) error {
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+
+package db
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps size bytes of a file from offset, which is page aligned,
+// read-only and shared, so processes mapping the same index share its pages
+func mapFile(file *os.File, offset int64, size int) ([]byte, error) {
+	if size == 0 {
+		return nil, nil
+	}
+	return syscall.Mmap(int(file.Fd()), offset, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// unmapFile releases a mapping returned by mapFile
+func unmapFile(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,425 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// Quantization selects how MemoryDB compresses vectors for graph traversal.
+// Searches estimate distances from the compressed codes and then re-rank
+// the best Config.Rerank candidates per result on the exact vectors. Only
+// the codes stay on the heap: the exact vectors, also needed for Save,
+// Export and Compact, move to a memory-mapped temporary file. Compact writes
+// a new file and releases the old one once no search reads it any more, and
+// Close releases the current one; databases that are never closed release
+// it when garbage collected. Vectors compared with MetricCosine are
+// normalized before compression. MetricHamming vectors are never quantized;
+// their graph traversal is cheap already.
+type Quantization int
+
+const (
+	// QuantizeNone searches on the exact float32 vectors
+	QuantizeNone Quantization = iota
+
+	// QuantizeInt8 stores every vector as one signed byte per component plus
+	// a float32 scale
+	QuantizeInt8
+
+	// QuantizePQ splits every vector into Config.PQSubvectors
+	// parts and stores the index of the nearest of up to 256 trained
+	// centroids for each, one byte per part. The codebooks are trained once
+	// Config.PQTrainingSize vectors have been added; until then searches
+	// use the exact vectors.
+	QuantizePQ
+)
+
+func (q Quantization) String() string {
+	switch q {
+	case QuantizeNone:
+		return "none"
+	case QuantizeInt8:
+		return "int8"
+	case QuantizePQ:
+		return "pq"
+	}
+	return fmt.Sprintf("quantization %d", int(q))
+}
+
+// ParseQuantization parses the name of a quantization as returned by String
+func ParseQuantization(name string) (Quantization, error) {
+	for _, q := range []Quantization{QuantizeNone, QuantizeInt8, QuantizePQ} {
+		if q.String() == name {
+			return q, nil
+		}
+	}
+	return QuantizeNone, fmt.Errorf("unknown quantization %q", name)
+}
+
+// pqCentroids is the number of centroids per subvector, the most a byte can
+// index
+const pqCentroids = 256
+
+// pqIterations is the number of k-means iterations when training codebooks
+const pqIterations = 10
+
+// quantizer compresses vectors into fixed-size codes and estimates the
+// metric's distances from a query to the compressed vectors
+type quantizer interface {
+	// codeSize is the number of bytes per code
+	codeSize() int
+
+	// encode writes the code of a vector to code
+	encode(code []byte, vector []float32)
+
+	// estimator returns the estimated distance from the query to the
+	// vector whose code starts at codes[id*codeSize()]
+	estimator(query []float32, codes []byte) func(id int) float64
+}
+
+// normalized returns a copy of v with unit length, or zeros if v is zero
+func normalized(v []float32) []float32 {
+	var norm float64
+	for _, val := range v {
+		norm += float64(val) * float64(val)
+	}
+	out := make([]float32, len(v))
+	if norm == 0 {
+		return out
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i, val := range v {
+		out[i] = val * scale
+	}
+	return out
+}
+
+// prepare returns the vector to compress or compare codes with: normalized
+// for MetricCosine, v itself otherwise
+func prepare(metric Metric, v []float32) []float32 {
+	if metric == MetricCosine {
+		return normalized(v)
+	}
+	return v
+}
+
+// int8Quantizer implements QuantizeInt8. A code is the scale (float32)
+// followed by the components divided by it, rounded to int8.
+type int8Quantizer struct {
+	dim    int
+	metric Metric
+}
+
+func (q *int8Quantizer) codeSize() int {
+	return 4 + q.dim
+}
+
+func (q *int8Quantizer) encode(code []byte, vector []float32) {
+	unit := prepare(q.metric, vector)
+	var largest float32
+	for _, val := range unit {
+		largest = max(largest, val, -val)
+	}
+
+	scale := largest / 127
+	binary.LittleEndian.PutUint32(code, math.Float32bits(scale))
+	for i, val := range unit {
+		if scale == 0 {
+			code[4+i] = 0
+		} else {
+			code[4+i] = byte(int8(math.Round(float64(val / scale))))
+		}
+	}
+}
+
+func (q *int8Quantizer) estimator(query []float32, codes []byte) func(id int) float64 {
+	unit := prepare(q.metric, query)
+	size := q.codeSize()
+	return func(id int) float64 {
+		code := codes[id*size : (id+1)*size]
+		scale := math.Float32frombits(binary.LittleEndian.Uint32(code))
+		if q.metric == MetricL2 {
+			var sum float32
+			for i, val := range unit {
+				diff := val - scale*float32(int8(code[4+i]))
+				sum += diff * diff
+			}
+			return float64(sum)
+		}
+
+		var dot float32
+		for i, val := range unit {
+			dot += val * float32(int8(code[4+i]))
+		}
+		if q.metric == MetricInnerProduct {
+			return -float64(dot * scale)
+		}
+		if scale == 0 {
+			// Zero vectors are orthogonal, as in cosineDistance
+			return 1
+		}
+		return 1 - float64(dot*scale)
+	}
+}
+
+// pqQuantizer implements QuantizePQ. Subvector i covers the components
+// bounds[i] to bounds[i+1] and centroids[i] holds its k centroids one after
+// another.
+type pqQuantizer struct {
+	bounds    []int
+	k         int
+	centroids [][]float32
+	metric    Metric
+}
+
+// trainPQ learns codebooks for subvectors subvectors from prepared training
+// vectors with k-means
+func trainPQ(training [][]float32, subvectors int, metric Metric, rng *rand.Rand) *pqQuantizer {
+	dim := len(training[0])
+	q := &pqQuantizer{
+		metric:    metric,
+		bounds:    make([]int, subvectors+1),
+		k:         min(pqCentroids, len(training)),
+		centroids: make([][]float32, subvectors),
+	}
+	for i := range q.bounds {
+		q.bounds[i] = i * dim / subvectors
+	}
+
+	assignments := make([]int, len(training))
+	for sub := range q.centroids {
+		lo, hi := q.bounds[sub], q.bounds[sub+1]
+		width := hi - lo
+		centroids := make([]float32, q.k*width)
+		for c, i := range rng.Perm(len(training))[:q.k] {
+			copy(centroids[c*width:], training[i][lo:hi])
+		}
+
+		for iteration := 0; iteration < pqIterations; iteration++ {
+			for i, vector := range training {
+				assignments[i] = nearestCentroid(centroids, width, vector[lo:hi])
+			}
+
+			sums := make([]float64, q.k*width)
+			counts := make([]int, q.k)
+			for i, vector := range training {
+				c := assignments[i]
+				counts[c]++
+				for j, val := range vector[lo:hi] {
+					sums[c*width+j] += float64(val)
+				}
+			}
+			for c, count := range counts {
+				if count == 0 {
+					// Restart an empty cluster from a random vector
+					copy(centroids[c*width:(c+1)*width], training[rng.Intn(len(training))][lo:hi])
+					continue
+				}
+				for j := 0; j < width; j++ {
+					centroids[c*width+j] = float32(sums[c*width+j] / float64(count))
+				}
+			}
+		}
+		q.centroids[sub] = centroids
+	}
+
+	return q
+}
+
+// nearestCentroid returns the index of the centroid closest to v in
+// Euclidean distance
+func nearestCentroid(centroids []float32, width int, v []float32) int {
+	best, bestDistance := 0, float32(math.MaxFloat32)
+	for c := 0; c*width < len(centroids); c++ {
+		var distance float32
+		for j, val := range v {
+			diff := val - centroids[c*width+j]
+			distance += diff * diff
+		}
+		if distance < bestDistance {
+			best, bestDistance = c, distance
+		}
+	}
+	return best
+}
+
+func (q *pqQuantizer) codeSize() int {
+	return len(q.centroids)
+}
+
+func (q *pqQuantizer) encode(code []byte, vector []float32) {
+	unit := prepare(q.metric, vector)
+	for sub, centroids := range q.centroids {
+		lo, hi := q.bounds[sub], q.bounds[sub+1]
+		code[sub] = byte(nearestCentroid(centroids, hi-lo, unit[lo:hi]))
+	}
+}
+
+// estimator computes the dot products, or squared distances for MetricL2,
+// of the query's subvectors with every centroid once, so that each estimate
+// is a sum of table lookups
+func (q *pqQuantizer) estimator(query []float32, codes []byte) func(id int) float64 {
+	unit := prepare(q.metric, query)
+	subvectors := len(q.centroids)
+	table := make([]float32, subvectors*q.k)
+	for sub, centroids := range q.centroids {
+		lo, hi := q.bounds[sub], q.bounds[sub+1]
+		width := hi - lo
+		for c := 0; c < q.k; c++ {
+			var sum float32
+			for j, val := range unit[lo:hi] {
+				if q.metric == MetricL2 {
+					diff := val - centroids[c*width+j]
+					sum += diff * diff
+				} else {
+					sum += val * centroids[c*width+j]
+				}
+			}
+			table[sub*q.k+c] = sum
+		}
+	}
+
+	return func(id int) float64 {
+		var sum float32
+		for sub, c := range codes[id*subvectors : (id+1)*subvectors] {
+			sum += table[sub*q.k+int(c)]
+		}
+		switch q.metric {
+		case MetricL2:
+			return float64(sum)
+		case MetricInnerProduct:
+			return -float64(sum)
+		}
+		return 1 - float64(sum)
+	}
+}
+
+// trainQuantizer creates the quantizer selected by config for the live
+// vectors, whose data vector returns. It returns nil without quantization,
+// for MetricHamming or while there are too few vectors to train product
+// quantization.
+func trainQuantizer(config Config, vector func(id int) []float32, dead []bool) quantizer {
+	if config.Metric == MetricHamming {
+		return nil
+	}
+	var live [][]float32
+	for id := range dead {
+		if !dead[id] {
+			live = append(live, vector(id))
+		}
+	}
+	if len(live) == 0 || len(live[0]) == 0 {
+		return nil
+	}
+	dim := len(live[0])
+
+	switch config.Quantization {
+	case QuantizeInt8:
+		return &int8Quantizer{dim: dim, metric: config.Metric}
+
+	case QuantizePQ:
+		size := max(config.PQTrainingSize, 1)
+		if len(live) < size {
+			return nil
+		}
+		subvectors := config.PQSubvectors
+		if subvectors <= 0 {
+			subvectors = max(dim/4, 1)
+		}
+		subvectors = min(subvectors, dim)
+
+		// A fixed seed keeps training reproducible, e.g. across Load
+		rng := rand.New(rand.NewSource(42))
+		training := make([][]float32, size)
+		for i, j := range rng.Perm(len(live))[:size] {
+			training[i] = prepare(config.Metric, live[j])
+		}
+		return trainPQ(training, subvectors, config.Metric, rng)
+	}
+	return nil
+}
+
+// quantize encodes the vectors that have no code yet, training the
+// quantizer first if there is none. The caller holds d.mu for writing or
+// owns d.
+func (d *MemoryDB) quantize() {
+	if d.config.Quantization == QuantizeNone || d.config.Metric == MetricHamming {
+		return
+	}
+	if d.quantizer == nil {
+		d.quantizer = trainQuantizer(d.config, d.vectorData, d.dead)
+		if d.quantizer == nil {
+			return
+		}
+	}
+
+	size := d.quantizer.codeSize()
+	for id := len(d.codes) / size; id < len(d.vectors); id++ {
+		d.codes = append(d.codes, make([]byte, size)...)
+		d.quantizer.encode(d.codes[id*size:], d.vectorData(id))
+	}
+}
+
+// quantizing reports whether the configuration compresses vectors, in which
+// case their exact data is kept in d.exact instead of the heap
+func (d *MemoryDB) quantizing() bool {
+	return d.config.Quantization != QuantizeNone && d.config.Metric != MetricHamming
+}
+
+// spill moves the data of the vectors from id on into d.exact when
+// quantizing. The caller holds d.mu for writing or owns d.
+func (d *MemoryDB) spill(from int) {
+	if !d.quantizing() {
+		return
+	}
+	for _, vector := range d.vectors[from:] {
+		if d.exact == nil {
+			d.exact = newVectorFile(len(vector.Data))
+		}
+		d.exact.append(vector.Data)
+		vector.Data = nil
+	}
+}
+
+// storedDim returns the dimension of the stored vectors, or of the
+// configuration if there are none. The caller holds d.mu.
+func (d *MemoryDB) storedDim() int {
+	if len(d.vectors) > 0 {
+		return len(d.vectorData(0))
+	}
+	return d.config.Dim
+}
+
+// exactVectors returns the stored vectors with their data, which points
+// into d.exact while quantizing. The caller holds d.mu.
+func (d *MemoryDB) exactVectors() []*fingerprint.Vector {
+	if d.exact == nil {
+		return d.vectors
+	}
+	vectors := make([]*fingerprint.Vector, len(d.vectors))
+	for id, vector := range d.vectors {
+		exact := *vector
+		exact.Data = d.vectorData(id)
+		vectors[id] = &exact
+	}
+	return vectors
+}
+
+// rerank replaces estimated distances with exact ones and returns the k
+// closest candidates
+func rerank(query []float32, candidates []hnswCandidate, k int, vector func(id int) []float32, distance func(a, b []float32) float64) []hnswCandidate {
+	for i := range candidates {
+		candidates[i].distance = distance(query, vector(candidates[i].id))
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].distance < candidates[j].distance
+	})
+	if len(candidates) > k {
+		candidates = candidates[:k]
+	}
+	return candidates
+}
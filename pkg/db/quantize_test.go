@@ -0,0 +1,259 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// createClusteredVectors draws vectors around random cluster centers with
+// the given spread, which resembles fingerprints better than uniform noise
+func createClusteredVectors(rng *rand.Rand, n, dim, clusters int, spread float64) []*fingerprint.Vector {
+	centers := make([][]float32, clusters)
+	for i := range centers {
+		centers[i] = make([]float32, dim)
+		for j := range centers[i] {
+			centers[i][j] = float32(rng.NormFloat64())
+		}
+	}
+	vectors := make([]*fingerprint.Vector, n)
+	for i := range vectors {
+		center := centers[rng.Intn(clusters)]
+		vectors[i] = &fingerprint.Vector{Data: make([]float32, dim), TimeRef: float64(i)}
+		for j := range center {
+			vectors[i].Data[j] = center[j] + float32(spread*rng.NormFloat64())
+		}
+	}
+	return vectors
+}
+
+// createQuantizedDB adds vectors as tracks of 100 vectors each
+func createQuantizedDB(tb testing.TB, config Config, vectors []*fingerprint.Vector) *MemoryDB {
+	tb.Helper()
+	d := NewMemoryDB(config)
+	for start := 0; start < len(vectors); start += 100 {
+		end := min(start+100, len(vectors))
+		metadata := &TrackMetadata{ID: fmt.Sprintf("track-%04d", start/100)}
+		if err := d.Add(context.Background(), metadata, vectors[start:end]); err != nil {
+			tb.Fatalf("Failed to add: %v", err)
+		}
+	}
+	return d
+}
+
+// recall returns the fraction of the exact k nearest neighbors of the
+// queries that a search finds
+func recall(tb testing.TB, d *MemoryDB, queries []*fingerprint.Vector, k int) float64 {
+	tb.Helper()
+	found := 0
+	for _, query := range queries {
+		exact := make([]float64, len(d.vectors))
+		for id := range d.vectors {
+			exact[id] = cosineDistance(query.Data, d.vectorData(id))
+		}
+		sort.Float64s(exact)
+
+		results, err := d.Search(context.Background(), []*fingerprint.Vector{query}, k)
+		if err != nil {
+			tb.Fatalf("Failed to search: %v", err)
+		}
+		for _, result := range results {
+			if 2*(1-result.Score) <= exact[k-1]+1e-9 {
+				found++
+			}
+		}
+	}
+	return float64(found) / float64(k*len(queries))
+}
+
+func TestQuantizerEstimates(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	vectors := createClusteredVectors(rng, 600, 32, 8, 1)
+	queries := createClusteredVectors(rng, 20, 32, 8, 1)
+	config := DefaultConfig()
+	config.PQTrainingSize = 500
+	dead := make([]bool, len(vectors))
+
+	for _, test := range []struct {
+		quantization Quantization
+		maxError     float64
+	}{
+		{QuantizeInt8, 0.01},
+		{QuantizePQ, 0.1},
+	} {
+		config.Quantization = test.quantization
+		q := trainQuantizer(config, func(id int) []float32 { return vectors[id].Data }, dead)
+		if q == nil {
+			t.Fatalf("%s: expected a quantizer", test.quantization)
+		}
+		codes := make([]byte, len(vectors)*q.codeSize())
+		for id, vector := range vectors {
+			q.encode(codes[id*q.codeSize():], vector.Data)
+		}
+
+		var total float64
+		for _, query := range queries {
+			estimate := q.estimator(query.Data, codes)
+			for id, vector := range vectors {
+				total += math.Abs(estimate(id) - cosineDistance(query.Data, vector.Data))
+			}
+		}
+		if mean := total / float64(len(queries)*len(vectors)); mean > test.maxError {
+			t.Errorf("%s: mean estimation error %.4f exceeds %.4f", test.quantization, mean, test.maxError)
+		}
+	}
+
+	// Product quantization waits for enough training data
+	config.Quantization = QuantizePQ
+	config.PQTrainingSize = 1000
+	if q := trainQuantizer(config, func(id int) []float32 { return vectors[id].Data }, dead); q != nil {
+		t.Error("Expected no product quantizer before PQTrainingSize vectors")
+	}
+
+	if q, err := ParseQuantization("int8"); err != nil || q != QuantizeInt8 {
+		t.Errorf("Expected int8 to parse, got %v (err %v)", q, err)
+	}
+	if _, err := ParseQuantization("float16"); err == nil {
+		t.Error("Expected an unknown quantization to be rejected")
+	}
+}
+
+func TestQuantizedSearch(t *testing.T) {
+	ctx := context.Background()
+	rng := rand.New(rand.NewSource(5))
+	vectors := createClusteredVectors(rng, 2000, 32, 16, 1)
+	queries := createClusteredVectors(rng, 30, 32, 16, 1)
+
+	for _, test := range []struct {
+		quantization Quantization
+		minRecall    float64
+	}{
+		{QuantizeNone, 0.95},
+		{QuantizeInt8, 0.95},
+		{QuantizePQ, 0.85},
+	} {
+		t.Run(test.quantization.String(), func(t *testing.T) {
+			config := DefaultConfig()
+			config.Dim = 32
+			config.Quantization = test.quantization
+			config.EfSearch = 128
+			config.PQSubvectors = 8
+			config.PQTrainingSize = 1000
+			d := createQuantizedDB(t, config, vectors)
+			if test.quantization != QuantizeNone && len(d.codes) != len(d.vectors)*d.quantizer.codeSize() {
+				t.Fatalf("Expected a code for each of %d vectors, have %d bytes", len(d.vectors), len(d.codes))
+			}
+
+			// Only the codes stay on the heap; the exact vectors are in the
+			// vector file
+			if test.quantization != QuantizeNone {
+				for id, vector := range d.vectors {
+					if vector.Data != nil || !reflect.DeepEqual(d.vectorData(id), vectors[id].Data) {
+						t.Fatalf("Expected vector %d off the heap with its exact data", id)
+					}
+				}
+			}
+
+			if r := recall(t, d, queries, 10); r < test.minRecall {
+				t.Errorf("Recall@10 %.3f is below %.3f", r, test.minRecall)
+			}
+
+			// Re-ranking makes the scores exact
+			for _, query := range queries[:5] {
+				results, err := d.Search(ctx, []*fingerprint.Vector{query}, 3)
+				if err != nil {
+					t.Fatalf("Failed to search: %v", err)
+				}
+				for _, result := range results {
+					if exact := MetricCosine.score(cosineDistance(query.Data, result.MatchedVector.Data)); result.Score != exact {
+						t.Errorf("Score %.6f is not the exact similarity %.6f", result.Score, exact)
+					}
+				}
+			}
+
+			// Codes survive compaction and reloading
+			if err := d.Delete(ctx, "track-0003"); err != nil {
+				t.Fatalf("Failed to delete: %v", err)
+			}
+			if _, err := d.Compact(ctx); err != nil {
+				t.Fatalf("Failed to compact: %v", err)
+			}
+			path := filepath.Join(t.TempDir(), "library.db")
+			if err := d.Save(ctx, path); err != nil {
+				t.Fatalf("Failed to save: %v", err)
+			}
+			loaded := NewMemoryDB(config)
+			if err := loaded.Load(ctx, path); err != nil {
+				t.Fatalf("Failed to load: %v", err)
+			}
+			if test.quantization == QuantizeInt8 && !reflect.DeepEqual(loaded.codes, d.codes) {
+				t.Error("Codes differ after compacting and reloading")
+			}
+			if test.quantization != QuantizeNone && len(loaded.codes) != len(loaded.vectors)*loaded.quantizer.codeSize() {
+				t.Errorf("Expected a code for each of %d loaded vectors, have %d bytes", len(loaded.vectors), len(loaded.codes))
+			}
+			if r := recall(t, loaded, queries, 10); r < test.minRecall {
+				t.Errorf("Recall@10 after reloading %.3f is below %.3f", r, test.minRecall)
+			}
+		})
+	}
+}
+
+// BenchmarkQuantizedSearch measures search speed, recall@10 and the heap
+// bytes per vector of the database, graph and bookkeeping included, for
+// each quantization. Recall is relative to an exhaustive search, so the
+// "none" case is the graph's own limit that quantization is compared
+// against.
+func BenchmarkQuantizedSearch(b *testing.B) {
+	rng := rand.New(rand.NewSource(9))
+	const dim = 64
+	vectors := createClusteredVectors(rng, 10000, dim, 64, 0.5)
+	queries := createClusteredVectors(rng, 100, dim, 64, 0.5)
+
+	for _, quantization := range []Quantization{QuantizeNone, QuantizeInt8, QuantizePQ} {
+		b.Run(quantization.String(), func(b *testing.B) {
+			config := DefaultConfig()
+			config.Dim = dim
+			config.EfSearch = 128
+			config.Quantization = quantization
+
+			// The database gets its own copies of the vectors, so that the
+			// heap keeps their data only if the database does
+			copies := make([]*fingerprint.Vector, len(vectors))
+			before := heapAlloc()
+			for i, vector := range vectors {
+				copies[i] = &fingerprint.Vector{Data: append([]float32(nil), vector.Data...), TimeRef: vector.TimeRef}
+			}
+			d := createQuantizedDB(b, config, copies)
+			heap := heapAlloc() - before
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				query := queries[i%len(queries)]
+				if _, err := d.Search(context.Background(), []*fingerprint.Vector{query}, 10); err != nil {
+					b.Fatalf("Failed to search: %v", err)
+				}
+			}
+			b.StopTimer()
+
+			b.ReportMetric(float64(heap)/float64(len(vectors)), "heap-bytes/vector")
+			b.ReportMetric(recall(b, d, queries, 10), "recall@10")
+		})
+	}
+}
+
+// heapAlloc returns the bytes of live heap objects after a garbage collection
+func heapAlloc() int64 {
+	runtime.GC()
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return int64(stats.HeapAlloc)
+}
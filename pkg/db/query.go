@@ -0,0 +1,315 @@
+package db
+
+import (
+	"container/heap"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidCursor is returned by Query for a cursor that was not returned
+// by an earlier Query with the same sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// SortOrder selects the order of Query results. Ties are broken by ID, so
+// the order is total and pages never overlap.
+type SortOrder int
+
+const (
+	SortByID SortOrder = iota
+	SortByTitle
+	SortByArtist
+	SortByAdded
+)
+
+func (s SortOrder) String() string {
+	switch s {
+	case SortByID:
+		return "id"
+	case SortByTitle:
+		return "title"
+	case SortByArtist:
+		return "artist"
+	case SortByAdded:
+		return "added"
+	}
+	return fmt.Sprintf("sort order %d", int(s))
+}
+
+// ParseSortOrder parses the name of a sort order as returned by String
+func ParseSortOrder(name string) (SortOrder, error) {
+	for _, s := range []SortOrder{SortByID, SortByTitle, SortByArtist, SortByAdded} {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+	return SortByID, fmt.Errorf("unknown sort order %q", name)
+}
+
+// ListOptions filters, orders and pages the tracks returned by Query. The
+// zero value lists every track ordered by ID.
+type ListOptions struct {
+	Artist      string    // Case-insensitive substring of the artist; empty matches any
+	Title       string    // Case-insensitive substring of the title; empty matches any
+	AddedAfter  int64     // Earliest Added timestamp, inclusive; 0 for no bound
+	AddedBefore int64     // Latest Added timestamp, exclusive; 0 for no bound
+	Sort        SortOrder // Order of the results
+	Descending  bool      // Reverses the order
+	Limit       int       // Maximum number of tracks per page; 0 for no limit
+	Cursor      string    // TrackPage.NextCursor of the previous page; empty for the first
+}
+
+// TrackPage is one page of Query results
+type TrackPage struct {
+	Tracks     []*TrackMetadata
+	NextCursor string // Continues after the last track; empty on the last page
+}
+
+// TrackQuerier is implemented by databases that can filter and page their
+// tracks, so that large catalogues need not be listed at once
+type TrackQuerier interface {
+	// Query returns a page of the tracks matching opts
+	Query(ctx context.Context, opts ListOptions) (*TrackPage, error)
+}
+
+// trackCursor is the position after which the next page starts, encoded as
+// base64 JSON. It holds the sort key of the last track returned.
+type trackCursor struct {
+	Sort       SortOrder `json:"s"`
+	Descending bool      `json:"d,omitempty"`
+	Text       string    `json:"t,omitempty"`
+	Added      int64     `json:"a,omitempty"`
+	ID         string    `json:"i"`
+}
+
+func (c trackCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// trackQuery is a ListOptions prepared for matching and ordering tracks
+type trackQuery struct {
+	ListOptions
+	artist, title string
+	after         *trackCursor
+}
+
+func newTrackQuery(opts ListOptions) (*trackQuery, error) {
+	if opts.Limit < 0 {
+		return nil, fmt.Errorf("negative limit %d", opts.Limit)
+	}
+	if opts.Sort < SortByID || opts.Sort > SortByAdded {
+		return nil, fmt.Errorf("unknown %s", opts.Sort)
+	}
+	q := &trackQuery{
+		ListOptions: opts,
+		artist:      strings.ToLower(opts.Artist),
+		title:       strings.ToLower(opts.Title),
+	}
+	if opts.Cursor != "" {
+		data, err := base64.RawURLEncoding.DecodeString(opts.Cursor)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		var cursor trackCursor
+		if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == "" {
+			return nil, ErrInvalidCursor
+		}
+		if cursor.Sort != opts.Sort || cursor.Descending != opts.Descending {
+			return nil, fmt.Errorf("%w: it continues a query sorted by %s", ErrInvalidCursor, cursor.Sort)
+		}
+		q.after = &cursor
+	}
+	return q, nil
+}
+
+// key returns the cursor that a page ending with metadata continues from
+func (q *trackQuery) key(metadata *TrackMetadata) trackCursor {
+	key := trackCursor{Sort: q.Sort, Descending: q.Descending, ID: metadata.ID}
+	switch q.Sort {
+	case SortByTitle:
+		key.Text = metadata.Title
+	case SortByArtist:
+		key.Text = metadata.Artist
+	case SortByAdded:
+		key.Added = metadata.Added
+	}
+	return key
+}
+
+// before reports whether key a comes before key b in the query's order
+func (q *trackQuery) before(a, b trackCursor) bool {
+	less := a.ID < b.ID
+	switch {
+	case a.Text != b.Text:
+		less = a.Text < b.Text
+	case a.Added != b.Added:
+		less = a.Added < b.Added
+	case a.ID == b.ID:
+		return false
+	}
+	return less != q.Descending
+}
+
+// matches reports whether a track passes the filters and lies after the
+// cursor
+func (q *trackQuery) matches(metadata *TrackMetadata) bool {
+	if q.artist != "" && !strings.Contains(strings.ToLower(metadata.Artist), q.artist) {
+		return false
+	}
+	if q.title != "" && !strings.Contains(strings.ToLower(metadata.Title), q.title) {
+		return false
+	}
+	if q.AddedAfter != 0 && metadata.Added < q.AddedAfter {
+		return false
+	}
+	if q.AddedBefore != 0 && metadata.Added >= q.AddedBefore {
+		return false
+	}
+	return q.after == nil || q.before(*q.after, q.key(metadata))
+}
+
+// trackPager collects the tracks of a page as they are matched. With a
+// limit it keeps only the first Limit after the cursor, in a heap with the
+// last of them on top, so a page costs O(n log Limit) whatever the size of
+// the catalogue.
+type trackPager struct {
+	q       *trackQuery
+	entries []pagedTrack
+	more    bool // Tracks were dropped past the limit
+}
+
+type pagedTrack struct {
+	metadata *TrackMetadata
+	key      trackCursor
+}
+
+func (q *trackQuery) pager() *trackPager {
+	return &trackPager{q: q}
+}
+
+// add offers a matching track for the page
+func (p *trackPager) add(metadata *TrackMetadata) {
+	entry := pagedTrack{metadata, p.q.key(metadata)}
+	switch {
+	case p.q.Limit == 0 || len(p.entries) < p.q.Limit:
+		heap.Push(p, entry)
+	case p.q.before(entry.key, p.entries[0].key):
+		p.entries[0] = entry
+		heap.Fix(p, 0)
+		p.more = true
+	default:
+		p.more = true
+	}
+}
+
+// page orders the collected tracks and returns them as a page, copying the
+// tracks
+func (p *trackPager) page() *TrackPage {
+	page := &TrackPage{Tracks: make([]*TrackMetadata, len(p.entries))}
+	if p.more && len(p.entries) > 0 {
+		page.NextCursor = p.entries[0].key.encode()
+	}
+	for i := len(p.entries) - 1; i >= 0; i-- {
+		page.Tracks[i] = heap.Pop(p).(pagedTrack).metadata.Clone()
+	}
+	return page
+}
+
+func (p *trackPager) Len() int { return len(p.entries) }
+
+func (p *trackPager) Less(i, j int) bool {
+	return p.q.before(p.entries[j].key, p.entries[i].key)
+}
+
+func (p *trackPager) Swap(i, j int) { p.entries[i], p.entries[j] = p.entries[j], p.entries[i] }
+
+func (p *trackPager) Push(x interface{}) { p.entries = append(p.entries, x.(pagedTrack)) }
+
+func (p *trackPager) Pop() interface{} {
+	last := p.entries[len(p.entries)-1]
+	p.entries = p.entries[:len(p.entries)-1]
+	return last
+}
+
+// Query returns a page of the tracks matching opts
+func (d *MemoryDB) Query(ctx context.Context, opts ListOptions) (*TrackPage, error) {
+	q, err := newTrackQuery(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tracks: %w", err)
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	pager := q.pager()
+	for _, metadata := range d.tracks {
+		if q.matches(metadata) {
+			pager.add(metadata)
+		}
+	}
+	return pager.page(), nil
+}
+
+// Query returns a page of the tracks matching opts
+func (m *MappedDB) Query(ctx context.Context, opts ListOptions) (*TrackPage, error) {
+	q, err := newTrackQuery(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tracks: %w", err)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	index, err := m.current()
+	if err != nil {
+		return nil, err
+	}
+	pager := q.pager()
+	for _, metadata := range index.tracks {
+		if q.matches(metadata) {
+			pager.add(metadata)
+		}
+	}
+	return pager.page(), nil
+}
+
+// Query queries every shard for a page and merges them. The shards must
+// implement TrackQuerier.
+func (d *ShardedDB) Query(ctx context.Context, opts ListOptions) (*TrackPage, error) {
+	q, err := newTrackQuery(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tracks: %w", err)
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	pages := make([]*TrackPage, len(d.shards))
+	err = d.scatter(ctx, func(ctx context.Context, shard int) error {
+		querier, ok := d.shards[shard].(TrackQuerier)
+		if !ok {
+			return fmt.Errorf("shard %d does not support queries", shard)
+		}
+		page, err := querier.Query(ctx, opts)
+		pages[shard] = page
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query tracks: %w", err)
+	}
+
+	// Every shard's page holds its first Limit matches, so the first Limit
+	// of their union are the first Limit overall
+	pager := q.pager()
+	for _, page := range pages {
+		for _, metadata := range page.Tracks {
+			pager.add(metadata)
+		}
+		pager.more = pager.more || page.NextCursor != ""
+	}
+	return pager.page(), nil
+}
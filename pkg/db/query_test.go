@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// createCatalogue adds tracks with few vectors and varied metadata: four
+// artists, titles with shared words and Added timestamps 0 to n-1
+func createCatalogue(t *testing.T, d VectorDB, n int) {
+	t.Helper()
+	ctx := context.Background()
+	for i := 0; i < n; i++ {
+		metadata := &TrackMetadata{
+			ID:     fmt.Sprintf("track-%03d", i),
+			Title:  fmt.Sprintf("Song %d", (i*7)%n),
+			Artist: []string{"The Beatles", "Beat Happening", "Nina Simone", "Björk"}[i%4],
+			Added:  int64((i * 13) % n),
+		}
+		vectors := []*fingerprint.Vector{{Data: []float32{float32(i), 1, 0, 0}}}
+		if err := d.Add(ctx, metadata, vectors); err != nil {
+			t.Fatalf("Failed to add %s: %v", metadata.ID, err)
+		}
+	}
+}
+
+// queryAll follows the cursors until the last page, returning the IDs in
+// order and the number of pages
+func queryAll(t *testing.T, d TrackQuerier, opts ListOptions) ([]string, int) {
+	t.Helper()
+	var ids []string
+	for pages := 1; ; pages++ {
+		page, err := d.Query(context.Background(), opts)
+		if err != nil {
+			t.Fatalf("Failed to query: %v", err)
+		}
+		if opts.Limit > 0 && len(page.Tracks) > opts.Limit {
+			t.Fatalf("Page of %d tracks exceeds the limit of %d", len(page.Tracks), opts.Limit)
+		}
+		for _, metadata := range page.Tracks {
+			ids = append(ids, metadata.ID)
+		}
+		if page.NextCursor == "" {
+			return ids, pages
+		}
+		opts.Cursor = page.NextCursor
+	}
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	d := NewMemoryDB(config)
+	createCatalogue(t, d, 50)
+
+	// Pages of the zero options concatenate to List
+	tracks, _ := d.List(ctx)
+	var want []string
+	for _, metadata := range tracks {
+		want = append(want, metadata.ID)
+	}
+	if got, pages := queryAll(t, d, ListOptions{Limit: 7}); !reflect.DeepEqual(got, want) || pages != 8 {
+		t.Errorf("Expected the listed IDs in 8 pages, got %d pages: %v", pages, got)
+	}
+
+	for _, test := range []struct {
+		name string
+		opts ListOptions
+		want []string
+	}{
+		// Added is i*13 % 50 and the title "Song <i*7 % 50>"
+		{"artist", ListOptions{Artist: "beat", Sort: SortByAdded, Limit: 3},
+			[]string{"track-000", "track-004", "track-008", "track-012", "track-016", "track-020", "track-024", "track-001", "track-028",
+				"track-005", "track-032", "track-009", "track-036", "track-013", "track-040", "track-017", "track-044", "track-021",
+				"track-048", "track-025", "track-029", "track-033", "track-037", "track-041", "track-045", "track-049"}},
+		{"title", ListOptions{Title: "SONG 1", Sort: SortByTitle, Limit: 2},
+			[]string{"track-043", "track-030", "track-023", "track-016", "track-009", "track-002", "track-045", "track-038",
+				"track-031", "track-024", "track-017"}},
+		{"added range", ListOptions{AddedAfter: 10, AddedBefore: 14, Sort: SortByAdded, Descending: true, Limit: 3},
+			[]string{"track-001", "track-024", "track-047", "track-020"}},
+		{"artist descending", ListOptions{Artist: "björk", Descending: true, Limit: 5},
+			[]string{"track-047", "track-043", "track-039", "track-035", "track-031", "track-027", "track-023", "track-019",
+				"track-015", "track-011", "track-007", "track-003"}},
+	} {
+		if got, _ := queryAll(t, d, test.opts); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+
+	// Cursors continue the query they came from only
+	page, err := d.Query(ctx, ListOptions{Limit: 5})
+	if err != nil || page.NextCursor == "" {
+		t.Fatalf("Expected a next page, got %+v (err %v)", page, err)
+	}
+	if _, err := d.Query(ctx, ListOptions{Sort: SortByAdded, Cursor: page.NextCursor}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected a cursor of another order to be rejected, got %v", err)
+	}
+	if _, err := d.Query(ctx, ListOptions{Cursor: "not a cursor"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("Expected a malformed cursor to be rejected, got %v", err)
+	}
+
+	// Tracks added between pages appear if they sort after the cursor
+	d.Add(ctx, &TrackMetadata{ID: "track-999"}, []*fingerprint.Vector{{Data: []float32{1, 1, 1, 1}}})
+	rest, _ := queryAll(t, d, ListOptions{Limit: 100, Cursor: page.NextCursor})
+	if len(rest) != 46 || rest[0] != "track-005" || rest[45] != "track-999" {
+		t.Errorf("Expected the 46 tracks after track-004, got %v", rest)
+	}
+}
+
+func TestQueryShardedAndMapped(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	d := NewMemoryDB(config)
+	createCatalogue(t, d, 40)
+
+	shards := make([]VectorDB, 3)
+	for i := range shards {
+		shards[i] = NewMemoryDB(config)
+	}
+	sharded, err := NewShardedDB(shards...)
+	if err != nil {
+		t.Fatalf("Failed to create sharded database: %v", err)
+	}
+	createCatalogue(t, sharded, 40)
+
+	path := filepath.Join(t.TempDir(), "library.idx")
+	if err := d.WriteIndex(ctx, path); err != nil {
+		t.Fatalf("Failed to write index: %v", err)
+	}
+	mapped, err := OpenMappedDB(path)
+	if err != nil {
+		t.Fatalf("Failed to open index: %v", err)
+	}
+	defer mapped.Close()
+
+	for _, opts := range []ListOptions{
+		{Limit: 4},
+		{Sort: SortByTitle, Descending: true, Limit: 6},
+		{Artist: "simone", Sort: SortByAdded, Limit: 3},
+		{AddedAfter: 5, Sort: SortByArtist},
+	} {
+		want, _ := queryAll(t, d, opts)
+		if got, _ := queryAll(t, sharded, opts); !reflect.DeepEqual(got, want) {
+			t.Errorf("%+v: sharded database returned %v, expected %v", opts, got, want)
+		}
+		if got, _ := queryAll(t, mapped, opts); !reflect.DeepEqual(got, want) {
+			t.Errorf("%+v: mapped index returned %v, expected %v", opts, got, want)
+		}
+	}
+}
+
+func TestQueryPagerBounded(t *testing.T) {
+	q, err := newTrackQuery(ListOptions{Sort: SortByTitle, Limit: 10})
+	if err != nil {
+		t.Fatalf("Failed to prepare query: %v", err)
+	}
+	pager := q.pager()
+	for _, i := range rand.New(rand.NewSource(3)).Perm(1000) {
+		pager.add(&TrackMetadata{ID: fmt.Sprintf("track-%03d", i), Title: fmt.Sprintf("Song %03d", i/2)})
+		if len(pager.entries) > 10 {
+			t.Fatalf("Pager holds %d tracks, expected at most the limit of 10", len(pager.entries))
+		}
+	}
+
+	page := pager.page()
+	var got []string
+	for _, metadata := range page.Tracks {
+		got = append(got, metadata.ID)
+	}
+	want := []string{"track-000", "track-001", "track-002", "track-003", "track-004",
+		"track-005", "track-006", "track-007", "track-008", "track-009"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected the first 10 tracks, got %v", got)
+	}
+	if page.NextCursor != q.key(page.Tracks[9]).encode() {
+		t.Error("Expected the next cursor to continue after the last track")
+	}
+
+	// A page that ends exactly at the last match has no next cursor
+	pager = q.pager()
+	for _, metadata := range page.Tracks {
+		pager.add(metadata)
+	}
+	if page := pager.page(); len(page.Tracks) != 10 || page.NextCursor != "" {
+		t.Errorf("Expected 10 tracks and no next cursor, got %d tracks and cursor %q", len(page.Tracks), page.NextCursor)
+	}
+}
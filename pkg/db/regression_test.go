@@ -0,0 +1,125 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/internal/golden"
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// createSyntheticFingerprint fingerprints seconds of chords over a sweep with
+// clicks at 22.05 kHz, starting at offset seconds. Each seed gives a
+// different track.
+func createSyntheticFingerprint(t *testing.T, trackID string, seed int64, offset, seconds float64) *fingerprint.Fingerprint {
+	t.Helper()
+	synth := audio.NewSynthesizer(22050, seed)
+	root := 196 + 20*float64(seed)
+
+	chords, err := synth.Chords(12, 0.5, []float64{root, root * 1.25, root * 0.75, root * 1.5}, 0.6)
+	if err != nil {
+		t.Fatalf("Failed to synthesize chords: %v", err)
+	}
+	sweep, err := synth.Sweep(12, 300*float64(seed), 4000, 0.4)
+	if err != nil {
+		t.Fatalf("Failed to synthesize sweep: %v", err)
+	}
+	clicks, err := synth.Clicks(12, 100+10*float64(seed), 0.3)
+	if err != nil {
+		t.Fatalf("Failed to synthesize clicks: %v", err)
+	}
+	track, err := audio.Mix(chords, sweep, clicks)
+	if err != nil {
+		t.Fatalf("Failed to mix track: %v", err)
+	}
+	track, err = audio.Excerpt(track, offset, offset+seconds)
+	if err != nil {
+		t.Fatalf("Failed to cut excerpt: %v", err)
+	}
+
+	fp, err := fingerprint.NewGenerator(fingerprint.DefaultConfig()).Fingerprint(track, trackID)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint %s: %v", trackID, err)
+	}
+	return fp
+}
+
+// describe summarizes a query against d: the best vector match of each query
+// vector and the number of hash matches per track
+func describe(t *testing.T, d *MemoryDB, query *fingerprint.Fingerprint) string {
+	t.Helper()
+	ctx := context.Background()
+
+	var lines []string
+	for _, vector := range query.Vectors {
+		results, err := d.Search(ctx, []*fingerprint.Vector{vector}, 1)
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		for _, result := range results {
+			lines = append(lines, fmt.Sprintf("vector %.2f: %s offset=%.2f score=%.4f", vector.TimeRef, result.TrackID, result.TimeOffset, result.Score))
+		}
+	}
+
+	matches, err := d.LookupHashes(ctx, query.Hashes)
+	if err != nil {
+		t.Fatalf("Failed to look up hashes: %v", err)
+	}
+	counts := make(map[string]int)
+	for _, match := range matches {
+		counts[match.Reference.TrackID]++
+	}
+	var tracks []string
+	for trackID := range counts {
+		tracks = append(tracks, trackID)
+	}
+	sort.Strings(tracks)
+	for _, trackID := range tracks {
+		lines = append(lines, fmt.Sprintf("hashes %s: %d", trackID, counts[trackID]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// TestRegressionSearch pins vector search and hash lookup results for a
+// synthetic library, before and after a save and load and after a delete.
+// Regenerate with go test -run Regression -update after intended changes.
+func TestRegressionSearch(t *testing.T) {
+	ctx := context.Background()
+	d := NewMemoryDB(DefaultConfig())
+	for seed := int64(1); seed <= 3; seed++ {
+		fp := createSyntheticFingerprint(t, fmt.Sprintf("track-%d", seed), seed, 0, 12)
+		if err := d.Add(ctx, &TrackMetadata{ID: fp.TrackID, Duration: fp.Duration}, fp.Vectors); err != nil {
+			t.Fatalf("Failed to add %s: %v", fp.TrackID, err)
+		}
+		if err := d.AddHashes(ctx, fp.TrackID, fp.Hashes); err != nil {
+			t.Fatalf("Failed to add hashes for %s: %v", fp.TrackID, err)
+		}
+	}
+
+	query := createSyntheticFingerprint(t, "", 2, 4, 4)
+	before := describe(t, d, query)
+	golden.Check(t, "regression_search.golden", before)
+
+	// The library survives a round trip through disk unchanged
+	path := filepath.Join(t.TempDir(), "library.db")
+	if err := d.Save(ctx, path); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+	loaded := NewMemoryDB(DefaultConfig())
+	if err := loaded.Load(ctx, path); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if after := describe(t, loaded, query); after != before {
+		t.Errorf("Results changed after loading:\ngot:\n%s\nwant:\n%s", after, before)
+	}
+
+	if err := d.Delete(ctx, "track-2"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	golden.Check(t, "regression_search_deleted.golden", describe(t, d, query))
+}
@@ -0,0 +1,456 @@
+package db
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// ShardedDB implements the VectorDB and HashIndex interfaces on top of
+// several databases. Every track lives on one shard, chosen by rendezvous
+// hashing of its ID, so adding a shard moves only the tracks that now belong
+// to it. Searches and hash lookups are sent to all shards concurrently and
+// their results merged.
+type ShardedDB struct {
+	mu     sync.RWMutex // Held for writing while tracks move between shards
+	shards []VectorDB
+}
+
+// shardManifest is the file written by ShardedDB.Save next to the shards
+type shardManifest struct {
+	Shards int `json:"shards"`
+}
+
+// NewShardedDB creates a database that partitions tracks across shards. The
+// shards should be empty, or hold exactly the tracks a ShardedDB with the
+// same shards in the same order assigned to them; call Rebalance otherwise.
+// Shards that implement HashIndex make the sharded database usable as one,
+// and shards that implement TrackExporter allow tracks to be moved.
+func NewShardedDB(shards ...VectorDB) (*ShardedDB, error) {
+	if len(shards) == 0 {
+		return nil, fmt.Errorf("sharded database needs at least one shard")
+	}
+	return &ShardedDB{shards: append([]VectorDB(nil), shards...)}, nil
+}
+
+// ShardPath returns the path a ShardedDB saved to path stores a shard at
+func ShardPath(path string, shard int) string {
+	return fmt.Sprintf("%s.%d", path, shard)
+}
+
+// shardWeight is the rendezvous hashing weight of a track on a shard
+func shardWeight(shard int, trackID string) uint64 {
+	h := fnv.New64a()
+	var prefix [8]byte
+	binary.LittleEndian.PutUint64(prefix[:], uint64(shard))
+	h.Write(prefix[:])
+	h.Write([]byte(trackID))
+
+	// FNV spreads trailing bytes poorly; finish with the splitmix64 mixer
+	x := h.Sum64()
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
+
+// shardFor returns the shard a track belongs to. The caller holds d.mu.
+func (d *ShardedDB) shardFor(trackID string) int {
+	best, bestWeight := 0, uint64(0)
+	for i := range d.shards {
+		if weight := shardWeight(i, trackID); i == 0 || weight > bestWeight {
+			best, bestWeight = i, weight
+		}
+	}
+	return best
+}
+
+// hashIndex returns a shard as a HashIndex. The caller holds d.mu.
+func (d *ShardedDB) hashIndex(shard int) (HashIndex, error) {
+	index, ok := d.shards[shard].(HashIndex)
+	if !ok {
+		return nil, fmt.Errorf("shard %d does not store hashes", shard)
+	}
+	return index, nil
+}
+
+// scatter calls fn for every shard concurrently and waits for all of them.
+// The context passed to fn is cancelled as soon as one call fails. The
+// caller holds d.mu.
+func (d *ShardedDB) scatter(ctx context.Context, fn func(ctx context.Context, shard int) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	errs := make([]error, len(d.shards))
+	var wg sync.WaitGroup
+	for i := range d.shards {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := fn(ctx, i); err != nil {
+				errs[i] = err
+				cancel()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	// Report the failure that cancelled the other calls, not a cancellation
+	var first error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("shard %d: %w", i, err)
+		if !errors.Is(err, context.Canceled) {
+			return err
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Add inserts vectors and metadata for a track on its shard
+func (d *ShardedDB) Add(ctx context.Context, metadata *TrackMetadata, vectors []*fingerprint.Vector) error {
+	if metadata == nil || metadata.ID == "" {
+		return fmt.Errorf("track metadata must have an ID")
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.shards[d.shardFor(metadata.ID)].Add(ctx, metadata, vectors)
+}
+
+// Search finds the k nearest neighbors of every query vector on all shards.
+// The shards' candidates for each query vector are merged by descending
+// Score and the best k kept, so results are ordered like those of a single
+// database: query vector by query vector.
+func (d *ShardedDB) Search(ctx context.Context, query []*fingerprint.Vector, k int) ([]SearchResult, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	// found[shard][i] holds the shard's results for query vector i
+	found := make([][][]SearchResult, len(d.shards))
+	err := d.scatter(ctx, func(ctx context.Context, shard int) error {
+		found[shard] = make([][]SearchResult, len(query))
+		for i := range query {
+			results, err := d.shards[shard].Search(ctx, query[i:i+1], k)
+			if err != nil {
+				return err
+			}
+			found[shard][i] = results
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search: %w", err)
+	}
+
+	var results []SearchResult
+	for i := range query {
+		var merged []SearchResult
+		for shard := range found {
+			merged = append(merged, found[shard][i]...)
+		}
+		// Stable, so ties keep shard order and results are deterministic
+		sort.SliceStable(merged, func(a, b int) bool {
+			return merged[a].Score > merged[b].Score
+		})
+		if len(merged) > k {
+			merged = merged[:k]
+		}
+		results = append(results, merged...)
+	}
+
+	return results, nil
+}
+
+// Delete removes a track from its shard
+func (d *ShardedDB) Delete(ctx context.Context, trackID string) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.shards[d.shardFor(trackID)].Delete(ctx, trackID)
+}
+
+// Export returns a copy of a track from its shard, which must implement
+// TrackExporter
+func (d *ShardedDB) Export(ctx context.Context, trackID string) (*TrackMetadata, []*fingerprint.Vector, []fingerprint.Hash, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	shard := d.shardFor(trackID)
+	exporter, ok := d.shards[shard].(TrackExporter)
+	if !ok {
+		return nil, nil, nil, fmt.Errorf("shard %d cannot export tracks", shard)
+	}
+	return exporter.Export(ctx, trackID)
+}
+
+// Update replaces the metadata of a track on its shard, which must
+// implement TrackUpdater
+func (d *ShardedDB) Update(ctx context.Context, metadata *TrackMetadata) error {
+	if metadata == nil || metadata.ID == "" {
+		return fmt.Errorf("track metadata must have an ID")
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	shard := d.shardFor(metadata.ID)
+	updater, ok := d.shards[shard].(TrackUpdater)
+	if !ok {
+		return fmt.Errorf("shard %d does not support updates", shard)
+	}
+	return updater.Update(ctx, metadata)
+}
+
+// Get retrieves track metadata from the track's shard
+func (d *ShardedDB) Get(ctx context.Context, trackID string) (*TrackMetadata, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	return d.shards[d.shardFor(trackID)].Get(ctx, trackID)
+}
+
+// List returns the track metadata of all shards ordered by ID
+func (d *ShardedDB) List(ctx context.Context) ([]*TrackMetadata, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	listed := make([][]*TrackMetadata, len(d.shards))
+	err := d.scatter(ctx, func(ctx context.Context, shard int) error {
+		tracks, err := d.shards[shard].List(ctx)
+		listed[shard] = tracks
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tracks: %w", err)
+	}
+
+	var tracks []*TrackMetadata
+	for _, shardTracks := range listed {
+		tracks = append(tracks, shardTracks...)
+	}
+	sort.Slice(tracks, func(i, j int) bool {
+		return tracks[i].ID < tracks[j].ID
+	})
+
+	return tracks, nil
+}
+
+// AddHashes inserts hashes for a track on its shard
+func (d *ShardedDB) AddHashes(ctx context.Context, trackID string, hashes []fingerprint.Hash) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	index, err := d.hashIndex(d.shardFor(trackID))
+	if err != nil {
+		return err
+	}
+	return index.AddHashes(ctx, trackID, hashes)
+}
+
+// LookupHashes returns every hash stored on any shard sharing a value with a
+// query hash
+func (d *ShardedDB) LookupHashes(ctx context.Context, query []fingerprint.Hash) ([]HashMatch, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	found := make([][]HashMatch, len(d.shards))
+	err := d.scatter(ctx, func(ctx context.Context, shard int) error {
+		index, err := d.hashIndex(shard)
+		if err != nil {
+			return err
+		}
+		found[shard], err = index.LookupHashes(ctx, query)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up hashes: %w", err)
+	}
+
+	var matches []HashMatch
+	for _, shardMatches := range found {
+		matches = append(matches, shardMatches...)
+	}
+
+	return matches, nil
+}
+
+// Compact compacts every shard that implements Compactor, concurrently, and
+// returns the combined statistics. Tracks moved off a shard by AddShard or
+// Rebalance are deleted there, so compacting afterwards reclaims their space.
+func (d *ShardedDB) Compact(ctx context.Context) (CompactStats, error) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	compacted := make([]CompactStats, len(d.shards))
+	err := d.scatter(ctx, func(ctx context.Context, shard int) error {
+		compactor, ok := d.shards[shard].(Compactor)
+		if !ok {
+			return nil
+		}
+		var err error
+		compacted[shard], err = compactor.Compact(ctx)
+		return err
+	})
+
+	var stats CompactStats
+	for _, shardStats := range compacted {
+		stats.Add(shardStats)
+	}
+	if err != nil {
+		return stats, fmt.Errorf("failed to compact: %w", err)
+	}
+	return stats, nil
+}
+
+// Save persists every shard to ShardPath(path, shard) and then writes a
+// manifest recording the number of shards to path
+func (d *ShardedDB) Save(ctx context.Context, path string) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	err := d.scatter(ctx, func(ctx context.Context, shard int) error {
+		return d.shards[shard].Save(ctx, ShardPath(path, shard))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save shards: %w", err)
+	}
+
+	manifest, err := json.Marshal(shardManifest{Shards: len(d.shards)})
+	if err != nil {
+		return fmt.Errorf("failed to encode shard manifest: %w", err)
+	}
+	err = writeFileAtomic(path, func(file *os.File) error {
+		_, err := file.Write(manifest)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save shard manifest: %w", err)
+	}
+
+	return nil
+}
+
+// Load restores every shard from a database written by Save. The number of
+// shards must match the manifest. If loading one shard fails the others may
+// already have been replaced.
+func (d *ShardedDB) Load(ctx context.Context, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read shard manifest: %w", err)
+	}
+	var manifest shardManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("%w: shard manifest: %v", ErrCorrupted, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if manifest.Shards != len(d.shards) {
+		return fmt.Errorf("%s holds %d shards, database has %d", path, manifest.Shards, len(d.shards))
+	}
+	err = d.scatter(ctx, func(ctx context.Context, shard int) error {
+		return d.shards[shard].Load(ctx, ShardPath(path, shard))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load shards: %w", err)
+	}
+
+	return nil
+}
+
+// AddShard adds a shard and moves the tracks that now belong to it there.
+// Reads and writes wait until the move is complete. If it fails, the shard
+// stays added and Rebalance finishes the move.
+func (d *ShardedDB) AddShard(ctx context.Context, shard VectorDB) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.shards = append(d.shards, shard)
+	return d.rebalance(ctx)
+}
+
+// Rebalance moves every track that is not on the shard it belongs to. Moving
+// requires the source shard to implement TrackExporter.
+func (d *ShardedDB) Rebalance(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.rebalance(ctx)
+}
+
+// rebalance implements Rebalance. The caller holds d.mu for writing.
+func (d *ShardedDB) rebalance(ctx context.Context) error {
+	for from, shard := range d.shards {
+		tracks, err := shard.List(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list shard %d: %w", from, err)
+		}
+		for _, metadata := range tracks {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			to := d.shardFor(metadata.ID)
+			if to == from {
+				continue
+			}
+			if err := d.move(ctx, metadata.ID, from, to); err != nil {
+				return fmt.Errorf("failed to move track %s from shard %d to %d: %w", metadata.ID, from, to, err)
+			}
+		}
+	}
+	return nil
+}
+
+// move copies a track to another shard and then deletes the original, so
+// an interrupted move leaves a copy rather than losing the track. The caller
+// holds d.mu for writing.
+func (d *ShardedDB) move(ctx context.Context, trackID string, from, to int) error {
+	exporter, ok := d.shards[from].(TrackExporter)
+	if !ok {
+		return fmt.Errorf("shard %d cannot export tracks", from)
+	}
+	metadata, vectors, hashes, err := exporter.Export(ctx, trackID)
+	if err != nil {
+		return err
+	}
+
+	// An earlier interrupted move may have copied the track already
+	target := d.shards[to]
+	if _, err := target.Get(ctx, trackID); err != nil && !errors.Is(err, ErrNotFound) {
+		return err
+	} else if err != nil {
+		if err := target.Add(ctx, metadata, vectors); err != nil {
+			return err
+		}
+		if len(hashes) > 0 {
+			index, err := d.hashIndex(to)
+			if err == nil {
+				err = index.AddHashes(ctx, trackID, hashes)
+			}
+			if err != nil {
+				// Don't leave a copy without hashes behind
+				if deleteErr := target.Delete(ctx, trackID); deleteErr != nil {
+					return fmt.Errorf("%w (rollback failed: %v)", err, deleteErr)
+				}
+				return err
+			}
+		}
+	}
+
+	return d.shards[from].Delete(ctx, trackID)
+}
@@ -0,0 +1,263 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// createShardedDB creates a sharded database over empty in-memory shards
+func createShardedDB(t *testing.T, config Config, shards int) (*ShardedDB, []*MemoryDB) {
+	t.Helper()
+	memories := make([]*MemoryDB, shards)
+	vectorDBs := make([]VectorDB, shards)
+	for i := range memories {
+		memories[i] = NewMemoryDB(config)
+		vectorDBs[i] = memories[i]
+	}
+	d, err := NewShardedDB(vectorDBs...)
+	if err != nil {
+		t.Fatalf("Failed to create sharded database: %v", err)
+	}
+	return d, memories
+}
+
+// fillSharded copies every track of source into a sharded database
+func fillSharded(t *testing.T, d *ShardedDB, source *MemoryDB) {
+	t.Helper()
+	ctx := context.Background()
+	tracks, _ := source.List(ctx)
+	for _, track := range tracks {
+		metadata, vectors, hashes, err := source.Export(ctx, track.ID)
+		if err != nil {
+			t.Fatalf("Failed to export %s: %v", track.ID, err)
+		}
+		if err := d.Add(ctx, metadata, vectors); err != nil {
+			t.Fatalf("Failed to add %s: %v", track.ID, err)
+		}
+		if err := d.AddHashes(ctx, track.ID, hashes); err != nil {
+			t.Fatalf("Failed to add hashes for %s: %v", track.ID, err)
+		}
+	}
+}
+
+// shardContents lists the track IDs on every shard
+func shardContents(t *testing.T, memories []*MemoryDB) [][]string {
+	t.Helper()
+	contents := make([][]string, len(memories))
+	for i, memory := range memories {
+		contents[i] = trackIDs(t, memory)
+	}
+	return contents
+}
+
+func TestShardedDB(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 8
+	config.EfSearch = 400 // Exhaustive on this little data, so results are exact
+	single := createTestDB(t, config, 12, 20)
+
+	d, memories := createShardedDB(t, config, 3)
+	fillSharded(t, d, single)
+
+	// Tracks are spread over the shards and found where they were put
+	for i, ids := range shardContents(t, memories) {
+		if len(ids) == 0 {
+			t.Errorf("Shard %d is empty", i)
+		}
+		for _, id := range ids {
+			if shard := d.shardFor(id); shard != i {
+				t.Errorf("Track %s is on shard %d, expected %d", id, i, shard)
+			}
+		}
+	}
+	want, _ := single.List(ctx)
+	got, err := d.List(ctx)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Sharded track list differs (err %v)", err)
+	}
+	if metadata, err := d.Get(ctx, "track-07"); err != nil || metadata.Title != "Title track-07" {
+		t.Errorf("Expected track-07, got %+v (err %v)", metadata, err)
+	}
+
+	// Merged results match a single database holding every track
+	query := createTestDB(t, config, 1, 10).vectors
+	for _, k := range []int{1, 5} {
+		wantResults, _ := single.Search(ctx, query, k)
+		gotResults, err := d.Search(ctx, query, k)
+		if err != nil {
+			t.Fatalf("Failed to search: %v", err)
+		}
+		if len(gotResults) != len(wantResults) {
+			t.Fatalf("k=%d: expected %d results, got %d", k, len(wantResults), len(gotResults))
+		}
+		for i := range gotResults {
+			if gotResults[i].TrackID != wantResults[i].TrackID || gotResults[i].Score != wantResults[i].Score {
+				t.Errorf("k=%d: result %d is %s (%.4f), expected %s (%.4f)", k, i,
+					gotResults[i].TrackID, gotResults[i].Score, wantResults[i].TrackID, wantResults[i].Score)
+			}
+		}
+	}
+
+	hashes := single.trackHashes["track-03"]
+	wantMatches, _ := single.LookupHashes(ctx, hashes)
+	gotMatches, err := d.LookupHashes(ctx, hashes)
+	if err != nil {
+		t.Fatalf("Failed to look up hashes: %v", err)
+	}
+	sortMatches(wantMatches)
+	sortMatches(gotMatches)
+	if !reflect.DeepEqual(gotMatches, wantMatches) {
+		t.Errorf("Sharded hash lookup differs: %d vs %d matches", len(gotMatches), len(wantMatches))
+	}
+
+	if err := d.Delete(ctx, "track-07"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	if _, err := d.Get(ctx, "track-07"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound for the deleted track, got %v", err)
+	}
+
+	// Cancelled searches fail
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := d.Search(cancelled, query, 1); err == nil {
+		t.Error("Expected a cancelled search to fail")
+	}
+}
+
+func TestShardedDBAddShard(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	source := createTestDB(t, config, 40, 3)
+
+	d, memories := createShardedDB(t, config, 3)
+	fillSharded(t, d, source)
+	before := shardContents(t, memories)
+
+	added := NewMemoryDB(config)
+	if err := d.AddShard(ctx, added); err != nil {
+		t.Fatalf("Failed to add shard: %v", err)
+	}
+	after := shardContents(t, append(memories, added))
+
+	// Only tracks moving to the new shard leave the old ones
+	moved := 0
+	for i := range memories {
+		kept := make(map[string]bool)
+		for _, id := range after[i] {
+			kept[id] = true
+		}
+		for _, id := range before[i] {
+			if !kept[id] {
+				moved++
+				if d.shardFor(id) != 3 {
+					t.Errorf("Track %s left shard %d for shard %d", id, i, d.shardFor(id))
+				}
+			}
+		}
+	}
+	if moved == 0 || moved != len(after[3]) {
+		t.Errorf("Expected the new shard to receive the moved tracks, moved %d, new shard holds %d", moved, len(after[3]))
+	}
+
+	// Moved tracks keep their vectors and hashes
+	for _, id := range after[3] {
+		_, wantVectors, wantHashes, _ := source.Export(ctx, id)
+		_, gotVectors, gotHashes, err := added.Export(ctx, id)
+		if err != nil || !reflect.DeepEqual(gotVectors, wantVectors) || !reflect.DeepEqual(gotHashes, wantHashes) {
+			t.Errorf("Track %s changed while moving (err %v)", id, err)
+		}
+	}
+	if tracks, _ := d.List(ctx); len(tracks) != 40 {
+		t.Errorf("Expected 40 tracks after adding a shard, got %d", len(tracks))
+	}
+
+	// A copy left behind by an interrupted move is cleaned up by Rebalance
+	id := after[3][0]
+	metadata, vectors, hashes, _ := added.Export(ctx, id)
+	memories[0].Add(ctx, metadata, vectors)
+	memories[0].AddHashes(ctx, id, hashes)
+	if err := d.Rebalance(ctx); err != nil {
+		t.Fatalf("Failed to rebalance: %v", err)
+	}
+	if _, err := memories[0].Get(ctx, id); err == nil {
+		t.Errorf("Expected the stray copy of %s to be removed", id)
+	}
+	if _, err := d.Get(ctx, id); err != nil {
+		t.Errorf("Expected %s to survive rebalancing: %v", id, err)
+	}
+}
+
+// unreadableShard fails every Get with err
+type unreadableShard struct {
+	*MemoryDB
+	err error
+}
+
+func (s unreadableShard) Get(ctx context.Context, trackID string) (*TrackMetadata, error) {
+	return nil, s.err
+}
+
+func TestShardedDBMoveLookupError(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	source, target := NewMemoryDB(config), NewMemoryDB(config)
+	failure := errors.New("disk failure")
+	d, err := NewShardedDB(source, unreadableShard{MemoryDB: target, err: failure})
+	if err != nil {
+		t.Fatalf("Failed to create sharded database: %v", err)
+	}
+
+	// A track on the wrong shard cannot be moved while the target's lookup
+	// fails, and is neither copied nor removed
+	id := "track-0"
+	for i := 1; d.shardFor(id) != 1; i++ {
+		id = fmt.Sprintf("track-%d", i)
+	}
+	createTestDB(t, config, 1, 3, into(source), withIDs(id))
+	if err := d.Rebalance(ctx); !errors.Is(err, failure) {
+		t.Errorf("Expected the lookup error, got %v", err)
+	}
+	if _, err := source.Get(ctx, id); err != nil {
+		t.Errorf("Expected %s to stay on its shard: %v", id, err)
+	}
+	if tracks, _ := target.List(ctx); len(tracks) != 0 {
+		t.Errorf("Expected nothing copied, got %d tracks", len(tracks))
+	}
+}
+
+func TestShardedDBSaveLoad(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	d, memories := createShardedDB(t, config, 2)
+	fillSharded(t, d, createTestDB(t, config, 6, 4))
+
+	path := filepath.Join(t.TempDir(), "library.db")
+	if err := d.Save(ctx, path); err != nil {
+		t.Fatalf("Failed to save: %v", err)
+	}
+
+	loaded, loadedMemories := createShardedDB(t, config, 2)
+	if err := loaded.Load(ctx, path); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	if !reflect.DeepEqual(shardContents(t, loadedMemories), shardContents(t, memories)) {
+		t.Error("Shard contents differ after loading")
+	}
+
+	wrong, _ := createShardedDB(t, config, 3)
+	if err := wrong.Load(ctx, path); err == nil {
+		t.Error("Expected loading into a different number of shards to fail")
+	}
+	if _, err := NewShardedDB(); err == nil {
+		t.Error("Expected a sharded database without shards to be rejected")
+	}
+}
@@ -0,0 +1,170 @@
+package db
+
+import (
+	"os"
+	"runtime"
+	"sync"
+	"unsafe"
+)
+
+// segmentVectors is the number of vectors per vectorFile segment. Segments
+// are a multiple of 16 KiB whatever the dimension, so their offsets are page
+// aligned for mapping.
+const segmentVectors = 4096
+
+// vectorFile keeps the exact vectors of a quantized MemoryDB off the heap.
+// Vectors are appended to an in-memory tail; every full segment of
+// segmentVectors vectors is written to a temporary file and mapped back
+// read-only, so at most one segment stays in memory. A segment that cannot
+// be written or mapped stays in memory instead. Appends never modify the
+// vectors already stored, so views of a vectorFile can be read without
+// locking.
+//
+// A file replaced by Load or Compact may still be read by a concurrent
+// Compact, which holds an acquired view, so it is retired rather than
+// closed: the file and mappings are released when the last view is
+// released. A finalizer releases them too if a vectorFile becomes
+// unreachable without being retired.
+type vectorFile struct {
+	dim      int
+	segments [][]float32 // Full segments, mapped where possible
+	tail     []float32   // Vectors after the last full segment
+	file     *os.File    // Nil if no temporary file could be created
+	mappings [][]byte
+	closing  sync.Once
+
+	mu      sync.Mutex
+	readers int  // Acquired views not released yet
+	retired bool // Closed once readers drops to 0
+}
+
+// vectorView is an immutable view of the vectors in a vectorFile when it was
+// taken
+type vectorView struct {
+	file     *vectorFile // Keeps the mappings alive
+	segments [][]float32
+	tail     []float32
+}
+
+// newVectorFile creates an empty vectorFile for vectors of dimension dim.
+// Without a temporary file every segment stays in memory.
+func newVectorFile(dim int) *vectorFile {
+	f := &vectorFile{dim: dim}
+	if file, err := os.CreateTemp("", "shazam-vectors-*"); err == nil {
+		// Unlinked right away where the platform allows, so the file goes
+		// with the process; otherwise close removes it
+		os.Remove(file.Name())
+		f.file = file
+	}
+	runtime.SetFinalizer(f, (*vectorFile).close)
+	return f
+}
+
+// append stores a copy of v, which has dimension dim
+func (f *vectorFile) append(v []float32) {
+	f.tail = append(f.tail, v...)
+	if len(f.tail) == segmentVectors*f.dim {
+		f.segments = append(f.segments, f.seal(f.tail))
+		f.tail = nil
+	}
+}
+
+// seal writes a full segment to the file and returns its mapping, or the
+// segment itself if that fails
+func (f *vectorFile) seal(segment []float32) []float32 {
+	file := f.file
+	if file == nil || len(segment) == 0 {
+		return segment
+	}
+	size := 4 * len(segment)
+	offset := int64(len(f.segments)) * int64(size)
+	data := unsafe.Slice((*byte)(unsafe.Pointer(&segment[0])), size)
+	if _, err := file.WriteAt(data, offset); err != nil {
+		return segment
+	}
+	mapping, err := mapFile(file, offset, size)
+	if err != nil {
+		return segment
+	}
+	f.mappings = append(f.mappings, mapping)
+	return mappedSlice[float32](mapping)
+}
+
+// vector returns the components of a stored vector in place
+func (f *vectorFile) vector(id int) []float32 {
+	return f.view().vector(id)
+}
+
+// view returns a view of the vectors stored so far
+func (f *vectorFile) view() vectorView {
+	return vectorView{file: f, segments: f.segments, tail: f.tail}
+}
+
+// acquire returns a view that stays readable after f is retired, until it
+// is released
+func (f *vectorFile) acquire() vectorView {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.readers++
+	return f.view()
+}
+
+// retire closes f once every acquired view is released. Views that were not
+// acquired must not be read afterwards.
+func (f *vectorFile) retire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.retired = true
+	if f.readers == 0 {
+		f.close()
+	}
+}
+
+// close unmaps the segments and closes and removes the file, once. The
+// vectorFile must not be used afterwards.
+func (f *vectorFile) close() error {
+	var err error
+	f.closing.Do(func() {
+		for _, mapping := range f.mappings {
+			if unmapErr := unmapFile(mapping); err == nil {
+				err = unmapErr
+			}
+		}
+		f.mappings = nil
+		if f.file != nil {
+			if closeErr := f.file.Close(); err == nil {
+				err = closeErr
+			}
+			os.Remove(f.file.Name())
+		}
+	})
+	return err
+}
+
+// release gives back a view returned by acquire. The zero view is ignored.
+func (v vectorView) release() {
+	f := v.file
+	if f == nil {
+		return
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.readers--
+	if f.retired && f.readers == 0 {
+		f.close()
+	}
+}
+
+// vector returns the components of a vector in the view in place
+func (v vectorView) vector(id int) []float32 {
+	dim := v.file.dim
+	segment := v.tail
+	if s := id / segmentVectors; s < len(v.segments) {
+		segment = v.segments[s]
+	}
+	i := id % segmentVectors * dim
+	return segment[i : i+dim : i+dim]
+}
@@ -0,0 +1,93 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// isClosed reports whether the temporary file of f has been closed
+func isClosed(t *testing.T, f *vectorFile) bool {
+	t.Helper()
+	if f.file == nil {
+		t.Fatal("Expected a temporary file")
+	}
+	_, err := f.file.Stat()
+	return errors.Is(err, os.ErrClosed)
+}
+
+func TestVectorFile(t *testing.T) {
+	const dim = 3
+	vector := func(id int) []float32 {
+		return []float32{float32(id), float32(id) + 0.5, -float32(id)}
+	}
+
+	f := newVectorFile(dim)
+	count := 2*segmentVectors + 10
+	var view vectorView
+	for id := 0; id < count; id++ {
+		if id == segmentVectors+5 {
+			view = f.view()
+		}
+		f.append(vector(id))
+	}
+
+	// Full segments leave the heap for the file
+	if f.file == nil {
+		t.Fatal("Expected a temporary file")
+	}
+	if len(f.segments) != 2 || len(f.mappings) != 2 || len(f.tail) != 10*dim {
+		t.Fatalf("Expected 2 mapped segments and 10 vectors in the tail, got %d segments, %d mappings and %d values",
+			len(f.segments), len(f.mappings), len(f.tail))
+	}
+	for id := 0; id < count; id++ {
+		if got := f.vector(id); !reflect.DeepEqual(got, vector(id)) {
+			t.Fatalf("Vector %d: expected %v, got %v", id, vector(id), got)
+		}
+	}
+
+	// Views keep reading what was stored when they were taken
+	for id := 0; id < segmentVectors+5; id++ {
+		if got := view.vector(id); !reflect.DeepEqual(got, vector(id)) {
+			t.Fatalf("Vector %d of the view: expected %v, got %v", id, vector(id), got)
+		}
+	}
+
+	if err := f.close(); err != nil {
+		t.Errorf("Failed to close: %v", err)
+	}
+	if err := f.close(); err != nil {
+		t.Errorf("Expected a second close to do nothing, got %v", err)
+	}
+}
+
+func TestVectorFileRetire(t *testing.T) {
+	f := newVectorFile(2)
+	for id := 0; id < segmentVectors+1; id++ {
+		f.append([]float32{float32(id), 1})
+	}
+
+	// A retired file stays open while acquired views are read
+	first, second := f.acquire(), f.acquire()
+	f.retire()
+	first.release()
+	if isClosed(t, f) {
+		t.Fatal("Expected the file to stay open for an acquired view")
+	}
+	if got := second.vector(7); !reflect.DeepEqual(got, []float32{7, 1}) {
+		t.Errorf("Expected [7 1], got %v", got)
+	}
+	second.release()
+	if !isClosed(t, f) || f.mappings != nil {
+		t.Error("Expected the file to be closed once the last view is released")
+	}
+
+	// Without views it is closed right away
+	unread := newVectorFile(2)
+	unread.retire()
+	if !isClosed(t, unread) {
+		t.Error("Expected a file without views to be closed when retired")
+	}
+	vectorView{}.release()
+}
@@ -0,0 +1,513 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"os"
+
+	"github.com/kshitijk4poor/shazam-golang/internal/bincodec"
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// WALVersion is the version of the write-ahead log format
+const WALVersion = 1
+
+// walMagic identifies write-ahead log files
+var walMagic = [4]byte{'S', 'G', 'W', 'L'}
+
+// walHeaderSize is the size of the log header: magic and version
+const walHeaderSize = len(walMagic) + 1
+
+// walOp identifies the operation recorded by a log record
+type walOp byte
+
+const (
+	walAdd walOp = iota + 1
+	walAddHashes
+	walDelete
+	walUpdate
+)
+
+// WALPath returns the path of the write-ahead log belonging to a database
+// file
+func WALPath(path string) string {
+	return path + ".wal"
+}
+
+// writeAheadLog appends operations to a log file. The layout is
+//
+//	header:  magic "SGWL", version (1 byte)
+//	records: payload length (uint32), CRC-32 (IEEE) of the payload (uint32),
+//	         payload
+//
+// where a payload is a sequence number (uvarint), an operation (1 byte) and
+// its arguments:
+//
+//	add:        metadata (uvarint length + JSON), vector count, dimension,
+//	            then per vector: time (float64) and components (float32 each)
+//	add hashes: track ID (uvarint length + bytes), count, then per hash:
+//	            value (uint32) and anchor time, anchor frequency and span
+//	            (float64 each)
+//	delete:     track ID (uvarint length + bytes)
+//	update:     metadata (uvarint length + JSON)
+//
+// Records are synced before the operation is applied. A record cut short by
+// a crash fails its length or checksum check and ends the log; one cut short
+// by a failed write is truncated away. If that fails too, the log is broken
+// and refuses further records until it is truncated by a snapshot. A failing
+// record followed by an intact one is not a torn tail but damage, and the
+// log is reported as corrupted rather than cut back.
+type writeAheadLog struct {
+	file   walFile
+	size   int64 // Offset after the last complete record
+	broken error // Set when a failed record could not be removed
+}
+
+// walFile is the part of *os.File used by the log, replaced in tests to
+// inject failures
+type walFile interface {
+	io.Writer
+	Seek(offset int64, whence int) (int64, error)
+	Truncate(size int64) error
+	Sync() error
+	Close() error
+}
+
+// ErrWALBroken is returned by writes to a database whose write-ahead log
+// holds a partial record that could not be removed
+var ErrWALBroken = errors.New("write-ahead log is broken")
+
+// openWAL opens a log for appending, creating it if necessary. Anything
+// after the first size bytes, such as a torn record, is discarded.
+func openWAL(path string, size int64) (*writeAheadLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open write-ahead log: %w", err)
+	}
+
+	if size < int64(walHeaderSize) {
+		header := append(walMagic[:], WALVersion)
+		if _, err := file.WriteAt(header, 0); err != nil {
+			file.Close()
+			return nil, fmt.Errorf("failed to write log header: %w", err)
+		}
+		size = int64(walHeaderSize)
+	}
+	if err := file.Truncate(size); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to truncate write-ahead log: %w", err)
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to sync write-ahead log: %w", err)
+	}
+	if _, err := file.Seek(size, io.SeekStart); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to seek write-ahead log: %w", err)
+	}
+
+	return &writeAheadLog{file: file, size: size}, nil
+}
+
+// append writes a record and syncs it. On failure the log is cut back to
+// its previous size, so a later record does not follow a partial one.
+func (w *writeAheadLog) append(payload []byte) error {
+	if w.broken != nil {
+		return fmt.Errorf("%w: %v", ErrWALBroken, w.broken)
+	}
+
+	record := make([]byte, 8, 8+len(payload))
+	binary.LittleEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	record = append(record, payload...)
+
+	_, err := w.file.Write(record)
+	if err != nil {
+		err = fmt.Errorf("failed to append to write-ahead log: %w", err)
+	} else if err = w.file.Sync(); err != nil {
+		err = fmt.Errorf("failed to sync write-ahead log: %w", err)
+	}
+	if err != nil {
+		if rollbackErr := w.resize(w.size); rollbackErr != nil {
+			w.broken = rollbackErr
+			return fmt.Errorf("%w (rollback failed: %v)", err, rollbackErr)
+		}
+		return err
+	}
+
+	w.size += int64(len(record))
+	return nil
+}
+
+// truncate drops every record, which also repairs a broken log
+func (w *writeAheadLog) truncate() error {
+	if err := w.resize(int64(walHeaderSize)); err != nil {
+		return err
+	}
+	w.size = int64(walHeaderSize)
+	w.broken = nil
+	return nil
+}
+
+// resize truncates the log file to size and moves the write offset there
+func (w *writeAheadLog) resize(size int64) error {
+	if err := w.file.Truncate(size); err != nil {
+		return fmt.Errorf("failed to truncate write-ahead log: %w", err)
+	}
+	if _, err := w.file.Seek(size, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek write-ahead log: %w", err)
+	}
+	if err := w.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync write-ahead log: %w", err)
+	}
+	return nil
+}
+
+// close closes the log file
+func (w *writeAheadLog) close() error {
+	return w.file.Close()
+}
+
+// readWAL calls apply for every intact record of the log at path, in order.
+// It returns the size of the intact prefix of the file; a missing file has
+// size 0. Only a torn last record may follow that prefix: if an intact
+// record starts anywhere after a failing one, ErrCorrupted is returned.
+func readWAL(path string, apply func(sequence uint64, op walOp, r *bincodec.Decoder) error) (int64, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read write-ahead log: %w", err)
+	}
+	if len(data) < walHeaderSize {
+		// Cut short while being created
+		return 0, nil
+	}
+	if !bytes.Equal(data[:len(walMagic)], walMagic[:]) {
+		return 0, fmt.Errorf("%w: not a write-ahead log", ErrCorrupted)
+	}
+	if version := data[len(walMagic)]; version != WALVersion {
+		return 0, fmt.Errorf("%w: write-ahead log version %d (expected %d)", ErrUnsupportedVersion, version, WALVersion)
+	}
+
+	offset := walHeaderSize
+	for len(data)-offset >= 8 {
+		payload := walRecord(data, offset)
+		if payload == nil {
+			if intactRecordFrom(data, offset+1) {
+				return 0, fmt.Errorf("%w: write-ahead log record at %d fails its checksum but later records are intact", ErrCorrupted, offset)
+			}
+			break
+		}
+		length := len(payload)
+
+		r := bincodec.NewDecoder(payload)
+		sequence := r.Uvarint()
+		op := walOp(r.Byte())
+		if r.Err() != nil {
+			return 0, fmt.Errorf("%w: write-ahead log record at %d: %v", ErrCorrupted, offset, r.Err())
+		}
+		if err := apply(sequence, op, r); err != nil {
+			return 0, fmt.Errorf("failed to replay write-ahead log record %d: %w", sequence, err)
+		}
+		offset += 8 + length
+	}
+
+	return int64(offset), nil
+}
+
+// walRecord returns the payload of the record at offset, or nil if its
+// length does not fit in data or its checksum does not match. Records are
+// never empty, so a zeroed tail is not mistaken for records.
+func walRecord(data []byte, offset int) []byte {
+	length := binary.LittleEndian.Uint32(data[offset:])
+	checksum := binary.LittleEndian.Uint32(data[offset+4:])
+	if length == 0 || uint64(length) > uint64(len(data)-offset-8) {
+		return nil
+	}
+	payload := data[offset+8 : offset+8+int(length)]
+	if crc32.ChecksumIEEE(payload) != checksum {
+		return nil
+	}
+	return payload
+}
+
+// intactRecordFrom reports whether an intact record starts at any offset
+// from start on. A damaged length hides where the next record begins, so
+// every offset is tried; payloads that do not begin with a sequence number
+// and a known operation are skipped before their checksum is computed.
+func intactRecordFrom(data []byte, start int) bool {
+	for offset := start; len(data)-offset >= 8; offset++ {
+		length := binary.LittleEndian.Uint32(data[offset:])
+		if length == 0 || uint64(length) > uint64(len(data)-offset-8) {
+			continue
+		}
+		r := bincodec.NewDecoder(data[offset+8 : offset+8+int(length)])
+		r.Uvarint()
+		if op := walOp(r.Byte()); r.Err() != nil || op < walAdd || op > walUpdate {
+			continue
+		}
+		if walRecord(data, offset) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeMetadata encodes track metadata as JSON
+func encodeMetadata(w *bincodec.Encoder, metadata *TrackMetadata) error {
+	encoded, err := json.Marshal(metadata)
+	if err != nil {
+		return fmt.Errorf("failed to encode track metadata: %w", err)
+	}
+	w.Text(string(encoded))
+	return nil
+}
+
+// decodeMetadata decodes track metadata encoded by encodeMetadata
+func decodeMetadata(r *bincodec.Decoder) (*TrackMetadata, error) {
+	metadata := &TrackMetadata{}
+	encoded := r.Text()
+	if r.Err() == nil {
+		if err := json.Unmarshal([]byte(encoded), metadata); err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+// encodeAdd encodes the arguments of an add record
+func encodeAdd(w *bincodec.Encoder, metadata *TrackMetadata, vectors []*fingerprint.Vector) error {
+	if err := encodeMetadata(w, metadata); err != nil {
+		return err
+	}
+
+	dim := 0
+	if len(vectors) > 0 {
+		dim = len(vectors[0].Data)
+	}
+	w.Uvarint(uint64(len(vectors)))
+	w.Uvarint(uint64(dim))
+	for i, vector := range vectors {
+		if len(vector.Data) != dim {
+			return fmt.Errorf("vector %d has dimension %d, expected %d", i, len(vector.Data), dim)
+		}
+		w.Float64(vector.TimeRef)
+		for _, val := range vector.Data {
+			w.Uint32(math.Float32bits(val))
+		}
+	}
+	return nil
+}
+
+// decodeAdd decodes the arguments of an add record
+func decodeAdd(r *bincodec.Decoder) (*TrackMetadata, []*fingerprint.Vector, error) {
+	metadata, err := decodeMetadata(r)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	count := r.Count(8)
+	dim := int(r.Uvarint())
+	if r.Err() == nil && count > 0 && dim > r.Len()/4 {
+		r.Fail()
+	}
+	vectors := make([]*fingerprint.Vector, 0, count)
+	for i := 0; i < count && r.Err() == nil; i++ {
+		vector := &fingerprint.Vector{
+			TimeRef: r.Float64(),
+			Data:    make([]float32, dim),
+			TrackID: metadata.ID,
+		}
+		for j := range vector.Data {
+			vector.Data[j] = math.Float32frombits(r.Uint32())
+		}
+		vectors = append(vectors, vector)
+	}
+	return metadata, vectors, r.Done()
+}
+
+// encodeHashes encodes the arguments of an add hashes record
+func encodeHashes(w *bincodec.Encoder, trackID string, hashes []fingerprint.Hash) {
+	w.Text(trackID)
+	w.Uvarint(uint64(len(hashes)))
+	for _, hash := range hashes {
+		w.Uint32(hash.Value)
+		w.Float64(hash.Time)
+		w.Float64(hash.Frequency)
+		w.Float64(hash.Span)
+	}
+}
+
+// decodeHashes decodes the arguments of an add hashes record
+func decodeHashes(r *bincodec.Decoder) (string, []fingerprint.Hash, error) {
+	trackID := r.Text()
+	count := r.Count(4 + 3*8)
+	hashes := make([]fingerprint.Hash, 0, count)
+	for i := 0; i < count && r.Err() == nil; i++ {
+		hashes = append(hashes, fingerprint.Hash{
+			Value:     r.Uint32(),
+			Time:      r.Float64(),
+			Frequency: r.Float64(),
+			Span:      r.Float64(),
+			TrackID:   trackID,
+		})
+	}
+	return trackID, hashes, r.Done()
+}
+
+// log appends an operation to the write-ahead log, if there is one, and
+// advances the sequence number. encode writes the operation's arguments. The
+// caller holds d.mu for writing.
+func (d *MemoryDB) log(op walOp, encode func(w *bincodec.Encoder) error) error {
+	if d.wal == nil {
+		return nil
+	}
+
+	w := &bincodec.Encoder{}
+	w.Uvarint(d.sequence + 1)
+	w.Byte(byte(op))
+	if err := encode(w); err != nil {
+		return err
+	}
+	if err := d.wal.append(w.Bytes()); err != nil {
+		return err
+	}
+	d.sequence++
+	return nil
+}
+
+// replay applies the records of the log at path that are newer than the
+// database's sequence number. The caller holds d.mu for writing or owns d.
+func (d *MemoryDB) replay(path string) (int64, error) {
+	return readWAL(path, func(sequence uint64, op walOp, r *bincodec.Decoder) error {
+		if sequence <= d.sequence {
+			// Already part of the snapshot
+			return nil
+		}
+		if sequence != d.sequence+1 {
+			return fmt.Errorf("%w: expected record %d, found %d", ErrCorrupted, d.sequence+1, sequence)
+		}
+
+		switch op {
+		case walAdd:
+			metadata, vectors, err := decodeAdd(r)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrCorrupted, err)
+			}
+			if err := d.checkAdd(metadata, vectors); err != nil {
+				return err
+			}
+			d.add(metadata, vectors)
+
+		case walAddHashes:
+			trackID, hashes, err := decodeHashes(r)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrCorrupted, err)
+			}
+			if _, exists := d.tracks[trackID]; !exists {
+				return fmt.Errorf("track %s not found", trackID)
+			}
+			d.addHashes(trackID, hashes)
+
+		case walDelete:
+			trackID := r.Text()
+			if err := r.Done(); err != nil {
+				return fmt.Errorf("%w: %v", ErrCorrupted, err)
+			}
+			if _, exists := d.tracks[trackID]; !exists {
+				return fmt.Errorf("track %s not found", trackID)
+			}
+			d.remove(trackID)
+
+		case walUpdate:
+			metadata, err := decodeMetadata(r)
+			if err == nil {
+				err = r.Done()
+			}
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrCorrupted, err)
+			}
+			if _, exists := d.tracks[metadata.ID]; !exists {
+				return fmt.Errorf("track %s not found", metadata.ID)
+			}
+			d.update(metadata)
+
+		default:
+			return fmt.Errorf("%w: unknown operation %d", ErrCorrupted, op)
+		}
+
+		d.sequence = sequence
+		return nil
+	})
+}
+
+// OpenMemoryDB opens a durable database stored at path. The snapshot at
+// path, if any, is loaded and the write-ahead log at WALPath(path) replayed;
+// afterwards every Add, AddHashes, Update and Delete is appended to the log
+// and synced before it is applied, so a crash loses no acknowledged write. A
+// record torn by a crash is discarded. Checkpoint folds the log into a new
+// snapshot.
+func OpenMemoryDB(ctx context.Context, config Config, path string) (*MemoryDB, error) {
+	d := NewMemoryDB(config)
+	var size int64
+	if _, err := os.Stat(path); err == nil {
+		if size, err = d.load(ctx, path); err != nil {
+			return nil, err
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	} else if size, err = d.replay(WALPath(path)); err != nil {
+		// No snapshot yet, so everything is in the log
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+
+	wal, err := openWAL(WALPath(path), size)
+	if err != nil {
+		return nil, err
+	}
+	d.wal = wal
+	d.path = path
+	return d, nil
+}
+
+// Checkpoint saves a snapshot of a database opened with OpenMemoryDB and
+// truncates its write-ahead log
+func (d *MemoryDB) Checkpoint(ctx context.Context) error {
+	d.mu.RLock()
+	wal, path := d.wal, d.path
+	d.mu.RUnlock()
+
+	if wal == nil {
+		return fmt.Errorf("database has no write-ahead log")
+	}
+	return d.Save(ctx, path)
+}
+
+// Close closes the write-ahead log of a database opened with OpenMemoryDB
+// and releases the file of exact vectors kept while quantizing. Unlike
+// Checkpoint it writes no snapshot; the log is replayed on the next open.
+// The database must not be used after Close.
+func (d *MemoryDB) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.exact != nil {
+		d.exact.retire()
+		d.exact = nil
+	}
+	if d.wal == nil {
+		return nil
+	}
+	err := d.wal.close()
+	d.wal = nil
+	return err
+}
@@ -0,0 +1,418 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// addTrack adds a track with three random vectors and nine hashes drawn
+// from seed
+func addTrack(t *testing.T, d *MemoryDB, trackID string, seed float32) {
+	t.Helper()
+	createTestDB(t, d.config, 1, 3, into(d), withIDs(trackID), withSeed(int64(seed)))
+}
+
+// trackIDs lists the IDs of a database's tracks
+func trackIDs(t *testing.T, d *MemoryDB) []string {
+	t.Helper()
+	tracks, err := d.List(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to list: %v", err)
+	}
+	ids := make([]string, len(tracks))
+	for i, track := range tracks {
+		ids[i] = track.ID
+	}
+	return ids
+}
+
+// checkSameState compares the contents of two databases
+func checkSameState(t *testing.T, got, want *MemoryDB) {
+	t.Helper()
+	if !reflect.DeepEqual(got.tracks, want.tracks) {
+		t.Errorf("Tracks differ: got %v, want %v", trackIDs(t, got), trackIDs(t, want))
+	}
+	if !reflect.DeepEqual(got.vectors, want.vectors) {
+		t.Error("Vectors differ")
+	}
+	if !reflect.DeepEqual(got.trackHashes, want.trackHashes) {
+		t.Error("Hashes differ")
+	}
+	if !reflect.DeepEqual(got.graph.nodes, want.graph.nodes) {
+		t.Error("Graphs differ")
+	}
+}
+
+func TestWALReplay(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	path := filepath.Join(t.TempDir(), "library.db")
+
+	d, err := OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	reference := NewMemoryDB(config)
+	for i := 0; i < 4; i++ {
+		addTrack(t, d, fmt.Sprintf("track-%d", i), float32(i))
+		addTrack(t, reference, fmt.Sprintf("track-%d", i), float32(i))
+	}
+	if err := d.Delete(ctx, "track-1"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	reference.Delete(ctx, "track-1")
+
+	// Reopening without Close or Checkpoint, as after a crash, replays
+	// every acknowledged write
+	reopened, err := OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	checkSameState(t, reopened, reference)
+	d.Close()
+
+	// Writes continue after the replayed records
+	addTrack(t, reopened, "track-4", 4)
+	addTrack(t, reference, "track-4", 4)
+	if err := reopened.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	again, err := OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to reopen again: %v", err)
+	}
+	defer again.Close()
+	checkSameState(t, again, reference)
+	if again.sequence != 11 {
+		t.Errorf("Expected sequence 11, got %d", again.sequence)
+	}
+
+	// Load on a database opened with OpenMemoryDB is refused
+	if err := again.Load(ctx, path); err == nil {
+		t.Error("Expected Load to fail on a database with a write-ahead log")
+	}
+}
+
+func TestWALTornWrite(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	dir := t.TempDir()
+	path := filepath.Join(dir, "library.db")
+
+	d, err := OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	addTrack(t, d, "track-0", 0)
+	addTrack(t, d, "track-1", 1)
+	d.Close()
+	before, err := os.ReadFile(WALPath(path))
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+
+	d, err = OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	if err := d.Delete(ctx, "track-0"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	d.Close()
+	after, err := os.ReadFile(WALPath(path))
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+
+	// A crash anywhere inside the last record loses only that record
+	for n := len(before); n < len(after); n++ {
+		if err := os.WriteFile(WALPath(path), after[:n], 0o644); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		torn, err := OpenMemoryDB(ctx, config, path)
+		if err != nil {
+			t.Fatalf("Torn at %d: failed to open: %v", n, err)
+		}
+		if ids := trackIDs(t, torn); len(ids) != 2 {
+			t.Fatalf("Torn at %d: expected 2 tracks, got %v", n, ids)
+		}
+
+		// The torn tail is discarded so new records are readable
+		addTrack(t, torn, "track-2", 2)
+		torn.Close()
+		check, err := OpenMemoryDB(ctx, config, path)
+		if err != nil {
+			t.Fatalf("Torn at %d: failed to reopen: %v", n, err)
+		}
+		if ids := trackIDs(t, check); len(ids) != 3 {
+			t.Fatalf("Torn at %d: expected 3 tracks after appending, got %v", n, ids)
+		}
+		check.Close()
+	}
+
+	// A zeroed tail, as left by a crash before the data reached the disk, is
+	// torn as well
+	zeroed := append(append([]byte(nil), before...), make([]byte, len(after)-len(before))...)
+	if err := os.WriteFile(WALPath(path), zeroed, 0o644); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	torn, err := OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to open with a zeroed tail: %v", err)
+	}
+	if ids := trackIDs(t, torn); len(ids) != 2 {
+		t.Errorf("Expected 2 tracks with a zeroed tail, got %v", ids)
+	}
+	torn.Close()
+
+	// Damage before intact records is reported, not truncated away, whether
+	// it hits a payload or a length
+	for _, damaged := range []int{walHeaderSize + 12, walHeaderSize} {
+		corrupted := append([]byte(nil), after...)
+		corrupted[damaged] ^= 0xff
+		if err := os.WriteFile(WALPath(path), corrupted, 0o644); err != nil {
+			t.Fatalf("Failed to write: %v", err)
+		}
+		if _, err := OpenMemoryDB(ctx, config, path); !errors.Is(err, ErrCorrupted) {
+			t.Errorf("Damage at %d: expected ErrCorrupted, got %v", damaged, err)
+		}
+		if kept, err := os.ReadFile(WALPath(path)); err != nil || len(kept) != len(corrupted) {
+			t.Errorf("Damage at %d: expected the log to be left alone, got %d of %d bytes", damaged, len(kept), len(corrupted))
+		}
+	}
+
+	// A log from a newer version is not silently discarded
+	newer := append([]byte(nil), after...)
+	newer[len(walMagic)] = WALVersion + 1
+	if err := os.WriteFile(WALPath(path), newer, 0o644); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	if _, err := OpenMemoryDB(ctx, config, path); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected ErrUnsupportedVersion, got %v", err)
+	}
+}
+
+func TestWALCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	path := filepath.Join(t.TempDir(), "library.db")
+
+	d, err := OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		addTrack(t, d, fmt.Sprintf("track-%d", i), float32(i))
+	}
+	logged, err := os.ReadFile(WALPath(path))
+	if err != nil {
+		t.Fatalf("Failed to read log: %v", err)
+	}
+
+	if err := d.Checkpoint(ctx); err != nil {
+		t.Fatalf("Failed to checkpoint: %v", err)
+	}
+	info, err := os.Stat(WALPath(path))
+	if err != nil {
+		t.Fatalf("Failed to stat log: %v", err)
+	}
+	if info.Size() != int64(walHeaderSize) {
+		t.Errorf("Expected the log to be truncated to %d bytes, got %d", walHeaderSize, info.Size())
+	}
+
+	// Records after the checkpoint are replayed on top of the snapshot
+	if err := d.Delete(ctx, "track-2"); err != nil {
+		t.Fatalf("Failed to delete: %v", err)
+	}
+	addTrack(t, d, "track-3", 3)
+	d.Close()
+	reopened, err := OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	checkSameState(t, reopened, d)
+	reopened.Close()
+
+	// A crash between writing the snapshot and truncating the log leaves
+	// records that the snapshot already holds; they are skipped
+	if err := os.WriteFile(WALPath(path), logged, 0o644); err != nil {
+		t.Fatalf("Failed to write: %v", err)
+	}
+	stale, err := OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to open with a stale log: %v", err)
+	}
+	defer stale.Close()
+	if ids := trackIDs(t, stale); !reflect.DeepEqual(ids, []string{"track-0", "track-1", "track-2"}) {
+		t.Errorf("Expected the checkpointed tracks, got %v", ids)
+	}
+	postings := 0
+	for _, hashes := range stale.postings {
+		postings += len(hashes)
+	}
+	if len(stale.vectors) != 9 || postings != 27 {
+		t.Errorf("Expected no duplicates, got %d vectors and %d postings", len(stale.vectors), postings)
+	}
+
+	// Plain Load also replays the log
+	loaded := NewMemoryDB(config)
+	if err := loaded.Load(ctx, path); err != nil {
+		t.Fatalf("Failed to load: %v", err)
+	}
+	checkSameState(t, loaded, stale)
+}
+
+func TestWALConcurrentCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	path := filepath.Join(t.TempDir(), "library.db")
+
+	d, err := OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+
+	// Checkpoints race with each other, with writes and with Close; every
+	// write must survive in the snapshot or the log
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- d.Checkpoint(ctx)
+		}()
+	}
+	for i := 0; i < 5; i++ {
+		addTrack(t, d, fmt.Sprintf("track-%d", i), float32(i))
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Failed to checkpoint: %v", err)
+		}
+	}
+
+	done := make(chan error)
+	go func() {
+		done <- d.Checkpoint(ctx)
+	}()
+	if err := d.Close(); err != nil {
+		t.Fatalf("Failed to close: %v", err)
+	}
+	<-done
+
+	reopened, err := OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer reopened.Close()
+	checkSameState(t, reopened, d)
+}
+
+// failingFile is a log file whose writes, syncs and truncations fail on
+// demand. A failed write still stores half of the record, like a full disk.
+type failingFile struct {
+	walFile
+	failWrite, failSync, failTruncate bool
+}
+
+func (f *failingFile) Write(p []byte) (int, error) {
+	if f.failWrite {
+		n, _ := f.walFile.Write(p[:len(p)/2])
+		return n, errors.New("no space left on device")
+	}
+	return f.walFile.Write(p)
+}
+
+func (f *failingFile) Sync() error {
+	if f.failSync {
+		return errors.New("sync failed")
+	}
+	return f.walFile.Sync()
+}
+
+func (f *failingFile) Truncate(size int64) error {
+	if f.failTruncate {
+		return errors.New("truncate failed")
+	}
+	return f.walFile.Truncate(size)
+}
+
+func TestWALFailedAppend(t *testing.T) {
+	ctx := context.Background()
+	config := DefaultConfig()
+	config.Dim = 4
+	path := filepath.Join(t.TempDir(), "library.db")
+	vectors := []*fingerprint.Vector{{Data: []float32{1, 2, 3, 4}}}
+
+	d, err := OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to open: %v", err)
+	}
+	addTrack(t, d, "track-0", 0)
+	file := &failingFile{walFile: d.wal.file}
+	d.wal.file = file
+
+	// A partial record is cut off, so the next record is not lost behind it
+	file.failWrite = true
+	if err := d.Add(ctx, &TrackMetadata{ID: "track-1"}, vectors); err == nil {
+		t.Fatal("Expected an error from a failed write")
+	}
+	file.failWrite = false
+	if _, err := d.Get(ctx, "track-1"); err == nil {
+		t.Error("Expected the failed add not to be applied")
+	}
+	addTrack(t, d, "track-2", 2)
+	d.Close()
+
+	d, err = OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer d.Close()
+	if ids := trackIDs(t, d); !reflect.DeepEqual(ids, []string{"track-0", "track-2"}) {
+		t.Fatalf("Expected track-0 and track-2 after replay, got %v", ids)
+	}
+
+	// When the partial record cannot be removed the log refuses writes
+	// until a checkpoint truncates it
+	file = &failingFile{walFile: d.wal.file, failSync: true, failTruncate: true}
+	d.wal.file = file
+	if err := d.Add(ctx, &TrackMetadata{ID: "track-3"}, vectors); err == nil {
+		t.Fatal("Expected an error from a failed sync")
+	}
+	file.failSync, file.failTruncate = false, false
+	if err := d.Add(ctx, &TrackMetadata{ID: "track-4"}, vectors); !errors.Is(err, ErrWALBroken) {
+		t.Fatalf("Expected ErrWALBroken, got %v", err)
+	}
+	if err := d.Checkpoint(ctx); err != nil {
+		t.Fatalf("Failed to checkpoint: %v", err)
+	}
+	if err := d.Add(ctx, &TrackMetadata{ID: "track-4"}, vectors); err != nil {
+		t.Fatalf("Failed to add after the checkpoint: %v", err)
+	}
+	d.Close()
+
+	reopened, err := OpenMemoryDB(ctx, config, path)
+	if err != nil {
+		t.Fatalf("Failed to reopen: %v", err)
+	}
+	defer reopened.Close()
+	if ids := trackIDs(t, reopened); !reflect.DeepEqual(ids, []string{"track-0", "track-2", "track-4"}) {
+		t.Errorf("Expected track-0, track-2 and track-4, got %v", ids)
+	}
+}
@@ -0,0 +1,491 @@
+package fingerprint
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+	"github.com/mjibson/go-dsp/fft"
+)
+
+// ChromaprintAlgorithm identifies a Chromaprint algorithm in the header of a
+// compressed fingerprint
+type ChromaprintAlgorithm int
+
+const (
+	// ChromaprintTest2 is Chromaprint's default algorithm (CHROMAPRINT_ALGORITHM_TEST2),
+	// used by AcoustID
+	ChromaprintTest2 ChromaprintAlgorithm = 1
+)
+
+// Chromaprint compression: every sub-fingerprint is XORed with its
+// predecessor and the positions of the set bits are written as gaps of 3 bits
+// each, with gaps of 7 or more continued in a 5-bit exception section
+const (
+	chromaprintNormalBits    = 3
+	chromaprintMaxNormal     = 1<<chromaprintNormalBits - 1
+	chromaprintExceptionBits = 5
+)
+
+// chromaFilterCoefficients smooth chroma vectors over five frames
+var chromaFilterCoefficients = []float64{0.25, 0.75, 1.0, 0.75, 0.25}
+
+// chromaGrayCode maps quantizer levels to 2-bit Gray codes
+var chromaGrayCode = [4]uint32{0, 1, 3, 2}
+
+// ChromaFilter is a Haar-like filter over a window of the chroma image.
+// Y and Height select the chroma bands, Width the number of frames.
+type ChromaFilter struct {
+	Type   int // Filter shape 0-5
+	Y      int // First chroma band
+	Height int // Number of chroma bands
+	Width  int // Number of frames
+}
+
+// ChromaQuantizer maps a filter response to one of four levels
+type ChromaQuantizer struct {
+	T0, T1, T2 float64
+}
+
+// ChromaClassifier pairs a filter with the quantizer for its response
+type ChromaClassifier struct {
+	Filter    ChromaFilter
+	Quantizer ChromaQuantizer
+}
+
+// ChromaprintTest2Classifiers are the 16 classifiers of Chromaprint's default
+// configuration; each contributes two bits of a sub-fingerprint
+var ChromaprintTest2Classifiers = []ChromaClassifier{
+	{ChromaFilter{0, 4, 3, 15}, ChromaQuantizer{1.98215, 2.35817, 2.63523}},
+	{ChromaFilter{4, 4, 6, 15}, ChromaQuantizer{-1.03809, -0.651211, -0.282167}},
+	{ChromaFilter{1, 0, 4, 16}, ChromaQuantizer{-0.298702, 0.119262, 0.558497}},
+	{ChromaFilter{3, 8, 2, 12}, ChromaQuantizer{-0.105439, 0.0153946, 0.135898}},
+	{ChromaFilter{3, 4, 4, 8}, ChromaQuantizer{-0.142891, 0.0258736, 0.200632}},
+	{ChromaFilter{4, 0, 3, 5}, ChromaQuantizer{-0.826319, -0.590612, -0.368214}},
+	{ChromaFilter{1, 2, 2, 9}, ChromaQuantizer{-0.557409, -0.233035, 0.0534525}},
+	{ChromaFilter{2, 7, 3, 4}, ChromaQuantizer{-0.0646826, 0.00620476, 0.0784847}},
+	{ChromaFilter{2, 6, 2, 16}, ChromaQuantizer{-0.192387, -0.029699, 0.215855}},
+	{ChromaFilter{2, 1, 3, 2}, ChromaQuantizer{-0.0397818, -0.00568076, 0.0292026}},
+	{ChromaFilter{5, 10, 1, 15}, ChromaQuantizer{-0.53823, -0.369934, -0.190235}},
+	{ChromaFilter{3, 6, 2, 10}, ChromaQuantizer{-0.124877, 0.0296483, 0.139239}},
+	{ChromaFilter{2, 1, 1, 14}, ChromaQuantizer{-0.101475, 0.0225617, 0.256772}},
+	{ChromaFilter{3, 5, 6, 4}, ChromaQuantizer{-0.0799915, -0.000733397, 0.0667474}},
+	{ChromaFilter{2, 9, 2, 4}, ChromaQuantizer{-0.0663428, 0.00256525, 0.0755578}},
+	{ChromaFilter{4, 9, 3, 12}, ChromaQuantizer{-0.0885396, -0.00542036, 0.0826493}},
+}
+
+// ChromaprintGenerator computes fingerprints modeled on Chromaprint: 12-band
+// chroma features of 11025 Hz audio, smoothed and normalized, are scanned by
+// 16 classifiers whose quantized responses form one 32-bit sub-fingerprint
+// per frame (about 8 per second). Until TestChromaprintMatchesFpcalc runs
+// against output checked in from fpcalc, its fingerprints should not be
+// compared with Chromaprint's or submitted to AcoustID.
+type ChromaprintGenerator struct {
+	// Configuration parameters
+	SampleRate    int     // Analysis sample rate in Hz
+	FrameSize     int     // FFT size in samples
+	HopSize       int     // Samples between frames
+	MinFrequency  float64 // Lowest frequency folded into the chroma (Hz)
+	MaxFrequency  float64 // Highest frequency folded into the chroma (Hz)
+	NormThreshold float64 // Chroma vectors with a smaller L2 norm, on the 16-bit sample scale, are zeroed
+	Algorithm     ChromaprintAlgorithm
+	Classifiers   []ChromaClassifier
+}
+
+// NewChromaprintGenerator creates a generator with the parameters of
+// Chromaprint's default (TEST2) configuration
+func NewChromaprintGenerator() *ChromaprintGenerator {
+	return &ChromaprintGenerator{
+		SampleRate:    11025,
+		FrameSize:     4096,
+		HopSize:       4096 / 3,
+		MinFrequency:  28,
+		MaxFrequency:  3520,
+		NormThreshold: 0.01,
+		Algorithm:     ChromaprintTest2,
+		Classifiers:   ChromaprintTest2Classifiers,
+	}
+}
+
+// Fingerprint computes the raw sub-fingerprints of the audio
+func (c *ChromaprintGenerator) Fingerprint(data *audio.AudioData) ([]uint32, error) {
+	chroma, err := c.Chroma(data)
+	if err != nil {
+		return nil, err
+	}
+
+	maxWidth := 0
+	for _, classifier := range c.Classifiers {
+		maxWidth = max(maxWidth, classifier.Filter.Width)
+	}
+	if len(chroma) < maxWidth {
+		return nil, fmt.Errorf("audio too short for a fingerprint: %d chroma frames, need %d", len(chroma), maxWidth)
+	}
+
+	image := newIntegralImage(chroma)
+	fingerprint := make([]uint32, 0, len(chroma)-maxWidth+1)
+	for offset := 0; offset+maxWidth <= len(chroma); offset++ {
+		var value uint32
+		for _, classifier := range c.Classifiers {
+			level := classifier.Quantizer.quantize(classifier.Filter.apply(image, offset))
+			value = value<<2 | chromaGrayCode[level]
+		}
+		fingerprint = append(fingerprint, value)
+	}
+
+	return fingerprint, nil
+}
+
+// FingerprintString computes the compressed, base64-encoded fingerprint in
+// the layout that fpcalc prints
+func (c *ChromaprintGenerator) FingerprintString(data *audio.AudioData) (string, error) {
+	fingerprint, err := c.Fingerprint(data)
+	if err != nil {
+		return "", err
+	}
+	return EncodeChromaprint(fingerprint, c.Algorithm), nil
+}
+
+// Chroma computes the smoothed, normalized 12-band chroma features. Band 0
+// corresponds to the note A.
+func (c *ChromaprintGenerator) Chroma(data *audio.AudioData) ([][]float64, error) {
+	if data == nil || len(data.Samples) == 0 {
+		return nil, fmt.Errorf("invalid audio data")
+	}
+	if c.HopSize <= 0 || c.HopSize > c.FrameSize {
+		return nil, fmt.Errorf("hop size must be in [1, %d], got %d", c.FrameSize, c.HopSize)
+	}
+
+	samples, err := c.prepareSamples(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Map FFT bins to notes
+	minIndex := max(1, int(math.Round(float64(c.FrameSize)*c.MinFrequency/float64(c.SampleRate))))
+	maxIndex := min(c.FrameSize/2, int(math.Round(float64(c.FrameSize)*c.MaxFrequency/float64(c.SampleRate))))
+	notes := make([]int, maxIndex)
+	for i := minIndex; i < maxIndex; i++ {
+		frequency := float64(i) * float64(c.SampleRate) / float64(c.FrameSize)
+		octave := math.Log2(frequency / (440.0 / 16.0))
+		notes[i] = int(12 * (octave - math.Floor(octave)))
+	}
+
+	window := make([]float64, c.FrameSize)
+	for i := range window {
+		window[i] = 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(c.FrameSize-1))
+	}
+
+	// Raw chroma per frame
+	var raw [][]float64
+	frame := make([]float64, c.FrameSize)
+	for start := 0; start+c.FrameSize <= len(samples); start += c.HopSize {
+		for i := range frame {
+			frame[i] = samples[start+i] * window[i]
+		}
+		spectrum := fft.FFTReal(frame)
+
+		features := make([]float64, 12)
+		for i := minIndex; i < maxIndex; i++ {
+			re, im := real(spectrum[i]), imag(spectrum[i])
+			features[notes[i]] += re*re + im*im
+		}
+		raw = append(raw, features)
+	}
+
+	// Smooth over time, then normalize
+	size := len(chromaFilterCoefficients)
+	if len(raw) < size {
+		return nil, nil
+	}
+	chroma := make([][]float64, 0, len(raw)-size+1)
+	for t := 0; t+size <= len(raw); t++ {
+		features := make([]float64, 12)
+		for j, coefficient := range chromaFilterCoefficients {
+			for band, val := range raw[t+j] {
+				features[band] += coefficient * val
+			}
+		}
+
+		norm := 0.0
+		for _, val := range features {
+			norm += val * val
+		}
+		norm = math.Sqrt(norm)
+		for band := range features {
+			if norm < c.NormThreshold {
+				features[band] = 0
+			} else {
+				features[band] /= norm
+			}
+		}
+		chroma = append(chroma, features)
+	}
+
+	return chroma, nil
+}
+
+// prepareSamples converts the audio to 16-bit mono samples at SampleRate as
+// Chromaprint's audio processor does. Chroma energies, and so NormThreshold,
+// are on the 16-bit scale.
+func (c *ChromaprintGenerator) prepareSamples(data *audio.AudioData) ([]float64, error) {
+	pcm, err := chromaprintSamples(data, c.SampleRate)
+	if err != nil {
+		return nil, err
+	}
+
+	samples := make([]float64, len(pcm))
+	for i, sample := range pcm {
+		samples[i] = float64(sample)
+	}
+	return samples, nil
+}
+
+// integralImage holds cumulative sums of the chroma image for constant-time
+// rectangle sums
+type integralImage struct {
+	rows int
+	sums [][]float64 // sums[r][c] is the sum over rows < r and columns < c
+}
+
+func newIntegralImage(data [][]float64) *integralImage {
+	sums := make([][]float64, len(data)+1)
+	sums[0] = make([]float64, 13)
+	for r, row := range data {
+		sums[r+1] = make([]float64, 13)
+		for c, val := range row {
+			sums[r+1][c+1] = sums[r+1][c] + sums[r][c+1] - sums[r][c] + val
+		}
+	}
+	return &integralImage{rows: len(data), sums: sums}
+}
+
+// area returns the sum over rows [r1, r2) and columns [c1, c2)
+func (m *integralImage) area(r1, c1, r2, c2 int) float64 {
+	if r1 >= r2 || c1 >= c2 {
+		return 0
+	}
+	return m.sums[r2][c2] - m.sums[r1][c2] - m.sums[r2][c1] + m.sums[r1][c1]
+}
+
+// apply evaluates the filter on the window starting at frame x as the
+// difference of the log-compressed sums of its two halves
+func (f ChromaFilter) apply(m *integralImage, x int) float64 {
+	y, w, h := f.Y, f.Width, f.Height
+	var a, b float64
+	switch f.Type {
+	case 0: // Whole window
+		a = m.area(x, y, x+w, y+h)
+	case 1: // Upper vs. lower bands
+		h2 := h / 2
+		a = m.area(x, y+h2, x+w, y+h)
+		b = m.area(x, y, x+w, y+h2)
+	case 2: // Later vs. earlier frames
+		w2 := w / 2
+		a = m.area(x+w2, y, x+w, y+h)
+		b = m.area(x, y, x+w2, y+h)
+	case 3: // Checkerboard
+		h2, w2 := h/2, w/2
+		a = m.area(x, y+h2, x+w2, y+h) + m.area(x+w2, y, x+w, y+h2)
+		b = m.area(x, y, x+w2, y+h2) + m.area(x+w2, y+h2, x+w, y+h)
+	case 4: // Middle third of the bands vs. the outer thirds
+		h3 := h / 3
+		a = m.area(x, y+h3, x+w, y+2*h3)
+		b = m.area(x, y, x+w, y+h3) + m.area(x, y+2*h3, x+w, y+h)
+	case 5: // Middle third of the frames vs. the outer thirds
+		w3 := w / 3
+		a = m.area(x+w3, y, x+2*w3, y+h)
+		b = m.area(x, y, x+w3, y+h) + m.area(x+2*w3, y, x+w, y+h)
+	}
+	return math.Log(1+a) - math.Log(1+b)
+}
+
+// quantize maps a filter response to a level in [0, 3]
+func (q ChromaQuantizer) quantize(value float64) int {
+	if value < q.T1 {
+		if value < q.T0 {
+			return 0
+		}
+		return 1
+	}
+	if value < q.T2 {
+		return 2
+	}
+	return 3
+}
+
+// EncodeChromaprint compresses sub-fingerprints into Chromaprint's
+// URL-safe base64 format
+func EncodeChromaprint(fingerprint []uint32, algorithm ChromaprintAlgorithm) string {
+	// Gaps between the set bits of each XOR delta, each list terminated by 0
+	var gaps []int
+	var previous uint32
+	for _, value := range fingerprint {
+		x := value ^ previous
+		last := 0
+		for x != 0 {
+			bit := bits.TrailingZeros32(x) + 1
+			gaps = append(gaps, bit-last)
+			last = bit
+			x &= x - 1
+		}
+		gaps = append(gaps, 0)
+		previous = value
+	}
+
+	length := len(fingerprint)
+	w := &bitWriter{out: []byte{byte(algorithm), byte(length >> 16), byte(length >> 8), byte(length)}}
+	for _, gap := range gaps {
+		w.write(uint32(min(gap, chromaprintMaxNormal)), chromaprintNormalBits)
+	}
+	w.flush()
+	for _, gap := range gaps {
+		if gap >= chromaprintMaxNormal {
+			w.write(uint32(gap-chromaprintMaxNormal), chromaprintExceptionBits)
+		}
+	}
+	w.flush()
+
+	return base64.RawURLEncoding.EncodeToString(w.out)
+}
+
+// DecodeChromaprint decompresses a fingerprint produced by EncodeChromaprint
+// or fpcalc
+func DecodeChromaprint(encoded string) ([]uint32, ChromaprintAlgorithm, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid fingerprint encoding: %w", err)
+	}
+	if len(data) < 4 {
+		return nil, 0, fmt.Errorf("fingerprint too short: %d bytes", len(data))
+	}
+	algorithm := ChromaprintAlgorithm(data[0])
+	length := int(data[1])<<16 | int(data[2])<<8 | int(data[3])
+
+	// Normal gaps until every sub-fingerprint has been terminated
+	r := &bitReader{data: data[4:]}
+	var gaps []int
+	exceptions := 0
+	for terminated := 0; terminated < length; {
+		gap, ok := r.read(chromaprintNormalBits)
+		if !ok {
+			return nil, 0, fmt.Errorf("fingerprint truncated: %d of %d sub-fingerprints", terminated, length)
+		}
+		if gap == 0 {
+			terminated++
+		} else if gap == chromaprintMaxNormal {
+			exceptions++
+		}
+		gaps = append(gaps, int(gap))
+	}
+
+	// Exception section starts on the next byte
+	r.align()
+	for i := range gaps {
+		if gaps[i] != chromaprintMaxNormal {
+			continue
+		}
+		extra, ok := r.read(chromaprintExceptionBits)
+		if !ok {
+			return nil, 0, fmt.Errorf("fingerprint truncated in exception section")
+		}
+		gaps[i] += int(extra)
+	}
+
+	fingerprint := make([]uint32, 0, length)
+	var value, delta uint32
+	bit := 0
+	for _, gap := range gaps {
+		if gap == 0 {
+			value ^= delta
+			fingerprint = append(fingerprint, value)
+			delta, bit = 0, 0
+			continue
+		}
+		bit += gap
+		if bit > 32 {
+			return nil, 0, fmt.Errorf("invalid fingerprint: bit position %d", bit)
+		}
+		delta |= 1 << (bit - 1)
+	}
+
+	return fingerprint, algorithm, nil
+}
+
+// CompareChromaprints returns the fraction of matching bits between two
+// fingerprints at the best alignment within maxOffset sub-fingerprints, and
+// that offset (positive when b starts later in the audio than a)
+func CompareChromaprints(a, b []uint32, maxOffset int) (similarity float64, offset int) {
+	for shift := -maxOffset; shift <= maxOffset; shift++ {
+		differing, compared := 0, 0
+		for i := max(0, -shift); i < len(a) && i+shift < len(b); i++ {
+			if i+shift < 0 {
+				continue
+			}
+			differing += bits.OnesCount32(a[i] ^ b[i+shift])
+			compared++
+		}
+		if compared == 0 {
+			continue
+		}
+		score := 1 - float64(differing)/float64(32*compared)
+		if score > similarity {
+			similarity, offset = score, shift
+		}
+	}
+	return similarity, offset
+}
+
+// bitWriter packs values least significant bit first
+type bitWriter struct {
+	out    []byte
+	buffer uint64
+	size   int
+}
+
+func (w *bitWriter) write(value uint32, n int) {
+	w.buffer |= uint64(value) << w.size
+	w.size += n
+	for w.size >= 8 {
+		w.out = append(w.out, byte(w.buffer))
+		w.buffer >>= 8
+		w.size -= 8
+	}
+}
+
+func (w *bitWriter) flush() {
+	if w.size > 0 {
+		w.out = append(w.out, byte(w.buffer))
+	}
+	w.buffer, w.size = 0, 0
+}
+
+// bitReader unpacks values written by bitWriter
+type bitReader struct {
+	data   []byte
+	pos    int // Next byte
+	buffer uint64
+	size   int
+}
+
+func (r *bitReader) read(n int) (uint32, bool) {
+	for r.size < n {
+		if r.pos >= len(r.data) {
+			return 0, false
+		}
+		r.buffer |= uint64(r.data[r.pos]) << r.size
+		r.pos++
+		r.size += 8
+	}
+	value := uint32(r.buffer & (1<<n - 1))
+	r.buffer >>= n
+	r.size -= n
+	return value, true
+}
+
+// align discards the bits left in the current byte
+func (r *bitReader) align() {
+	r.buffer, r.size = 0, 0
+}
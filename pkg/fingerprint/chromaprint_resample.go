@@ -0,0 +1,227 @@
+package fingerprint
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+)
+
+// Chromaprint's audio processor: 16-bit samples are downmixed into a buffer
+// and, when the input rate differs from the analysis rate, resampled by the
+// polyphase filter of FFmpeg's legacy av_resample bundled with Chromaprint
+const (
+	chromaprintMinSampleRate   = 1000
+	chromaprintBufferSize      = 1 << 15 // Samples buffered between resampler calls
+	chromaprintFilterSize      = 16      // Filter taps at the output rate
+	chromaprintPhaseShift      = 8       // log2 of the number of filter phases
+	chromaprintResampleCutoff  = 0.8     // Cutoff relative to the output Nyquist frequency
+	chromaprintKaiserBeta      = 9       // Window of the filter taps
+	chromaprintFilterPrecision = 15      // Fractional bits of the 16-bit taps
+)
+
+// chromaprintSamples converts audio to the 16-bit mono samples at sampleRate
+// that Chromaprint's audio processor hands to its FFT. Channels are averaged
+// with integer division, and the input is resampled in buffers of
+// chromaprintBufferSize samples, so samples near the end that the filter
+// cannot reach are dropped as they are by Chromaprint.
+func chromaprintSamples(data *audio.AudioData, sampleRate int) ([]int16, error) {
+	if data.Channels <= 0 {
+		return nil, fmt.Errorf("invalid number of channels: %d", data.Channels)
+	}
+	if data.SampleRate <= chromaprintMinSampleRate {
+		return nil, fmt.Errorf("sample rate %d Hz is too low, Chromaprint needs more than %d Hz", data.SampleRate, chromaprintMinSampleRate)
+	}
+
+	var resampler *chromaprintResampler
+	if data.SampleRate != sampleRate {
+		var err error
+		if resampler, err = newChromaprintResampler(sampleRate, data.SampleRate); err != nil {
+			return nil, err
+		}
+	}
+
+	var output []int16
+	buffer := make([]int16, chromaprintBufferSize)
+	resampled := make([]int16, chromaprintBufferSize)
+	buffered := 0
+	flush := func() {
+		if resampler == nil {
+			output = append(output, buffer[:buffered]...)
+			buffered = 0
+			return
+		}
+		n, consumed := resampler.resample(resampled, buffer[:buffered])
+		output = append(output, resampled[:n]...)
+		buffered = max(buffered-consumed, 0)
+		copy(buffer, buffer[consumed:consumed+buffered])
+	}
+
+	for frame := 0; frame+data.Channels <= len(data.Samples); frame += data.Channels {
+		sum := 0
+		for _, sample := range data.Samples[frame : frame+data.Channels] {
+			sum += int(toInt16(sample))
+		}
+		buffer[buffered] = int16(sum / data.Channels)
+		buffered++
+
+		if buffered == len(buffer) {
+			flush()
+			if buffered == len(buffer) {
+				return nil, fmt.Errorf("resampler consumed no input")
+			}
+		}
+	}
+	if buffered > 0 {
+		flush()
+	}
+
+	return output, nil
+}
+
+// toInt16 maps a sample in [-1, 1] to a 16-bit integer, the inverse of the
+// division by 32768 with which 16-bit audio is loaded
+func toInt16(sample float64) int16 {
+	return int16(max(math.MinInt16, min(math.MaxInt16, math.Round(sample*(1<<15)))))
+}
+
+// chromaprintResampler is a port of av_resample for 16-bit samples. The
+// filter bank holds one set of taps per phase of the output position between
+// two input samples, and index tracks that position in input samples times
+// the number of phases, with frac carrying the remainder in units of
+// 1/srcIncr.
+type chromaprintResampler struct {
+	filters      []int16
+	filterLength int
+	phaseMask    int
+	index        int
+	frac         int
+	srcIncr      int
+	dstIncr      int
+}
+
+// newChromaprintResampler builds a resampler from inRate to outRate with
+// Chromaprint's settings
+func newChromaprintResampler(outRate, inRate int) (*chromaprintResampler, error) {
+	factor := math.Min(float64(outRate)*chromaprintResampleCutoff/float64(inRate), 1.0)
+	phaseCount := 1 << chromaprintPhaseShift
+
+	r := &chromaprintResampler{
+		filterLength: max(int(math.Ceil(chromaprintFilterSize/factor)), 1),
+		phaseMask:    phaseCount - 1,
+	}
+	r.filters = chromaprintFilterBank(factor, r.filterLength, phaseCount)
+
+	// Output and input steps as a reduced fraction
+	divisor := gcd(outRate, inRate*phaseCount)
+	r.srcIncr, r.dstIncr = outRate/divisor, inRate*phaseCount/divisor
+	if r.srcIncr > math.MaxInt32/2 || r.dstIncr > math.MaxInt32/2 {
+		return nil, fmt.Errorf("cannot resample from %d Hz to %d Hz", inRate, outRate)
+	}
+	r.index = -phaseCount * ((r.filterLength - 1) / 2)
+
+	return r, nil
+}
+
+// chromaprintFilterBank computes the Kaiser-windowed sinc taps of every
+// phase, each phase normalized to unit gain and rounded to 16 bits
+func chromaprintFilterBank(factor float64, tapCount, phaseCount int) []int16 {
+	filters := make([]int16, tapCount*phaseCount)
+	taps := make([]float64, tapCount)
+	center := (tapCount - 1) / 2
+	for phase := 0; phase < phaseCount; phase++ {
+		norm := 0.0
+		for i := range taps {
+			x := math.Pi * (float64(i-center) - float64(phase)/float64(phaseCount)) * factor
+			y := 1.0
+			if x != 0 {
+				y = math.Sin(x) / x
+			}
+			w := 2.0 * x / (factor * float64(tapCount) * math.Pi)
+			y *= kaiserBessel(chromaprintKaiserBeta * math.Sqrt(math.Max(1-w*w, 0)))
+			taps[i] = y
+			norm += y
+		}
+
+		// Rounded through a float32 as by lrintf
+		for i, tap := range taps {
+			rounded := math.RoundToEven(float64(float32(tap * (1 << chromaprintFilterPrecision) / norm)))
+			filters[phase*tapCount+i] = int16(max(math.MinInt16, min(math.MaxInt16, rounded)))
+		}
+	}
+	return filters
+}
+
+// kaiserBessel computes the zeroth-order modified Bessel function of the
+// first kind, summing its series until the sum stops changing
+func kaiserBessel(x float64) float64 {
+	x = x * x / 4
+	sum, last, term := 1.0, 0.0, 1.0
+	for i := 1; sum != last; i++ {
+		last = sum
+		term *= x / float64(i*i)
+		sum += term
+	}
+	return sum
+}
+
+// resample fills dst with as many output samples as src covers and returns
+// their number and the number of input samples the next call no longer
+// needs. The arithmetic is av_resample's, including 32-bit accumulation and
+// mirrored input before the first sample.
+func (r *chromaprintResampler) resample(dst, src []int16) (int, int) {
+	index, frac := r.index, r.frac
+	dstIncrFrac := r.dstIncr % r.srcIncr
+	dstIncr := r.dstIncr / r.srcIncr
+
+	n := 0
+	for ; n < len(dst); n++ {
+		filter := r.filters[r.filterLength*(index&r.phaseMask):]
+		sampleIndex := index >> chromaprintPhaseShift
+
+		var val int32
+		if sampleIndex < 0 {
+			for i := 0; i < r.filterLength; i++ {
+				k := sampleIndex + i
+				if k < 0 {
+					k = -k
+				}
+				val += int32(src[k%len(src)]) * int32(filter[i])
+			}
+		} else if sampleIndex+r.filterLength > len(src) {
+			break
+		} else {
+			for i := 0; i < r.filterLength; i++ {
+				val += int32(src[sampleIndex+i]) * int32(filter[i])
+			}
+		}
+
+		val = (val + 1<<(chromaprintFilterPrecision-1)) >> chromaprintFilterPrecision
+		if uint32(val+32768) > 65535 {
+			val = val>>31 ^ 32767
+		}
+		dst[n] = int16(val)
+
+		frac += dstIncrFrac
+		index += dstIncr
+		if frac >= r.srcIncr {
+			frac -= r.srcIncr
+			index++
+		}
+	}
+
+	consumed := max(index, 0) >> chromaprintPhaseShift
+	if index >= 0 {
+		index &= r.phaseMask
+	}
+	r.index, r.frac = index, frac
+	return n, consumed
+}
+
+// gcd returns the greatest common divisor of two positive integers
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
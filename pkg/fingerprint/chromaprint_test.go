@@ -0,0 +1,267 @@
+package fingerprint
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math"
+	"math/bits"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/internal/golden"
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+)
+
+// createChordProgression renders seconds of audio cycling through four
+// triads, half a second each, at 44.1 kHz
+func createChordProgression(seconds float64, seed int64) *audio.AudioData {
+	return createChordProgressionAt(seconds, seed, 44100)
+}
+
+// createChordProgressionAt renders the chord progression at sampleRate
+func createChordProgressionAt(seconds float64, seed int64, sampleRate int) *audio.AudioData {
+	rng := rand.New(rand.NewSource(seed))
+	roots := make([]float64, 4)
+	for i := range roots {
+		roots[i] = 220 * math.Pow(2, float64(rng.Intn(12))/12)
+	}
+
+	samples := make([]float64, int(seconds*float64(sampleRate)))
+	for i := range samples {
+		t := float64(i) / float64(sampleRate)
+		root := roots[int(t*2)%len(roots)]
+		for _, interval := range []float64{0, 4, 7} {
+			samples[i] += 0.2 * math.Sin(2*math.Pi*root*math.Pow(2, interval/12)*t)
+		}
+	}
+	return &audio.AudioData{Samples: samples, SampleRate: sampleRate, Channels: 1, Duration: seconds}
+}
+
+// TestChromaprintGolden pins the encoded fingerprint of a synthetic signal.
+// It was produced by this implementation, not by fpcalc, so it guards against
+// regressions but does not prove compatibility. Regenerate with
+// go test -run Chromaprint -update after intended changes.
+func TestChromaprintGolden(t *testing.T) {
+	generator := NewChromaprintGenerator()
+	encoded, err := generator.FingerprintString(createChordProgression(10, 1))
+	if err != nil {
+		t.Fatalf("Failed to fingerprint: %v", err)
+	}
+	golden.Check(t, "chromaprint_chords.golden", encoded)
+}
+
+var fpcalcPath = flag.String("fpcalc", "", "fpcalc binary used to rewrite testdata/chromaprint_chords_*.fpcalc")
+
+// TestChromaprintMatchesFpcalc compares the fingerprint of the chord
+// progression, stored as a 16-bit WAV file, with the one fpcalc computes from
+// the same file. fpcalc's output is kept in testdata/chromaprint_chords_*.fpcalc;
+// write it with go test -run Fpcalc -fpcalc $(which fpcalc). Without the files
+// the test is skipped.
+//
+// At 11025 Hz nothing is resampled, so that file checks the chroma and
+// classifiers alone. The 44.1 kHz file also goes through resampling, which
+// fpcalc 1.4 and later leave to FFmpeg before the audio reaches Chromaprint.
+func TestChromaprintMatchesFpcalc(t *testing.T) {
+	for _, sampleRate := range []int{11025, 44100} {
+		t.Run(strconv.Itoa(sampleRate), func(t *testing.T) {
+			checkFpcalc(t, createChordProgressionAt(10, 1, sampleRate),
+				filepath.Join("testdata", fmt.Sprintf("chromaprint_chords_%d.fpcalc", sampleRate)))
+		})
+	}
+}
+
+// checkFpcalc compares the fingerprint of data, written to a 16-bit WAV
+// file, with fpcalc's output for that file stored at expectedPath
+func checkFpcalc(t *testing.T, data *audio.AudioData, expectedPath string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "chords.wav")
+	if err := audio.NewAudioUtils().SaveWAV(path, data, audio.PCM16); err != nil {
+		t.Fatalf("Failed to write WAV: %v", err)
+	}
+
+	if *fpcalcPath != "" {
+		output, err := exec.Command(*fpcalcPath, "-plain", path).Output()
+		if err != nil {
+			t.Fatalf("Failed to run fpcalc: %v", err)
+		}
+		if err := os.WriteFile(expectedPath, output, 0o644); err != nil {
+			t.Fatalf("Failed to write fpcalc output: %v", err)
+		}
+	}
+	expected, err := os.ReadFile(expectedPath)
+	if os.IsNotExist(err) {
+		t.Skipf("No fpcalc output in %s", expectedPath)
+	}
+	if err != nil {
+		t.Fatalf("Failed to read fpcalc output: %v", err)
+	}
+	want, _, err := DecodeChromaprint(strings.TrimSpace(string(expected)))
+	if err != nil {
+		t.Fatalf("Failed to decode fpcalc output: %v", err)
+	}
+
+	// Fingerprint the decoded file, as fpcalc does
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open WAV: %v", err)
+	}
+	defer file.Close()
+	loaded, err := audio.NewWAVLoader().Load(context.Background(), file, audio.WAV)
+	if err != nil {
+		t.Fatalf("Failed to load WAV: %v", err)
+	}
+	got, err := NewChromaprintGenerator().Fingerprint(loaded)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint: %v", err)
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("Expected %d sub-fingerprints like fpcalc, got %d", len(want), len(got))
+	}
+	differing := 0
+	for i := range want {
+		differing += bits.OnesCount32(got[i] ^ want[i])
+	}
+	if differing != 0 {
+		t.Errorf("Fingerprint differs from fpcalc in %d of %d bits", differing, 32*len(want))
+	}
+}
+
+func TestChromaprintSamples(t *testing.T) {
+	// 16-bit samples loaded from a file come back unchanged, and channels are
+	// averaged with integer division
+	stereo := &audio.AudioData{
+		Samples:    []float64{-1, -1, 32767.0 / 32768, 32767.0 / 32768, -3.0 / 32768, 0, 5.0 / 32768, 0},
+		SampleRate: 11025,
+		Channels:   2,
+	}
+	pcm, err := chromaprintSamples(stereo, 11025)
+	if err != nil {
+		t.Fatalf("Failed to convert samples: %v", err)
+	}
+	if want := []int16{-32768, 32767, -1, 2}; !reflect.DeepEqual(pcm, want) {
+		t.Errorf("Expected %v, got %v", want, pcm)
+	}
+
+	// Resampled values checked against Chromaprint's av_resample
+	sampleRate := 44100
+	tones := &audio.AudioData{Samples: make([]float64, sampleRate/10), SampleRate: sampleRate, Channels: 1}
+	for i := range tones.Samples {
+		at := float64(i) / float64(sampleRate)
+		tones.Samples[i] = 0.6*math.Sin(2*math.Pi*440*at) + 0.3*math.Sin(2*math.Pi*5000*at)
+	}
+	pcm, err = chromaprintSamples(tones, 11025)
+	if err != nil {
+		t.Fatalf("Failed to resample: %v", err)
+	}
+	if len(pcm) != 1093 {
+		t.Fatalf("Expected 1093 samples, got %d", len(pcm))
+	}
+	for index, want := range map[int]int16{0: 10432, 1: 3545, 2: 8468, 100: -90, 500: -6808, 1000: -10728, 1092: -8297} {
+		if pcm[index] != want {
+			t.Errorf("Sample %d: expected %d, got %d", index, want, pcm[index])
+		}
+	}
+}
+
+func TestChromaprintEncoding(t *testing.T) {
+	// A single sub-fingerprint with only bit 0 set: gaps {1, 0}
+	if got := EncodeChromaprint([]uint32{1}, ChromaprintTest2); got != "AQAAAQE" {
+		t.Errorf("Expected AQAAAQE, got %s", got)
+	}
+
+	rng := rand.New(rand.NewSource(3))
+	fingerprint := []uint32{0, math.MaxUint32, 1 << 31}
+	for i := 0; i < 100; i++ {
+		fingerprint = append(fingerprint, rng.Uint32())
+	}
+	decoded, algorithm, err := DecodeChromaprint(EncodeChromaprint(fingerprint, ChromaprintTest2))
+	if err != nil {
+		t.Fatalf("Failed to decode: %v", err)
+	}
+	if algorithm != ChromaprintTest2 {
+		t.Errorf("Expected algorithm %d, got %d", ChromaprintTest2, algorithm)
+	}
+	if len(decoded) != len(fingerprint) {
+		t.Fatalf("Expected %d sub-fingerprints, got %d", len(fingerprint), len(decoded))
+	}
+	for i := range fingerprint {
+		if decoded[i] != fingerprint[i] {
+			t.Fatalf("Sub-fingerprint %d: got %08x, want %08x", i, decoded[i], fingerprint[i])
+		}
+	}
+}
+
+func TestChromaprintSimilarity(t *testing.T) {
+	generator := NewChromaprintGenerator()
+	reference, err := generator.Fingerprint(createChordProgression(10, 1))
+	if err != nil {
+		t.Fatalf("Failed to fingerprint: %v", err)
+	}
+
+	// The same music with added noise still matches
+	noisy := createChordProgression(10, 1)
+	rng := rand.New(rand.NewSource(2))
+	for i := range noisy.Samples {
+		noisy.Samples[i] += 0.05 * rng.NormFloat64()
+	}
+	query, err := generator.Fingerprint(noisy)
+	if err != nil {
+		t.Fatalf("Failed to fingerprint: %v", err)
+	}
+	if similarity, offset := CompareChromaprints(reference, query, 10); similarity < 0.9 || offset != 0 {
+		t.Errorf("Expected a close match at offset 0, got %.3f at %d", similarity, offset)
+	}
+
+	// Different chords do not
+	other, err := generator.Fingerprint(createChordProgression(10, 7))
+	if err != nil {
+		t.Fatalf("Failed to fingerprint: %v", err)
+	}
+	if similarity, _ := CompareChromaprints(reference, other, 10); similarity > 0.8 {
+		t.Errorf("Expected different music to differ, got similarity %.3f", similarity)
+	}
+}
+
+func TestChromaprintQuietAudio(t *testing.T) {
+	generator := NewChromaprintGenerator()
+	chromaNorms := func(amplitude float64) (zeroed, kept int) {
+		t.Helper()
+		data := createChordProgression(3, 1)
+		for i := range data.Samples {
+			data.Samples[i] *= amplitude / 0.6
+		}
+		chroma, err := generator.Chroma(data)
+		if err != nil {
+			t.Fatalf("Failed to compute chroma: %v", err)
+		}
+		for _, features := range chroma {
+			norm := 0.0
+			for _, val := range features {
+				norm += val * val
+			}
+			if norm == 0 {
+				zeroed++
+			} else {
+				kept++
+			}
+		}
+		return zeroed, kept
+	}
+
+	// A few LSBs of 16-bit audio are still music, below half an LSB it is
+	// digital silence
+	if zeroed, _ := chromaNorms(4.0 / math.MaxInt16); zeroed != 0 {
+		t.Errorf("Expected no zeroed chroma frames for audio at 4 LSBs, got %d", zeroed)
+	}
+	if _, kept := chromaNorms(0.4 / math.MaxInt16); kept != 0 {
+		t.Errorf("Expected only zeroed chroma frames below half an LSB, got %d", kept)
+	}
+}
@@ -0,0 +1,354 @@
+package fingerprint
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"strings"
+
+	"github.com/kshitijk4poor/shazam-golang/internal/bincodec"
+)
+
+// FormatVersion is the version of the binary fingerprint format written by
+// Marshal. Unmarshal rejects any other version.
+const FormatVersion = 1
+
+// formatMagic identifies serialized fingerprints
+var formatMagic = [4]byte{'S', 'G', 'F', 'P'}
+
+var (
+	// ErrUnsupportedVersion is returned when decoding a fingerprint written
+	// with a different format version
+	ErrUnsupportedVersion = errors.New("unsupported fingerprint format version")
+
+	// ErrConfigMismatch is returned when decoding a fingerprint produced with
+	// a different analyzer or generator configuration
+	ErrConfigMismatch = errors.New("fingerprint configuration mismatch")
+)
+
+// FrameGeometry describes the spectrogram grid a fingerprint was computed on.
+// Peak and hash times and frequencies are stored as grid indices and restored
+// from it.
+type FrameGeometry struct {
+	SampleRate int
+	WindowSize int
+	HopSize    int
+}
+
+// frameTime returns the start time of a frame in seconds, computed exactly as
+// the spectral analyzer does
+func (f FrameGeometry) frameTime(index int) float64 {
+	return float64(index*f.HopSize) / float64(f.SampleRate)
+}
+
+// frameIndex returns the frame nearest to a time in seconds
+func (f FrameGeometry) frameIndex(t float64) int {
+	return int(math.Round(t * float64(f.SampleRate) / float64(f.HopSize)))
+}
+
+// binFrequency returns the center frequency of a bin in Hz, computed exactly
+// as the spectral analyzer does
+func (f FrameGeometry) binFrequency(index int) float64 {
+	return float64(index) * float64(f.SampleRate) / float64(f.WindowSize)
+}
+
+// binIndex returns the bin nearest to a frequency in Hz
+func (f FrameGeometry) binIndex(frequency float64) int {
+	return int(math.Round(frequency * float64(f.WindowSize) / float64(f.SampleRate)))
+}
+
+// ConfigHash fingerprints every setting that changes the generated peaks,
+// hashes or vectors. The analysis sample rate is part of Config; when it is 0
+// the rate of the audio is carried in FrameGeometry instead. Peak filters are
+// hashed by describeFilter.
+func (g *GeneratorImpl) ConfigHash() uint64 {
+	a, e, h := g.Analyzer, g.Extractor, g.Hasher
+	hasher := fnv.New64a()
+	fmt.Fprintf(hasher, "analyzer:%d/%d/%s/%g/%g/%g/%g/%t/%g/%s/%g/%t/%d;",
+		a.WindowSize, a.HopSize, a.WindowType, a.KaiserBeta, a.GaussianSigma, a.MinFreq, a.MaxFreq,
+		a.DBScale, a.TopDB, a.Normalization, a.NormalizePercentile, a.MelScale, a.NumMelBins)
+	fmt.Fprintf(hasher, "extractor:%d/%g/%g/%d/%g/%g/%s/%d/%d/%g/%g/%g/%g/%s;",
+		e.NeighborhoodSize, e.AbsoluteThreshold, e.RelativeThreshold, e.MaxPeaksPerFrame, e.MinFrequency, e.MaxFrequency,
+		e.ThresholdMode, e.LocalMeanTimeRadius, e.LocalMeanFreqRadius, e.LocalMeanOffset, e.MaskingDecay, e.MaskingSpread,
+		e.TargetPeaksPerSecond, describeFilter(e.Filter))
+	fmt.Fprintf(hasher, "hasher:%s/%d/%g/%g/%g/%d;",
+		h.Mode, h.FanOut, h.MinTimeDelta, h.MaxTimeDelta, h.FreqRatioStep, h.TimeRatioLevels)
+	fmt.Fprintf(hasher, "generator:%+v/%s", g.Config, describeFilter(g.Filter))
+	return hasher.Sum64()
+}
+
+// describeFilter returns a canonical description of a peak filter: pointers
+// are described by the filter they point to and pipelines by their stages.
+// Filters defined elsewhere can provide a Describe() string method; otherwise
+// they are described by their type and printed value.
+func describeFilter(filter PeakFilter) string {
+	if v := reflect.ValueOf(filter); v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return "none"
+		}
+		if elem, ok := v.Elem().Interface().(PeakFilter); ok {
+			filter = elem
+		}
+	}
+
+	switch f := filter.(type) {
+	case nil:
+		return "none"
+	case FilterPipeline:
+		stages := make([]string, 0, len(f))
+		for _, stage := range f {
+			if stage != nil {
+				stages = append(stages, describeFilter(stage))
+			}
+		}
+		return "pipeline[" + strings.Join(stages, ",") + "]"
+	case FrequencyBandFilter:
+		return fmt.Sprintf("band(%g,%g)", f.MinFrequency, f.MaxFrequency)
+	case AmplitudeFilter:
+		return fmt.Sprintf("amplitude(%g)", f.MinAmplitude)
+	case TimeWindowFilter:
+		return fmt.Sprintf("time(%g,%g)", f.MinTime, f.MaxTime)
+	case BandQuotaFilter:
+		return fmt.Sprintf("quota(%g,%d,%g)", f.BandEdges, f.PeaksPerBand, f.Window)
+	case MinSpacingFilter:
+		return fmt.Sprintf("spacing(%g,%g)", f.MinInterval, f.FrequencyTolerance)
+	case interface{ Describe() string }:
+		return fmt.Sprintf("%T(%s)", f, f.Describe())
+	default:
+		return fmt.Sprintf("%T%+v", f, f)
+	}
+}
+
+// Geometry returns the frame geometry of fingerprints computed from audio at
+// sampleRate, which is Config.SampleRate when set
+func (g *GeneratorImpl) Geometry(sampleRate int) FrameGeometry {
+	if g.Config.SampleRate > 0 {
+		sampleRate = g.Config.SampleRate
+	}
+	return FrameGeometry{
+		SampleRate: sampleRate,
+		WindowSize: g.Analyzer.WindowSize,
+		HopSize:    g.Analyzer.HopSize,
+	}
+}
+
+// Marshal encodes a fingerprint in the versioned binary format. The layout is
+//
+//	header:  magic "SGFP", version (1 byte), config hash (8 bytes),
+//	         sample rate, window size, hop size (uvarints),
+//	         duration (float64), track ID (uvarint length + bytes)
+//	peaks:   count, then per peak: time index delta (varint),
+//	         frequency index (uvarint), amplitude (float32)
+//	hashes:  count, then per hash: value (uint32), anchor frame delta (varint),
+//	         anchor frequency index (uvarint), span in frames (uvarint)
+//	vectors: count, dimension, then per vector: time delta in microseconds
+//	         (varint) and components (float32 each)
+//	trailer: CRC-32 (IEEE) of everything before it
+//
+// Fixed-width values are little-endian. Peak and hash times and frequencies
+// must lie on the frame grid described by geometry.
+func Marshal(fp *Fingerprint, configHash uint64, geometry FrameGeometry) ([]byte, error) {
+	if fp == nil {
+		return nil, fmt.Errorf("fingerprint is nil")
+	}
+	if geometry.SampleRate <= 0 || geometry.WindowSize <= 0 || geometry.HopSize <= 0 {
+		return nil, fmt.Errorf("invalid frame geometry: %+v", geometry)
+	}
+
+	w := &bincodec.Encoder{}
+	w.Write(formatMagic[:])
+	w.Byte(FormatVersion)
+	w.Uint64(configHash)
+	w.Uvarint(uint64(geometry.SampleRate))
+	w.Uvarint(uint64(geometry.WindowSize))
+	w.Uvarint(uint64(geometry.HopSize))
+	w.Uint64(math.Float64bits(fp.Duration))
+	w.Text(fp.TrackID)
+
+	// Peaks
+	w.Uvarint(uint64(len(fp.Peaks)))
+	previous := 0
+	for _, peak := range fp.Peaks {
+		if peak.TimeIndex < 0 || peak.FreqIndex < 0 {
+			return nil, fmt.Errorf("peak has negative grid index: %+v", peak)
+		}
+		w.Varint(int64(peak.TimeIndex - previous))
+		w.Uvarint(uint64(peak.FreqIndex))
+		w.Uint32(math.Float32bits(float32(peak.Amplitude)))
+		previous = peak.TimeIndex
+	}
+
+	// Hashes
+	w.Uvarint(uint64(len(fp.Hashes)))
+	previous = 0
+	for _, hash := range fp.Hashes {
+		frame := geometry.frameIndex(hash.Time)
+		span := geometry.frameIndex(hash.Span)
+		bin := geometry.binIndex(hash.Frequency)
+		if frame < 0 || span < 0 || bin < 0 {
+			return nil, fmt.Errorf("hash lies outside the frame grid: %+v", hash)
+		}
+		w.Uint32(hash.Value)
+		w.Varint(int64(frame - previous))
+		w.Uvarint(uint64(bin))
+		w.Uvarint(uint64(span))
+		previous = frame
+	}
+
+	// Vectors
+	w.Uvarint(uint64(len(fp.Vectors)))
+	dim := 0
+	if len(fp.Vectors) > 0 {
+		dim = len(fp.Vectors[0].Data)
+	}
+	w.Uvarint(uint64(dim))
+	var previousTime int64
+	for i, vector := range fp.Vectors {
+		if len(vector.Data) != dim {
+			return nil, fmt.Errorf("vector %d has dimension %d, expected %d", i, len(vector.Data), dim)
+		}
+		micros := int64(math.Round(vector.TimeRef * 1e6))
+		if micros < 0 {
+			return nil, fmt.Errorf("vector %d has negative time %f", i, vector.TimeRef)
+		}
+		w.Varint(micros - previousTime)
+		for _, val := range vector.Data {
+			w.Uint32(math.Float32bits(val))
+		}
+		previousTime = micros
+	}
+
+	w.Uint32(crc32.ChecksumIEEE(w.Bytes()))
+	return w.Bytes(), nil
+}
+
+// Unmarshal decodes a fingerprint written by Marshal. It returns
+// ErrUnsupportedVersion for other format versions and ErrConfigMismatch when
+// the fingerprint was not produced with configHash.
+func Unmarshal(data []byte, configHash uint64) (*Fingerprint, FrameGeometry, error) {
+	var geometry FrameGeometry
+
+	if len(data) < len(formatMagic)+1+8+4 || !bytes.Equal(data[:len(formatMagic)], formatMagic[:]) {
+		return nil, geometry, fmt.Errorf("not a serialized fingerprint")
+	}
+	if version := data[len(formatMagic)]; version != FormatVersion {
+		return nil, geometry, fmt.Errorf("%w: %d (expected %d)", ErrUnsupportedVersion, version, FormatVersion)
+	}
+
+	body, trailer := data[:len(data)-4], data[len(data)-4:]
+	if crc32.ChecksumIEEE(body) != binary.LittleEndian.Uint32(trailer) {
+		return nil, geometry, fmt.Errorf("fingerprint checksum mismatch")
+	}
+
+	r := bincodec.NewDecoder(body[len(formatMagic)+1:])
+	if stored := r.Uint64(); stored != configHash {
+		return nil, geometry, fmt.Errorf("%w: got %016x, expected %016x", ErrConfigMismatch, stored, configHash)
+	}
+	geometry.SampleRate = int(r.Uvarint())
+	geometry.WindowSize = int(r.Uvarint())
+	geometry.HopSize = int(r.Uvarint())
+	if r.Err() == nil && (geometry.SampleRate <= 0 || geometry.WindowSize <= 0 || geometry.HopSize <= 0) {
+		return nil, geometry, fmt.Errorf("invalid frame geometry: %+v", geometry)
+	}
+
+	fp := &Fingerprint{}
+	fp.Duration = math.Float64frombits(r.Uint64())
+	fp.TrackID = r.Text()
+
+	// Peaks
+	count := r.Count(3)
+	fp.Peaks = make([]Peak, 0, count)
+	timeIndex := 0
+	for i := 0; i < count && r.Err() == nil; i++ {
+		timeIndex += int(r.Varint())
+		freqIndex := int(r.Uvarint())
+		if timeIndex < 0 || freqIndex < 0 {
+			return nil, geometry, fmt.Errorf("failed to decode fingerprint: peak %d has negative grid index (%d, %d)", i, timeIndex, freqIndex)
+		}
+		fp.Peaks = append(fp.Peaks, Peak{
+			TimeIndex: timeIndex,
+			FreqIndex: freqIndex,
+			Time:      geometry.frameTime(timeIndex),
+			Frequency: geometry.binFrequency(freqIndex),
+			Amplitude: float64(math.Float32frombits(r.Uint32())),
+		})
+	}
+
+	// Hashes
+	count = r.Count(7)
+	fp.Hashes = make([]Hash, 0, count)
+	frame := 0
+	for i := 0; i < count && r.Err() == nil; i++ {
+		value := r.Uint32()
+		frame += int(r.Varint())
+		bin := int(r.Uvarint())
+		span := int(r.Uvarint())
+		if frame < 0 || bin < 0 || span < 0 || frame+span < 0 {
+			return nil, geometry, fmt.Errorf("failed to decode fingerprint: hash %d lies outside the frame grid (frame %d, bin %d, span %d)", i, frame, bin, span)
+		}
+		fp.Hashes = append(fp.Hashes, Hash{
+			Value:     value,
+			Time:      geometry.frameTime(frame),
+			Frequency: geometry.binFrequency(bin),
+			Span:      geometry.frameTime(frame+span) - geometry.frameTime(frame),
+			TrackID:   fp.TrackID,
+		})
+	}
+
+	// Vectors
+	count = r.Count(1)
+	dim := int(r.Uvarint())
+	if r.Err() == nil && count > 0 && dim > r.Len()/4 {
+		r.Fail()
+	}
+	fp.Vectors = make([]*Vector, 0, count)
+	var micros int64
+	for i := 0; i < count && r.Err() == nil; i++ {
+		micros += r.Varint()
+		if micros < 0 {
+			return nil, geometry, fmt.Errorf("failed to decode fingerprint: vector %d has negative time %dµs", i, micros)
+		}
+		vector := &Vector{
+			Data:    make([]float32, dim),
+			TimeRef: float64(micros) / 1e6,
+			TrackID: fp.TrackID,
+		}
+		for j := range vector.Data {
+			vector.Data[j] = math.Float32frombits(r.Uint32())
+		}
+		fp.Vectors = append(fp.Vectors, vector)
+	}
+
+	if err := r.Done(); err != nil {
+		return nil, geometry, fmt.Errorf("failed to decode fingerprint: %w", err)
+	}
+
+	return fp, geometry, nil
+}
+
+// MarshalFingerprint encodes a fingerprint produced by this generator from
+// audio at sampleRate
+func (g *GeneratorImpl) MarshalFingerprint(fp *Fingerprint, sampleRate int) ([]byte, error) {
+	return Marshal(fp, g.ConfigHash(), g.Geometry(sampleRate))
+}
+
+// UnmarshalFingerprint decodes a fingerprint, rejecting fingerprints produced
+// with a different configuration or analysis sample rate than this
+// generator's. Without Config.SampleRate any rate is accepted, so the caller
+// must make sure fingerprints it compares share one.
+func (g *GeneratorImpl) UnmarshalFingerprint(data []byte) (*Fingerprint, error) {
+	fp, geometry, err := Unmarshal(data, g.ConfigHash())
+	if err != nil {
+		return nil, err
+	}
+	if geometry.WindowSize != g.Analyzer.WindowSize || geometry.HopSize != g.Analyzer.HopSize ||
+		(g.Config.SampleRate > 0 && geometry.SampleRate != g.Config.SampleRate) {
+		return nil, fmt.Errorf("%w: frame geometry %+v", ErrConfigMismatch, geometry)
+	}
+	return fp, nil
+}
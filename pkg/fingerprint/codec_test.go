@@ -0,0 +1,258 @@
+package fingerprint
+
+import (
+	"errors"
+	"hash/crc32"
+	"math"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/internal/bincodec"
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+)
+
+func TestFingerprintRoundTrip(t *testing.T) {
+	// Two seconds of alternating tones
+	sampleRate := 22050
+	samples := make([]float64, 2*sampleRate)
+	for i := range samples {
+		freq := 440.0
+		if (i/(sampleRate/4))%2 == 1 {
+			freq = 1320.0
+		}
+		samples[i] = 0.5 * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate))
+	}
+	data := &audio.AudioData{Samples: samples, SampleRate: sampleRate, Channels: 1, Duration: 2}
+
+	generator := NewGenerator(DefaultConfig())
+	fp, err := generator.Fingerprint(data, "track-1")
+	if err != nil {
+		t.Fatalf("Failed to fingerprint: %v", err)
+	}
+	if len(fp.Peaks) == 0 || len(fp.Hashes) == 0 || len(fp.Vectors) == 0 {
+		t.Fatalf("Expected peaks, hashes and vectors, got %d, %d, %d", len(fp.Peaks), len(fp.Hashes), len(fp.Vectors))
+	}
+
+	encoded, err := generator.MarshalFingerprint(fp, sampleRate)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	decoded, err := generator.UnmarshalFingerprint(encoded)
+	if err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+
+	if decoded.TrackID != fp.TrackID || decoded.Duration != fp.Duration {
+		t.Errorf("Header mismatch: got %q/%f, want %q/%f", decoded.TrackID, decoded.Duration, fp.TrackID, fp.Duration)
+	}
+
+	if len(decoded.Peaks) != len(fp.Peaks) {
+		t.Fatalf("Expected %d peaks, got %d", len(fp.Peaks), len(decoded.Peaks))
+	}
+	for i, peak := range fp.Peaks {
+		got := decoded.Peaks[i]
+		if got.TimeIndex != peak.TimeIndex || got.FreqIndex != peak.FreqIndex ||
+			got.Time != peak.Time || got.Frequency != peak.Frequency ||
+			got.Amplitude != float64(float32(peak.Amplitude)) {
+			t.Fatalf("Peak %d: got %+v, want %+v", i, got, peak)
+		}
+	}
+
+	if len(decoded.Hashes) != len(fp.Hashes) {
+		t.Fatalf("Expected %d hashes, got %d", len(fp.Hashes), len(decoded.Hashes))
+	}
+	for i, hash := range fp.Hashes {
+		got := decoded.Hashes[i]
+		if got.Value != hash.Value || got.Time != hash.Time || got.Frequency != hash.Frequency ||
+			math.Abs(got.Span-hash.Span) > 1e-9 || got.TrackID != hash.TrackID {
+			t.Fatalf("Hash %d: got %+v, want %+v", i, got, hash)
+		}
+	}
+
+	if len(decoded.Vectors) != len(fp.Vectors) {
+		t.Fatalf("Expected %d vectors, got %d", len(fp.Vectors), len(decoded.Vectors))
+	}
+	for i, vector := range fp.Vectors {
+		got := decoded.Vectors[i]
+		if math.Abs(got.TimeRef-vector.TimeRef) > 1e-6 || got.TrackID != vector.TrackID {
+			t.Fatalf("Vector %d: got time %f, want %f", i, got.TimeRef, vector.TimeRef)
+		}
+		for j := range vector.Data {
+			if got.Data[j] != vector.Data[j] {
+				t.Fatalf("Vector %d component %d: got %f, want %f", i, j, got.Data[j], vector.Data[j])
+			}
+		}
+	}
+}
+
+func TestFingerprintRejectsMismatches(t *testing.T) {
+	generator := NewGenerator(DefaultConfig())
+	fp := &Fingerprint{
+		TrackID: "track-1",
+		Peaks:   []Peak{{TimeIndex: 3, FreqIndex: 10, Amplitude: 0.5}},
+	}
+	encoded, err := generator.MarshalFingerprint(fp, 44100)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+
+	// A different hash mode produces incompatible hashes
+	other := NewGenerator(DefaultConfig())
+	other.Hasher.Mode = HashTriplets
+	if _, err := other.UnmarshalFingerprint(encoded); !errors.Is(err, ErrConfigMismatch) {
+		t.Errorf("Expected config mismatch, got %v", err)
+	}
+
+	// Fingerprints analyzed at another sample rate have other bins and frames
+	geometry := generator.Geometry(44100)
+	if geometry.SampleRate != 22050 {
+		t.Errorf("Expected the analysis rate 22050, got %d", geometry.SampleRate)
+	}
+	geometry.SampleRate = 44100
+	resampled, err := Marshal(fp, generator.ConfigHash(), geometry)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	if _, err := generator.UnmarshalFingerprint(resampled); !errors.Is(err, ErrConfigMismatch) {
+		t.Errorf("Expected config mismatch for another sample rate, got %v", err)
+	}
+
+	// Unknown format versions are refused
+	future := append([]byte(nil), encoded...)
+	future[4] = FormatVersion + 1
+	if _, err := generator.UnmarshalFingerprint(future); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected unsupported version, got %v", err)
+	}
+
+	// Corruption is detected by the checksum
+	corrupted := append([]byte(nil), encoded...)
+	corrupted[len(corrupted)-6] ^= 0xff
+	if _, err := generator.UnmarshalFingerprint(corrupted); err == nil {
+		t.Error("Expected an error for corrupted data")
+	}
+
+	// Truncated data never decodes
+	for n := 0; n < len(encoded); n++ {
+		if _, err := generator.UnmarshalFingerprint(encoded[:n]); err == nil {
+			t.Fatalf("Expected an error for data truncated to %d bytes", n)
+		}
+	}
+}
+
+func TestFingerprintRejectsNegativeTimes(t *testing.T) {
+	generator := NewGenerator(DefaultConfig())
+	geometry := generator.Geometry(44100)
+
+	// encode writes a checksummed fingerprint with the given peak, hash and
+	// vector sections, which Marshal itself would refuse to produce
+	encode := func(sections func(w *bincodec.Encoder)) []byte {
+		w := &bincodec.Encoder{}
+		w.Write(formatMagic[:])
+		w.Byte(FormatVersion)
+		w.Uint64(generator.ConfigHash())
+		w.Uvarint(uint64(geometry.SampleRate))
+		w.Uvarint(uint64(geometry.WindowSize))
+		w.Uvarint(uint64(geometry.HopSize))
+		w.Float64(1)
+		w.Text("track-1")
+		sections(w)
+		w.Uint32(crc32.ChecksumIEEE(w.Bytes()))
+		return w.Bytes()
+	}
+
+	tests := map[string]func(w *bincodec.Encoder){
+		"peak frame": func(w *bincodec.Encoder) {
+			w.Uvarint(2)
+			w.Varint(3)
+			w.Uvarint(10)
+			w.Uint32(0)
+			w.Varint(-4)
+			w.Uvarint(10)
+			w.Uint32(0)
+			w.Uvarint(0)
+			w.Uvarint(0)
+			w.Uvarint(0)
+		},
+		"hash frame": func(w *bincodec.Encoder) {
+			w.Uvarint(0)
+			w.Uvarint(1)
+			w.Uint32(7)
+			w.Varint(-1)
+			w.Uvarint(10)
+			w.Uvarint(2)
+			w.Uvarint(0)
+			w.Uvarint(0)
+		},
+		"hash span": func(w *bincodec.Encoder) {
+			w.Uvarint(0)
+			w.Uvarint(1)
+			w.Uint32(7)
+			w.Varint(5)
+			w.Uvarint(10)
+			w.Uvarint(math.MaxUint64)
+			w.Uvarint(0)
+			w.Uvarint(0)
+		},
+		"vector time": func(w *bincodec.Encoder) {
+			w.Uvarint(0)
+			w.Uvarint(0)
+			w.Uvarint(1)
+			w.Uvarint(1)
+			w.Varint(-1000)
+			w.Uint32(0)
+		},
+	}
+	for name, sections := range tests {
+		if fp, err := generator.UnmarshalFingerprint(encode(sections)); err == nil {
+			t.Errorf("%s: expected a negative value to fail decoding, got %+v", name, fp)
+		}
+	}
+
+	// The same layout with non-negative values decodes
+	valid := encode(func(w *bincodec.Encoder) {
+		w.Uvarint(0)
+		w.Uvarint(1)
+		w.Uint32(7)
+		w.Varint(5)
+		w.Uvarint(10)
+		w.Uvarint(2)
+		w.Uvarint(1)
+		w.Uvarint(1)
+		w.Varint(1000)
+		w.Uint32(0)
+	})
+	if _, err := generator.UnmarshalFingerprint(valid); err != nil {
+		t.Errorf("Expected the valid layout to decode, got %v", err)
+	}
+}
+
+func TestConfigHashDescribesFilters(t *testing.T) {
+	hash := func(filter PeakFilter) uint64 {
+		generator := NewGenerator(DefaultConfig())
+		generator.Filter = filter
+		return generator.ConfigHash()
+	}
+
+	// Equal filters hash equally whether or not they are pointers
+	band := hash(&FrequencyBandFilter{MinFrequency: 100, MaxFrequency: 2000})
+	if other := hash(&FrequencyBandFilter{MinFrequency: 100, MaxFrequency: 2000}); other != band {
+		t.Error("Expected equal pointer filters to hash equally")
+	}
+	if other := hash(FrequencyBandFilter{MinFrequency: 100, MaxFrequency: 2000}); other != band {
+		t.Error("Expected a pointer filter to hash as its value")
+	}
+	pipeline := hash(NewFilterPipeline(&AmplitudeFilter{MinAmplitude: 0.2}, &BandQuotaFilter{BandEdges: []float64{0, 1000}, PeaksPerBand: 3}))
+	if other := hash(NewFilterPipeline(&AmplitudeFilter{MinAmplitude: 0.2}, &BandQuotaFilter{BandEdges: []float64{0, 1000}, PeaksPerBand: 3})); other != pipeline {
+		t.Error("Expected equal pipelines of pointer filters to hash equally")
+	}
+
+	// Different settings hash differently
+	if hash(&FrequencyBandFilter{MinFrequency: 100, MaxFrequency: 3000}) == band {
+		t.Error("Expected different bands to hash differently")
+	}
+	if hash(NewFilterPipeline(&AmplitudeFilter{MinAmplitude: 0.3}, &BandQuotaFilter{BandEdges: []float64{0, 1000}, PeaksPerBand: 3})) == pipeline {
+		t.Error("Expected different pipelines to hash differently")
+	}
+	if hash(nil) != hash((*AmplitudeFilter)(nil)) {
+		t.Error("Expected a nil pointer filter to hash as no filter")
+	}
+}
@@ -0,0 +1,96 @@
+package fingerprint
+
+// MaxFilter2D computes the maximum of every (2*timeRadius+1) x (2*freqRadius+1)
+// neighborhood of data, clipped at the edges. The filter is separable, so it
+// runs as two 1D sliding-window passes in O(T*F) regardless of the radii.
+func MaxFilter2D(data [][]float64, timeRadius, freqRadius int) [][]float64 {
+	if len(data) == 0 {
+		return nil
+	}
+
+	// Filter along frequency within each frame
+	result := make([][]float64, len(data))
+	for t, frame := range data {
+		result[t] = make([]float64, len(frame))
+		slidingMax(frame, result[t], freqRadius)
+	}
+
+	// Filter along time within each frequency bin
+	numBins := len(data[0])
+	column := make([]float64, len(data))
+	filtered := make([]float64, len(data))
+	for f := 0; f < numBins; f++ {
+		for t := range result {
+			column[t] = result[t][f]
+		}
+		slidingMax(column, filtered, timeRadius)
+		for t := range result {
+			result[t][f] = filtered[t]
+		}
+	}
+
+	return result
+}
+
+// BoxMean2D computes the mean of every (2*timeRadius+1) x (2*freqRadius+1)
+// neighborhood of data, averaging only the cells inside the bounds
+func BoxMean2D(data [][]float64, timeRadius, freqRadius int) [][]float64 {
+	if len(data) == 0 {
+		return nil
+	}
+
+	numFrames := len(data)
+	numBins := len(data[0])
+
+	// Summed-area table with a zero row and column
+	sums := make([][]float64, numFrames+1)
+	sums[0] = make([]float64, numBins+1)
+	for t := 0; t < numFrames; t++ {
+		sums[t+1] = make([]float64, numBins+1)
+		for f := 0; f < numBins; f++ {
+			sums[t+1][f+1] = data[t][f] + sums[t][f+1] + sums[t+1][f] - sums[t][f]
+		}
+	}
+
+	result := make([][]float64, numFrames)
+	for t := 0; t < numFrames; t++ {
+		result[t] = make([]float64, numBins)
+		t0, t1 := max(0, t-timeRadius), min(numFrames, t+timeRadius+1)
+		for f := 0; f < numBins; f++ {
+			f0, f1 := max(0, f-freqRadius), min(numBins, f+freqRadius+1)
+			total := sums[t1][f1] - sums[t0][f1] - sums[t1][f0] + sums[t0][f0]
+			result[t][f] = total / float64((t1-t0)*(f1-f0))
+		}
+	}
+
+	return result
+}
+
+// slidingMax writes the maximum of input[i-radius..i+radius] to output[i]
+// using a monotonic deque of indices
+func slidingMax(input, output []float64, radius int) {
+	n := len(input)
+	if radius <= 0 {
+		copy(output, input)
+		return
+	}
+
+	deque := make([]int, 0, 2*radius+1)
+	next := 0
+	for i := 0; i < n; i++ {
+		// Admit everything up to the right edge of the window
+		for ; next < n && next <= i+radius; next++ {
+			for len(deque) > 0 && input[deque[len(deque)-1]] <= input[next] {
+				deque = deque[:len(deque)-1]
+			}
+			deque = append(deque, next)
+		}
+
+		// Drop indices left of the window
+		for deque[0] < i-radius {
+			deque = deque[1:]
+		}
+
+		output[i] = input[deque[0]]
+	}
+}
@@ -0,0 +1,108 @@
+package fingerprint
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// randomMatrix returns a frames x bins matrix of uniform values in [0, 1)
+func randomMatrix(frames, bins int, seed int64) [][]float64 {
+	rng := rand.New(rand.NewSource(seed))
+	data := make([][]float64, frames)
+	for t := range data {
+		data[t] = make([]float64, bins)
+		for f := range data[t] {
+			data[t][f] = rng.Float64()
+		}
+	}
+	return data
+}
+
+// bruteForce applies reduce to every clipped neighborhood of data
+func bruteForce(data [][]float64, timeRadius, freqRadius int, reduce func([]float64) float64) [][]float64 {
+	result := make([][]float64, len(data))
+	for t := range data {
+		result[t] = make([]float64, len(data[t]))
+		for f := range data[t] {
+			var cells []float64
+			for dt := -timeRadius; dt <= timeRadius; dt++ {
+				for df := -freqRadius; df <= freqRadius; df++ {
+					if t+dt >= 0 && t+dt < len(data) && f+df >= 0 && f+df < len(data[t]) {
+						cells = append(cells, data[t+dt][f+df])
+					}
+				}
+			}
+			result[t][f] = reduce(cells)
+		}
+	}
+	return result
+}
+
+func TestMaxFilter2D(t *testing.T) {
+	data := randomMatrix(37, 23, 1)
+	maximum := func(cells []float64) float64 {
+		best := math.Inf(-1)
+		for _, cell := range cells {
+			best = math.Max(best, cell)
+		}
+		return best
+	}
+
+	for _, radii := range [][2]int{{0, 0}, {1, 1}, {3, 2}, {0, 5}, {50, 50}} {
+		want := bruteForce(data, radii[0], radii[1], maximum)
+		got := MaxFilter2D(data, radii[0], radii[1])
+		for frame := range want {
+			for f := range want[frame] {
+				if got[frame][f] != want[frame][f] {
+					t.Fatalf("Radii %v: expected %f at (%d, %d), got %f", radii, want[frame][f], frame, f, got[frame][f])
+				}
+			}
+		}
+	}
+
+	if MaxFilter2D(nil, 1, 1) != nil {
+		t.Error("Expected nil for empty input")
+	}
+}
+
+func TestBoxMean2D(t *testing.T) {
+	data := randomMatrix(29, 17, 2)
+	mean := func(cells []float64) float64 {
+		sum := 0.0
+		for _, cell := range cells {
+			sum += cell
+		}
+		return sum / float64(len(cells))
+	}
+
+	for _, radii := range [][2]int{{0, 0}, {2, 1}, {10, 10}} {
+		want := bruteForce(data, radii[0], radii[1], mean)
+		got := BoxMean2D(data, radii[0], radii[1])
+		for frame := range want {
+			for f := range want[frame] {
+				if math.Abs(got[frame][f]-want[frame][f]) > 1e-9 {
+					t.Fatalf("Radii %v: expected %f at (%d, %d), got %f", radii, want[frame][f], frame, f, got[frame][f])
+				}
+			}
+		}
+	}
+}
+
+func TestSlidingMax(t *testing.T) {
+	input := []float64{1, 3, 2, 5, 4, 0, 0, 0, 6}
+	for radius, want := range [][]float64{
+		{1, 3, 2, 5, 4, 0, 0, 0, 6},
+		{3, 3, 5, 5, 5, 4, 0, 6, 6},
+		{3, 5, 5, 5, 5, 5, 6, 6, 6},
+	} {
+		got := make([]float64, len(input))
+		slidingMax(input, got, radius)
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Radius %d: expected %v, got %v", radius, want, got)
+				break
+			}
+		}
+	}
+}
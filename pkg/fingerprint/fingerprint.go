@@ -6,9 +6,11 @@ import (
 
 // Peak represents a spectral peak in time-frequency domain
 type Peak struct {
-	Frequency float64
-	Time      float64
-	Amplitude float64
+	TimeIndex int     // Index of the time bin
+	FreqIndex int     // Index of the frequency bin
+	Time      float64 // Time position in seconds
+	Frequency float64 // Frequency in Hz
+	Amplitude float64 // Amplitude/energy of the peak
 }
 
 // Vector represents a fingerprint vector in high-dimensional space
@@ -18,6 +20,16 @@ type Vector struct {
 	TrackID string    // Associated track identifier
 }
 
+// Fingerprint bundles everything generated for one piece of audio
+type Fingerprint struct {
+	TrackID  string
+	Duration float64        // Duration of the fingerprinted audio in seconds
+	Peaks    []Peak         // Spectral peaks in time order
+	Vectors  []*Vector      // Fingerprint vectors
+	Hashes   []Hash         // Landmark hashes
+	Quality  *QualityReport // Set by GeneratorImpl.Fingerprint
+}
+
 // Generator handles creation of fingerprint vectors from audio
 type Generator interface {
 	// ExtractPeaks finds significant peaks in spectrogram
@@ -36,4 +48,18 @@ type Config struct {
 	PeakThreshold float64 // Minimum amplitude for peak detection
 	NeighborSize  int     // Size of neighborhood for peak finding
 	VectorsPerSec float64 // Number of vectors to generate per second
+	VectorWindow  float64 // Duration of audio summarized by each vector (seconds)
+	SampleRate    int     // Analysis sample rate in Hz; 0 analyzes audio at its own rate
+}
+
+// DefaultConfig returns the default fingerprint generation parameters
+func DefaultConfig() Config {
+	return Config{
+		VectorDim:     64,
+		PeakThreshold: 0.1,
+		NeighborSize:  3,
+		VectorsPerSec: 4,
+		VectorWindow:  1.0,
+		SampleRate:    22050,
+	}
 }
@@ -0,0 +1,243 @@
+package fingerprint
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+)
+
+// GeneratorImpl implements the Generator interface. It computes a
+// spectrogram with SpectralAnalyzerImpl, picks peaks with PeakExtractor and
+// summarizes the peaks of each VectorWindow into a VectorDim-dimensional
+// vector of band energies on a logarithmic frequency scale.
+type GeneratorImpl struct {
+	Config    Config
+	Analyzer  *audio.SpectralAnalyzerImpl
+	Extractor *PeakExtractor
+	Processor *audio.PCMProcessor
+	Hasher    *Hasher
+	Filter    PeakFilter // Applied to the extracted peaks before vectors are built
+
+	QualityConfig QualityConfig // Thresholds of the quality report
+}
+
+// NewGenerator creates a new generator with the given configuration
+func NewGenerator(config Config) *GeneratorImpl {
+	return &GeneratorImpl{
+		Config:    config,
+		Analyzer:  audio.NewSpectralAnalyzer(),
+		Extractor: NewPeakExtractor(),
+		Processor: audio.NewPCMProcessor(),
+		Hasher:    NewHasher(),
+
+		QualityConfig: DefaultQualityConfig(),
+	}
+}
+
+// ExtractPeaks finds significant peaks in spectrogram. Config.PeakThreshold
+// and Config.NeighborSize override the extractor's threshold and neighborhood,
+// and Filter runs after the extractor's own filter.
+func (g *GeneratorImpl) ExtractPeaks(spec *audio.Spectrogram) ([]Peak, error) {
+	extractor := *g.Extractor
+	extractor.AbsoluteThreshold = g.Config.PeakThreshold
+	if g.Config.NeighborSize > 0 {
+		extractor.NeighborhoodSize = g.Config.NeighborSize
+	}
+
+	peaks, err := extractor.ExtractPeaks(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	return extractor.FilterPeaks(peaks, g.Filter), nil
+}
+
+// GenerateVector creates fingerprint vector from peaks. Each component holds
+// the summed amplitude of the peaks falling in one log-spaced frequency band
+// between the extractor's MinFrequency and MaxFrequency; the vector is
+// L2-normalized. TimeRef is set to the earliest peak.
+func (g *GeneratorImpl) GenerateVector(peaks []Peak) (*Vector, error) {
+	if g.Config.VectorDim <= 0 {
+		return nil, fmt.Errorf("vector dimension must be positive, got %d", g.Config.VectorDim)
+	}
+	if len(peaks) == 0 {
+		return nil, fmt.Errorf("cannot generate a vector without peaks")
+	}
+
+	data := make([]float32, g.Config.VectorDim)
+	timeRef := peaks[0].Time
+	for _, peak := range peaks {
+		data[g.band(peak.Frequency)] += float32(peak.Amplitude)
+		timeRef = math.Min(timeRef, peak.Time)
+	}
+
+	// L2-normalize so vectors compare by shape rather than loudness
+	norm := 0.0
+	for _, val := range data {
+		norm += float64(val) * float64(val)
+	}
+	if norm > 0 {
+		scale := float32(1 / math.Sqrt(norm))
+		for i := range data {
+			data[i] *= scale
+		}
+	}
+
+	return &Vector{
+		Data:    data,
+		TimeRef: timeRef,
+	}, nil
+}
+
+// Process handles complete fingerprint generation from audio
+func (g *GeneratorImpl) Process(data *audio.AudioData) ([]*Vector, error) {
+	return g.ProcessTrack(data, "")
+}
+
+// ProcessTrack generates fingerprint vectors for a track, emitting
+// VectorsPerSec vectors per second each stamped with its window start time and
+// trackID. Windows without any peaks (e.g. silence) produce no vector.
+func (g *GeneratorImpl) ProcessTrack(data *audio.AudioData, trackID string) ([]*Vector, error) {
+	_, vectors, err := g.peaksAndVectors(data, trackID)
+	return vectors, err
+}
+
+// peaksAndVectors extracts the peaks of a track and the vectors built from
+// them, the steps shared by ProcessTrack and Fingerprint
+func (g *GeneratorImpl) peaksAndVectors(data *audio.AudioData, trackID string) ([]Peak, []*Vector, error) {
+	if g.Config.VectorsPerSec <= 0 {
+		return nil, nil, fmt.Errorf("vectors per second must be positive, got %f", g.Config.VectorsPerSec)
+	}
+	if g.Config.VectorWindow <= 0 {
+		return nil, nil, fmt.Errorf("vector window must be positive, got %f", g.Config.VectorWindow)
+	}
+
+	spec, err := g.ComputeSpectrogram(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	peaks, err := g.ExtractPeaks(spec)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to extract peaks: %w", err)
+	}
+
+	vectors, err := g.vectorsFromPeaks(peaks, spec.TimePoints[len(spec.TimePoints)-1], trackID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return peaks, vectors, nil
+}
+
+// Fingerprint computes peaks, vectors, hashes and a quality report for a
+// track from a single spectrogram
+func (g *GeneratorImpl) Fingerprint(data *audio.AudioData, trackID string) (*Fingerprint, error) {
+	peaks, vectors, err := g.peaksAndVectors(data, trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes, err := g.Hasher.Hashes(peaks, trackID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash peaks: %w", err)
+	}
+
+	fp := &Fingerprint{
+		TrackID:  trackID,
+		Duration: audioDuration(data),
+		Peaks:    peaks,
+		Vectors:  vectors,
+		Hashes:   hashes,
+	}
+	if fp.Quality, err = g.QualityReport(data, fp); err != nil {
+		return nil, fmt.Errorf("failed to assess fingerprint quality: %w", err)
+	}
+
+	return fp, nil
+}
+
+// ComputeSpectrogram converts audio to the spectrogram used for peak picking,
+// downmixing stereo input and resampling it to Config.SampleRate first
+func (g *GeneratorImpl) ComputeSpectrogram(data *audio.AudioData) (*audio.Spectrogram, error) {
+	if data == nil || len(data.Samples) == 0 {
+		return nil, fmt.Errorf("invalid audio data")
+	}
+
+	// Spectral analysis requires mono audio
+	if data.Channels != 1 {
+		mono, err := g.Processor.ConvertToMono(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert to mono: %w", err)
+		}
+		data = mono
+	}
+	if g.Config.SampleRate > 0 {
+		resampled, err := g.Processor.ResampleTo(data, g.Config.SampleRate)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resample: %w", err)
+		}
+		data = resampled
+	}
+
+	spec, err := g.Analyzer.ComputeSpectrogram(data, g.Analyzer.WindowSize, g.Analyzer.HopSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute spectrogram: %w", err)
+	}
+
+	return spec, nil
+}
+
+// vectorsFromPeaks slides a VectorWindow over time-ordered peaks
+func (g *GeneratorImpl) vectorsFromPeaks(peaks []Peak, endTime float64, trackID string) ([]*Vector, error) {
+	step := 1 / g.Config.VectorsPerSec
+	window := g.Config.VectorWindow
+
+	var vectors []*Vector
+	first := 0
+	for i := 0; ; i++ {
+		start := float64(i) * step
+		// Always emit the first window, even for clips shorter than VectorWindow
+		if i > 0 && start+window > endTime {
+			break
+		}
+
+		// Skip peaks before the window
+		for first < len(peaks) && peaks[first].Time < start {
+			first++
+		}
+		last := first
+		for last < len(peaks) && peaks[last].Time < start+window {
+			last++
+		}
+		if last == first {
+			continue
+		}
+
+		vector, err := g.GenerateVector(peaks[first:last])
+		if err != nil {
+			return nil, err
+		}
+		vector.TimeRef = start
+		vector.TrackID = trackID
+		vectors = append(vectors, vector)
+	}
+
+	return vectors, nil
+}
+
+// band maps a frequency to its vector component using log-spaced bands
+func (g *GeneratorImpl) band(frequency float64) int {
+	minFreq := math.Max(g.Extractor.MinFrequency, 1)
+	maxFreq := math.Max(g.Extractor.MaxFrequency, minFreq*2)
+
+	position := math.Log(math.Max(frequency, minFreq)/minFreq) / math.Log(maxFreq/minFreq)
+	index := int(position * float64(g.Config.VectorDim))
+	if index < 0 {
+		index = 0
+	}
+	if index >= g.Config.VectorDim {
+		index = g.Config.VectorDim - 1
+	}
+	return index
+}
@@ -0,0 +1,147 @@
+package fingerprint
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+)
+
+// createChords renders major triads on roots at 22050 Hz, one every
+// chordLength seconds, cycling through roots until duration is filled
+func createChords(duration, chordLength float64, roots []float64) *audio.AudioData {
+	const sampleRate = 22050
+	samples := make([]float64, int(duration*sampleRate))
+	for i := range samples {
+		t := float64(i) / sampleRate
+		root := roots[int(t/chordLength)%len(roots)]
+		for _, interval := range []float64{0, 4, 7} {
+			samples[i] += 0.8 / 3 * math.Sin(2*math.Pi*root*math.Pow(2, interval/12)*t)
+		}
+	}
+	return &audio.AudioData{Samples: samples, SampleRate: sampleRate, Channels: 1, Duration: duration}
+}
+
+func TestGenerateVector(t *testing.T) {
+	g := NewGenerator(DefaultConfig())
+	peaks := []Peak{
+		{Time: 0.5, Frequency: g.Extractor.MinFrequency, Amplitude: 3},
+		{Time: 0.2, Frequency: g.Extractor.MaxFrequency, Amplitude: 4},
+	}
+
+	vector, err := g.GenerateVector(peaks)
+	if err != nil {
+		t.Fatalf("Failed to generate vector: %v", err)
+	}
+	if len(vector.Data) != g.Config.VectorDim {
+		t.Fatalf("Expected %d components, got %d", g.Config.VectorDim, len(vector.Data))
+	}
+	if vector.TimeRef != 0.2 {
+		t.Errorf("Expected TimeRef of the earliest peak 0.2, got %f", vector.TimeRef)
+	}
+
+	// The band energies 3 and 4 are normalized to 0.6 and 0.8
+	first, last := vector.Data[0], vector.Data[len(vector.Data)-1]
+	if math.Abs(float64(first)-0.6) > 1e-6 || math.Abs(float64(last)-0.8) > 1e-6 {
+		t.Errorf("Expected the outer bands to hold 0.6 and 0.8, got %f and %f", first, last)
+	}
+
+	if _, err := g.GenerateVector(nil); err == nil {
+		t.Error("Expected an error without peaks")
+	}
+	g.Config.VectorDim = 0
+	if _, err := g.GenerateVector(peaks); err == nil {
+		t.Error("Expected an error for a zero dimension")
+	}
+}
+
+func TestProcessTrack(t *testing.T) {
+	chords := createChords(4, 0.5, []float64{220, 262, 196, 294})
+
+	config := DefaultConfig()
+	config.VectorDim = 32
+	config.VectorsPerSec = 8
+	config.VectorWindow = 0.5
+	g := NewGenerator(config)
+
+	vectors, err := g.ProcessTrack(chords, "track-1")
+	if err != nil {
+		t.Fatalf("Failed to process track: %v", err)
+	}
+
+	// One vector every 1/VectorsPerSec seconds while a whole window fits
+	spec, err := g.ComputeSpectrogram(chords)
+	if err != nil {
+		t.Fatalf("Failed to compute spectrogram: %v", err)
+	}
+	endTime := spec.TimePoints[len(spec.TimePoints)-1]
+	expected := int(math.Floor((endTime-config.VectorWindow)*config.VectorsPerSec)) + 1
+	if len(vectors) != expected {
+		t.Fatalf("Expected %d vectors for %.2f seconds, got %d", expected, endTime, len(vectors))
+	}
+	for i, vector := range vectors {
+		if len(vector.Data) != config.VectorDim {
+			t.Errorf("Vector %d: expected %d components, got %d", i, config.VectorDim, len(vector.Data))
+		}
+		if vector.TrackID != "track-1" {
+			t.Errorf("Vector %d: expected track ID track-1, got %q", i, vector.TrackID)
+		}
+		if want := float64(i) / config.VectorsPerSec; math.Abs(vector.TimeRef-want) > 1e-9 {
+			t.Errorf("Vector %d: expected TimeRef %f, got %f", i, want, vector.TimeRef)
+		}
+		norm := 0.0
+		for _, val := range vector.Data {
+			norm += float64(val) * float64(val)
+		}
+		if math.Abs(norm-1) > 1e-5 {
+			t.Errorf("Vector %d: expected unit norm, got %f", i, math.Sqrt(norm))
+		}
+	}
+
+	// Fingerprint builds the same vectors
+	fp, err := g.Fingerprint(chords, "track-1")
+	if err != nil {
+		t.Fatalf("Failed to fingerprint: %v", err)
+	}
+	if !reflect.DeepEqual(fp.Vectors, vectors) {
+		t.Errorf("Expected Fingerprint to return the %d vectors of ProcessTrack, got %d", len(vectors), len(fp.Vectors))
+	}
+
+	// Process leaves the track ID empty
+	unnamed, err := g.Process(chords)
+	if err != nil {
+		t.Fatalf("Failed to process: %v", err)
+	}
+	if len(unnamed) != len(vectors) || unnamed[0].TrackID != "" {
+		t.Errorf("Expected %d vectors without a track ID, got %d", len(vectors), len(unnamed))
+	}
+}
+
+func TestProcessTrackSkipsSilence(t *testing.T) {
+	// Two seconds of chords followed by two of silence
+	data := createChords(4, 0.5, []float64{220, 262})
+	for i := len(data.Samples) / 2; i < len(data.Samples); i++ {
+		data.Samples[i] = 0
+	}
+
+	config := DefaultConfig()
+	config.VectorWindow = 0.5
+	vectors, err := NewGenerator(config).ProcessTrack(data, "track")
+	if err != nil {
+		t.Fatalf("Failed to process track: %v", err)
+	}
+	if len(vectors) == 0 {
+		t.Fatal("Expected vectors for the chords")
+	}
+	for _, vector := range vectors {
+		if vector.TimeRef >= 2 {
+			t.Errorf("Expected no vector in the silence, got one at %.2f seconds", vector.TimeRef)
+		}
+	}
+
+	config.VectorsPerSec = 0
+	if _, err := NewGenerator(config).ProcessTrack(data, "track"); err == nil {
+		t.Error("Expected an error for zero vectors per second")
+	}
+}
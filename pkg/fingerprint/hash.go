@@ -0,0 +1,203 @@
+package fingerprint
+
+import (
+	"fmt"
+	"math"
+)
+
+// HashMode selects how peaks are combined into hashes
+type HashMode string
+
+const (
+	// HashPairs combines an anchor peak with each target peak into a
+	// (f1, f2, Δt) landmark. Exact, but breaks under speed or pitch changes.
+	HashPairs HashMode = "pairs"
+	// HashTriplets combines three peaks into a hash of their log-frequency
+	// differences and time ratio (as in Panako), which is invariant to
+	// time-scaling and pitch-shifting.
+	HashTriplets HashMode = "triplets"
+)
+
+// ParseHashMode converts a string such as "triplets" into a HashMode
+func ParseHashMode(name string) (HashMode, error) {
+	switch mode := HashMode(name); mode {
+	case HashPairs, HashTriplets:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unsupported hash mode: %s", name)
+}
+
+// tripletFlag marks triplet hash values so they never collide with pair hashes
+const tripletFlag = 1 << 31
+
+// Hash is a landmark hash together with the anchor information needed to
+// align matches in time and estimate speed and pitch changes
+type Hash struct {
+	Value     uint32  // Quantized hash value
+	Time      float64 // Anchor peak time in seconds
+	Frequency float64 // Anchor peak frequency in Hz
+	Span      float64 // Time between the first and last peak of the hash in seconds
+	TrackID   string  // Associated track identifier
+}
+
+// Hasher combines peaks into landmark hashes
+type Hasher struct {
+	// Configuration parameters
+	Mode            HashMode // Pair or triplet hashing
+	FanOut          int      // Number of target peaks considered per anchor
+	MinTimeDelta    float64  // Start of the target zone after the anchor (seconds)
+	MaxTimeDelta    float64  // End of the target zone after the anchor (seconds)
+	FreqRatioStep   float64  // Triplet log-frequency quantization step in semitones
+	TimeRatioLevels int      // Number of triplet time-ratio quantization levels (max 64)
+}
+
+// NewHasher creates a new pair hasher with default settings
+func NewHasher() *Hasher {
+	return &Hasher{
+		Mode:            HashPairs,
+		FanOut:          5,
+		MinTimeDelta:    0.02,
+		MaxTimeDelta:    2.0,
+		FreqRatioStep:   2.0,
+		TimeRatioLevels: 16,
+	}
+}
+
+// Landmark is a hash value together with the peaks it was computed from
+type Landmark struct {
+	Value uint32
+	Peaks []Peak // Anchor first, then the target peaks in time order
+}
+
+// Hashes combines time-ordered peaks into hashes stamped with trackID
+func (h *Hasher) Hashes(peaks []Peak, trackID string) ([]Hash, error) {
+	landmarks, err := h.Landmarks(peaks)
+	if err != nil {
+		return nil, err
+	}
+
+	hashes := make([]Hash, len(landmarks))
+	for i, landmark := range landmarks {
+		anchor, last := landmark.Peaks[0], landmark.Peaks[len(landmark.Peaks)-1]
+		hashes[i] = Hash{
+			Value:     landmark.Value,
+			Time:      anchor.Time,
+			Frequency: anchor.Frequency,
+			Span:      last.Time - anchor.Time,
+			TrackID:   trackID,
+		}
+	}
+	return hashes, nil
+}
+
+// Landmarks combines time-ordered peaks into hash values, keeping the peaks
+// each value was computed from (e.g. for visualization)
+func (h *Hasher) Landmarks(peaks []Peak) ([]Landmark, error) {
+	if h.FanOut <= 0 {
+		return nil, fmt.Errorf("fan-out must be positive, got %d", h.FanOut)
+	}
+	if h.MaxTimeDelta <= h.MinTimeDelta {
+		return nil, fmt.Errorf("invalid target zone: %f - %f seconds", h.MinTimeDelta, h.MaxTimeDelta)
+	}
+
+	switch h.Mode {
+	case HashPairs, "":
+		return h.pairLandmarks(peaks), nil
+	case HashTriplets:
+		if h.FreqRatioStep <= 0 {
+			return nil, fmt.Errorf("frequency ratio step must be positive, got %f", h.FreqRatioStep)
+		}
+		if h.TimeRatioLevels <= 0 || h.TimeRatioLevels > 64 {
+			return nil, fmt.Errorf("time ratio levels must be in [1, 64], got %d", h.TimeRatioLevels)
+		}
+		return h.tripletLandmarks(peaks), nil
+	default:
+		return nil, fmt.Errorf("unsupported hash mode: %s", h.Mode)
+	}
+}
+
+// pairLandmarks packs (anchor bin, target bin, frame delta) as 9+10+12 bits,
+// leaving bit 31 to tripletFlag. Pairs whose bins or delta do not fit are
+// skipped rather than clamped, so distinct pairs never share a value and a
+// few high peaks do not fail the whole track.
+func (h *Hasher) pairLandmarks(peaks []Peak) []Landmark {
+	var landmarks []Landmark
+	for i, anchor := range peaks {
+		if anchor.FreqIndex >= 1<<9 {
+			continue
+		}
+		for _, target := range h.targets(peaks, i) {
+			deltaFrames := target.TimeIndex - anchor.TimeIndex
+			if target.FreqIndex >= 1<<10 || deltaFrames >= 1<<12 {
+				continue
+			}
+			value := uint32(anchor.FreqIndex)<<22 |
+				uint32(target.FreqIndex)<<12 |
+				uint32(deltaFrames)
+			landmarks = append(landmarks, Landmark{
+				Value: value,
+				Peaks: []Peak{anchor, target},
+			})
+		}
+	}
+	return landmarks
+}
+
+// tripletLandmarks packs the two log-frequency steps (8 bits each) and the
+// time ratio (6 bits) of every anchor/target/target triplet
+func (h *Hasher) tripletLandmarks(peaks []Peak) []Landmark {
+	var landmarks []Landmark
+	for i, first := range peaks {
+		if first.Frequency <= 0 {
+			continue
+		}
+		targets := h.targets(peaks, i)
+		for j, second := range targets {
+			for _, third := range targets[j+1:] {
+				if third.TimeIndex <= second.TimeIndex || second.Frequency <= 0 {
+					continue
+				}
+
+				// Frequency steps in semitones are unchanged by pitch shifts
+				step12 := h.quantizeInterval(second.Frequency / first.Frequency)
+				step23 := h.quantizeInterval(third.Frequency / second.Frequency)
+
+				// The relative position of the middle peak is unchanged by time-scaling
+				ratio := (second.Time - first.Time) / (third.Time - first.Time)
+				level := min(int(ratio*float64(h.TimeRatioLevels)), h.TimeRatioLevels-1)
+
+				landmarks = append(landmarks, Landmark{
+					Value: tripletFlag | step12<<14 | step23<<6 | uint32(level),
+					Peaks: []Peak{first, second, third},
+				})
+			}
+		}
+	}
+	return landmarks
+}
+
+// targets returns up to FanOut peaks in the anchor's target zone
+func (h *Hasher) targets(peaks []Peak, anchor int) []Peak {
+	var targets []Peak
+	for j := anchor + 1; j < len(peaks) && len(targets) < h.FanOut; j++ {
+		delta := peaks[j].Time - peaks[anchor].Time
+		if delta > h.MaxTimeDelta {
+			break
+		}
+		if delta < h.MinTimeDelta || peaks[j].TimeIndex == peaks[anchor].TimeIndex {
+			continue
+		}
+		targets = append(targets, peaks[j])
+	}
+	return targets
+}
+
+// quantizeInterval maps a frequency ratio to an unsigned 8-bit step count
+func (h *Hasher) quantizeInterval(ratio float64) uint32 {
+	if ratio <= 0 {
+		return 128
+	}
+	semitones := 12 * math.Log2(ratio)
+	steps := int(math.Round(semitones / h.FreqRatioStep))
+	return uint32(max(-128, min(127, steps)) + 128)
+}
@@ -0,0 +1,169 @@
+package fingerprint
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// createPeakSet draws n time-ordered peaks, one per frame of a 100 frames per
+// second spectrogram with 20 Hz bins, between 200 and 2000 Hz
+func createPeakSet(n int, seed int64) []Peak {
+	rng := rand.New(rand.NewSource(seed))
+	peaks := make([]Peak, n)
+	time := 0.0
+	for i := range peaks {
+		time += 0.1 + 0.3*rng.Float64()
+		frequency := 200 * math.Pow(10, rng.Float64())
+		peaks[i] = Peak{
+			TimeIndex: int(math.Round(time * 100)),
+			FreqIndex: int(math.Round(frequency / 20)),
+			Time:      time,
+			Frequency: frequency,
+			Amplitude: rng.Float64(),
+		}
+	}
+	return peaks
+}
+
+// transformPeaks plays peaks speed times as fast at pitch times the frequency
+func transformPeaks(peaks []Peak, speed, pitch float64) []Peak {
+	transformed := make([]Peak, len(peaks))
+	for i, peak := range peaks {
+		peak.Time /= speed
+		peak.TimeIndex = int(math.Round(peak.Time * 100))
+		peak.Frequency *= pitch
+		peak.FreqIndex = int(math.Round(peak.Frequency / 20))
+		transformed[i] = peak
+	}
+	return transformed
+}
+
+// hashValues counts the hashes of every value
+func hashValues(hashes []Hash) map[uint32]int {
+	values := make(map[uint32]int, len(hashes))
+	for _, hash := range hashes {
+		values[hash.Value]++
+	}
+	return values
+}
+
+func TestTripletHashesInvariant(t *testing.T) {
+	peaks := createPeakSet(40, 1)
+	// 3% faster and a semitone up
+	shifted := transformPeaks(peaks, 1.03, math.Pow(2, 1.0/12))
+
+	hasher := NewHasher()
+	hasher.Mode = HashTriplets
+	original, err := hasher.Hashes(peaks, "track")
+	if err != nil {
+		t.Fatalf("Failed to hash peaks: %v", err)
+	}
+	transformed, err := hasher.Hashes(shifted, "track")
+	if err != nil {
+		t.Fatalf("Failed to hash shifted peaks: %v", err)
+	}
+	if len(original) == 0 {
+		t.Fatal("Expected triplet hashes")
+	}
+	if len(transformed) != len(original) {
+		t.Fatalf("Expected %d hashes, got %d", len(original), len(transformed))
+	}
+
+	// Same values in the same order, with times, spans and frequencies
+	// scaled by the transform
+	for i := range original {
+		a, b := original[i], transformed[i]
+		if a.Value != b.Value {
+			t.Fatalf("Hash %d: expected value %08x, got %08x", i, a.Value, b.Value)
+		}
+		if a.Value&tripletFlag == 0 {
+			t.Errorf("Hash %d: expected the triplet flag in %08x", i, a.Value)
+		}
+		if math.Abs(b.Span*1.03-a.Span) > 1e-9 || math.Abs(b.Time*1.03-a.Time) > 1e-9 {
+			t.Errorf("Hash %d: expected time and span scaled by 1/1.03, got %f/%f and %f/%f", i, b.Time, a.Time, b.Span, a.Span)
+		}
+		if ratio := b.Frequency / a.Frequency; math.Abs(ratio-math.Pow(2, 1.0/12)) > 1e-9 {
+			t.Errorf("Hash %d: expected the anchor frequency a semitone up, got ratio %f", i, ratio)
+		}
+	}
+
+	// Pair hashes encode absolute bins and frame deltas, so they change
+	hasher.Mode = HashPairs
+	pairs, _ := hasher.Hashes(peaks, "track")
+	shiftedPairs, _ := hasher.Hashes(shifted, "track")
+	shared := 0
+	values := hashValues(pairs)
+	for value := range hashValues(shiftedPairs) {
+		if values[value] > 0 {
+			shared++
+		}
+	}
+	if shared > len(values)/2 {
+		t.Errorf("Expected most pair hashes to change, %d of %d are shared", shared, len(values))
+	}
+}
+
+func TestHasherValidation(t *testing.T) {
+	peaks := createPeakSet(10, 2)
+	for _, invalid := range []func(*Hasher){
+		func(h *Hasher) { h.FanOut = 0 },
+		func(h *Hasher) { h.MaxTimeDelta = h.MinTimeDelta },
+		func(h *Hasher) { h.Mode = "quads" },
+		func(h *Hasher) { h.Mode, h.FreqRatioStep = HashTriplets, 0 },
+		func(h *Hasher) { h.Mode, h.TimeRatioLevels = HashTriplets, 65 },
+	} {
+		hasher := NewHasher()
+		invalid(hasher)
+		if _, err := hasher.Hashes(peaks, "track"); err == nil {
+			t.Errorf("Expected an error for %+v", hasher)
+		}
+	}
+}
+
+func TestPairHashLimits(t *testing.T) {
+	pair := func(anchorBin, targetBin, deltaFrames int) []Peak {
+		return []Peak{
+			{TimeIndex: 0, FreqIndex: anchorBin, Time: 0},
+			{TimeIndex: deltaFrames, FreqIndex: targetBin, Time: 0.5},
+		}
+	}
+	hasher := NewHasher()
+
+	// The highest bins and delta that fit keep the triplet flag clear
+	hashes, err := hasher.Hashes(pair(511, 1023, 4095), "track")
+	if err != nil {
+		t.Fatalf("Failed to hash peaks: %v", err)
+	}
+	if len(hashes) != 1 || hashes[0].Value != 511<<22|1023<<12|4095 || hashes[0].Value&tripletFlag != 0 {
+		t.Errorf("Expected a pair hash of bins 511 and 1023 and delta 4095, got %+v", hashes)
+	}
+
+	// Larger ones are skipped rather than clamped into another value
+	for _, peaks := range [][]Peak{pair(512, 100, 10), pair(100, 1024, 10), pair(100, 100, 4096)} {
+		if hashes, err := hasher.Hashes(peaks, "track"); err != nil || len(hashes) != 0 {
+			t.Errorf("Expected bins %d and %d and delta %d to be skipped, got %+v, %v",
+				peaks[0].FreqIndex, peaks[1].FreqIndex, peaks[1].TimeIndex, hashes, err)
+		}
+	}
+
+	// without losing the pairs of the same track that fit
+	peaks := append(pair(600, 100, 10), Peak{TimeIndex: 20, FreqIndex: 100, Time: 0.8})
+	hashes, err = hasher.Hashes(peaks, "track")
+	if err != nil || len(hashes) != 1 || hashes[0].Value != 100<<22|100<<12|10 {
+		t.Errorf("Expected only the pair that fits, got %+v, %v", hashes, err)
+	}
+}
+
+func TestParseHashMode(t *testing.T) {
+	for _, mode := range []HashMode{HashPairs, HashTriplets} {
+		if parsed, err := ParseHashMode(string(mode)); err != nil || parsed != mode {
+			t.Errorf("Expected %s, got %s (err %v)", mode, parsed, err)
+		}
+	}
+	for _, name := range []string{"", "quads", "Pairs"} {
+		if _, err := ParseHashMode(name); err == nil {
+			t.Errorf("Expected an error for %q", name)
+		}
+	}
+}
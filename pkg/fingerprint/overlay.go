@@ -0,0 +1,72 @@
+package fingerprint
+
+import (
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+)
+
+// NewOverlay converts peaks to markers and landmarks to segments linking
+// their peaks, for rendering with audio.SpectrogramRenderer
+func NewOverlay(peaks []Peak, landmarks []Landmark) *audio.Overlay {
+	overlay := &audio.Overlay{
+		Markers: make([]audio.Point, len(peaks)),
+	}
+	for i, peak := range peaks {
+		overlay.Markers[i] = peakPoint(peak)
+	}
+	for _, landmark := range landmarks {
+		overlay.Segments = append(overlay.Segments, landmarkPoints(landmark))
+	}
+	return overlay
+}
+
+// MatchOverlays builds overlays for a query and a reference in which the
+// landmarks whose hash value occurs in both are highlighted, together with
+// their peaks
+func MatchOverlays(queryPeaks []Peak, query []Landmark, referencePeaks []Peak, reference []Landmark) (*audio.Overlay, *audio.Overlay) {
+	queryValues := make(map[uint32]bool, len(query))
+	for _, landmark := range query {
+		queryValues[landmark.Value] = true
+	}
+	referenceValues := make(map[uint32]bool, len(reference))
+	for _, landmark := range reference {
+		referenceValues[landmark.Value] = true
+	}
+
+	return highlightOverlay(queryPeaks, query, referenceValues), highlightOverlay(referencePeaks, reference, queryValues)
+}
+
+// highlightOverlay highlights the landmarks with a value in matched
+func highlightOverlay(peaks []Peak, landmarks []Landmark, matched map[uint32]bool) *audio.Overlay {
+	overlay := NewOverlay(peaks, nil)
+	highlighted := make(map[audio.Point]bool)
+	for _, landmark := range landmarks {
+		points := landmarkPoints(landmark)
+		if !matched[landmark.Value] {
+			overlay.Segments = append(overlay.Segments, points)
+			continue
+		}
+
+		overlay.HighlightedLinks = append(overlay.HighlightedLinks, points)
+		for _, point := range points {
+			if !highlighted[point] {
+				highlighted[point] = true
+				overlay.HighlightedMarkers = append(overlay.HighlightedMarkers, point)
+			}
+		}
+	}
+	return overlay
+}
+
+// peakPoint returns the position of a peak
+func peakPoint(peak Peak) audio.Point {
+	return audio.Point{Time: peak.Time, Frequency: peak.Frequency}
+}
+
+// landmarkPoints returns the positions of a landmark's peaks
+func landmarkPoints(landmark Landmark) []audio.Point {
+	points := make([]audio.Point, len(landmark.Peaks))
+	for i, peak := range landmark.Peaks {
+		points[i] = peakPoint(peak)
+	}
+	return points
+}
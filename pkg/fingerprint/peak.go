@@ -2,50 +2,136 @@ package fingerprint
 
 import (
 	"fmt"
+	"math"
 	"sort"
 
 	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
 )
 
-// Peak represents a spectral peak in the time-frequency domain
-type Peak struct {
-	TimeIndex     int     // Index of the time bin
-	FreqIndex     int     // Index of the frequency bin
-	Time          float64 // Time position in seconds
-	Frequency     float64 // Frequency in Hz
-	Amplitude     float64 // Amplitude/energy of the peak
-	IsLocalMaxima bool    // Whether this is a local maxima
-}
+// ThresholdMode selects how the amplitude threshold for a peak is computed
+type ThresholdMode string
+
+const (
+	// ThresholdGlobal uses max(AbsoluteThreshold, RelativeThreshold * global maximum)
+	ThresholdGlobal ThresholdMode = "global"
+	// ThresholdLocalMean requires a peak to exceed the mean of its
+	// time-frequency neighborhood by LocalMeanOffset
+	ThresholdLocalMean ThresholdMode = "local-mean"
+	// ThresholdMasking uses a decaying masking threshold that every accepted
+	// peak raises around its frequency (after Ellis' landmark fingerprinter)
+	ThresholdMasking ThresholdMode = "masking"
+)
 
 // PeakExtractor extracts spectral peaks from a spectrogram
 type PeakExtractor struct {
 	// Configuration parameters
-	NeighborhoodSize  int     // Size of the neighborhood for local maxima detection
-	AbsoluteThreshold float64 // Absolute amplitude threshold
-	RelativeThreshold float64 // Relative amplitude threshold (fraction of max amplitude)
-	MaxPeaksPerFrame  int     // Maximum number of peaks to extract per time frame
-	MinFrequency      float64 // Minimum frequency to consider (Hz)
-	MaxFrequency      float64 // Maximum frequency to consider (Hz)
+	NeighborhoodSize  int           // Size of the neighborhood for local maxima detection
+	AbsoluteThreshold float64       // Absolute amplitude threshold
+	RelativeThreshold float64       // Relative amplitude threshold (fraction of max amplitude, global mode only)
+	MaxPeaksPerFrame  int           // Maximum number of peaks to extract per time frame
+	MinFrequency      float64       // Minimum frequency to consider (Hz)
+	MaxFrequency      float64       // Maximum frequency to consider (Hz)
+	ThresholdMode     ThresholdMode // How the amplitude threshold is computed
+
+	// Local mean thresholding
+	LocalMeanTimeRadius int     // Half-width of the averaging neighborhood in frames
+	LocalMeanFreqRadius int     // Half-height of the averaging neighborhood in bins
+	LocalMeanOffset     float64 // Amount a peak must exceed the local mean by
+
+	// Masking thresholding
+	MaskingDecay  float64 // Fraction of the masking threshold kept from one frame to the next
+	MaskingSpread float64 // Standard deviation of a peak's masking skirt in bins
+
+	// Target density: denser seconds keep their loudest peaks, sparser ones
+	// take the most salient local maxima that missed the threshold
+	TargetPeaksPerSecond float64 // Peaks per second to aim for (0 disables)
+
+	// Filter is applied to the extracted peaks when set
+	Filter PeakFilter
 }
 
 // NewPeakExtractor creates a new peak extractor with default settings
 func NewPeakExtractor() *PeakExtractor {
 	return &PeakExtractor{
-		NeighborhoodSize:  3,     // 3x3 neighborhood
-		AbsoluteThreshold: 0.01,  // Minimum amplitude
-		RelativeThreshold: 0.1,   // 10% of maximum amplitude
-		MaxPeaksPerFrame:  5,     // Maximum 5 peaks per time frame
-		MinFrequency:      100.0, // Minimum frequency 100 Hz
-		MaxFrequency:      4000.0, // Maximum frequency 4000 Hz
+		NeighborhoodSize:     3,                  // 7x7 neighborhood
+		AbsoluteThreshold:    0.01,               // Minimum amplitude
+		RelativeThreshold:    0.1,                // 10% of maximum amplitude
+		MaxPeaksPerFrame:     5,                  // Maximum 5 peaks per time frame
+		MinFrequency:         100.0,              // Minimum frequency 100 Hz
+		MaxFrequency:         4000.0,             // Maximum frequency 4000 Hz
+		ThresholdMode:        ThresholdLocalMean, // Adapt to the surrounding loudness
+		LocalMeanTimeRadius:  10,                 // ~0.12s at 44.1kHz with 512 hop
+		LocalMeanFreqRadius:  10,                 // ~430 Hz at 44.1kHz with 1024 window
+		LocalMeanOffset:      0.05,               // 4 dB above the local mean with an 80 dB range
+		MaskingDecay:         0.99,               // Threshold halves in ~70 frames
+		MaskingSpread:        10.0,               // Masking skirt width in bins
+		TargetPeaksPerSecond: 30.0,               // Evens out loud and quiet passages
 	}
 }
 
-// ExtractPeaks extracts spectral peaks from a spectrogram
+// ExtractPeaks extracts spectral peaks from a spectrogram. Candidates are
+// local maxima of a (2*NeighborhoodSize+1)^2 max filter above
+// AbsoluteThreshold; those that pass the threshold selected by ThresholdMode
+// become peaks, at most MaxPeaksPerFrame per frame. TargetPeaksPerSecond
+// then evens out the density before Filter runs. Peaks are returned in time
+// order, loudest first within a frame.
 func (p *PeakExtractor) ExtractPeaks(spectrogram *audio.Spectrogram) ([]Peak, error) {
 	if spectrogram == nil || len(spectrogram.Data) == 0 || len(spectrogram.Data[0]) == 0 {
 		return nil, fmt.Errorf("invalid spectrogram data")
 	}
 
+	// Find the frequency bin indices corresponding to min/max frequencies
+	minFreqIndex := 0
+	maxFreqIndex := len(spectrogram.FreqPoints) - 1
+
+	for i, freq := range spectrogram.FreqPoints {
+		if freq >= p.MinFrequency && minFreqIndex == 0 {
+			minFreqIndex = i
+		}
+		if freq > p.MaxFrequency {
+			maxFreqIndex = i - 1
+			break
+		}
+	}
+
+	// Local maxima are the cells equal to the maximum of their neighborhood
+	neighborhoodMax := MaxFilter2D(spectrogram.Data, p.NeighborhoodSize, p.NeighborhoodSize)
+
+	var allPeaks []Peak
+	var rejected []salientPeak
+	var err error
+	switch p.ThresholdMode {
+	case ThresholdGlobal, "":
+		allPeaks, rejected = p.globalThresholdPeaks(spectrogram, neighborhoodMax, minFreqIndex, maxFreqIndex)
+	case ThresholdLocalMean:
+		allPeaks, rejected = p.localMeanPeaks(spectrogram, neighborhoodMax, minFreqIndex, maxFreqIndex)
+	case ThresholdMasking:
+		allPeaks, rejected, err = p.maskingPeaks(spectrogram, neighborhoodMax, minFreqIndex, maxFreqIndex)
+	default:
+		err = fmt.Errorf("unsupported threshold mode: %s", p.ThresholdMode)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Even out the number of peaks per second
+	if p.TargetPeaksPerSecond > 0 {
+		allPeaks = p.limitDensity(p.fillDensity(allPeaks, rejected))
+	}
+
+	return p.FilterPeaks(allPeaks, p.Filter), nil
+}
+
+// salientPeak is a peak candidate with the margin by which it passed its
+// threshold, negative if it missed it
+type salientPeak struct {
+	Peak
+	salience float64
+}
+
+// globalThresholdPeaks picks peaks above a single spectrogram-wide threshold
+// and returns the candidates below it as well
+func (p *PeakExtractor) globalThresholdPeaks(spectrogram *audio.Spectrogram, neighborhoodMax [][]float64, minFreqIndex, maxFreqIndex int) ([]Peak, []salientPeak) {
 	// Find the global maximum amplitude for relative thresholding
 	maxAmplitude := 0.0
 	for _, frame := range spectrogram.Data {
@@ -63,251 +149,246 @@ func (p *PeakExtractor) ExtractPeaks(spectrogram *audio.Spectrogram) ([]Peak, er
 		effectiveThreshold = relativeThresholdValue
 	}
 
-	// Find the frequency bin indices corresponding to min/max frequencies
-	minFreqIndex := 0
-	maxFreqIndex := len(spectrogram.FreqPoints) - 1
-
-	for i, freq := range spectrogram.FreqPoints {
-		if freq >= p.MinFrequency && minFreqIndex == 0 {
-			minFreqIndex = i
-		}
-		if freq > p.MaxFrequency {
-			maxFreqIndex = i - 1
-			break
+	var allPeaks []Peak
+	var rejected []salientPeak
+	for t := 0; t < spectrogram.TimeBins; t++ {
+		var framePeaks []salientPeak
+		for f := minFreqIndex; f <= maxFreqIndex; f++ {
+			amplitude := spectrogram.Data[t][f]
+			if amplitude < p.AbsoluteThreshold || amplitude < neighborhoodMax[t][f] {
+				continue
+			}
+			candidate := salientPeak{newPeak(spectrogram, t, f), amplitude - effectiveThreshold}
+			if candidate.salience < 0 {
+				rejected = append(rejected, candidate)
+				continue
+			}
+			framePeaks = append(framePeaks, candidate)
 		}
+		allPeaks = append(allPeaks, p.topOfFrame(framePeaks)...)
 	}
 
-	// Extract peaks
-	var allPeaks []Peak
+	return allPeaks, rejected
+}
 
-	// Process each time frame
-	for t := 0; t < spectrogram.TimeBins; t++ {
-		// Find peaks in this time frame
-		var framePeaks []Peak
+// localMeanPeaks picks peaks that stand out from their local neighborhood
+// and returns the candidates that do not as well
+func (p *PeakExtractor) localMeanPeaks(spectrogram *audio.Spectrogram, neighborhoodMax [][]float64, minFreqIndex, maxFreqIndex int) ([]Peak, []salientPeak) {
+	localMean := BoxMean2D(spectrogram.Data, p.LocalMeanTimeRadius, p.LocalMeanFreqRadius)
 
-		// Check each frequency bin within the specified range
+	var allPeaks []Peak
+	var rejected []salientPeak
+	for t := 0; t < spectrogram.TimeBins; t++ {
+		var framePeaks []salientPeak
 		for f := minFreqIndex; f <= maxFreqIndex; f++ {
 			amplitude := spectrogram.Data[t][f]
-
-			// Skip if below threshold
-			if amplitude < effectiveThreshold {
+			if amplitude < p.AbsoluteThreshold || amplitude < neighborhoodMax[t][f] {
 				continue
 			}
-
-			// Check if this is a local maximum in its neighborhood
-			isLocalMax := true
-			for dt := -p.NeighborhoodSize; dt <= p.NeighborhoodSize; dt++ {
-				for df := -p.NeighborhoodSize; df <= p.NeighborhoodSize; df++ {
-					// Skip the point itself
-					if dt == 0 && df == 0 {
-						continue
-					}
-
-					// Check if the neighbor is within bounds
-					nt := t + dt
-					nf := f + df
-					if nt >= 0 && nt < spectrogram.TimeBins && nf >= 0 && nf < spectrogram.FreqBins {
-						// If any neighbor has higher amplitude, this is not a local maximum
-						if spectrogram.Data[nt][nf] > amplitude {
-							isLocalMax = false
-							break
-						}
-					}
-				}
-				if !isLocalMax {
-					break
-				}
+			margin := amplitude - localMean[t][f]
+			if margin < p.LocalMeanOffset {
+				rejected = append(rejected, salientPeak{newPeak(spectrogram, t, f), margin - p.LocalMeanOffset})
+				continue
 			}
+			framePeaks = append(framePeaks, salientPeak{newPeak(spectrogram, t, f), margin})
+		}
+		allPeaks = append(allPeaks, p.topOfFrame(framePeaks)...)
+	}
 
-			// If this is a local maximum, add it to the peaks
-			if isLocalMax {
-				peak := Peak{
-					TimeIndex:     t,
-					FreqIndex:     f,
-					Time:          spectrogram.TimePoints[t],
-					Frequency:     spectrogram.FreqPoints[f],
-					Amplitude:     amplitude,
-					IsLocalMaxima: true,
-				}
-				framePeaks = append(framePeaks, peak)
+	return allPeaks, rejected
+}
+
+// maskingPeaks picks peaks against a decaying masking threshold. Every
+// accepted peak raises the threshold around its bin with a Gaussian skirt,
+// suppressing weaker peaks nearby in frequency and in the following frames.
+// Masked candidates are returned as well.
+func (p *PeakExtractor) maskingPeaks(spectrogram *audio.Spectrogram, neighborhoodMax [][]float64, minFreqIndex, maxFreqIndex int) ([]Peak, []salientPeak, error) {
+	if p.MaskingDecay <= 0 || p.MaskingDecay > 1 {
+		return nil, nil, fmt.Errorf("masking decay must be in (0, 1], got %f", p.MaskingDecay)
+	}
+	if p.MaskingSpread <= 0 {
+		return nil, nil, fmt.Errorf("masking spread must be positive, got %f", p.MaskingSpread)
+	}
+
+	// Precompute the masking skirt out to three standard deviations
+	skirtRadius := int(3 * p.MaskingSpread)
+	skirt := make([]float64, 2*skirtRadius+1)
+	for i := range skirt {
+		d := float64(i-skirtRadius) / p.MaskingSpread
+		skirt[i] = math.Exp(-0.5 * d * d)
+	}
+
+	threshold := make([]float64, spectrogram.FreqBins)
+	var allPeaks []Peak
+	var rejected []salientPeak
+	for t := 0; t < spectrogram.TimeBins; t++ {
+		// Collect this frame's local maxima, loudest first
+		var candidates []salientPeak
+		for f := minFreqIndex; f <= maxFreqIndex; f++ {
+			amplitude := spectrogram.Data[t][f]
+			if amplitude < p.AbsoluteThreshold || amplitude < neighborhoodMax[t][f] {
+				continue
 			}
+			candidates = append(candidates, salientPeak{newPeak(spectrogram, t, f), 0})
 		}
+		sort.Slice(candidates, func(i, j int) bool {
+			return candidates[i].Amplitude > candidates[j].Amplitude
+		})
+
+		// Accept candidates above the threshold and let them mask their surroundings
+		var framePeaks []salientPeak
+		for _, candidate := range candidates {
+			f := candidate.FreqIndex
+			candidate.salience = candidate.Amplitude - threshold[f]
+			if candidate.salience <= 0 {
+				rejected = append(rejected, candidate)
+				continue
+			}
+			framePeaks = append(framePeaks, candidate)
 
-		// Sort peaks by amplitude (descending) and take the top N
-		if len(framePeaks) > 0 {
-			sort.Slice(framePeaks, func(i, j int) bool {
-				return framePeaks[i].Amplitude > framePeaks[j].Amplitude
-			})
-
-			// Limit the number of peaks per frame
-			if len(framePeaks) > p.MaxPeaksPerFrame {
-				framePeaks = framePeaks[:p.MaxPeaksPerFrame]
+			for i, weight := range skirt {
+				bin := f + i - skirtRadius
+				if bin >= 0 && bin < len(threshold) {
+					threshold[bin] = math.Max(threshold[bin], candidate.Amplitude*weight)
+				}
 			}
+		}
+		allPeaks = append(allPeaks, p.topOfFrame(framePeaks)...)
 
-			// Add to all peaks
-			allPeaks = append(allPeaks, framePeaks...)
+		// Let the threshold decay towards zero
+		for f := range threshold {
+			threshold[f] *= p.MaskingDecay
 		}
 	}
 
-	return allPeaks, nil
+	return allPeaks, rejected, nil
 }
 
-// FilterPeaks filters peaks based on various criteria
-func (p *PeakExtractor) FilterPeaks(peaks []Peak, options map[string]interface{}) []Peak {
-	if len(peaks) == 0 {
-		return peaks
+// topOfFrame keeps the MaxPeaksPerFrame most salient peaks of a frame and
+// orders them by amplitude (descending)
+func (p *PeakExtractor) topOfFrame(framePeaks []salientPeak) []Peak {
+	sort.Slice(framePeaks, func(i, j int) bool {
+		return framePeaks[i].salience > framePeaks[j].salience
+	})
+	if p.MaxPeaksPerFrame > 0 && len(framePeaks) > p.MaxPeaksPerFrame {
+		framePeaks = framePeaks[:p.MaxPeaksPerFrame]
 	}
+	sort.SliceStable(framePeaks, func(i, j int) bool {
+		return framePeaks[i].Amplitude > framePeaks[j].Amplitude
+	})
 
-	filtered := make([]Peak, 0, len(peaks))
-
-	// Apply frequency range filtering
-	minFreq, hasMinFreq := options["min_frequency"].(float64)
-	maxFreq, hasMaxFreq := options["max_frequency"].(float64)
-	
-	// Apply amplitude threshold filtering
-	ampThreshold, hasAmpThreshold := options["amplitude_threshold"].(float64)
-	
-	// Apply time range filtering
-	minTime, hasMinTime := options["min_time"].(float64)
-	maxTime, hasMaxTime := options["max_time"].(float64)
+	peaks := make([]Peak, len(framePeaks))
+	for i, peak := range framePeaks {
+		peaks[i] = peak.Peak
+	}
+	return peaks
+}
 
-	// Filter peaks
+// fillDensity adds rejected candidates to one-second segments with fewer than
+// TargetPeaksPerSecond peaks, the most salient first and no more than
+// MaxPeaksPerFrame per frame. This lowers the threshold of quiet passages
+// until they reach the target; silence below AbsoluteThreshold stays empty.
+// Peaks are returned in time order, loudest first within a frame.
+func (p *PeakExtractor) fillDensity(peaks []Peak, rejected []salientPeak) []Peak {
+	quota := int(math.Ceil(p.TargetPeaksPerSecond))
+	perSecond := make(map[float64]int)
+	perFrame := make(map[int]int)
 	for _, peak := range peaks {
-		// Check frequency range
-		if hasMinFreq && peak.Frequency < minFreq {
-			continue
-		}
-		if hasMaxFreq && peak.Frequency > maxFreq {
-			continue
-		}
-		
-		// Check amplitude threshold
-		if hasAmpThreshold && peak.Amplitude < ampThreshold {
-			continue
-		}
-		
-		// Check time range
-		if hasMinTime && peak.Time < minTime {
-			continue
-		}
-		if hasMaxTime && peak.Time > maxTime {
+		perSecond[math.Floor(peak.Time)]++
+		perFrame[peak.TimeIndex]++
+	}
+
+	sort.SliceStable(rejected, func(i, j int) bool {
+		return rejected[i].salience > rejected[j].salience
+	})
+	filled := peaks
+	for _, candidate := range rejected {
+		second := math.Floor(candidate.Time)
+		if perSecond[second] >= quota || (p.MaxPeaksPerFrame > 0 && perFrame[candidate.TimeIndex] >= p.MaxPeaksPerFrame) {
 			continue
 		}
-		
-		// If all checks pass, add to filtered peaks
-		filtered = append(filtered, peak)
+		filled = append(filled, candidate.Peak)
+		perSecond[second]++
+		perFrame[candidate.TimeIndex]++
+	}
+	if len(filled) == len(peaks) {
+		return peaks
 	}
 
-	return filtered
+	sort.SliceStable(filled, func(i, j int) bool {
+		if filled[i].TimeIndex != filled[j].TimeIndex {
+			return filled[i].TimeIndex < filled[j].TimeIndex
+		}
+		return filled[i].Amplitude > filled[j].Amplitude
+	})
+	return filled
 }
 
-// VisualizePeaks creates a visualization of peaks on a spectrogram
-func (p *PeakExtractor) VisualizePeaks(spectrogram *audio.Spectrogram, peaks []Peak, filePath string) error {
-	// Import required packages
-	import (
-		"image"
-		"image/color"
-		"image/draw"
-		"image/png"
-		"os"
-	)
-
-	// Check if spectrogram is valid
-	if spectrogram == nil || len(spectrogram.Data) == 0 || len(spectrogram.Data[0]) == 0 {
-		return fmt.Errorf("invalid spectrogram data")
-	}
-
-	// Create a new image
-	width := spectrogram.TimeBins
-	height := spectrogram.FreqBins
-	img := image.NewRGBA(image.Rect(0, 0, width, height))
-
-	// Define a color palette (from blue to red)
-	getColor := func(value float64) color.RGBA {
-		// Map value from [0,1] to a color
-		// Blue (0,0,255) -> Cyan (0,255,255) -> Green (0,255,0) -> Yellow (255,255,0) -> Red (255,0,0)
-		r, g, b := 0, 0, 0
-		
-		if value < 0.25 {
-			// Blue to Cyan
-			v := value * 4
-			b = 255
-			g = int(v * 255)
-		} else if value < 0.5 {
-			// Cyan to Green
-			v := (value - 0.25) * 4
-			g = 255
-			b = 255 - int(v*255)
-		} else if value < 0.75 {
-			// Green to Yellow
-			v := (value - 0.5) * 4
-			g = 255
-			r = int(v * 255)
-		} else {
-			// Yellow to Red
-			v := (value - 0.75) * 4
-			r = 255
-			g = 255 - int(v*255)
+// limitDensity keeps at most TargetPeaksPerSecond peaks in every one-second
+// segment, preferring the loudest peaks of each segment, and preserves
+// the original order
+func (p *PeakExtractor) limitDensity(peaks []Peak) []Peak {
+	quota := int(math.Ceil(p.TargetPeaksPerSecond))
+
+	var limited []Peak
+	for start := 0; start < len(peaks); {
+		// Find the peaks of this one-second segment
+		segment := math.Floor(peaks[start].Time)
+		end := start
+		for end < len(peaks) && math.Floor(peaks[end].Time) == segment {
+			end++
 		}
-		
-		return color.RGBA{uint8(r), uint8(g), uint8(b), 255}
-	}
 
-	// Fill the image with spectrogram data
-	// Note: Frequency axis is typically displayed with low frequencies at the bottom
-	for t := 0; t < width; t++ {
-		for f := 0; f < height; f++ {
-			// Get the spectrogram value (ensure it's in [0,1] range)
-			value := spectrogram.Data[t][height-f-1] // Invert frequency axis
-			if value < 0 {
-				value = 0
+		if end-start <= quota {
+			limited = append(limited, peaks[start:end]...)
+		} else {
+			// Rank by amplitude and keep the quota, then restore time order
+			indices := make([]int, end-start)
+			for i := range indices {
+				indices[i] = start + i
 			}
-			if value > 1 {
-				value = 1
+			sort.SliceStable(indices, func(i, j int) bool {
+				return peaks[indices[i]].Amplitude > peaks[indices[j]].Amplitude
+			})
+			indices = indices[:quota]
+			sort.Ints(indices)
+			for _, index := range indices {
+				limited = append(limited, peaks[index])
 			}
-			
-			// Set the pixel color
-			img.Set(t, f, getColor(value))
 		}
+
+		start = end
 	}
 
-	// Draw peaks on the image
-	peakColor := color.RGBA{255, 255, 255, 255} // White
-	for _, peak := range peaks {
-		// Calculate the position in the image
-		x := peak.TimeIndex
-		y := height - peak.FreqIndex - 1 // Invert frequency axis
-		
-		// Draw a small circle around the peak
-		for dx := -2; dx <= 2; dx++ {
-			for dy := -2; dy <= 2; dy++ {
-				// Skip corners to make it more circular
-				if dx*dx + dy*dy > 5 {
-					continue
-				}
-				
-				// Check if the point is within the image bounds
-				nx := x + dx
-				ny := y + dy
-				if nx >= 0 && nx < width && ny >= 0 && ny < height {
-					img.Set(nx, ny, peakColor)
-				}
-			}
-		}
+	return limited
+}
+
+// newPeak creates the peak at time bin t and frequency bin f
+func newPeak(spectrogram *audio.Spectrogram, t, f int) Peak {
+	return Peak{
+		TimeIndex: t,
+		FreqIndex: f,
+		Time:      spectrogram.TimePoints[t],
+		Frequency: spectrogram.FreqPoints[f],
+		Amplitude: spectrogram.Data[t][f],
 	}
+}
 
-	// Create the output file
-	file, err := os.Create(filePath)
-	if err != nil {
-		return fmt.Errorf("failed to create image file: %w", err)
+// FilterPeaks filters peaks with the given filter (or pipeline of filters)
+func (p *PeakExtractor) FilterPeaks(peaks []Peak, filter PeakFilter) []Peak {
+	if len(peaks) == 0 || filter == nil {
+		return peaks
 	}
-	defer file.Close()
 
-	// Encode and save the image
-	err = png.Encode(file, img)
+	return filter.Filter(peaks)
+}
+
+// VisualizePeaks creates a visualization of peaks on a spectrogram
+func (p *PeakExtractor) VisualizePeaks(spectrogram *audio.Spectrogram, peaks []Peak, filePath string) error {
+	img, err := audio.NewSpectrogramRenderer().Render(spectrogram, NewOverlay(peaks, nil))
 	if err != nil {
-		return fmt.Errorf("failed to encode image: %w", err)
+		return err
 	}
 
-	return nil
-} 
\ No newline at end of file
+	return audio.SavePNG(img, filePath)
+}
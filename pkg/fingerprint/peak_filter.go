@@ -0,0 +1,205 @@
+package fingerprint
+
+import (
+	"math"
+	"sort"
+)
+
+// PeakFilter selects a subset of peaks. Filters return peaks in the order
+// they received them.
+type PeakFilter interface {
+	// Filter returns the peaks that pass the filter
+	Filter(peaks []Peak) []Peak
+}
+
+// FilterPipeline applies a sequence of filters in order
+type FilterPipeline []PeakFilter
+
+// NewFilterPipeline composes filters into a pipeline, skipping nil filters
+func NewFilterPipeline(filters ...PeakFilter) FilterPipeline {
+	pipeline := make(FilterPipeline, 0, len(filters))
+	for _, filter := range filters {
+		if filter != nil {
+			pipeline = append(pipeline, filter)
+		}
+	}
+	return pipeline
+}
+
+// Filter runs every filter of the pipeline on the output of the previous one
+func (p FilterPipeline) Filter(peaks []Peak) []Peak {
+	for _, filter := range p {
+		peaks = filter.Filter(peaks)
+	}
+	return peaks
+}
+
+// FrequencyBandFilter keeps peaks within [MinFrequency, MaxFrequency] Hz.
+// A MaxFrequency of 0 means no upper bound.
+type FrequencyBandFilter struct {
+	MinFrequency float64
+	MaxFrequency float64
+}
+
+// Filter returns the peaks inside the frequency band
+func (f FrequencyBandFilter) Filter(peaks []Peak) []Peak {
+	return keepPeaks(peaks, func(peak Peak) bool {
+		return peak.Frequency >= f.MinFrequency && (f.MaxFrequency <= 0 || peak.Frequency <= f.MaxFrequency)
+	})
+}
+
+// AmplitudeFilter keeps peaks with an amplitude of at least MinAmplitude
+type AmplitudeFilter struct {
+	MinAmplitude float64
+}
+
+// Filter returns the peaks at or above the amplitude threshold
+func (f AmplitudeFilter) Filter(peaks []Peak) []Peak {
+	return keepPeaks(peaks, func(peak Peak) bool {
+		return peak.Amplitude >= f.MinAmplitude
+	})
+}
+
+// TimeWindowFilter keeps peaks within [MinTime, MaxTime] seconds.
+// A MaxTime of 0 means no upper bound.
+type TimeWindowFilter struct {
+	MinTime float64
+	MaxTime float64
+}
+
+// Filter returns the peaks inside the time window
+func (f TimeWindowFilter) Filter(peaks []Peak) []Peak {
+	return keepPeaks(peaks, func(peak Peak) bool {
+		return peak.Time >= f.MinTime && (f.MaxTime <= 0 || peak.Time <= f.MaxTime)
+	})
+}
+
+// BandQuotaFilter keeps at most PeaksPerBand of the loudest peaks in every
+// frequency band for every Window seconds, so no band dominates the
+// fingerprint. BandEdges are ascending frequencies in Hz delimiting the bands;
+// peaks outside all bands pass through untouched.
+type BandQuotaFilter struct {
+	BandEdges    []float64 // Band boundaries in Hz, e.g. {100, 500, 1000, 2000, 4000}
+	PeaksPerBand int       // Maximum peaks per band and window
+	Window       float64   // Window length in seconds (defaults to 1)
+}
+
+// Filter returns the peaks within each band's quota
+func (f BandQuotaFilter) Filter(peaks []Peak) []Peak {
+	if len(f.BandEdges) < 2 || f.PeaksPerBand <= 0 {
+		return peaks
+	}
+	window := f.Window
+	if window <= 0 {
+		window = 1.0
+	}
+
+	// Group peak indices by (window, band)
+	type cell struct {
+		window int
+		band   int
+	}
+	groups := make(map[cell][]int)
+	keep := make([]bool, len(peaks))
+	for i, peak := range peaks {
+		// Band i covers [BandEdges[i], BandEdges[i+1])
+		band := sort.Search(len(f.BandEdges), func(e int) bool {
+			return f.BandEdges[e] > peak.Frequency
+		}) - 1
+		if band < 0 || band >= len(f.BandEdges)-1 {
+			keep[i] = true
+			continue
+		}
+		key := cell{int(math.Floor(peak.Time / window)), band}
+		groups[key] = append(groups[key], i)
+	}
+
+	// Keep the loudest peaks of each group
+	for _, indices := range groups {
+		sort.SliceStable(indices, func(a, b int) bool {
+			return peaks[indices[a]].Amplitude > peaks[indices[b]].Amplitude
+		})
+		if len(indices) > f.PeaksPerBand {
+			indices = indices[:f.PeaksPerBand]
+		}
+		for _, index := range indices {
+			keep[index] = true
+		}
+	}
+
+	filtered := make([]Peak, 0, len(peaks))
+	for i, peak := range peaks {
+		if keep[i] {
+			filtered = append(filtered, peak)
+		}
+	}
+	return filtered
+}
+
+// MinSpacingFilter enforces a minimum time between peaks that are close in
+// frequency. Louder peaks win: a peak is dropped when a louder kept peak lies
+// within FrequencyTolerance Hz and less than MinInterval seconds away.
+type MinSpacingFilter struct {
+	MinInterval        float64 // Minimum spacing in seconds
+	FrequencyTolerance float64 // Peaks further apart than this (Hz) never conflict
+}
+
+// Filter returns the peaks that respect the minimum spacing
+func (f MinSpacingFilter) Filter(peaks []Peak) []Peak {
+	if f.MinInterval <= 0 || len(peaks) == 0 {
+		return peaks
+	}
+
+	// Visit peaks loudest first
+	order := make([]int, len(peaks))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return peaks[order[a]].Amplitude > peaks[order[b]].Amplitude
+	})
+
+	// Kept peaks bucketed by MinInterval so only neighboring buckets are checked
+	buckets := make(map[int][]Peak)
+	keep := make([]bool, len(peaks))
+	for _, index := range order {
+		peak := peaks[index]
+		bucket := int(math.Floor(peak.Time / f.MinInterval))
+
+		conflict := false
+		for b := bucket - 1; b <= bucket+1 && !conflict; b++ {
+			for _, kept := range buckets[b] {
+				if math.Abs(kept.Time-peak.Time) < f.MinInterval &&
+					math.Abs(kept.Frequency-peak.Frequency) <= f.FrequencyTolerance {
+					conflict = true
+					break
+				}
+			}
+		}
+		if conflict {
+			continue
+		}
+
+		keep[index] = true
+		buckets[bucket] = append(buckets[bucket], peak)
+	}
+
+	filtered := make([]Peak, 0, len(peaks))
+	for i, peak := range peaks {
+		if keep[i] {
+			filtered = append(filtered, peak)
+		}
+	}
+	return filtered
+}
+
+// keepPeaks returns the peaks for which keep returns true
+func keepPeaks(peaks []Peak, keep func(Peak) bool) []Peak {
+	filtered := make([]Peak, 0, len(peaks))
+	for _, peak := range peaks {
+		if keep(peak) {
+			filtered = append(filtered, peak)
+		}
+	}
+	return filtered
+}
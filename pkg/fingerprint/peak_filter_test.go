@@ -0,0 +1,138 @@
+package fingerprint
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testPeaks are time-ordered peaks spread over two seconds and three bands
+var testPeaks = []Peak{
+	{Time: 0.10, Frequency: 150, Amplitude: 0.9},
+	{Time: 0.15, Frequency: 160, Amplitude: 0.3},
+	{Time: 0.40, Frequency: 800, Amplitude: 0.5},
+	{Time: 0.60, Frequency: 170, Amplitude: 0.6},
+	{Time: 0.90, Frequency: 3000, Amplitude: 0.2},
+	{Time: 1.20, Frequency: 800, Amplitude: 0.8},
+	{Time: 1.25, Frequency: 2000, Amplitude: 0.4},
+	{Time: 1.70, Frequency: 50, Amplitude: 0.7},
+}
+
+// peakTimes returns the times of peaks, which identify the test peaks
+func peakTimes(peaks []Peak) []float64 {
+	times := make([]float64, len(peaks))
+	for i, peak := range peaks {
+		times[i] = peak.Time
+	}
+	return times
+}
+
+func TestPeakFilters(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		filter PeakFilter
+		times  []float64
+	}{
+		{"band", FrequencyBandFilter{MinFrequency: 160, MaxFrequency: 1000}, []float64{0.15, 0.40, 0.60, 1.20}},
+		{"band without upper bound", FrequencyBandFilter{MinFrequency: 1000}, []float64{0.90, 1.25}},
+		{"amplitude", AmplitudeFilter{MinAmplitude: 0.6}, []float64{0.10, 0.60, 1.20, 1.70}},
+		{"time window", TimeWindowFilter{MinTime: 0.4, MaxTime: 1.2}, []float64{0.40, 0.60, 0.90, 1.20}},
+		{"time window without upper bound", TimeWindowFilter{MinTime: 1.25}, []float64{1.25, 1.70}},
+		{
+			// One peak per band and second; 50 Hz lies outside all bands
+			"band quota",
+			BandQuotaFilter{BandEdges: []float64{100, 500, 2500, 4000}, PeaksPerBand: 1},
+			[]float64{0.10, 0.40, 0.90, 1.20, 1.70},
+		},
+		{
+			"band quota per half second",
+			BandQuotaFilter{BandEdges: []float64{100, 500}, PeaksPerBand: 1, Window: 0.5},
+			[]float64{0.10, 0.40, 0.60, 0.90, 1.20, 1.25, 1.70},
+		},
+		{"band quota without bands", BandQuotaFilter{PeaksPerBand: 1}, peakTimes(testPeaks)},
+		{
+			// The 0.9 peak at 0.10s suppresses its neighbours at 0.15s and 0.60s
+			"min spacing",
+			MinSpacingFilter{MinInterval: 0.6, FrequencyTolerance: 50},
+			[]float64{0.10, 0.40, 0.90, 1.20, 1.25, 1.70},
+		},
+		{"min spacing with a narrow tolerance", MinSpacingFilter{MinInterval: 0.6, FrequencyTolerance: 5}, peakTimes(testPeaks)},
+		{"empty pipeline", NewFilterPipeline(), peakTimes(testPeaks)},
+		{
+			"pipeline",
+			NewFilterPipeline(FrequencyBandFilter{MinFrequency: 100}, nil, AmplitudeFilter{MinAmplitude: 0.4}, TimeWindowFilter{MaxTime: 1.5}),
+			[]float64{0.10, 0.40, 0.60, 1.20, 1.25},
+		},
+		{
+			// Order matters: the quota sees only the peaks the amplitude filter kept
+			"nested pipeline",
+			NewFilterPipeline(
+				NewFilterPipeline(AmplitudeFilter{MinAmplitude: 0.5}),
+				BandQuotaFilter{BandEdges: []float64{0, 4000}, PeaksPerBand: 2},
+			),
+			[]float64{0.10, 0.60, 1.20, 1.70},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			input := append([]Peak(nil), testPeaks...)
+			if got := peakTimes(test.filter.Filter(input)); !reflect.DeepEqual(got, test.times) {
+				t.Errorf("Expected peaks at %v, got %v", test.times, got)
+			}
+			if !reflect.DeepEqual(input, testPeaks) {
+				t.Error("Expected the input peaks to be left untouched")
+			}
+		})
+	}
+}
+
+func TestNewFilterPipelineSkipsNil(t *testing.T) {
+	pipeline := NewFilterPipeline(nil, AmplitudeFilter{}, nil)
+	if len(pipeline) != 1 {
+		t.Errorf("Expected 1 filter, got %d", len(pipeline))
+	}
+}
+
+func TestFilterFields(t *testing.T) {
+	// Triads inside and below the band
+	generator := NewGenerator(DefaultConfig())
+	spec, err := generator.ComputeSpectrogram(createChords(3, 0.5, []float64{220, 880}))
+	if err != nil {
+		t.Fatalf("Failed to compute spectrogram: %v", err)
+	}
+	all, err := generator.ExtractPeaks(spec)
+	if err != nil {
+		t.Fatalf("Failed to extract peaks: %v", err)
+	}
+
+	band := FrequencyBandFilter{MinFrequency: 500, MaxFrequency: 1500}
+	want := band.Filter(all)
+	if len(want) == 0 || len(want) == len(all) {
+		t.Fatalf("Expected the band to keep some of %d peaks, kept %d", len(all), len(want))
+	}
+
+	// The extractor's filter
+	extractor := *generator.Extractor
+	extractor.AbsoluteThreshold = generator.Config.PeakThreshold
+	extractor.NeighborhoodSize = generator.Config.NeighborSize
+	extractor.Filter = band
+	peaks, err := extractor.ExtractPeaks(spec)
+	if err != nil {
+		t.Fatalf("Failed to extract peaks: %v", err)
+	}
+	if !reflect.DeepEqual(peaks, want) {
+		t.Errorf("Expected the extractor filter to keep %d peaks, got %d", len(want), len(peaks))
+	}
+
+	// The generator's filter runs after the extractor's
+	generator.Filter = band
+	peaks, err = generator.ExtractPeaks(spec)
+	if err != nil {
+		t.Fatalf("Failed to extract peaks: %v", err)
+	}
+	if !reflect.DeepEqual(peaks, want) {
+		t.Errorf("Expected the generator filter to keep %d peaks, got %d", len(want), len(peaks))
+	}
+	generator.Extractor.Filter = AmplitudeFilter{MinAmplitude: 2}
+	if peaks, _ := generator.ExtractPeaks(spec); len(peaks) != 0 {
+		t.Errorf("Expected both filters to apply, got %d peaks", len(peaks))
+	}
+}
@@ -0,0 +1,198 @@
+package fingerprint
+
+import (
+	"math"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+)
+
+// createSpectrogram wraps data in a spectrogram with framesPerSec frames per
+// second and 40 Hz bins
+func createSpectrogram(data [][]float64, framesPerSec float64) *audio.Spectrogram {
+	spec := &audio.Spectrogram{
+		Data:       data,
+		TimeBins:   len(data),
+		FreqBins:   len(data[0]),
+		TimePoints: make([]float64, len(data)),
+		FreqPoints: make([]float64, len(data[0])),
+	}
+	for t := range spec.TimePoints {
+		spec.TimePoints[t] = float64(t) / framesPerSec
+	}
+	for f := range spec.FreqPoints {
+		spec.FreqPoints[f] = float64(f) * 40
+	}
+	return spec
+}
+
+// constantMatrix returns a frames x bins matrix filled with value
+func constantMatrix(frames, bins int, value float64) [][]float64 {
+	data := make([][]float64, frames)
+	for t := range data {
+		data[t] = make([]float64, bins)
+		for f := range data[t] {
+			data[t][f] = value
+		}
+	}
+	return data
+}
+
+func TestLocalMeanThreshold(t *testing.T) {
+	// A loud, flat background with one bump standing out of it
+	data := constantMatrix(40, 60, 0.6)
+	data[20][30] = 0.7
+	spec := createSpectrogram(data, 20)
+
+	extractor := NewPeakExtractor()
+	extractor.TargetPeaksPerSecond = 0
+	peaks, err := extractor.ExtractPeaks(spec)
+	if err != nil {
+		t.Fatalf("Failed to extract peaks: %v", err)
+	}
+	if len(peaks) != 1 || peaks[0].TimeIndex != 20 || peaks[0].FreqIndex != 30 {
+		t.Errorf("Expected only the bump at (20, 30), got %v", peaks)
+	}
+
+	// A global threshold takes the flat background for peaks too
+	extractor.ThresholdMode = ThresholdGlobal
+	peaks, err = extractor.ExtractPeaks(spec)
+	if err != nil {
+		t.Fatalf("Failed to extract peaks: %v", err)
+	}
+	if len(peaks) <= 1 {
+		t.Errorf("Expected the global threshold to pass the background, got %d peaks", len(peaks))
+	}
+}
+
+func TestMaskingThreshold(t *testing.T) {
+	// An onset in bin 30 decays over the following frames, then a second,
+	// louder onset follows
+	data := constantMatrix(60, 60, 0)
+	for frame := 0; frame < 30; frame++ {
+		data[frame][30] = 0.9 * math.Pow(0.9, float64(frame))
+	}
+	data[40][30] = 0.95
+	spec := createSpectrogram(data, 20)
+
+	extractor := NewPeakExtractor()
+	extractor.ThresholdMode = ThresholdMasking
+	extractor.NeighborhoodSize = 0 // Every cell of the tail is a candidate
+	extractor.TargetPeaksPerSecond = 0
+	peaks, err := extractor.ExtractPeaks(spec)
+	if err != nil {
+		t.Fatalf("Failed to extract peaks: %v", err)
+	}
+	if len(peaks) != 2 || peaks[0].TimeIndex != 0 || peaks[1].TimeIndex != 40 {
+		t.Errorf("Expected the onsets at frames 0 and 40 only, got %v", peaks)
+	}
+
+	// Without masking the tail passes the threshold
+	extractor.ThresholdMode = ThresholdGlobal
+	extractor.RelativeThreshold = 0
+	peaks, err = extractor.ExtractPeaks(spec)
+	if err != nil {
+		t.Fatalf("Failed to extract peaks: %v", err)
+	}
+	if len(peaks) < 10 {
+		t.Errorf("Expected the global threshold to pass the tail, got %d peaks", len(peaks))
+	}
+
+	extractor.ThresholdMode = ThresholdMasking
+	extractor.MaskingDecay = 0
+	if _, err := extractor.ExtractPeaks(spec); err == nil {
+		t.Error("Expected an error for a zero masking decay")
+	}
+}
+
+func TestTargetPeaksPerSecond(t *testing.T) {
+	// Ten seconds of the same texture, 30 dB quieter in the second half of an
+	// 80 dB scale and flattened in the last two seconds, so that few local
+	// maxima stand out from their neighborhood there
+	const framesPerSec = 20
+	data := randomMatrix(10*framesPerSec, 100, 3)
+	for frame := 5 * framesPerSec; frame < len(data); frame++ {
+		for f := range data[frame] {
+			data[frame][f] = math.Max(0, data[frame][f]-30.0/80)
+			if frame >= 8*framesPerSec {
+				data[frame][f] = 0.1 + 0.1*data[frame][f]
+			}
+		}
+	}
+	for frame := range data {
+		for f := range data[frame] {
+			data[frame][f] *= 0.5
+		}
+	}
+	spec := createSpectrogram(data, framesPerSec)
+
+	countPerSecond := func(extractor *PeakExtractor) []int {
+		t.Helper()
+		peaks, err := extractor.ExtractPeaks(spec)
+		if err != nil {
+			t.Fatalf("Failed to extract peaks: %v", err)
+		}
+		counts := make([]int, 10)
+		for i, peak := range peaks {
+			counts[int(peak.Time)]++
+			if i > 0 && (peak.TimeIndex < peaks[i-1].TimeIndex ||
+				peak.TimeIndex == peaks[i-1].TimeIndex && peak.Amplitude > peaks[i-1].Amplitude) {
+				t.Fatalf("Expected peaks in time order, loudest first, got %+v after %+v", peak, peaks[i-1])
+			}
+		}
+		return counts
+	}
+
+	extractor := NewPeakExtractor()
+	extractor.NeighborhoodSize = 1
+	target := extractor.TargetPeaksPerSecond
+	extractor.TargetPeaksPerSecond = 0
+	if counts := countPerSecond(extractor); counts[0] <= int(target) || counts[9] >= int(target) {
+		t.Fatalf("Expected dense and sparse seconds without a target, got %v", counts)
+	}
+
+	extractor.TargetPeaksPerSecond = target
+	counts := countPerSecond(extractor)
+	for second, count := range counts {
+		if count != int(target) {
+			t.Errorf("Expected %.0f peaks in second %d, got %d (all seconds: %v)", target, second, count, counts)
+		}
+	}
+
+	// Silence has no candidates to fill up with
+	silence := make([][]float64, 2*framesPerSec)
+	for frame := range silence {
+		silence[frame] = make([]float64, 100)
+	}
+	peaks, err := extractor.ExtractPeaks(createSpectrogram(silence, framesPerSec))
+	if err != nil {
+		t.Fatalf("Failed to extract peaks: %v", err)
+	}
+	if len(peaks) != 0 {
+		t.Errorf("Expected no peaks in silence, got %d", len(peaks))
+	}
+}
+
+func TestLimitDensity(t *testing.T) {
+	peaks := []Peak{
+		{Time: 0.1, Amplitude: 0.2},
+		{Time: 0.2, Amplitude: 0.9},
+		{Time: 0.3, Amplitude: 0.5},
+		{Time: 0.9, Amplitude: 0.7},
+		{Time: 1.5, Amplitude: 0.1},
+	}
+	extractor := NewPeakExtractor()
+	extractor.TargetPeaksPerSecond = 2
+
+	limited := extractor.limitDensity(peaks)
+	want := []float64{0.2, 0.9, 1.5}
+	if len(limited) != len(want) {
+		t.Fatalf("Expected peaks at %v, got %v", want, limited)
+	}
+	for i, peak := range limited {
+		if peak.Time != want[i] {
+			t.Errorf("Expected peaks at %v, got %v", want, limited)
+			break
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package fingerprint
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+)
+
+// TimeRange is a span of audio in seconds
+type TimeRange struct {
+	Start float64
+	End   float64
+}
+
+// QualityConfig holds the thresholds of the fingerprint quality report
+type QualityConfig struct {
+	MinPeaksPerSecond  float64   // Fewer peaks per second flag the fingerprint
+	MinHashesPerSecond float64   // Fewer hashes per second flag the fingerprint
+	MinBandCoverage    float64   // Lower mean band coverage flags the fingerprint
+	MaxSilentFraction  float64   // More silence flags the fingerprint
+	SilenceThreshold   float64   // RMS level in dBFS below which audio counts as silent
+	MinSilence         float64   // Shortest silent region reported (seconds)
+	BandEdges          []float64 // Frequency bands for the coverage report (Hz)
+	CoverageWindow     float64   // Window length for band coverage (seconds)
+}
+
+// DefaultQualityConfig returns the default quality thresholds
+func DefaultQualityConfig() QualityConfig {
+	return QualityConfig{
+		MinPeaksPerSecond:  5,
+		MinHashesPerSecond: 10,
+		MinBandCoverage:    0.25,
+		MaxSilentFraction:  0.5,
+		SilenceThreshold:   -50,
+		MinSilence:         1.0,
+		BandEdges:          []float64{100, 250, 500, 1000, 2000, 4000},
+		CoverageWindow:     1.0,
+	}
+}
+
+// QualityReport summarizes how well a fingerprint is likely to match
+type QualityReport struct {
+	Duration        float64     // Duration of the audio in seconds
+	PeaksPerSecond  float64     // Spectral peaks per second
+	HashesPerSecond float64     // Landmark hashes per second
+	BandEdges       []float64   // Frequency band boundaries in Hz
+	BandCoverage    []float64   // Per band, the fraction of windows containing a peak
+	SilentRegions   []TimeRange // Regions quieter than the silence threshold
+	SilentFraction  float64     // Fraction of the audio that is silent
+	LowConfidence   bool        // Set when any check fails; matches against the track are unreliable
+	Warnings        []string    // Reasons for LowConfidence
+}
+
+// QualityReport evaluates a fingerprint computed from data. The duration is
+// taken from the samples, so data.Duration need not be set.
+func (g *GeneratorImpl) QualityReport(data *audio.AudioData, fp *Fingerprint) (*QualityReport, error) {
+	duration := audioDuration(data)
+	if duration <= 0 {
+		return nil, fmt.Errorf("invalid audio data")
+	}
+	if fp == nil {
+		return nil, fmt.Errorf("fingerprint is nil")
+	}
+	config := g.QualityConfig
+
+	report := &QualityReport{
+		Duration:        duration,
+		PeaksPerSecond:  float64(len(fp.Peaks)) / duration,
+		HashesPerSecond: float64(len(fp.Hashes)) / duration,
+		BandEdges:       config.BandEdges,
+	}
+
+	// Band coverage: in how many windows each band has at least one peak
+	if len(config.BandEdges) >= 2 {
+		window := config.CoverageWindow
+		if window <= 0 {
+			window = 1.0
+		}
+		windows := max(1, int(math.Ceil(duration/window)))
+		covered := make([]map[int]bool, len(config.BandEdges)-1)
+		for band := range covered {
+			covered[band] = make(map[int]bool)
+		}
+		for _, peak := range fp.Peaks {
+			for band := range covered {
+				if peak.Frequency >= config.BandEdges[band] && peak.Frequency < config.BandEdges[band+1] {
+					covered[band][int(peak.Time/window)] = true
+					break
+				}
+			}
+		}
+		report.BandCoverage = make([]float64, len(covered))
+		for band, windowSet := range covered {
+			report.BandCoverage[band] = float64(len(windowSet)) / float64(windows)
+		}
+	}
+
+	silent, err := g.silentRegions(data, config)
+	if err != nil {
+		return nil, err
+	}
+	report.SilentRegions = silent
+	for _, region := range silent {
+		report.SilentFraction += (region.End - region.Start) / duration
+	}
+
+	// Flag fingerprints that are unlikely to match
+	if report.PeaksPerSecond < config.MinPeaksPerSecond {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%.1f peaks per second, expected at least %.1f", report.PeaksPerSecond, config.MinPeaksPerSecond))
+	}
+	if report.HashesPerSecond < config.MinHashesPerSecond {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%.1f hashes per second, expected at least %.1f", report.HashesPerSecond, config.MinHashesPerSecond))
+	}
+	if len(report.BandCoverage) > 0 {
+		mean := 0.0
+		for _, coverage := range report.BandCoverage {
+			mean += coverage
+		}
+		mean /= float64(len(report.BandCoverage))
+		if mean < config.MinBandCoverage {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("mean band coverage %.2f, expected at least %.2f", mean, config.MinBandCoverage))
+		}
+	}
+	if report.SilentFraction > config.MaxSilentFraction {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("%.0f%% of the audio is silent", 100*report.SilentFraction))
+	}
+	report.LowConfidence = len(report.Warnings) > 0
+
+	return report, nil
+}
+
+// audioDuration returns the length of data in seconds, or 0 for empty or
+// malformed audio
+func audioDuration(data *audio.AudioData) float64 {
+	if data == nil || data.SampleRate <= 0 || data.Channels <= 0 {
+		return 0
+	}
+	return float64(len(data.Samples)/data.Channels) / float64(data.SampleRate)
+}
+
+// silentRegions finds regions of at least MinSilence seconds whose RMS level
+// in 100 ms blocks stays below SilenceThreshold dBFS
+func (g *GeneratorImpl) silentRegions(data *audio.AudioData, config QualityConfig) ([]TimeRange, error) {
+	if data.Channels != 1 {
+		mono, err := g.Processor.ConvertToMono(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert to mono: %w", err)
+		}
+		data = mono
+	}
+
+	block := max(1, data.SampleRate/10)
+	threshold := math.Pow(10, config.SilenceThreshold/20)
+
+	var regions []TimeRange
+	start := -1
+	closeRegion := func(end int) {
+		if start >= 0 {
+			region := TimeRange{
+				Start: float64(start) / float64(data.SampleRate),
+				End:   float64(end) / float64(data.SampleRate),
+			}
+			if region.End-region.Start >= config.MinSilence {
+				regions = append(regions, region)
+			}
+		}
+		start = -1
+	}
+
+	for offset := 0; offset < len(data.Samples); offset += block {
+		end := min(offset+block, len(data.Samples))
+		sum := 0.0
+		for _, sample := range data.Samples[offset:end] {
+			sum += sample * sample
+		}
+		rms := math.Sqrt(sum / float64(end-offset))
+
+		if rms < threshold {
+			if start < 0 {
+				start = offset
+			}
+		} else {
+			closeRegion(offset)
+		}
+	}
+	closeRegion(len(data.Samples))
+
+	return regions, nil
+}
@@ -0,0 +1,134 @@
+package fingerprint
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+)
+
+// createGappedTrack renders three seconds of chords and a sweep, a silent
+// gap of gap seconds and, if after is set, the music again
+func createGappedTrack(t *testing.T, gap float64, after bool) *audio.AudioData {
+	t.Helper()
+	synth := audio.NewSynthesizer(22050, 1)
+	chords, err := synth.Chords(3, 0.5, []float64{220, 262, 196, 294}, 0.6)
+	if err != nil {
+		t.Fatalf("Failed to synthesize chords: %v", err)
+	}
+	sweep, err := synth.Sweep(3, 200, 4000, 0.4)
+	if err != nil {
+		t.Fatalf("Failed to synthesize sweep: %v", err)
+	}
+	music, err := audio.Mix(chords, sweep)
+	if err != nil {
+		t.Fatalf("Failed to mix: %v", err)
+	}
+	silence, err := synth.Noise(gap, 0)
+	if err != nil {
+		t.Fatalf("Failed to synthesize silence: %v", err)
+	}
+
+	parts := []*audio.AudioData{music, silence}
+	if after {
+		parts = append(parts, music)
+	}
+	track, err := audio.Concat(parts...)
+	if err != nil {
+		t.Fatalf("Failed to join: %v", err)
+	}
+	return track
+}
+
+func TestQualityReport(t *testing.T) {
+	generator := NewGenerator(DefaultConfig())
+	track := createGappedTrack(t, 3, true)
+	fp, err := generator.Fingerprint(track, "track")
+	if err != nil {
+		t.Fatalf("Failed to fingerprint: %v", err)
+	}
+	report := fp.Quality
+	if report == nil {
+		t.Fatal("Expected a quality report with the fingerprint")
+	}
+
+	if math.Abs(report.Duration-9) > 1e-3 {
+		t.Errorf("Expected a duration of 9s, got %f", report.Duration)
+	}
+	if want := float64(len(fp.Peaks)) / report.Duration; report.PeaksPerSecond != want {
+		t.Errorf("Expected %f peaks per second, got %f", want, report.PeaksPerSecond)
+	}
+	if want := float64(len(fp.Hashes)) / report.Duration; report.HashesPerSecond != want {
+		t.Errorf("Expected %f hashes per second, got %f", want, report.HashesPerSecond)
+	}
+
+	// The gap is found to within a block of 100 ms
+	if len(report.SilentRegions) != 1 {
+		t.Fatalf("Expected one silent region, got %+v", report.SilentRegions)
+	}
+	if region := report.SilentRegions[0]; math.Abs(region.Start-3) > 0.1 || math.Abs(region.End-6) > 0.1 {
+		t.Errorf("Expected silence from 3s to 6s, got %+v", region)
+	}
+	if math.Abs(report.SilentFraction-1.0/3) > 0.02 {
+		t.Errorf("Expected a third of the track silent, got %f", report.SilentFraction)
+	}
+
+	// No band has peaks in the three windows of the gap; the sweep passes
+	// through every band
+	bands := len(generator.QualityConfig.BandEdges) - 1
+	if len(report.BandCoverage) != bands {
+		t.Fatalf("Expected coverage of %d bands, got %d", bands, len(report.BandCoverage))
+	}
+	for band, coverage := range report.BandCoverage {
+		if coverage <= 0 || coverage > 6.0/9+1e-9 {
+			t.Errorf("Band %d: expected coverage in (0, 2/3], got %f", band, coverage)
+		}
+	}
+	if report.LowConfidence {
+		t.Errorf("Expected no low-confidence flag, got warnings %v", report.Warnings)
+	}
+
+	// Mostly silent tracks are flagged
+	fp, err = generator.Fingerprint(createGappedTrack(t, 7, false), "track")
+	if err != nil {
+		t.Fatalf("Failed to fingerprint: %v", err)
+	}
+	if !fp.Quality.LowConfidence || len(fp.Quality.Warnings) == 0 || !strings.Contains(strings.Join(fp.Quality.Warnings, "\n"), "silent") {
+		t.Errorf("Expected a low-confidence flag for silence, got %+v", fp.Quality)
+	}
+}
+
+func TestQualityReportDuration(t *testing.T) {
+	generator := NewGenerator(DefaultConfig())
+	track := createGappedTrack(t, 1, true)
+	fp, err := generator.Fingerprint(track, "track")
+	if err != nil {
+		t.Fatalf("Failed to fingerprint: %v", err)
+	}
+
+	// The duration comes from the samples, not the Duration field
+	unset := *track
+	unset.Duration = 0
+	report, err := generator.QualityReport(&unset, fp)
+	if err != nil {
+		t.Fatalf("Failed to report without Duration: %v", err)
+	}
+	if math.Abs(report.Duration-7) > 1e-3 {
+		t.Errorf("Expected a duration of 7s, got %f", report.Duration)
+	}
+
+	for i, invalid := range []*audio.AudioData{
+		nil,
+		{SampleRate: 22050, Channels: 1},
+		{Samples: track.Samples, Channels: 1},
+		{Samples: track.Samples, SampleRate: 22050},
+	} {
+		if _, err := generator.QualityReport(invalid, fp); err == nil {
+			t.Errorf("Invalid audio %d: expected an error", i)
+		}
+	}
+	if _, err := generator.QualityReport(track, nil); err == nil {
+		t.Error("Expected an error without a fingerprint")
+	}
+}
@@ -0,0 +1,122 @@
+package fingerprint
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/internal/golden"
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+)
+
+// The regression tests pin the peaks and hashes of synthetic signals so that
+// changes to windows, thresholds or quantization cannot silently change match
+// behaviour. Regenerate with go test -run Regression -update after intended
+// changes and review the diff of testdata.
+
+// createSyntheticSignals renders the regression signals at 22.05 kHz
+func createSyntheticSignals(t *testing.T) map[string]*audio.AudioData {
+	t.Helper()
+	synth := audio.NewSynthesizer(22050, 1)
+
+	signals := make(map[string]*audio.AudioData)
+	add := func(name string, data *audio.AudioData, err error) {
+		if err != nil {
+			t.Fatalf("Failed to synthesize %s: %v", name, err)
+		}
+		signals[name] = data
+	}
+
+	sweep, err := synth.Sweep(3, 200, 4000, 0.8)
+	add("sweep", sweep, err)
+	chords, err := synth.Chords(3, 0.5, []float64{220, 262, 196, 294}, 0.8)
+	add("chords", chords, err)
+	noise, err := synth.NoiseBursts(3, 0.5, 0.2, 0.5)
+	add("noise", noise, err)
+	clicks, err := synth.Clicks(3, 150, 0.8)
+	add("clicks", clicks, err)
+
+	mixed, err := audio.Mix(sweep, chords, clicks)
+	add("mixed", mixed, err)
+	return signals
+}
+
+// formatPeaks lists peaks as time and frequency bin indices
+func formatPeaks(peaks []Peak) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "peaks %d", len(peaks))
+	for _, peak := range peaks {
+		fmt.Fprintf(&b, "\n%d %d", peak.TimeIndex, peak.FreqIndex)
+	}
+	return b.String()
+}
+
+// formatHashes lists hashes as value and anchor time, sorted
+func formatHashes(hashes []Hash) string {
+	lines := make([]string, len(hashes))
+	for i, hash := range hashes {
+		lines[i] = fmt.Sprintf("%08x %.4f", hash.Value, hash.Time)
+	}
+	sort.Strings(lines)
+	return fmt.Sprintf("hashes %d\n%s", len(hashes), strings.Join(lines, "\n"))
+}
+
+func TestRegressionPeaks(t *testing.T) {
+	signals := createSyntheticSignals(t)
+	generator := NewGenerator(DefaultConfig())
+
+	for _, name := range []string{"sweep", "chords", "noise", "clicks", "mixed"} {
+		t.Run(name, func(t *testing.T) {
+			spec, err := generator.ComputeSpectrogram(signals[name])
+			if err != nil {
+				t.Fatalf("Failed to compute spectrogram: %v", err)
+			}
+			peaks, err := generator.ExtractPeaks(spec)
+			if err != nil {
+				t.Fatalf("Failed to extract peaks: %v", err)
+			}
+			if len(peaks) == 0 {
+				t.Fatal("Expected peaks")
+			}
+			golden.Check(t, "regression_peaks_"+name+".golden", formatPeaks(peaks))
+		})
+	}
+}
+
+func TestRegressionHashes(t *testing.T) {
+	signals := createSyntheticSignals(t)
+
+	for _, mode := range []HashMode{HashPairs, HashTriplets} {
+		t.Run(string(mode), func(t *testing.T) {
+			generator := NewGenerator(DefaultConfig())
+			generator.Hasher.Mode = mode
+			fp, err := generator.Fingerprint(signals["mixed"], "mixed")
+			if err != nil {
+				t.Fatalf("Failed to fingerprint: %v", err)
+			}
+			if len(fp.Hashes) == 0 {
+				t.Fatal("Expected hashes")
+			}
+			golden.Check(t, "regression_hashes_"+string(mode)+".golden", formatHashes(fp.Hashes))
+		})
+	}
+}
+
+// TestRegressionSynthesizer guards the signals themselves, so a failure in
+// the other regression tests is not caused by a changed generator
+func TestRegressionSynthesizer(t *testing.T) {
+	signals := createSyntheticSignals(t)
+
+	var lines []string
+	for _, name := range []string{"sweep", "chords", "noise", "clicks", "mixed"} {
+		data := signals[name]
+		sum, peak := 0.0, 0.0
+		for _, sample := range data.Samples {
+			sum += sample * sample
+			peak = max(peak, sample, -sample)
+		}
+		lines = append(lines, fmt.Sprintf("%s samples=%d energy=%.3f peak=%.4f", name, len(data.Samples), sum, peak))
+	}
+	golden.Check(t, "regression_signals.golden", strings.Join(lines, "\n"))
+}
@@ -0,0 +1,252 @@
+package matcher
+
+import (
+	"math"
+	"sort"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/db"
+)
+
+// OffsetAligner implements TimeAlignment by histogramming time offsets.
+// Matches whose offsets agree within TimeAlignWindow vote for the same bin
+// and the best bin per track determines the alignment.
+type OffsetAligner struct {
+	Config Config
+}
+
+// NewOffsetAligner creates a new aligner with the given configuration
+func NewOffsetAligner(config Config) *OffsetAligner {
+	return &OffsetAligner{Config: config}
+}
+
+// VerifyAlignment checks if matched vectors have consistent time offsets.
+// A track's confidence is the summed Score of its aligned matches over the
+// number of matches, in [0, 1] since every Score is.
+func (a *OffsetAligner) VerifyAlignment(matches []db.SearchResult) ([]Match, error) {
+	byTrack := make(map[string][]db.SearchResult)
+	for _, match := range matches {
+		byTrack[match.TrackID] = append(byTrack[match.TrackID], match)
+	}
+
+	var results []Match
+	for trackID, trackMatches := range byTrack {
+		offsets := make([]float64, len(trackMatches))
+		for i, match := range trackMatches {
+			offsets[i] = match.TimeOffset
+		}
+		aligned := a.alignedIndices(offsets)
+
+		score := 0.0
+		offset := 0.0
+		queryTime := math.Inf(1)
+		for _, i := range aligned {
+			match := trackMatches[i]
+			score += match.Score
+			offset += match.TimeOffset
+			if match.MatchedVector != nil {
+				queryTime = math.Min(queryTime, match.MatchedVector.TimeRef-match.TimeOffset)
+			}
+		}
+		if math.IsInf(queryTime, 1) {
+			queryTime = 0
+		}
+		offset /= float64(len(aligned))
+
+		results = append(results, Match{
+			TrackID:        trackID,
+			Confidence:     score / float64(len(matches)),
+			TimeOffset:     offset + queryTime,
+			QueryTime:      queryTime,
+			MatchedVectors: len(aligned),
+			TimeScale:      1,
+			PitchFactor:    1,
+		})
+	}
+
+	return a.filter(results), nil
+}
+
+// AlignHashes aligns hash matches per track, estimating the time-scale and
+// pitch factors between query and reference. queryHashes is the number of
+// hashes in the query and normalizes the confidence.
+//
+// The time scale is first estimated from the ratio of hash spans, which
+// triplet hashes preserve under speed changes, so offsets can be compared
+// after undoing the scale. The aligned matches are then fitted by least
+// squares to refine the scale and offset.
+func (a *OffsetAligner) AlignHashes(matches []db.HashMatch, queryHashes int) []Match {
+	if queryHashes <= 0 {
+		return nil
+	}
+
+	byTrack := make(map[string][]db.HashMatch)
+	for _, match := range matches {
+		byTrack[match.Reference.TrackID] = append(byTrack[match.Reference.TrackID], match)
+	}
+
+	var results []Match
+	for trackID, trackMatches := range byTrack {
+		if len(trackMatches) < a.Config.MinMatchedVectors {
+			continue
+		}
+
+		// Coarse time scale from the span ratios
+		ratios := make([]float64, 0, len(trackMatches))
+		for _, match := range trackMatches {
+			if match.Query.Span > 0 && match.Reference.Span > 0 {
+				ratios = append(ratios, match.Reference.Span/match.Query.Span)
+			}
+		}
+		scale := 1.0
+		if len(ratios) > 0 {
+			scale = median(ratios)
+		}
+
+		offsets := make([]float64, len(trackMatches))
+		for i, match := range trackMatches {
+			offsets[i] = match.Reference.Time - scale*match.Query.Time
+		}
+		aligned, pitch := a.consistentPitch(trackMatches, a.alignedIndices(offsets))
+		if len(aligned) == 0 || len(aligned) < a.Config.MinMatchedVectors {
+			continue
+		}
+
+		// Refine scale and offset on the aligned matches
+		queryTimes := make([]float64, len(aligned))
+		referenceTimes := make([]float64, len(aligned))
+		for j, i := range aligned {
+			queryTimes[j] = trackMatches[i].Query.Time
+			referenceTimes[j] = trackMatches[i].Reference.Time
+		}
+		intercept, slope := fitLine(queryTimes, referenceTimes, scale)
+
+		queryTime := queryTimes[0]
+		for _, t := range queryTimes {
+			queryTime = math.Min(queryTime, t)
+		}
+
+		results = append(results, Match{
+			TrackID:        trackID,
+			Confidence:     math.Min(1, float64(len(aligned))/float64(queryHashes)),
+			TimeOffset:     intercept + slope*queryTime,
+			QueryTime:      queryTime,
+			MatchedVectors: len(aligned),
+			TimeScale:      slope,
+			PitchFactor:    pitch,
+		})
+	}
+
+	return a.filter(results)
+}
+
+// alignedIndices returns the indices of the offsets within MaxTimeDeviation
+// of the most populated TimeAlignWindow bin
+func (a *OffsetAligner) alignedIndices(offsets []float64) []int {
+	window := a.Config.TimeAlignWindow
+	if window <= 0 {
+		window = 0.1
+	}
+
+	counts := make(map[int]int)
+	bestBin, bestCount := 0, 0
+	for _, offset := range offsets {
+		bin := int(math.Floor(offset / window))
+		counts[bin]++
+		if counts[bin] > bestCount || (counts[bin] == bestCount && bin < bestBin) {
+			bestBin, bestCount = bin, counts[bin]
+		}
+	}
+
+	center := (float64(bestBin) + 0.5) * window
+	deviation := math.Max(a.Config.MaxTimeDeviation, window/2)
+	var aligned []int
+	for i, offset := range offsets {
+		if math.Abs(offset-center) <= deviation {
+			aligned = append(aligned, i)
+		}
+	}
+	return aligned
+}
+
+// consistentPitch estimates the pitch factor of the matches at indices as
+// their median frequency ratio and keeps the indices within MaxPitchDeviation
+// of it. A real match shifts every peak by the same factor, while hash
+// collisions at a chance offset have unrelated frequencies.
+func (a *OffsetAligner) consistentPitch(matches []db.HashMatch, indices []int) ([]int, float64) {
+	pitches := make([]float64, 0, len(indices))
+	for _, i := range indices {
+		if reference := matches[i].Reference.Frequency; reference > 0 {
+			pitches = append(pitches, matches[i].Query.Frequency/reference)
+		}
+	}
+	if len(pitches) == 0 {
+		return indices, 1.0
+	}
+	pitch := median(pitches)
+	if a.Config.MaxPitchDeviation <= 0 {
+		return indices, pitch
+	}
+
+	// Matches without frequencies cannot be checked and are kept
+	var kept []int
+	for _, i := range indices {
+		reference := matches[i].Reference.Frequency
+		if reference <= 0 || math.Abs(matches[i].Query.Frequency/reference/pitch-1) <= a.Config.MaxPitchDeviation {
+			kept = append(kept, i)
+		}
+	}
+	return kept, pitch
+}
+
+// filter drops matches below the configured thresholds and sorts the rest by
+// descending confidence
+func (a *OffsetAligner) filter(matches []Match) []Match {
+	kept := matches[:0]
+	for _, match := range matches {
+		if match.MatchedVectors >= a.Config.MinMatchedVectors && match.Confidence >= a.Config.MinConfidence {
+			kept = append(kept, match)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool {
+		if kept[i].Confidence != kept[j].Confidence {
+			return kept[i].Confidence > kept[j].Confidence
+		}
+		return kept[i].TrackID < kept[j].TrackID
+	})
+	return kept
+}
+
+// fitLine fits y = intercept + slope*x by least squares, keeping fallbackSlope
+// when the x values do not spread enough to determine a slope
+func fitLine(x, y []float64, fallbackSlope float64) (intercept, slope float64) {
+	n := float64(len(x))
+	var meanX, meanY float64
+	for i := range x {
+		meanX += x[i]
+		meanY += y[i]
+	}
+	meanX /= n
+	meanY /= n
+
+	var covariance, variance float64
+	for i := range x {
+		covariance += (x[i] - meanX) * (y[i] - meanY)
+		variance += (x[i] - meanX) * (x[i] - meanX)
+	}
+
+	slope = fallbackSlope
+	if variance > 1e-6*n {
+		slope = covariance / variance
+	}
+	return meanY - slope*meanX, slope
+}
+
+// median returns the median of values, reordering them
+func median(values []float64) float64 {
+	sort.Float64s(values)
+	mid := len(values) / 2
+	if len(values)%2 == 0 {
+		return (values[mid-1] + values[mid]) / 2
+	}
+	return values[mid]
+}
@@ -0,0 +1,223 @@
+package matcher
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/db"
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// createHashMatches returns n matches of a query against trackID where the
+// reference runs scale times as long from offset seconds, at 1/pitch times
+// the frequency of the query
+func createHashMatches(rng *rand.Rand, trackID string, n int, offset, scale, pitch float64) []db.HashMatch {
+	matches := make([]db.HashMatch, n)
+	for i := range matches {
+		queryTime := 5 * rng.Float64()
+		span := 0.1 + rng.Float64()
+		frequency := 200 + 2000*rng.Float64()
+		matches[i] = db.HashMatch{
+			Query: fingerprint.Hash{Value: uint32(i), Time: queryTime, Frequency: frequency * pitch, Span: span},
+			Reference: fingerprint.Hash{
+				Value:     uint32(i),
+				Time:      offset + scale*queryTime,
+				Frequency: frequency,
+				Span:      scale * span,
+				TrackID:   trackID,
+			},
+		}
+	}
+	return matches
+}
+
+func TestAlignHashes(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	matches := createHashMatches(rng, "track-1", 60, 12, 1.03, 0.98)
+
+	// Chance matches of the same track at random offsets, and of another
+	// track too few to count
+	for _, match := range createHashMatches(rng, "track-1", 10, 0, 1, 1) {
+		match.Reference.Time = 30 * rng.Float64()
+		matches = append(matches, match)
+	}
+	matches = append(matches, createHashMatches(rng, "track-2", 3, 4, 1, 1)...)
+
+	aligner := NewOffsetAligner(DefaultConfig())
+	results := aligner.AlignHashes(matches, 200)
+	if len(results) != 1 {
+		t.Fatalf("Expected only track-1, got %+v", results)
+	}
+	match := results[0]
+	if match.TrackID != "track-1" {
+		t.Fatalf("Expected track-1, got %s", match.TrackID)
+	}
+	if match.MatchedVectors < 60 || match.MatchedVectors > 62 {
+		t.Errorf("Expected the 60 aligned matches, got %d", match.MatchedVectors)
+	}
+	if math.Abs(match.TimeScale-1.03) > 1e-6 {
+		t.Errorf("Expected time scale 1.03, got %f", match.TimeScale)
+	}
+	if math.Abs(match.PitchFactor-0.98) > 1e-6 {
+		t.Errorf("Expected pitch factor 0.98, got %f", match.PitchFactor)
+	}
+	if want := 12 + 1.03*match.QueryTime; math.Abs(match.TimeOffset-want) > 1e-6 {
+		t.Errorf("Expected offset %f at query time %f, got %f", want, match.QueryTime, match.TimeOffset)
+	}
+	if want := float64(match.MatchedVectors) / 200; match.Confidence != want {
+		t.Errorf("Expected confidence %f, got %f", want, match.Confidence)
+	}
+
+	if results := aligner.AlignHashes(matches, 0); results != nil {
+		t.Errorf("Expected no results without query hashes, got %+v", results)
+	}
+}
+
+func TestAlignHashesOrdersByConfidence(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	matches := append(createHashMatches(rng, "track-1", 20, 3, 1, 1), createHashMatches(rng, "track-2", 40, 7, 1, 1)...)
+	results := NewOffsetAligner(DefaultConfig()).AlignHashes(matches, 100)
+	if len(results) != 2 || results[0].TrackID != "track-2" || results[1].TrackID != "track-1" {
+		t.Errorf("Expected track-2 before track-1, got %+v", results)
+	}
+}
+
+func TestAlignHashesRequiresConsistentPitch(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	matches := createHashMatches(rng, "track-1", 40, 12, 1, 0.98)
+
+	// Collisions at the right offset whose frequencies are unrelated, and a
+	// track made only of such collisions
+	scatter := func(matches []db.HashMatch) []db.HashMatch {
+		for i := range matches {
+			matches[i].Query.Frequency = 200 + 2000*rng.Float64()
+		}
+		return matches
+	}
+	matches = append(matches, scatter(createHashMatches(rng, "track-1", 20, 12, 1, 1))...)
+	matches = append(matches, scatter(createHashMatches(rng, "track-2", 30, 4, 1, 1))...)
+
+	results := NewOffsetAligner(DefaultConfig()).AlignHashes(matches, 200)
+	if len(results) != 1 || results[0].TrackID != "track-1" {
+		t.Fatalf("Expected only track-1, got %+v", results)
+	}
+	if match := results[0]; match.MatchedVectors < 40 || match.MatchedVectors > 42 || math.Abs(match.PitchFactor-0.98) > 1e-6 {
+		t.Errorf("Expected the 40 matches at pitch 0.98, got %d at %f", match.MatchedVectors, match.PitchFactor)
+	}
+
+	// Without a pitch deviation limit every aligned match counts
+	config := DefaultConfig()
+	config.MaxPitchDeviation = 0
+	if results := NewOffsetAligner(config).AlignHashes(matches, 200); len(results) != 2 {
+		t.Errorf("Expected both tracks without a pitch limit, got %+v", results)
+	}
+}
+
+func TestAlignHashesWithoutConsistentPitch(t *testing.T) {
+	// Two matches at the same offset whose pitches are both too far from
+	// their median leave nothing aligned, even without a minimum count
+	rng := rand.New(rand.NewSource(4))
+	matches := createHashMatches(rng, "track-1", 2, 12, 1, 1)
+	matches[1].Query.Frequency = 2 * matches[1].Reference.Frequency
+
+	config := DefaultConfig()
+	config.MinMatchedVectors = 0
+	config.MinConfidence = 0
+	config.MaxPitchDeviation = 0.05
+	if results := NewOffsetAligner(config).AlignHashes(matches, 10); len(results) != 0 {
+		t.Errorf("Expected no results for inconsistent pitches, got %+v", results)
+	}
+}
+
+func TestVerifyAlignmentMetrics(t *testing.T) {
+	ctx := context.Background()
+	for _, metric := range []db.Metric{db.MetricCosine, db.MetricInnerProduct, db.MetricL2, db.MetricHamming} {
+		t.Run(metric.String(), func(t *testing.T) {
+			// Two tracks of long random vectors, so that inner products are
+			// far outside [0, 1]
+			rng := rand.New(rand.NewSource(3))
+			config := db.DefaultConfig()
+			config.Dim = 16
+			config.Metric = metric
+			memory := db.NewMemoryDB(config)
+			var reference []*fingerprint.Vector
+			for _, trackID := range []string{"track-1", "track-2"} {
+				vectors := make([]*fingerprint.Vector, 20)
+				for i := range vectors {
+					vectors[i] = &fingerprint.Vector{Data: make([]float32, config.Dim), TimeRef: float64(i) / 4}
+					for j := range vectors[i].Data {
+						vectors[i].Data[j] = float32(10 * rng.NormFloat64())
+					}
+				}
+				if err := memory.Add(ctx, &db.TrackMetadata{ID: trackID}, vectors); err != nil {
+					t.Fatalf("Failed to add %s: %v", trackID, err)
+				}
+				if trackID == "track-1" {
+					reference = vectors
+				}
+			}
+
+			// The query is track-1 from 2 seconds on
+			query := make([]*fingerprint.Vector, 8)
+			for i := range query {
+				query[i] = &fingerprint.Vector{Data: reference[8+i].Data, TimeRef: reference[8+i].TimeRef - 2}
+			}
+			results, err := memory.Search(ctx, query, DefaultConfig().SearchNeighbors)
+			if err != nil {
+				t.Fatalf("Failed to search: %v", err)
+			}
+			for _, result := range results {
+				if result.Score < 0 || result.Score > 1 {
+					t.Fatalf("Expected scores in [0, 1], got %f", result.Score)
+				}
+			}
+
+			matches, err := NewOffsetAligner(DefaultConfig()).VerifyAlignment(results)
+			if err != nil {
+				t.Fatalf("Failed to verify alignment: %v", err)
+			}
+			if len(matches) == 0 || matches[0].TrackID != "track-1" {
+				t.Fatalf("Expected track-1 first, got %+v", matches)
+			}
+			if best := matches[0]; best.MatchedVectors != 8 || math.Abs(best.TimeOffset-2) > 1e-9 {
+				t.Errorf("Expected 8 matches at offset 2, got %d at %f", best.MatchedVectors, best.TimeOffset)
+			}
+			for _, match := range matches {
+				if match.Confidence < 0 || match.Confidence > 1 {
+					t.Errorf("Expected confidence in [0, 1], got %f for %s", match.Confidence, match.TrackID)
+				}
+			}
+		})
+	}
+}
+
+func TestFitLine(t *testing.T) {
+	x := []float64{1, 2, 3, 4}
+	y := []float64{3.5, 5.5, 7.5, 9.5}
+	if intercept, slope := fitLine(x, y, 1); math.Abs(intercept-1.5) > 1e-9 || math.Abs(slope-2) > 1e-9 {
+		t.Errorf("Expected y = 1.5 + 2x, got y = %f + %fx", intercept, slope)
+	}
+
+	// Without spread in x the fallback slope is kept and the line passes
+	// through the mean
+	if intercept, slope := fitLine([]float64{2, 2}, []float64{5, 7}, 1.03); slope != 1.03 || math.Abs(intercept-(6-2*1.03)) > 1e-9 {
+		t.Errorf("Expected y = %f + 1.03x, got y = %f + %fx", 6-2*1.03, intercept, slope)
+	}
+}
+
+func TestMedian(t *testing.T) {
+	for _, test := range []struct {
+		values []float64
+		want   float64
+	}{
+		{[]float64{3}, 3},
+		{[]float64{5, 1, 3}, 3},
+		{[]float64{4, 1, 3, 2}, 2.5},
+	} {
+		if got := median(test.values); got != test.want {
+			t.Errorf("Expected median %f, got %f", test.want, got)
+		}
+	}
+}
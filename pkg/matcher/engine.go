@@ -0,0 +1,111 @@
+package matcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+	"github.com/kshitijk4poor/shazam-golang/pkg/db"
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// EngineImpl implements the Engine interface. Reference tracks are stored as
+// vectors in a VectorDB and landmark hashes in a HashIndex; queries are
+// identified by looking up their hashes and aligning the matches in time.
+type EngineImpl struct {
+	Config    Config
+	Generator *fingerprint.GeneratorImpl
+	DB        db.VectorDB
+	Index     db.HashIndex
+	Aligner   *OffsetAligner
+}
+
+// NewEngine creates a new engine. vectorDB and hashIndex are usually the same
+// db.MemoryDB.
+func NewEngine(config Config, generator *fingerprint.GeneratorImpl, vectorDB db.VectorDB, hashIndex db.HashIndex) *EngineImpl {
+	return &EngineImpl{
+		Config:    config,
+		Generator: generator,
+		DB:        vectorDB,
+		Index:     hashIndex,
+		Aligner:   NewOffsetAligner(config),
+	}
+}
+
+// AddTrack processes and adds a reference track
+func (e *EngineImpl) AddTrack(ctx context.Context, data *audio.AudioData, metadata *db.TrackMetadata) error {
+	if metadata == nil || metadata.ID == "" {
+		return fmt.Errorf("track metadata must have an ID")
+	}
+
+	fp, err := e.Generator.Fingerprint(data, metadata.ID)
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint track %s: %w", metadata.ID, err)
+	}
+
+	// Keep the quality report with the track so weak references can be found
+	stored := *metadata
+	stored.Quality = fp.Quality
+
+	if err := e.DB.Add(ctx, &stored, fp.Vectors); err != nil {
+		return fmt.Errorf("failed to store vectors: %w", err)
+	}
+	if err := e.Index.AddHashes(ctx, metadata.ID, fp.Hashes); err != nil {
+		// Don't leave a track without hashes behind
+		if deleteErr := e.DB.Delete(ctx, metadata.ID); deleteErr != nil {
+			return fmt.Errorf("failed to store hashes: %w (rollback failed: %v)", err, deleteErr)
+		}
+		return fmt.Errorf("failed to store hashes: %w", err)
+	}
+
+	return nil
+}
+
+// Identify processes query audio and returns matches ordered by confidence.
+// Each match reports the estimated time-scale and pitch factors of the query
+// relative to the reference.
+func (e *EngineImpl) Identify(ctx context.Context, data *audio.AudioData) ([]Match, error) {
+	fp, err := e.Generator.Fingerprint(data, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint query: %w", err)
+	}
+
+	return e.IdentifyFingerprint(ctx, fp)
+}
+
+// IdentifyFingerprint matches a query fingerprint computed elsewhere, e.g. on
+// a client, without decoding any audio. Only the hashes are used, so they
+// must come from a generator configured like e.Generator; decode serialized
+// fingerprints with e.Generator.UnmarshalFingerprint to enforce this.
+// Matches carry the current metadata of their reference tracks; tracks the
+// DB no longer holds are left out.
+func (e *EngineImpl) IdentifyFingerprint(ctx context.Context, fp *fingerprint.Fingerprint) ([]Match, error) {
+	if fp == nil {
+		return nil, fmt.Errorf("query fingerprint is nil")
+	}
+	if len(fp.Hashes) == 0 {
+		return nil, nil
+	}
+
+	matches, err := e.Index.LookupHashes(ctx, fp.Hashes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up hashes: %w", err)
+	}
+
+	// Drop tracks deleted since their hashes were looked up
+	results := e.Aligner.AlignHashes(matches, len(fp.Hashes))
+	found := results[:0]
+	for _, result := range results {
+		metadata, err := e.DB.Get(ctx, result.TrackID)
+		if errors.Is(err, db.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get track %s: %w", result.TrackID, err)
+		}
+		result.Metadata = metadata
+		found = append(found, result)
+	}
+	return found, nil
+}
@@ -0,0 +1,83 @@
+package matcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/pkg/db"
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// staleDB fails to get one track with err, e.g. db.ErrNotFound as if it was
+// deleted after its hashes were looked up
+type staleDB struct {
+	db.VectorDB
+	deleted string
+	err     error
+}
+
+func (s staleDB) Get(ctx context.Context, trackID string) (*db.TrackMetadata, error) {
+	if trackID == s.deleted {
+		return nil, s.err
+	}
+	return s.VectorDB.Get(ctx, trackID)
+}
+
+func TestIdentifyFingerprint(t *testing.T) {
+	ctx := context.Background()
+	generator := fingerprint.NewGenerator(fingerprint.DefaultConfig())
+	memory := db.NewMemoryDB(db.DefaultConfig())
+	engine := NewEngine(DefaultConfig(), generator, memory, memory)
+
+	library := make(map[string]*fingerprint.Fingerprint)
+	for i := 1; i <= 3; i++ {
+		metadata := &db.TrackMetadata{ID: fmt.Sprintf("track-%d", i), Title: fmt.Sprintf("Title %d", i)}
+		track := createSyntheticTrack(t, 10, int64(i))
+		if err := engine.AddTrack(ctx, track, metadata); err != nil {
+			t.Fatalf("Failed to add %s: %v", metadata.ID, err)
+		}
+		fp, err := generator.Fingerprint(excerpt(t, track, 2, 7), "")
+		if err != nil {
+			t.Fatalf("Failed to fingerprint query: %v", err)
+		}
+		library[metadata.ID] = fp
+	}
+
+	matches, err := engine.IdentifyFingerprint(ctx, library["track-2"])
+	if err != nil {
+		t.Fatalf("Failed to identify: %v", err)
+	}
+	if len(matches) == 0 {
+		t.Fatal("Expected a match")
+	}
+	best := matches[0]
+	if best.TrackID != "track-2" || best.Metadata == nil || best.Metadata.Title != "Title 2" {
+		t.Errorf("Expected track-2 with its metadata, got %+v", best)
+	}
+
+	if _, err := engine.IdentifyFingerprint(ctx, nil); err == nil {
+		t.Error("Expected an error for a nil fingerprint")
+	}
+	if matches, err := engine.IdentifyFingerprint(ctx, &fingerprint.Fingerprint{}); err != nil || matches != nil {
+		t.Errorf("Expected no matches without hashes, got %+v (err %v)", matches, err)
+	}
+
+	// Tracks whose metadata is gone are dropped, not returned without it
+	engine.DB = staleDB{VectorDB: memory, deleted: "track-2", err: fmt.Errorf("%w: track-2", db.ErrNotFound)}
+	matches, err = engine.IdentifyFingerprint(ctx, library["track-2"])
+	if err != nil {
+		t.Fatalf("Failed to identify: %v", err)
+	}
+	for _, match := range matches {
+		if match.TrackID == "track-2" || match.Metadata == nil {
+			t.Errorf("Expected only matches with metadata, got %+v", match)
+		}
+	}
+	// Other failures are returned rather than treated as deletions
+	engine.DB = staleDB{VectorDB: memory, deleted: "track-2", err: context.Canceled}
+	if matches, err := engine.IdentifyFingerprint(ctx, library["track-2"]); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected context.Canceled, got %+v (err %v)", matches, err)
+	}
+}
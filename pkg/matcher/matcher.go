@@ -5,6 +5,7 @@ import (
 
 	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
 	"github.com/kshitijk4poor/shazam-golang/pkg/db"
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
 )
 
 // Match represents a confident match with a track
@@ -14,6 +15,10 @@ type Match struct {
 	TimeOffset     float64 // Matched position in reference track
 	QueryTime      float64 // Position in query audio
 	MatchedVectors int     // Number of matching vectors
+	TimeScale      float64 // Reference seconds per query second (1.03 = query played 3% fast)
+	PitchFactor    float64 // Query frequency / reference frequency (1.0 = same pitch)
+
+	Metadata *db.TrackMetadata // Reference track, set by EngineImpl
 }
 
 // Engine handles audio identification
@@ -21,6 +26,9 @@ type Engine interface {
 	// Identify processes query audio and returns matches
 	Identify(ctx context.Context, data *audio.AudioData) ([]Match, error)
 
+	// IdentifyFingerprint matches a pre-computed query fingerprint
+	IdentifyFingerprint(ctx context.Context, fp *fingerprint.Fingerprint) ([]Match, error)
+
 	// AddTrack processes and adds a reference track
 	AddTrack(ctx context.Context, data *audio.AudioData, metadata *db.TrackMetadata) error
 }
@@ -32,6 +40,19 @@ type Config struct {
 	SearchNeighbors   int     // Number of neighbors to search for each vector
 	TimeAlignWindow   float64 // Time window for alignment verification
 	MaxTimeDeviation  float64 // Maximum allowed time offset deviation
+	MaxPitchDeviation float64 // Maximum relative deviation of a hash match's frequency ratio from the track's pitch factor
+}
+
+// DefaultConfig returns the default matcher configuration
+func DefaultConfig() Config {
+	return Config{
+		MinConfidence:     0.01,
+		MinMatchedVectors: 5,
+		SearchNeighbors:   10,
+		TimeAlignWindow:   0.1,
+		MaxTimeDeviation:  0.1,
+		MaxPitchDeviation: 0.05,
+	}
 }
 
 // TimeAlignment handles verification of temporal consistency
@@ -40,7 +61,8 @@ type TimeAlignment interface {
 	VerifyAlignment(matches []db.SearchResult) ([]Match, error)
 }
 
-// Scorer handles match scoring and ranking
+// Scorer handles match scoring and ranking. db.SearchResult.Score is in
+// [0, 1] under every db.Metric, higher meaning a closer match.
 type Scorer interface {
 	// Score computes confidence scores for potential matches
 	Score(matches []db.SearchResult) ([]Match, error)
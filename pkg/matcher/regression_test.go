@@ -0,0 +1,163 @@
+package matcher
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+
+	"github.com/kshitijk4poor/shazam-golang/internal/golden"
+	"github.com/kshitijk4poor/shazam-golang/pkg/audio"
+	"github.com/kshitijk4poor/shazam-golang/pkg/db"
+	"github.com/kshitijk4poor/shazam-golang/pkg/fingerprint"
+)
+
+// createSyntheticTrack renders seconds of chords, sweeps, noise bursts and
+// clicks at 22.05 kHz. Each seed gives a different track.
+func createSyntheticTrack(t *testing.T, seconds float64, seed int64) *audio.AudioData {
+	t.Helper()
+	rng := rand.New(rand.NewSource(seed))
+	synth := audio.NewSynthesizer(22050, seed)
+
+	roots := make([]float64, 4)
+	for i := range roots {
+		roots[i] = 196 * float64(int(100*(1+rng.Float64()))) / 100
+	}
+	chords, err := synth.Chords(seconds, 0.5, roots, 0.6)
+	if err != nil {
+		t.Fatalf("Failed to synthesize chords: %v", err)
+	}
+
+	var sweeps []*audio.AudioData
+	for elapsed := 0.0; elapsed < seconds; elapsed += 2 {
+		sweep, err := synth.Sweep(2, 300+1000*rng.Float64(), 1500+3000*rng.Float64(), 0.4)
+		if err != nil {
+			t.Fatalf("Failed to synthesize sweep: %v", err)
+		}
+		sweeps = append(sweeps, sweep)
+	}
+	sweep, err := audio.Concat(sweeps...)
+	if err != nil {
+		t.Fatalf("Failed to join sweeps: %v", err)
+	}
+
+	noise, err := synth.NoiseBursts(seconds, 0.75, 0.1, 0.1)
+	if err != nil {
+		t.Fatalf("Failed to synthesize noise: %v", err)
+	}
+	clicks, err := synth.Clicks(seconds, 90+float64(rng.Intn(60)), 0.3)
+	if err != nil {
+		t.Fatalf("Failed to synthesize clicks: %v", err)
+	}
+
+	track, err := audio.Mix(chords, sweep, noise, clicks)
+	if err != nil {
+		t.Fatalf("Failed to mix track: %v", err)
+	}
+	return excerpt(t, track, 0, seconds)
+}
+
+// excerpt cuts start to end seconds from data
+func excerpt(t *testing.T, data *audio.AudioData, start, end float64) *audio.AudioData {
+	t.Helper()
+	cut, err := audio.Excerpt(data, start, end)
+	if err != nil {
+		t.Fatalf("Failed to cut excerpt: %v", err)
+	}
+	return cut
+}
+
+// TestRegressionIdentify pins the identify results for distorted excerpts of
+// a synthetic library. Regenerate with go test -run Regression -update after
+// intended changes and review the diff of testdata.
+func TestRegressionIdentify(t *testing.T) {
+	ctx := context.Background()
+
+	library := make([]*audio.AudioData, 4)
+	for i := range library {
+		library[i] = createSyntheticTrack(t, 12, int64(i+1))
+	}
+
+	// Queries: clean, noisy, 3% fast and unknown
+	clean := excerpt(t, library[1], 3, 8)
+	noise, err := audio.NewSynthesizer(22050, 99).Noise(clean.Duration, 0.05)
+	if err != nil {
+		t.Fatalf("Failed to synthesize noise: %v", err)
+	}
+	noisy, err := audio.Mix(clean, noise)
+	if err != nil {
+		t.Fatalf("Failed to mix noise: %v", err)
+	}
+	source := excerpt(t, library[2], 2, 8)
+	source.SampleRate = 22050 * 103 / 100
+	fast, err := audio.NewPCMProcessor().ResampleTo(source, 22050)
+	if err != nil {
+		t.Fatalf("Failed to resample: %v", err)
+	}
+	unknown := excerpt(t, createSyntheticTrack(t, 12, 42), 2, 7)
+
+	// Besides the golden file, every query must find its track where it
+	// starts and at its speed, and the unknown query nothing. Pair hashes are
+	// not expected to survive speed changes, so the fast query is only checked
+	// with triplets.
+	queries := []struct {
+		name         string
+		data         *audio.AudioData
+		expected     string
+		start        float64 // Reference position of the query's start
+		speed        float64 // Expected time scale and pitch factor
+		tripletsOnly bool
+	}{
+		{"clean", clean, "track-2", 3, 1, false},
+		{"noisy", noisy, "track-2", 3, 1, false},
+		{"fast", fast, "track-3", 2, 1.03, true},
+		{"unknown", unknown, "", 0, 0, false},
+	}
+
+	var lines []string
+	for _, mode := range []fingerprint.HashMode{fingerprint.HashPairs, fingerprint.HashTriplets} {
+		generator := fingerprint.NewGenerator(fingerprint.DefaultConfig())
+		generator.Hasher.Mode = mode
+		memory := db.NewMemoryDB(db.DefaultConfig())
+		engine := NewEngine(DefaultConfig(), generator, memory, memory)
+		for i, track := range library {
+			metadata := &db.TrackMetadata{ID: fmt.Sprintf("track-%d", i+1)}
+			if err := engine.AddTrack(ctx, track, metadata); err != nil {
+				t.Fatalf("Failed to add %s: %v", metadata.ID, err)
+			}
+		}
+
+		for _, query := range queries {
+			matches, err := engine.Identify(ctx, query.data)
+			if err != nil {
+				t.Fatalf("Failed to identify %s: %v", query.name, err)
+			}
+			checked := !query.tripletsOnly || mode == fingerprint.HashTriplets
+			if len(matches) == 0 {
+				if checked && query.expected != "" {
+					t.Errorf("%s %s: expected %s, got no match", mode, query.name, query.expected)
+				}
+				lines = append(lines, fmt.Sprintf("%s %s: no match", mode, query.name))
+				continue
+			}
+			best := matches[0]
+			if best.Metadata == nil || best.Metadata.ID != best.TrackID {
+				t.Errorf("%s %s: expected the metadata of %s with the match", mode, query.name, best.TrackID)
+			}
+			if checked && query.expected == "" {
+				t.Errorf("%s %s: expected no match, got %s with confidence %.3f", mode, query.name, best.TrackID, best.Confidence)
+			}
+			start := best.TimeOffset - best.TimeScale*best.QueryTime
+			if checked && query.expected != "" && (best.TrackID != query.expected || math.Abs(start-query.start) > 0.1 ||
+				math.Abs(best.TimeScale-query.speed) > 0.01 || math.Abs(best.PitchFactor-query.speed) > 0.01) {
+				t.Errorf("%s %s: expected %s from %.2f at speed %.2f, got %s from %.2f at scale %.3f and pitch %.3f",
+					mode, query.name, query.expected, query.start, query.speed, best.TrackID, start, best.TimeScale, best.PitchFactor)
+			}
+			lines = append(lines, fmt.Sprintf("%s %s: %s offset=%.2f confidence=%.3f matched=%d scale=%.3f pitch=%.3f candidates=%d",
+				mode, query.name, best.TrackID, best.TimeOffset, best.Confidence, best.MatchedVectors, best.TimeScale, best.PitchFactor, len(matches)))
+		}
+	}
+	golden.Check(t, "regression_identify.golden", strings.Join(lines, "\n"))
+}